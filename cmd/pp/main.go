@@ -25,6 +25,9 @@ import (
 
 func main() {
 	if err := internal.Main(); err != nil {
+		if e, ok := err.(*internal.ExitError); ok {
+			os.Exit(e.Code)
+		}
 		fmt.Fprintf(os.Stderr, "Failed: %s\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,175 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+	"github.com/maruel/panicparse/terminal"
+)
+
+// attachMain implements "pp attach <pid>", which makes a running process
+// print its stack traces and prints them aggregated.
+func attachMain(args []string) error {
+	fs := flag.NewFlagSet("attach", flag.ContinueOnError)
+	logFlag := fs.String("log", "", "File the process writes its stderr to; defaults to its stderr when it is a file, only supported on linux")
+	pprof := fs.String("pprof", "", "Fetch the stack traces from this net/http/pprof server instead of sending SIGQUIT, ex: -pprof http://localhost:6060")
+	timeout := fs.Duration("timeout", 10*time.Second, "How long to wait for the stack traces")
+	aggressive := fs.Bool("aggressive", false, "Aggressive deduplication including non pointers")
+	color := colorFlags(fs)
+	cfg, err := subcommandConfig(fs)
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Permit "pp attach 1234 -log service.log" since flag stops at the first
+	// non-flag argument.
+	var pids []string
+	for fs.NArg() != 0 {
+		pids = append(pids, fs.Arg(0))
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	s := stack.AnyPointer
+	if *aggressive {
+		s = stack.AnyValue
+	}
+	var out io.Writer = os.Stdout
+	p := &Palette{}
+	if color() {
+		if p, err = loadPalette(cfg.colors); err != nil {
+			return err
+		}
+		out = terminal.NewWriter(os.Stdout)
+	}
+	if *pprof != "" {
+		if len(pids) != 0 {
+			return errors.New("can't use both a process ID and -pprof")
+		}
+		return fetchPprof(out, p, s, *pprof, *timeout)
+	}
+	if len(pids) != 1 {
+		return errors.New("specify a single process ID")
+	}
+	pid, err := strconv.Atoi(pids[0])
+	if err != nil {
+		return fmt.Errorf("invalid process ID %q", pids[0])
+	}
+	logPath := *logFlag
+	if logPath == "" {
+		if logPath = stderrFile(pid); logPath == "" {
+			return errors.New("the stderr of the process is not a file; specify where it is written with -log, or use -pprof")
+		}
+	}
+	return attach(out, p, s, pid, logPath, *timeout)
+}
+
+// attachQuiet is how long the log must stay unchanged after SIGQUIT for the
+// stack traces to be considered completely written.
+const attachQuiet = 200 * time.Millisecond
+
+// attach sends SIGQUIT to the process pid, then waits for its stack traces
+// to be written to logPath and prints them aggregated.
+func attach(out io.Writer, p *Palette, s stack.Similarity, pid int, logPath string, timeout time.Duration) error {
+	w := newWatcher(logPath, nil)
+	if err := w.skip(); err != nil {
+		return err
+	}
+	defer w.f.Close()
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := proc.Signal(syscall.SIGQUIT); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	last := time.Now()
+	for {
+		changed, err := w.poll()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if changed {
+			last = now
+		} else if w.parser.Offset() != 0 && now.Sub(last) >= attachQuiet {
+			break
+		}
+		if now.After(deadline) {
+			break
+		}
+		time.Sleep(attachQuiet / 4)
+	}
+	if err := w.render(out, p, s, false); err != nil {
+		return err
+	}
+	if w.seen == 0 {
+		return fmt.Errorf("no stack trace written to %s after %s", logPath, timeout)
+	}
+	return nil
+}
+
+// stderrFile returns the file the process pid writes its stderr to, if it is
+// a regular file.
+//
+// It is only supported on linux.
+func stderrFile(pid int) string {
+	p, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/2", pid))
+	if err != nil {
+		return ""
+	}
+	if fi, err := os.Stat(p); err != nil || !fi.Mode().IsRegular() {
+		return ""
+	}
+	return p
+}
+
+// fetchPprof fetches the stack traces from a net/http/pprof server and prints
+// them aggregated.
+//
+// If the URL has no path, the default /debug/pprof/goroutine?debug=2 is used.
+func fetchPprof(out io.Writer, p *Palette, s stack.Similarity, url string, timeout time.Duration) error {
+	if i := strings.Index(url, "://"); i != -1 && !strings.Contains(strings.TrimSuffix(url[i+3:], "/"), "/") {
+		url = strings.TrimSuffix(url, "/") + "/debug/pprof/goroutine?debug=2"
+	}
+	body, err := fetchURL(newHTTPClient(timeout, false), url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if len(b) != 0 && b[len(b)-1] != '\n' {
+		// The last line is only parsed once terminated.
+		b = append(b, '\n')
+	}
+	w := newWatcher("", nil)
+	if err := w.add(b); err != nil {
+		return err
+	}
+	if err := w.render(out, p, s, false); err != nil {
+		return err
+	}
+	if w.seen == 0 {
+		return fmt.Errorf("%s: no stack trace found", url)
+	}
+	return nil
+}
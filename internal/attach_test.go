@@ -0,0 +1,119 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// attachDump is a stack dump that doesn't depend on the Go version used to
+// run the tests.
+const attachDump = "goroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:10 +0x20\n\n"
+
+func TestFetchPprof(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/goroutine", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("debug") != "2" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_, _ = io.WriteString(w, attachDump)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	out := &bytes.Buffer{}
+	if err := fetchPprof(out, &Palette{}, stack.AnyPointer, s.URL, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), ": 1 goroutines\n1: running [24d1d4d2]\n    main main.go:10 main()\n") {
+		t.Fatalf("unexpected %q", out.String())
+	}
+	if err := fetchPprof(out, &Palette{}, stack.AnyPointer, s.URL+"/debug/pprof/goroutine", time.Minute); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestAttach(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGQUIT is not supported on windows")
+	}
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	logPath := filepath.Join(d, "service.log")
+	if err := ioutil.WriteFile(logPath, []byte("old\n"+attachDump), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAttachHelper$")
+	cmd.Env = append(os.Environ(), "PANICPARSE_ATTACH_HELPER="+logPath)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	// Wait for the helper to handle SIGQUIT.
+	if l, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || l != "ready\n" {
+		t.Fatalf("%q, %v", l, err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := attach(out, &Palette{}, stack.AnyPointer, cmd.Process.Pid, logPath, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// Only the stack trace written after SIGQUIT is processed.
+	if !strings.HasSuffix(out.String(), ": 1 goroutines\n1: running [24d1d4d2]\n    main main.go:10 main()\n") {
+		t.Fatalf("unexpected %q", out.String())
+	}
+}
+
+// TestAttachHelper is the process attached to by TestAttach.
+func TestAttachHelper(t *testing.T) {
+	logPath := os.Getenv("PANICPARSE_ATTACH_HELPER")
+	if logPath == "" {
+		t.Skip("only run by TestAttach")
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGQUIT)
+	os.Stdout.WriteString("ready\n")
+	<-c
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		os.Exit(1)
+	}
+	_, _ = f.WriteString("SIGQUIT: quit\n\n" + attachDump)
+	_ = f.Close()
+	os.Exit(2)
+}
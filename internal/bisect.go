@@ -0,0 +1,126 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// bisectMain implements "pp bisect", which finds the first stack dump in a
+// directory that contains a bucket.
+func bisectMain(args []string) error {
+	fs := flag.NewFlagSet("bisect", flag.ContinueOnError)
+	id := fs.String("fingerprint", "", "ID of the bucket to look for, as printed by pp, ex: -fingerprint ab12")
+	sinceFlag := fs.String("since", "", "Only search the stack dumps modified at or after this RFC 3339 time, ex: -since 2020-05-10T12:00:00Z")
+	untilFlag := fs.String("until", "", "Only search the stack dumps modified before this RFC 3339 time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Permit "pp bisect dir -fingerprint ab12" since flag stops at the first
+	// non-flag argument.
+	var dirs []string
+	for fs.NArg() != 0 {
+		dirs = append(dirs, fs.Arg(0))
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if *id == "" {
+		return errors.New("-fingerprint is required")
+	}
+	if len(dirs) != 1 {
+		return errors.New("specify a single directory")
+	}
+	var since, until time.Time
+	var err error
+	if *sinceFlag != "" {
+		if since, err = time.Parse(time.RFC3339, *sinceFlag); err != nil {
+			return fmt.Errorf("invalid -since: %v", err)
+		}
+	}
+	if *untilFlag != "" {
+		if until, err = time.Parse(time.RFC3339, *untilFlag); err != nil {
+			return fmt.Errorf("invalid -until: %v", err)
+		}
+	}
+	return bisect(os.Stdout, dirs[0], *id, since, until)
+}
+
+// bisect binary searches the stack dumps in dir for the first one containing
+// a bucket matching id, and prints the time window in which it appeared.
+//
+// The files are processed in lexical order, which must be chronological, like
+// the files written by "pp split". The bucket is assumed to be present in all
+// the files after the first one it appears in. The time of each file is its
+// modification time. Only the files modified in [since, until) are searched;
+// a zero time is not a bound.
+func bisect(out io.Writer, dir, id string, since, until time.Time) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var files []os.FileInfo
+	for _, e := range entries {
+		if !e.Mode().IsRegular() {
+			continue
+		}
+		if (!since.IsZero() && e.ModTime().Before(since)) || (!until.IsZero() && !e.ModTime().Before(until)) {
+			continue
+		}
+		files = append(files, e)
+	}
+	var err2 error
+	i := sort.Search(len(files), func(i int) bool {
+		if err2 != nil {
+			return true
+		}
+		var found bool
+		found, err2 = dumpHasBucket(filepath.Join(dir, files[i].Name()), id)
+		return found
+	})
+	if err2 != nil {
+		return err2
+	}
+	if i == len(files) {
+		return fmt.Errorf("bucket %s not found in %d files", id, len(files))
+	}
+	if i != 0 {
+		if _, err := fmt.Fprintf(out, "last absent: %s (%s)\n", filepath.Join(dir, files[i-1].Name()), files[i-1].ModTime().Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(out, "first seen:  %s (%s)\n", filepath.Join(dir, files[i].Name()), files[i].ModTime().Format(time.RFC3339))
+	return err
+}
+
+// dumpHasBucket returns true if the stack dump in the file has a bucket
+// matching id.
+func dumpHasBucket(p, id string) (bool, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	c, err := stack.ParseDump(f, ioutil.Discard, false)
+	if c == nil || err != nil {
+		return false, err
+	}
+	for _, b := range stack.Aggregate(c.Goroutines, stack.AnyPointer) {
+		if b.MatchID(id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
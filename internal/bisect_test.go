@@ -0,0 +1,98 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestBisect(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	base := strings.Join([]string{
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/foo/main.go:52 +0x49",
+		"",
+	}, "\n")
+	leak := strings.Join([]string{
+		"",
+		"goroutine 7 [chan receive]:",
+		"main.leak(0xc000020000)",
+		"	/gopath/src/foo/main.go:80 +0x49",
+		"created by main.main",
+		"	/gopath/src/foo/main.go:50 +0x49",
+		"",
+	}, "\n")
+	for i := 0; i < 5; i++ {
+		s := base
+		if i >= 3 {
+			s += leak
+		}
+		p := filepath.Join(d, fmt.Sprintf("20200510-1230%02d-000.txt", i))
+		if err := ioutil.WriteFile(p, []byte(s), 0666); err != nil {
+			t.Fatal(err)
+		}
+		m := time.Date(2020, 5, 10, 12, 30, i, 0, time.UTC)
+		if err := os.Chtimes(p, m, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name := func(i int) string {
+		return filepath.Join(d, fmt.Sprintf("20200510-1230%02d-000.txt", i))
+	}
+	c, err := stack.ParseDump(strings.NewReader(base+leak), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ""
+	for _, b := range stack.Aggregate(c.Goroutines, stack.AnyPointer) {
+		if b.State == "chan receive" {
+			id = b.ShortID()
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := bisect(out, d, id, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "last absent: " + name(2) + " (" + time.Date(2020, 5, 10, 12, 30, 2, 0, time.UTC).Local().Format(time.RFC3339) + ")\n" +
+		"first seen:  " + name(3) + " (" + time.Date(2020, 5, 10, 12, 30, 3, 0, time.UTC).Local().Format(time.RFC3339) + ")\n"
+	compareString(t, want, out.String())
+
+	// Only the files in the time window are searched.
+	out.Reset()
+	since := time.Date(2020, 5, 10, 12, 30, 3, 0, time.UTC)
+	if err := bisect(out, d, id, since, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "first seen:  "+name(3)+" ("+since.Local().Format(time.RFC3339)+")\n", out.String())
+	out.Reset()
+	if err := bisect(out, d, id, time.Time{}, since); err == nil {
+		t.Fatal("expected error")
+	}
+
+	out.Reset()
+	if err := bisect(out, d, "ffffffff", time.Time{}, time.Time{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// remap is a source path prefix to replace to find the file in a local
+// checkout.
+type remap struct {
+	from string
+	to   string
+}
+
+// remapFlag implements flag.Value for a repeatable -map-path flag.
+type remapFlag []remap
+
+func (r *remapFlag) String() string {
+	out := make([]string, 0, len(*r))
+	for _, m := range *r {
+		out = append(out, m.from+"="+m.to)
+	}
+	return strings.Join(out, ",")
+}
+
+func (r *remapFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("invalid remap %q; expected from=to", s)
+	}
+	*r = append(*r, remap{from: s[:i], to: s[i+1:]})
+	return nil
+}
+
+// blamer annotates buckets with the last commit that touched their top
+// first-party call, as found by git blame.
+type blamer struct {
+	// cache is the annotation for each "path:line" already blamed.
+	cache map[string]string
+}
+
+func newBlamer() *blamer {
+	return &blamer{cache: map[string]string{}}
+}
+
+// annotate returns the commit that last touched the top first-party call of
+// the bucket. It returns an empty string if none was found.
+func (b *blamer) annotate(bucket *stack.Bucket) string {
+	c := firstPartyCall(bucket)
+	if c == nil {
+		return ""
+	}
+	p := localPath(c)
+	key := p + ":" + strconv.Itoa(c.Line)
+	if s, ok := b.cache[key]; ok {
+		return s
+	}
+	s, err := gitBlame(p, c.Line)
+	if err != nil {
+		log.Printf("git blame %s: %v", key, err)
+	}
+	b.cache[key] = s
+	return s
+}
+
+// localPath returns the path to the source file of the call in the local
+// checkout, as mapped with -map-path.
+func localPath(c *stack.Call) string {
+	if c.LocalSrcPath != "" {
+		return c.LocalSrcPath
+	}
+	return c.SrcPath
+}
+
+// firstPartyCall returns the top call that is not in the standard library and
+// has a source file.
+func firstPartyCall(bucket *stack.Bucket) *stack.Call {
+	for i := range bucket.Stack.Calls {
+		c := &bucket.Stack.Calls[i]
+		if c.IsStdlib || !strings.HasSuffix(c.SrcPath, ".go") {
+			continue
+		}
+		return c
+	}
+	return nil
+}
+
+// gitBlame runs git blame on a single line and returns a one line summary of
+// the commit.
+func gitBlame(path string, line int) (string, error) {
+	l := strconv.Itoa(line)
+	cmd := exec.Command("git", "blame", "--porcelain", "-L", l+","+l, "--", filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return parseBlame(out)
+}
+
+// parseBlame parses the output of "git blame --porcelain" for a single line.
+func parseBlame(out []byte) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(out))
+	if !s.Scan() {
+		return "", errors.New("empty git blame output")
+	}
+	sha := strings.SplitN(s.Text(), " ", 2)[0]
+	if len(sha) < 8 {
+		return "", fmt.Errorf("unexpected git blame output: %q", s.Text())
+	}
+	author := ""
+	date := ""
+	summary := ""
+	for s.Scan() {
+		t := s.Text()
+		switch {
+		case strings.HasPrefix(t, "author "):
+			author = t[len("author "):]
+		case strings.HasPrefix(t, "author-time "):
+			if i, err := strconv.ParseInt(t[len("author-time "):], 10, 64); err == nil {
+				date = time.Unix(i, 0).UTC().Format("2006-01-02")
+			}
+		case strings.HasPrefix(t, "summary "):
+			summary = t[len("summary "):]
+		}
+	}
+	return fmt.Sprintf("%s %s %s %s", sha[:8], date, author, summary), nil
+}
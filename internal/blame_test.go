@@ -0,0 +1,131 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestParseBlame(t *testing.T) {
+	t.Parallel()
+	out := strings.Join([]string{
+		"2c4f1a8e9b7d6c5e4f3a2b1c0d9e8f7a6b5c4d3e 12 12 1",
+		"author Jane Doe",
+		"author-mail <jane@example.com>",
+		"author-time 1577836800",
+		"author-tz +0000",
+		"committer Jane Doe",
+		"summary Add the worker pool",
+		"filename main.go",
+		"\tgo worker()",
+		"",
+	}, "\n")
+	got, err := parseBlame([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "2c4f1a8e 2020-01-01 Jane Doe Add the worker pool", got)
+
+	if _, err := parseBlame(nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := parseBlame([]byte("fatal: no such path\n")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRemapFlag(t *testing.T) {
+	t.Parallel()
+	var r remapFlag
+	if err := r.Set("/build/src=/home/me/src"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set("/other="); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "/build/src=/home/me/src,/other=", r.String())
+	if err := r.Set("=/foo"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := r.Set("foo"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		c    stack.Call
+		want string
+	}{
+		{stack.Call{SrcPath: "/gopath/src/foo/main.go", LocalSrcPath: "/home/me/go/src/foo/main.go"}, "/home/me/go/src/foo/main.go"},
+		{stack.Call{SrcPath: "/gopath/src/foo/main.go"}, "/gopath/src/foo/main.go"},
+	}
+	for _, line := range data {
+		compareString(t, line.want, localPath(&line.c))
+	}
+}
+
+func TestBlamer(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := ioutil.WriteFile(filepath.Join(d, "main.go"), []byte("package main\n\nfunc main() {\n}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	env := append(os.Environ(),
+		"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com", "GIT_AUTHOR_DATE=2020-01-01T00:00:00Z",
+		"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com", "GIT_COMMITTER_DATE=2020-01-01T00:00:00Z")
+	for _, args := range [][]string{{"init", "-q"}, {"add", "main.go"}, {"commit", "-q", "-m", "Initial commit"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = d
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+
+	b := newBlamer()
+	bucket := &stack.Bucket{
+		Signature: stack.Signature{
+			Stack: stack.Stack{
+				Calls: []stack.Call{
+					{SrcPath: "/goroot/src/runtime/proc.go", Line: 300, IsStdlib: true},
+					{SrcPath: "/build/main.go", LocalSrcPath: filepath.Join(d, "main.go"), Line: 3},
+				},
+			},
+		},
+	}
+	got := b.annotate(bucket)
+	if !strings.HasSuffix(got, " 2020-01-01 Jane Doe Initial commit") || len(got) < 9 || got[8] != ' ' {
+		t.Fatalf("unexpected %q", got)
+	}
+	// Cached.
+	compareString(t, got, b.annotate(bucket))
+
+	// Not found.
+	bucket.Stack.Calls[1].LocalSrcPath = "/other/main.go"
+	compareString(t, "", b.annotate(bucket))
+	// No first-party call.
+	bucket.Stack.Calls = bucket.Stack.Calls[:1]
+	compareString(t, "", b.annotate(bucket))
+}
@@ -0,0 +1,293 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configDir returns the directory of the configuration files, or "" if there
+// is no home directory.
+func configDir() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "panicparse")
+}
+
+// defaultConfigFile returns the path of the default configuration file, or ""
+// if there is no home directory.
+func defaultConfigFile() string {
+	if dir := configDir(); dir != "" {
+		return filepath.Join(dir, "config.toml")
+	}
+	return ""
+}
+
+// config is the content of a configuration file.
+//
+// It is a subset of TOML: the top level keys are the default values of the
+// command line flags and the [colors] table overrides the palette, e.g.:
+//
+//   aggressive = true
+//   map-path = ["/build/src=/home/me/src"]
+//   [colors]
+//   funcmain = "#ffaf00+b"
+type config struct {
+	// flags is the default value of each flag, in the order found. A flag
+	// can be listed multiple times when its value is an array.
+	flags []configFlag
+	// colors is the [colors] table, as accepted by Palette.applyColors().
+	colors string
+}
+
+type configFlag struct {
+	name  string
+	value string
+}
+
+// loadConfig reads the configuration file at path. A missing file is not an
+// error unless mustExist is true.
+//
+// The colors file in configDir(), which predates the [colors] table, is
+// loaded as the start of the [colors] table, so the table has precedence.
+func loadConfig(path string, mustExist bool) (*config, error) {
+	c, err := readConfig(path, mustExist)
+	if err != nil {
+		return nil, err
+	}
+	if dir := configDir(); dir != "" {
+		colors, err := readColors(filepath.Join(dir, "colors"))
+		if err != nil {
+			return nil, err
+		}
+		if colors != "" {
+			c.colors = strings.TrimSuffix(colors+"\n"+c.colors, "\n")
+		}
+	}
+	return c, nil
+}
+
+// readConfig reads the configuration file at path, without the colors file.
+func readConfig(path string, mustExist bool) (*config, error) {
+	if path == "" {
+		return &config{}, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !mustExist {
+			return &config{}, nil
+		}
+		return nil, err
+	}
+	c, err := parseConfig(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// readColors returns the content of the colors file at path, one
+// "element=color" per line as accepted by Palette.applyColors(), or "" if
+// there is none.
+func readColors(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	// Validate it now, to tell which file is invalid.
+	p := defaultPalette
+	if err := p.applyColors(string(b)); err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// parseConfig parses the content of a configuration file.
+func parseConfig(s string) (*config, error) {
+	c := &config{}
+	var colors []string
+	table := ""
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if table = strings.TrimSpace(line[1 : len(line)-1]); table != "colors" {
+				return nil, fmt.Errorf("line %d: unknown table %q", i+1, table)
+			}
+			continue
+		}
+		j := strings.IndexByte(line, '=')
+		if j <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		key := strings.Trim(strings.TrimSpace(line[:j]), `"`)
+		values, err := parseConfigValue(strings.TrimSpace(line[j+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if table == "colors" {
+			if len(values) != 1 {
+				return nil, fmt.Errorf("line %d: expected a single color", i+1)
+			}
+			colors = append(colors, key+"="+values[0])
+			continue
+		}
+		for _, v := range values {
+			c.flags = append(c.flags, configFlag{name: key, value: v})
+		}
+	}
+	c.colors = strings.Join(colors, "\n")
+	return c, nil
+}
+
+// parseConfigValue parses a string, a boolean, a number or a single line
+// array of these. An array returns one item per element.
+func parseConfigValue(s string) ([]string, error) {
+	if strings.HasPrefix(s, "[") {
+		if !strings.HasSuffix(s, "]") {
+			return nil, errors.New("arrays must be on a single line")
+		}
+		var out []string
+		for s = strings.TrimSpace(s[1 : len(s)-1]); s != ""; {
+			v, rest, err := nextConfigValue(s)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+			rest = strings.TrimSpace(rest)
+			if rest != "" && !strings.HasPrefix(rest, ",") {
+				return nil, fmt.Errorf("expected ',' before %q", rest)
+			}
+			s = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+		}
+		return out, nil
+	}
+	v, rest, err := nextConfigValue(s)
+	if err != nil {
+		return nil, err
+	}
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return nil, fmt.Errorf("unexpected %q", rest)
+	}
+	return []string{v}, nil
+}
+
+// nextConfigValue parses the value at the start of s and returns the rest.
+func nextConfigValue(s string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		// Find the closing quote, skipping the escaped ones.
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				v, err := strconv.Unquote(s[:i+1])
+				return v, s[i+1:], err
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string %s", s)
+	case strings.HasPrefix(s, "'"):
+		// A literal string has no escape.
+		if i := strings.IndexByte(s[1:], '\''); i != -1 {
+			return s[1 : i+1], s[i+2:], nil
+		}
+		return "", "", fmt.Errorf("unterminated string %s", s)
+	}
+	i := strings.IndexAny(s, " \t,#")
+	if i == -1 {
+		i = len(s)
+	}
+	v := s[:i]
+	if v != "true" && v != "false" {
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return "", "", fmt.Errorf("invalid value %q", v)
+		}
+	}
+	return v, s[i:], nil
+}
+
+// apply sets the flags found in the configuration file, before the command
+// line is parsed so it takes precedence.
+func (c *config) apply(fs *flag.FlagSet) error {
+	for _, f := range c.flags {
+		if f.name == "config" || fs.Lookup(f.name) == nil {
+			return fmt.Errorf("unknown flag %q in the configuration file", f.name)
+		}
+		if err := fs.Set(f.name, f.value); err != nil {
+			return fmt.Errorf("invalid value %q for flag %q in the configuration file: %v", f.value, f.name, err)
+		}
+	}
+	return nil
+}
+
+// applyKnown is like apply for a subcommand: the flags that fs doesn't define
+// are for the other commands and are ignored.
+func (c *config) applyKnown(fs *flag.FlagSet) error {
+	k := &config{colors: c.colors}
+	for _, f := range c.flags {
+		if f.name != "config" && fs.Lookup(f.name) != nil {
+			k.flags = append(k.flags, f)
+		}
+	}
+	return k.apply(fs)
+}
+
+// subcommandConfig loads the default configuration file and sets the flags of
+// the subcommand fs it lists.
+func subcommandConfig(fs *flag.FlagSet) (*config, error) {
+	cfg, err := loadConfig(defaultConfigFile(), false)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.applyKnown(fs); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configFlagValue returns the value of the -config flag in args, if any, as
+// it must be known before the command line is parsed.
+func configFlagValue(args []string) (string, bool) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" || !strings.HasPrefix(a, "-") {
+			break
+		}
+		a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		if a == "config" && i+1 < len(args) {
+			return args[i+1], true
+		}
+		if strings.HasPrefix(a, "config=") {
+			return a[len("config="):], true
+		}
+		if !strings.Contains(a, "=") {
+			// Skip the value of non-boolean flags, e.g. "-f value".
+			if f := flag.Lookup(a); f != nil {
+				if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+					i++
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,214 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mgutz/ansi"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+	const s = `# Team defaults.
+aggressive = true
+f = "IO wait|select" # Trailing comment.
+top = 10
+blame-remap = ["/build/src=/home/me/src", '/ci/go=C:\go']
+
+[colors]
+funcmain = "#ffaf00+b"
+createdby = "244"
+`
+	c, err := parseConfig(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []configFlag{
+		{"aggressive", "true"},
+		{"f", "IO wait|select"},
+		{"top", "10"},
+		{"blame-remap", "/build/src=/home/me/src"},
+		{"blame-remap", `/ci/go=C:\go`},
+	}
+	if diff := cmp.Diff(want, c.flags, cmp.AllowUnexported(configFlag{})); diff != "" {
+		t.Fatalf("Mismatch (-want +got):\n%s", diff)
+	}
+	compareString(t, "funcmain=#ffaf00+b\ncreatedby=244", c.colors)
+}
+
+func TestParseConfigErr(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"aggressive",
+		"f = \"unterminated",
+		"f = unquoted",
+		"f = \"a\" \"b\"",
+		"remap = [\"a\"",
+		"remap = [\"a\" \"b\"]",
+		"[other]",
+		"[colors]\nfuncmain = [\"red\", \"blue\"]",
+	}
+	for i, s := range data {
+		if _, err := parseConfig(s); err == nil {
+			t.Fatalf("#%d: %q: expected error", i, s)
+		}
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	t.Parallel()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	aggressive := fs.Bool("aggressive", false, "")
+	top := fs.Int("top", 0, "")
+	var remaps remapFlag
+	fs.Var(&remaps, "blame-remap", "")
+	c := &config{flags: []configFlag{{"aggressive", "true"}, {"top", "10"}, {"blame-remap", "/a=/b"}, {"blame-remap", "/c=/d"}}}
+	if err := c.apply(fs); err != nil {
+		t.Fatal(err)
+	}
+	// The command line has precedence.
+	if err := fs.Parse([]string{"-top", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if !*aggressive || *top != 3 {
+		t.Fatalf("unexpected values %t, %d", *aggressive, *top)
+	}
+	compareString(t, "/a=/b,/c=/d", remaps.String())
+
+	for _, f := range []configFlag{{"unknown", "1"}, {"top", "ten"}, {"config", "foo"}} {
+		c := &config{flags: []configFlag{f}}
+		if err := c.apply(fs); err == nil {
+			t.Fatalf("%v: expected error", f)
+		}
+	}
+}
+
+func TestConfigApplyKnown(t *testing.T) {
+	t.Parallel()
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	aggressive := fs.Bool("aggressive", false, "")
+	// The flags of the other commands are ignored.
+	c := &config{flags: []configFlag{{"aggressive", "true"}, {"rel-path", "true"}, {"config", "foo"}}}
+	if err := c.applyKnown(fs); err != nil {
+		t.Fatal(err)
+	}
+	if !*aggressive {
+		t.Fatal("expected -aggressive to be set")
+	}
+	c = &config{flags: []configFlag{{"aggressive", "maybe"}}}
+	if err := c.applyKnown(fs); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	p := filepath.Join(d, "config.toml")
+	if c, err := loadConfig(p, false); err != nil || len(c.flags) != 0 {
+		t.Fatalf("%v, %v", c, err)
+	}
+	if _, err := loadConfig(p, true); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := ioutil.WriteFile(p, []byte("aggressive = true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareInt(t, 1, len(c.flags))
+}
+
+func TestLoadConfigColors(t *testing.T) {
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	oldXDG := os.Getenv("XDG_CONFIG_HOME")
+	defer os.Setenv("XDG_CONFIG_HOME", oldXDG)
+	os.Setenv("XDG_CONFIG_HOME", d)
+	if err := os.Mkdir(filepath.Join(d, "panicparse"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(d, "panicparse", "config.toml")
+	if err := ioutil.WriteFile(p, []byte("[colors]\nfuncother = \"green\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	colors := filepath.Join(d, "panicparse", "colors")
+	if err := ioutil.WriteFile(colors, []byte("# Legacy colors file.\nfuncmain=cyan\nfuncother=blue\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The colors file is loaded first, so the [colors] table has precedence.
+	c, err := loadConfig(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "# Legacy colors file.\nfuncmain=cyan\nfuncother=blue\nfuncother=green", c.colors)
+	pal, err := loadPalette(c.colors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, ansi.Cyan, pal.FuncMain)
+	compareString(t, ansi.Green, pal.FuncOther)
+
+	// Without a configuration file.
+	if c, err = loadConfig("", false); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "# Legacy colors file.\nfuncmain=cyan\nfuncother=blue", c.colors)
+
+	if err := ioutil.WriteFile(colors, []byte("funcmain=nope\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = loadConfig("", false); err == nil || !strings.Contains(err.Error(), colors) {
+		t.Fatalf("expected error about %s, got %v", colors, err)
+	}
+}
+
+func TestConfigFlagValue(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		args []string
+		want string
+		ok   bool
+	}{
+		{nil, "", false},
+		{[]string{"-config", "a.toml"}, "a.toml", true},
+		{[]string{"--config=a.toml"}, "a.toml", true},
+		{[]string{"-test.v", "-config=a.toml", "crash.txt"}, "a.toml", true},
+		{[]string{"crash.txt", "-config", "a.toml"}, "", false},
+		{[]string{"--", "-config", "a.toml"}, "", false},
+	}
+	for i, line := range data {
+		got, ok := configFlagValue(line.args)
+		if got != line.want || ok != line.ok {
+			t.Fatalf("#%d: %q: expected %q, %t; got %q, %t", i, line.args, line.want, line.ok, got, ok)
+		}
+	}
+}
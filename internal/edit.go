@@ -0,0 +1,123 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// editor opens the source file of a call of the crashing goroutine in the
+// user's editor, after the stack dump was printed.
+type editor struct {
+	// cmd is the editor command line, e.g. []string{"code", "--wait"}.
+	cmd []string
+	// in is where the selection is read from. It is the terminal, since
+	// stdin is usually the piped stack dump.
+	in io.Reader
+	// out is where the calls are listed.
+	out io.Writer
+	// run starts the editor and waits for it to exit.
+	run func(args []string) error
+}
+
+// newEditor returns the editor in $VISUAL or $EDITOR, defaulting to vi.
+func newEditor() (*editor, error) {
+	e := os.Getenv("VISUAL")
+	if e == "" {
+		e = os.Getenv("EDITOR")
+	}
+	if e == "" {
+		e = "vi"
+	}
+	tty, err := openTerminal()
+	if err != nil {
+		return nil, fmt.Errorf("-edit requires a terminal: %v", err)
+	}
+	return &editor{cmd: strings.Fields(e), in: tty, out: os.Stderr, run: runEditor}, nil
+}
+
+// openTerminal opens the console for reading. It is never closed.
+func openTerminal() (*os.File, error) {
+	if runtime.GOOS == "windows" {
+		return os.Open("CONIN$")
+	}
+	return os.Open("/dev/tty")
+}
+
+func runEditor(args []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	tty, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	cmd.Stdin = tty
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// edit lists the calls of the bucket that have a source file, asks which one
+// to open and launches the editor on it. Pressing enter selects the top
+// first-party call.
+//
+// It does nothing if no call has a source file or if the input is empty.
+func (e *editor) edit(p *Palette, pf pathFormat, bucket *stack.Bucket) error {
+	var calls []*stack.Call
+	def := 0
+	for i := range bucket.Stack.Calls {
+		c := &bucket.Stack.Calls[i]
+		if !strings.HasSuffix(c.SrcPath, ".go") {
+			continue
+		}
+		if c == firstPartyCall(bucket) {
+			def = len(calls)
+		}
+		calls = append(calls, c)
+	}
+	if len(calls) == 0 {
+		return nil
+	}
+	for i, c := range calls {
+		_, _ = fmt.Fprintf(e.out, "%s%3d%s %s %s\n", p.BucketID, i+1, p.EOLReset, pf.formatCall(c), c.Func.PkgDotName())
+	}
+	r := bufio.NewReader(e.in)
+	for {
+		_, _ = fmt.Fprintf(e.out, "Open call [%d]: ", def+1)
+		l, err := r.ReadString('\n')
+		if err != nil && l == "" {
+			// Nothing was typed; e.g. ^D.
+			_, _ = io.WriteString(e.out, "\n")
+			return nil
+		}
+		l = strings.TrimSpace(l)
+		if l == "" {
+			return e.open(calls[def])
+		}
+		if n, err := strconv.Atoi(l); err == nil && n >= 1 && n <= len(calls) {
+			return e.open(calls[n-1])
+		}
+		_, _ = fmt.Fprintf(e.out, "invalid choice %q\n", l)
+	}
+}
+
+// open launches the editor as "$EDITOR +line file".
+func (e *editor) open(c *stack.Call) error {
+	path := c.LocalSrcPath
+	if path == "" {
+		path = c.SrcPath
+	}
+	args := append(append([]string{}, e.cmd...), "+"+strconv.Itoa(c.Line), path)
+	return e.run(args)
+}
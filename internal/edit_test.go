@@ -0,0 +1,73 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestEditorEdit(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in   string
+		want []string
+	}{
+		// Enter selects the top first-party call.
+		{"\n", []string{"vim", "-p", "+10", "/gopath/src/foo/main.go"}},
+		{"1\n", []string{"vim", "-p", "+1000", "/goroot/src/runtime/panic.go"}},
+		{"3\n2", []string{"vim", "-p", "+10", "/gopath/src/foo/main.go"}},
+		{"", nil},
+	}
+	for i, line := range data {
+		c, err := stack.ParseDump(strings.NewReader(firstDump), ioutil.Discard, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := crashedBucket(c, stack.Aggregate(c.Goroutines, stack.AnyPointer))
+		b.Stack.Calls[0].IsStdlib = true
+		var got []string
+		out := &bytes.Buffer{}
+		e := &editor{
+			cmd: []string{"vim", "-p"},
+			in:  strings.NewReader(line.in),
+			out: out,
+			run: func(args []string) error {
+				got = args
+				return nil
+			},
+		}
+		if err := e.edit(&Palette{}, basePath, b); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(line.want, got); diff != "" {
+			t.Fatalf("#%d: (-want +got)\n%s", i, diff)
+		}
+		if !strings.HasPrefix(out.String(), "  1 panic.go:1000 panic\n  2 main.go:10 main.main\nOpen call [2]: ") {
+			t.Fatalf("#%d: unexpected output:\n%s", i, out.String())
+		}
+	}
+}
+
+func TestEditorEditNoSource(t *testing.T) {
+	t.Parallel()
+	e := &editor{
+		in:  strings.NewReader("\n"),
+		out: ioutil.Discard,
+		run: func(args []string) error {
+			t.Fatal("unexpected call")
+			return nil
+		},
+	}
+	b := &stack.Bucket{Signature: stack.Signature{Stack: stack.Stack{Calls: []stack.Call{{SrcPath: "?"}}}}}
+	if err := e.edit(&Palette{}, basePath, b); err != nil {
+		t.Fatal(err)
+	}
+}
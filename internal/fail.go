@@ -0,0 +1,45 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// failPolicy tells when pp must exit with a non-zero exit code, for when the
+// exit code of the process piped into pp is lost, e.g. in CI.
+type failPolicy struct {
+	onPanic bool
+	onRace  bool
+}
+
+// failed returns true if c contains a panic or races found a data race, and
+// the policy asks to fail on it. c and races can be nil.
+func (f failPolicy) failed(c *stack.Context, races *raceDetector) bool {
+	if f.onPanic && c != nil && len(c.Panics) != 0 {
+		return true
+	}
+	return f.onRace && races != nil && races.found
+}
+
+// raceDetector passes the data through and records if it contains a data
+// race report.
+type raceDetector struct {
+	w     io.Writer
+	found bool
+}
+
+// raceWarning is the header of a data race report.
+var raceWarning = []byte("WARNING: DATA RACE")
+
+func (r *raceDetector) Write(b []byte) (int, error) {
+	if !r.found && bytes.Contains(b, raceWarning) {
+		r.found = true
+	}
+	return r.w.Write(b)
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestProcessFailOnPanic(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		fail failPolicy
+		code int
+	}{
+		{failPolicy{}, 0},
+		{failPolicy{onRace: true}, 0},
+		{failPolicy{onPanic: true}, 2},
+	}
+	for i, line := range data {
+		err := process([]input{{r: strings.NewReader(mergeDump)}}, ioutil.Discard, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: basePath, fail: line.fail})
+		code := 0
+		if e, ok := err.(*ExitError); ok {
+			code = e.Code
+		} else if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		compareInt(t, line.code, code)
+	}
+}
+
+func TestProcessFailOnRace(t *testing.T) {
+	t.Parallel()
+	const race = "==================\n" +
+		"WARNING: DATA RACE\n" +
+		"Read at 0x00c0000a0010 by goroutine 7:\n" +
+		"  main.main.func1()\n" +
+		"      /gopath/src/foo/main.go:10 +0x38\n" +
+		"==================\n" +
+		"--- FAIL: TestFoo (0.00s)\n" +
+		"    testing.go:853: race detected during execution of test\n"
+	out := &bytes.Buffer{}
+	err := process([]input{{r: strings.NewReader(race)}}, out, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: basePath, fail: failPolicy{onRace: true}})
+	if e, ok := err.(*ExitError); !ok || e.Code != 2 {
+		t.Fatalf("expected ExitError, got %v", err)
+	}
+	// The output is passed through untouched.
+	compareString(t, race, out.String())
+
+	err = process([]input{{r: strings.NewReader("all good\n")}}, ioutil.Discard, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: basePath, fail: failPolicy{onRace: true, onPanic: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
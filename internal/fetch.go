@@ -0,0 +1,48 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isURL returns true if the argument is an HTTP URL to fetch instead of a
+// file name.
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// newHTTPClient returns a client to fetch stack dumps.
+//
+// If insecure is true, the TLS certificate of the server is not verified.
+func newHTTPClient(timeout time.Duration, insecure bool) *http.Client {
+	c := &http.Client{Timeout: timeout}
+	if insecure {
+		c.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	return c
+}
+
+// fetchURL starts fetching the stack dump at url. The caller must close the
+// returned body.
+func fetchURL(c *http.Client, url string) (io.ReadCloser, error) {
+	resp, err := c.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
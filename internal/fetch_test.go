@@ -0,0 +1,68 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsURL(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in   string
+		want bool
+	}{
+		{"http://localhost:6060/debug/pprof/goroutine?debug=2", true},
+		{"https://example.com/dump.txt", true},
+		{"stack.txt", false},
+		{"/tmp/http://", false},
+	}
+	for i, line := range data {
+		if got := isURL(line.in); got != line.want {
+			t.Fatalf("#%d: isURL(%q) = %t", i, line.in, got)
+		}
+	}
+}
+
+func TestFetchURL(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dump" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, "goroutine 1 [running]:\n")
+	})
+	s := httptest.NewTLSServer(h)
+	defer s.Close()
+	// Silence the TLS handshake error logged by the server.
+	s.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	if _, err := fetchURL(newHTTPClient(time.Minute, false), s.URL+"/dump"); err == nil {
+		t.Fatal("expected certificate error")
+	}
+	c := newHTTPClient(time.Minute, true)
+	body, err := fetchURL(c, s.URL+"/dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err2 := body.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "goroutine 1 [running]:\n", string(b))
+	if _, err := fetchURL(c, s.URL+"/other"); err == nil {
+		t.Fatal("expected error")
+	}
+}
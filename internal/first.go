@@ -0,0 +1,53 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// crashedBucket returns the bucket of the goroutine that panicked, or of the
+// goroutine printed first if none panicked. It returns nil if not found.
+func crashedBucket(c *stack.Context, buckets []*stack.Bucket) *stack.Bucket {
+	g, _ := c.Crashed()
+	if g == nil {
+		for _, r := range c.Goroutines {
+			if r.First {
+				g = r
+				break
+			}
+		}
+		if g == nil {
+			return nil
+		}
+	}
+	for _, b := range buckets {
+		for _, id := range b.IDs {
+			if id == g.ID {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// othersLine returns the count of the goroutines and buckets of all that are
+// not in shown.
+func othersLine(p *Palette, all, shown []*stack.Bucket) string {
+	skip := map[*stack.Bucket]bool{}
+	for _, b := range shown {
+		skip[b] = true
+	}
+	routines, buckets := 0, 0
+	for _, b := range all {
+		if !skip[b] {
+			routines += len(b.IDs)
+			buckets++
+		}
+	}
+	return fmt.Sprintf("%s+ %s in %s%s\n", p.BucketID, plural(routines, "other goroutine"), plural(buckets, "other bucket"), p.EOLReset)
+}
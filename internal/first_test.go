@@ -0,0 +1,70 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+const firstDump = "panic: boom\n\n" +
+	"goroutine 6 [chan receive]:\n" +
+	"main.worker()\n" +
+	"\t/gopath/src/foo/main.go:20 +0x20\n" +
+	"created by main.main\n" +
+	"\t/gopath/src/foo/main.go:8 +0x20\n\n" +
+	"goroutine 1 [running]:\n" +
+	"panic(0x45, 0x1)\n" +
+	"\t/goroot/src/runtime/panic.go:1000 +0x20\n" +
+	"main.main()\n" +
+	"\t/gopath/src/foo/main.go:10 +0x20\n\n" +
+	"goroutine 7 [chan receive]:\n" +
+	"main.worker()\n" +
+	"\t/gopath/src/foo/main.go:20 +0x20\n" +
+	"created by main.main\n" +
+	"\t/gopath/src/foo/main.go:8 +0x20\n"
+
+func TestCrashedBucket(t *testing.T) {
+	t.Parallel()
+	c, err := stack.ParseDump(strings.NewReader(firstDump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets := stack.Aggregate(c.Goroutines, stack.AnyPointer)
+	b := crashedBucket(c, buckets)
+	if b == nil || b.State != "running" {
+		t.Fatalf("unexpected bucket %v", b)
+	}
+	compareString(t, "+ 2 other goroutines in 1 other bucket\n", othersLine(&Palette{}, buckets, []*stack.Bucket{b}))
+
+	// Without a panic, the goroutine printed first is used.
+	c, err = stack.ParseDump(strings.NewReader(mergeDump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets = stack.Aggregate(c.Goroutines, stack.AnyPointer)
+	if b = crashedBucket(c, buckets); b == nil || b.IDs[0] != 1 {
+		t.Fatalf("unexpected bucket %v", b)
+	}
+	if b = crashedBucket(c, nil); b != nil {
+		t.Fatalf("unexpected bucket %v", b)
+	}
+}
+
+func TestProcessFirst(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	if err := process([]input{{r: strings.NewReader(firstDump)}}, out, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: basePath, first: true}); err != nil {
+		t.Fatal(err)
+	}
+	s := out.String()
+	if !strings.HasPrefix(s, "panic: boom\n\n1: running [") || strings.Contains(s, "chan receive") || !strings.HasSuffix(s, "main.go:10    main()\n+ 2 other goroutines in 1 other bucket\n") {
+		t.Fatalf("unexpected output:\n%s", s)
+	}
+}
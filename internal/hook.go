@@ -0,0 +1,66 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// hook runs a user command on each panic found by -stream or "pp watch", for
+// ad-hoc alerting.
+type hook struct {
+	cmd string
+	// errs is where the failures to run the command are printed. They do not
+	// stop the processing.
+	errs io.Writer
+	// run runs cmd with the shell, passing stdin, and waits for it to exit.
+	run func(cmd string, stdin io.Reader) error
+}
+
+// newHook returns nil if cmd is empty.
+func newHook(cmd string) *hook {
+	if cmd == "" {
+		return nil
+	}
+	return &hook{cmd: cmd, errs: os.Stderr, run: runShell}
+}
+
+// fire runs the command with the JSON document of -json on stdin if c
+// contains a panic. h can be nil.
+func (h *hook) fire(c *stack.Context, buckets []*stack.Bucket) {
+	if h == nil || len(c.Panics) == 0 {
+		return
+	}
+	var b bytes.Buffer
+	if err := writeJSON(&b, c, buckets); err != nil {
+		_, _ = fmt.Fprintf(h.errs, "-exec: %v\n", err)
+		return
+	}
+	if err := h.run(h.cmd, &b); err != nil {
+		_, _ = fmt.Fprintf(h.errs, "-exec %q: %v\n", h.cmd, err)
+	}
+}
+
+// runShell runs cmd with sh, or cmd.exe on Windows. Its output goes to
+// stderr, to not interleave with the stack traces.
+func runShell(cmd string, stdin io.Reader) error {
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd.exe", "/C", cmd)
+	} else {
+		c = exec.Command("/bin/sh", "-c", cmd)
+	}
+	c.Stdin = stdin
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	return c.Run()
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// quitDump is a stack dump without a panic, as printed on SIGQUIT.
+const quitDump = "goroutine 1 [running]:\n" +
+	"main.main()\n" +
+	"\t/gopath/src/foo/main.go:10 +0x20\n\n"
+
+// recordHook returns a hook that records the documents it receives.
+func recordHook(t *testing.T, docs *[]jsonDump, err error) *hook {
+	return &hook{
+		cmd:  "alert",
+		errs: ioutil.Discard,
+		run: func(cmd string, stdin io.Reader) error {
+			var d jsonDump
+			if err := json.NewDecoder(stdin).Decode(&d); err != nil {
+				t.Fatal(err)
+			}
+			*docs = append(*docs, d)
+			return err
+		},
+	}
+}
+
+func TestHookFire(t *testing.T) {
+	t.Parallel()
+	if h := newHook(""); h != nil {
+		t.Fatal("expected nil")
+	}
+	// A nil hook does nothing.
+	(*hook)(nil).fire(&stack.Context{}, nil)
+
+	var docs []jsonDump
+	h := recordHook(t, &docs, nil)
+	c, err := stack.ParseDump(strings.NewReader(quitDump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.fire(c, stack.Aggregate(c.Goroutines, stack.AnyPointer))
+	if len(docs) != 0 {
+		t.Fatalf("unexpected run without a panic: %v", docs)
+	}
+	if c, err = stack.ParseDump(strings.NewReader(firstDump), ioutil.Discard, false); err != nil {
+		t.Fatal(err)
+	}
+	h.fire(c, stack.Aggregate(c.Goroutines, stack.AnyPointer))
+	if len(docs) != 1 || len(docs[0].Panics) != 1 || docs[0].Panics[0].Message != "boom" || len(docs[0].Buckets) != 2 {
+		t.Fatalf("unexpected documents: %v", docs)
+	}
+}
+
+func TestHookFireError(t *testing.T) {
+	t.Parallel()
+	var docs []jsonDump
+	h := recordHook(t, &docs, errors.New("exit status 1"))
+	errs := &bytes.Buffer{}
+	h.errs = errs
+	c, err := stack.ParseDump(strings.NewReader(firstDump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.fire(c, nil)
+	compareString(t, "-exec \"alert\": exit status 1\n", errs.String())
+}
+
+func TestStreamHook(t *testing.T) {
+	t.Parallel()
+	var docs []jsonDump
+	h := recordHook(t, &docs, nil)
+	in := "starting\n" + firstDump + "\nrestarted\n" + quitDump
+	if err := stream(strings.NewReader(in), ioutil.Discard, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: basePath}, h, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || len(docs[0].Panics) != 1 {
+		t.Fatalf("unexpected documents: %v", docs)
+	}
+}
+
+func TestStreamHookTwoPanics(t *testing.T) {
+	t.Parallel()
+	var docs []jsonDump
+	h := recordHook(t, &docs, nil)
+	in := firstDump + "\nrestarted\n" + strings.Replace(firstDump, "boom", "bang", 1)
+	if err := stream(strings.NewReader(in), ioutil.Discard, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: basePath}, h, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[0].Panics[0].Message != "boom" || docs[1].Panics[0].Message != "bang" {
+		t.Fatalf("unexpected documents: %v", docs)
+	}
+}
+
+func TestWatcherRenderHook(t *testing.T) {
+	t.Parallel()
+	var docs []jsonDump
+	w := newWatcher("", recordHook(t, &docs, nil))
+	if err := w.add([]byte(firstDump)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.render(ioutil.Discard, &Palette{}, stack.AnyPointer, false); err != nil {
+		t.Fatal(err)
+	}
+	// The same panic is not reported again.
+	if err := w.add([]byte("\n" + quitDump)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.render(ioutil.Discard, &Palette{}, stack.AnyPointer, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("unexpected documents: %v", docs)
+	}
+	// The process crashed again.
+	if err := w.add([]byte("\nrestarted\n" + strings.Replace(firstDump, "boom", "bang", 1))); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.render(ioutil.Discard, &Palette{}, stack.AnyPointer, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[1].Panics[0].Message != "bang" {
+		t.Fatalf("unexpected documents: %v", docs)
+	}
+}
+
+func TestRunShell(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	if err := runShell("read l && test \"$l\" = hello", strings.NewReader("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := runShell("exit 3", nil); err == nil || err.Error() != "exit status 3" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
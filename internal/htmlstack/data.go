@@ -6,7 +6,7 @@ import (
 	"html/template"
 )
 
-const indexHTML = "<!DOCTYPE html>\n{{- /* Accepts a Args */ -}}\n{{- define \"RenderArgs\" -}}\n<span class=\"args\"><span>\n{{- $elided := .Elided -}}\n{{- if .Processed -}}\n{{- $l := len .Processed -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := .Processed -}}\n{{- $e -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if or $elided $isNotLast}}, {{end -}}\n{{- end -}}\n{{- else -}}\n{{- $l := len .Values -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := .Values -}}\n{{- $e.String -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if or $elided $isNotLast}}, {{end -}}\n{{- end -}}\n{{- end -}}\n{{- if $elided}}…{{end -}}\n</span></span>\n{{- end -}}\n{{- /* Accepts a Call */ -}}\n{{- define \"RenderCall\" -}}\n<span class=\"call\"><a href=\"{{srcURL .}}\">{{.SrcName}}:{{.Line}}</a> <span class=\"{{funcClass .}}\">\n<a href=\"{{pkgURL .}}\">{{.Func.PkgName}}.{{.Func.Name}}</a></span>({{template \"RenderArgs\" .Args}})</span>\n{{- if isDebug -}}\n<br>SrcPath: {{.SrcPath}}\n<br>LocalSrcPath: {{.LocalSrcPath}}\n<br>Func: {{.Func.Raw}}\n<br>IsStdlib: {{.IsStdlib}}\n{{- end -}}\n{{- end -}}\n{{- /* Accepts a Stack */ -}}\n{{- define \"RenderCalls\" -}}\n<table class=\"stack\">\n{{- range $i, $e := .Calls -}}\n<tr>\n<td>{{$i}}</td>\n<td>\n<a href=\"{{pkgURL $e}}\">{{$e.Func.PkgName}}</a>\n</td>\n<td>\n<a href=\"{{srcURL $e}}\">{{$e.SrcName}}:{{$e.Line}}</a>\n</td>\n<td>\n<span class=\"{{funcClass $e}}\"><a href=\"{{pkgURL $e}}\">{{$e.Func.Name}}</a></span>({{template \"RenderArgs\" $e.Args}})\n</td>\n</tr>\n{{- end -}}\n{{- if .Elided}}<tr><td>(…)</td><tr>{{end -}}\n</table>\n{{- end -}}\n<meta charset=\"UTF-8\">\n<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n<title>PanicParse</title>\n<link rel=\"shortcut icon\" type=\"image/gif\" href=\"data:image/gif;base64,{{.Favicon}}\"/>\n<style>\n{{- /* Minimal CSS reset */ -}}\n* {\nfont-family: inherit;\nfont-size: 1em;\nmargin: 0;\npadding: 0;\n}\nhtml {\nbox-sizing: border-box;\nfont-size: 62.5%;\n}\n*, *:before, *:after {\nbox-sizing: inherit;\n}\nh1 {\nfont-size: 1.5em;\nmargin-bottom: 0.2em;\nmargin-top: 0.5em;\n}\nh2 {\nfont-size: 1.2em;\nmargin-bottom: 0.2em;\nmargin-top: 0.3em;\n}\nbody {\nfont-size: 1.6em;\nmargin: 2px;\n}\nli {\nmargin-left: 2.5em;\n}\na {\ncolor: inherit;\ntext-decoration: inherit;\n}\nol, ul {\nmargin-bottom: 0.5em;\nmargin-top: 0.5em;\n}\np {\nmargin-bottom: 2em;\n}\ntable.stack {\nmargin: 0.6em;\n}\ntable.stack tr:hover {\nbackground-color: #DDD;\n}\ntable.stack td {\nfont-family: monospace;\npadding: 0.2em 0.4em 0.2em;\n}\n.call {\nfont-family: monospace;\n}\n@media screen and (max-width: 500px) {\nh1 {\nfont-size: 1.3em;\n}\n}\n@media screen and (max-width: 500px) and (orientation: portrait) {\n.args span {\ndisplay: none;\n}\n.args::after {\ncontent: '…';\n}\n}\n.created {\nwhite-space: nowrap;\n}\n.topright {\nfloat: right;\n}\n.button {\nbackground-color: white;\nborder: 2px solid #4CAF50;\ncolor: black;\nmargin: 0.3em;\npadding: 0.6em 1.0em;\ntransition-duration: 0.4s;\n}\n.button:hover {\nbackground-color: #4CAF50;\ncolor: white;\nbox-shadow: 0 12px 16px 0 rgba(0,0,0,0.24), 0 17px 50px 0 rgba(0,0,0,0.19);\n}\n#augment {\ndisplay: none;\n}\n#content {\nwidth: 100%;\n}\n{{- /* Highlights */ -}}\n.FuncStdLibExported {\ncolor: #00B000;\n}\n.FuncStdLib {\ncolor: #006000;\n}\n.FuncMain {\ncolor: #808000;\n}\n.FuncOtherExported {\ncolor: #C00000;\n}\n.FuncOther {\ncolor: #800000;\n}\n.RoutineFirst {\n}\n.Routine {\n}\n</style>\n<script>\nfunction getParamByName(name) {\nlet query = window.location.search.substring(1);\nlet vars = query.split(\"&\");\nfor (let i=0; i<vars.length; i++) {\nlet pair = vars[i].split(\"=\");\nif (pair[0] == name) {\nreturn pair[1];\n}\n}\n}\nfunction ready() {\nif (getParamByName(\"augment\") === undefined) {\ndocument.getElementById(\"augment\").style.display = \"inline\";\n}\n}\n{{- if .Live -}}\ndocument.addEventListener(\"DOMContentLoaded\", ready);\n{{- end -}}}\n</script>\n<div id=\"content\">\n<div class=\"topright\">\n{{- /* Only shown when augment query parameter is not specified */ -}}\n<a class=button id=augment href=\"?augment=1\">Analyse sources</a>\n</div>\n{{- range $i, $e := .Buckets -}}\n{{$l := len $e.IDs}}\n<h1>Signature #{{$i}}: <span class=\"{{routineClass $e}}\">{{$l}} routine{{if ne 1 $l}}s{{end}}: <span class=\"state\">{{$e.State}}</span>\n{{- if $e.SleepMax -}}\n{{- if ne $e.SleepMin $e.SleepMax}} <span class=\"sleep\">[{{$e.SleepMin}}~{{$e.SleepMax}} mins]</span>\n{{- else}} <span class=\"sleep\">[{{$e.SleepMax}} mins]</span>\n{{- end -}}\n{{- end -}}\n</h1>\n{{if $e.Locked}} <span class=\"locked\">[locked]</span>\n{{- end -}}\n{{- if $e.CreatedBy.Func.Raw}} <span class=\"created\">Created by: {{template \"RenderCall\" $e.CreatedBy}}</span>\n{{- end -}}\n{{template \"RenderCalls\" $e.Signature.Stack}}\n{{- end -}}\n</div>\n<p>\n<div id=\"legend\">\nCreated on {{.Now.String}}:\n<ul>\n<li>{{.Version}}</li>\n<li>GOROOT: {{.GOROOT}}</li>\n<li>GOPATH: {{.GOPATH}}</li>\n<li>GOMAXPROCS: {{.GOMAXPROCS}}</li>\n{{- if .NeedsEnv -}}\n<li>To see all goroutines, visit <a\nhref=https://github.com/maruel/panicparse#gotraceback>github.com/maruel/panicparse</a></li>\n{{- end -}}\n</ul>\n</div>\n"
+const indexHTML = "<!DOCTYPE html>\n{{- /* Accepts a Args */ -}}\n{{- define \"RenderArgs\" -}}\n<span class=\"args\"><span>\n{{- $elided := .Elided -}}\n{{- if argsFormat -}}\n{{- .Format (argsFormat) -}}\n{{- else if .Processed -}}\n{{- $l := len .Processed -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := .Processed -}}\n{{- $e -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if or $elided $isNotLast}}, {{end -}}\n{{- end -}}\n{{- else -}}\n{{- $l := len .Values -}}\n{{- $last := minus $l 1 -}}\n{{- range $i, $e := .Values -}}\n{{- $e.String -}}\n{{- $isNotLast := ne $i $last -}}\n{{- if or $elided $isNotLast}}, {{end -}}\n{{- end -}}\n{{- end -}}\n{{- if and $elided (not argsFormat)}}…{{end -}}\n</span></span>\n{{- end -}}\n{{- /* Accepts a Call */ -}}\n{{- define \"RenderCall\" -}}\n<span class=\"call\"><a href=\"{{srcURL .}}\">{{.SrcName}}:{{.Line}}</a> <span class=\"{{funcClass .}}\">\n<a href=\"{{pkgURL .}}\">{{.Func.PkgName}}.{{.Func.Name}}</a></span>({{template \"RenderArgs\" .Args}})</span>\n{{- if isDebug -}}\n<br>SrcPath: {{.SrcPath}}\n<br>LocalSrcPath: {{.LocalSrcPath}}\n<br>Func: {{.Func.Raw}}\n<br>IsStdlib: {{.IsStdlib}}\n{{- end -}}\n{{- end -}}\n{{- /* Accepts a Stack */ -}}\n{{- define \"RenderCalls\" -}}\n<table class=\"stack\">\n{{- range $i, $e := .Calls -}}\n<tr>\n<td>{{$i}}</td>\n<td>\n<a href=\"{{pkgURL $e}}\">{{$e.Func.PkgName}}</a>\n</td>\n<td>\n<a href=\"{{srcURL $e}}\">{{$e.SrcName}}:{{$e.Line}}</a>\n</td>\n<td>\n<span class=\"{{funcClass $e}}\"><a href=\"{{pkgURL $e}}\">{{$e.Func.Name}}</a></span>({{template \"RenderArgs\" $e.Args}})\n{{- if $e.Inlined}} <span class=\"inlined\" title=\"Inlined in the next call\">[inlined]</span>{{end}}\n</td>\n</tr>\n{{- with snippet $e -}}\n<tr class=\"src\">\n<td></td>\n<td colspan=\"3\">\n<details><summary>Source</summary><pre>\n{{- range . -}}\n<span{{if .Current}} class=\"current\"{{end}}>{{printf \"%5d\" .Line}}  {{.Text}}</span>{{\"\\n\"}}\n{{- end -}}\n</pre></details>\n</td>\n</tr>\n{{- end -}}\n{{- end -}}\n{{- if .Elided}}<tr><td>(…)</td><tr>{{end -}}\n</table>\n{{- end -}}\n{{- /* Accepts a creationNode */ -}}\n{{- define \"RenderCreation\" -}}\n<details open><summary>\n{{- with .CreatedBy}}Created by {{template \"RenderCall\" .}}{{else}}No creator{{end}}: {{.Count}} routine{{if ne 1 .Count}}s{{end -}}\n</summary>\n<ul>\n{{- range .Buckets -}}\n{{- $l := len .IDs}}\n<li><a class=\"bucketid\" href=\"#{{.ShortID}}\" onclick=\"showTab('goroutines')\">[{{.ShortID}}]</a> {{$l}} routine{{if ne 1 $l}}s{{end}}: <span class=\"state\">{{.State}}</span>\n{{- with .Stack.Calls}} <span class=\"call\">{{(index . 0).Func.PkgDotName}}</span>{{end -}}\n</li>\n{{- end -}}\n{{- range .Children}}\n<li>{{template \"RenderCreation\" .}}</li>\n{{- end -}}\n</ul>\n</details>\n{{- end -}}\n<meta charset=\"UTF-8\">\n<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n<title>{{block \"title\" .}}PanicParse{{end}}</title>\n<link rel=\"shortcut icon\" type=\"image/gif\" href=\"data:image/gif;base64,{{.Favicon}}\"/>\n<style>\n{{- block \"style\" . -}}\n{{- /* Minimal CSS reset */ -}}\n* {\nfont-family: inherit;\nfont-size: 1em;\nmargin: 0;\npadding: 0;\n}\nhtml {\nbox-sizing: border-box;\nfont-size: 62.5%;\n}\n*, *:before, *:after {\nbox-sizing: inherit;\n}\nh1 {\nfont-size: 1.5em;\nmargin-bottom: 0.2em;\nmargin-top: 0.5em;\n}\nh2 {\nfont-size: 1.2em;\nmargin-bottom: 0.2em;\nmargin-top: 0.3em;\n}\nbody {\nfont-size: 1.6em;\nmargin: 2px;\n}\nli {\nmargin-left: 2.5em;\n}\na {\ncolor: inherit;\ntext-decoration: inherit;\n}\nol, ul {\nmargin-bottom: 0.5em;\nmargin-top: 0.5em;\n}\np {\nmargin-bottom: 2em;\n}\ntable.stack {\nmargin: 0.6em;\n}\ntable.stack tr:hover {\nbackground-color: #DDD;\n}\ntable.stack td {\nfont-family: monospace;\npadding: 0.2em 0.4em 0.2em;\n}\n.call {\nfont-family: monospace;\n}\ntr.src pre {\ncolor: #808080;\nfont-family: monospace;\n}\ntr.src .current {\ncolor: black;\nfont-weight: bold;\n}\n@media screen and (max-width: 500px) {\nh1 {\nfont-size: 1.3em;\n}\n}\n@media screen and (max-width: 500px) and (orientation: portrait) {\n.args span {\ndisplay: none;\n}\n.args::after {\ncontent: '…';\n}\n}\n.created {\nwhite-space: nowrap;\n}\n.annotation, .inlined {\ncolor: #808080;\nfont-size: 0.8em;\n}\n.pprof {\nfont-size: 0.6em;\n}\n.pprof a {\ncolor: #0000C0;\n}\n.errors {\ncolor: #C00000;\n}\n.bucketid {\ncolor: #808080;\nfont-family: monospace;\n}\n.topright {\nfloat: right;\n}\n.button {\nbackground-color: white;\nborder: 2px solid #4CAF50;\ncolor: black;\nmargin: 0.3em;\npadding: 0.6em 1.0em;\ntransition-duration: 0.4s;\n}\n.button:hover {\nbackground-color: #4CAF50;\ncolor: white;\nbox-shadow: 0 12px 16px 0 rgba(0,0,0,0.24), 0 17px 50px 0 rgba(0,0,0,0.19);\n}\n#augment {\ndisplay: none;\n}\n#content {\nwidth: 100%;\n}\n.bucket > summary {\ncursor: pointer;\n}\n.bucket > summary h1 {\ndisplay: inline-block;\n}\n#flamegraph, #creation {\ndisplay: none;\n}\n#creation {\nmargin: 0.6em;\n}\n#creation ul {\nlist-style: none;\n}\n#creation summary {\ncursor: pointer;\n}\n#flame {\nmargin: 0.6em;\nposition: relative;\n}\n#flame div {\nborder: 1px solid white;\ncursor: pointer;\nfont-family: monospace;\nfont-size: 0.8em;\nheight: 1.8em;\noverflow: hidden;\npadding: 0.2em;\nposition: absolute;\nwhite-space: nowrap;\n}\n{{- /* Highlights */ -}}\n.FuncStdLibExported {\ncolor: #00B000;\n}\n.FuncStdLib {\ncolor: #006000;\n}\n.FuncMain {\ncolor: #808000;\n}\n.FuncOtherExported {\ncolor: #C00000;\n}\n.FuncOther {\ncolor: #800000;\n}\n.RoutineFirst {\n}\n.Routine {\n}\n{{- end -}}\n</style>\n{{- block \"head\" . -}}{{- end -}}\n<script>\nconst flame = {{flameGraph .Buckets}};\nfunction showTab(name) {\nlet tabs = {goroutines: \"content\", flamegraph: \"flamegraph\", creation: \"creation\"};\nfor (let t in tabs) {\ndocument.getElementById(tabs[t]).style.display = t == name ? \"block\" : \"none\";\n}\nif (name == \"flamegraph\") {\ndrawFlame(flame);\n}\n}\nfunction frameColor(name) {\nlet h = 0;\nfor (let i=0; i<name.length; i++) {\nh = (h * 31 + name.charCodeAt(i)) % 360;\n}\nreturn \"hsl(\" + (h % 55) + \", 80%, \" + (60 + h % 20) + \"%)\";\n}\n{{/* Draws the graph rooted at root, the outermost calls at the top. Clicking a\nframe zooms on it. */}}\nfunction drawFlame(root) {\nlet div = document.getElementById(\"flame\");\ndiv.innerHTML = \"\";\nif (!root.v) {\nreturn;\n}\nlet maxDepth = 0;\nlet add = function(node, x, depth) {\nif (node.v / root.v < 0.001) {\nreturn;\n}\nlet e = document.createElement(\"div\");\ne.style.left = (100 * x / root.v) + \"%\";\ne.style.width = (100 * node.v / root.v) + \"%\";\ne.style.top = (2 * depth) + \"em\";\ne.style.backgroundColor = frameColor(node.n);\ne.textContent = node.n;\ne.title = node.n + \": \" + node.v + \" routine\" + (node.v == 1 ? \"\" : \"s\") + \" (\" + (100 * node.v / flame.v).toFixed(1) + \"%)\";\ne.onclick = function() { drawFlame(node); };\ndiv.appendChild(e);\nmaxDepth = Math.max(maxDepth, depth);\nfor (let c of node.c || []) {\nadd(c, x, depth + 1);\nx += c.v;\n}\n};\nadd(root, 0, 0);\ndiv.style.height = (2 * (maxDepth + 1)) + \"em\";\n}\nfunction getParamByName(name) {\nlet query = window.location.search.substring(1);\nlet vars = query.split(\"&\");\nfor (let i=0; i<vars.length; i++) {\nlet pair = vars[i].split(\"=\");\nif (pair[0] == name) {\nreturn pair[1];\n}\n}\n}\nfunction ready() {\nif (getParamByName(\"augment\") === undefined) {\ndocument.getElementById(\"augment\").style.display = \"inline\";\n}\n}\n{{/* The IDs of the collapsed buckets are remembered across page loads. The\nbucket IDs are stable across snapshots of the same executable. */}}\nfunction getCollapsed() {\ntry {\nreturn JSON.parse(window.localStorage.getItem(\"panicparse.collapsed\")) || {};\n} catch (e) {\nreturn {};\n}\n}\nfunction setCollapsed(id, collapsed) {\nlet c = getCollapsed();\nif (collapsed) {\nc[id] = true;\n} else {\ndelete c[id];\n}\ntry {\nwindow.localStorage.setItem(\"panicparse.collapsed\", JSON.stringify(c));\n} catch (e) {\n}\n}\nfunction restoreState() {\nlet c = getCollapsed();\nlet hash = window.location.hash.substring(1);\nfor (let e of document.querySelectorAll(\"details.bucket\")) {\nlet id = e.dataset.id;\n{{/* Always expand the bucket linked to. */}}\nif (c[id] && id != hash) {\ne.open = false;\n}\ne.addEventListener(\"toggle\", function() { setCollapsed(id, !e.open); });\n}\nif (hash == \"flamegraph\" || hash == \"creation\") {\nshowTab(hash);\n} else if (hash) {\nshowBucket(hash);\n}\nwindow.addEventListener(\"hashchange\", function() {\nshowBucket(window.location.hash.substring(1));\n});\n}\nfunction showBucket(id) {\nlet e = document.querySelector(\"details.bucket[data-id='\" + id + \"']\");\nif (e) {\ne.open = true;\ne.scrollIntoView();\n}\n}\ndocument.addEventListener(\"DOMContentLoaded\", restoreState);\n{{- if .Live -}}\ndocument.addEventListener(\"DOMContentLoaded\", ready);\n{{- end -}}\n</script>\n{{- block \"header\" . -}}{{- end -}}\n{{- if .Errors -}}\n<ul class=\"errors\">\n{{- range .Errors -}}\n<li>{{.}}</li>\n{{- end -}}\n</ul>\n{{- end -}}\n<div class=\"topright\">\n<a class=button href=\"#\" onclick=\"showTab('goroutines')\">Goroutines</a>\n<a class=button href=\"#flamegraph\" onclick=\"showTab('flamegraph')\">Flamegraph</a>\n<a class=button href=\"#creation\" onclick=\"showTab('creation')\">Creation tree</a>\n{{- /* Only shown when augment query parameter is not specified */ -}}\n<a class=button id=augment href=\"?augment=1\">Analyse sources</a>\n</div>\n<div id=\"flamegraph\">\n<a class=button href=\"#flamegraph\" onclick=\"drawFlame(flame)\">Reset zoom</a>\n<div id=\"flame\"></div>\n</div>\n<div id=\"creation\">\n{{- range creationTree .Buckets}}\n{{template \"RenderCreation\" .}}\n{{- end}}\n</div>\n<div id=\"content\">\n{{- range $i, $e := .Buckets -}}\n{{$l := len $e.IDs}}\n{{- $id := $e.ShortID}}\n<details class=\"bucket\" data-id=\"{{$id}}\" open><summary>\n<h1 id=\"{{$id}}\">Signature #{{$i}} <a class=\"bucketid\" href=\"#{{$id}}\">[{{$id}}]</a>: <span class=\"{{routineClass $e}}\">{{$l}} routine{{if ne 1 $l}}s{{end}}: <span class=\"state\">{{$e.State}}</span>\n{{- if $e.SleepMax -}}\n{{- if ne $e.SleepMin $e.SleepMax}} <span class=\"sleep\">[{{$e.SleepMin}}~{{$e.SleepMax}} mins]</span>\n{{- else}} <span class=\"sleep\">[{{$e.SleepMax}} mins]</span>\n{{- end -}}\n{{- end -}}\n{{- with annotate $e}} <span class=\"annotation\">({{.}})</span>{{end -}}\n{{- with $.Pprof}} <span class=\"pprof\">\n{{- range pprofLinks . $e}} <a href=\"{{.URL}}\">{{.Name}}</a>{{end -}}\n</span>{{end -}}\n</h1></summary>\n{{if $e.Locked}} <span class=\"locked\">[locked]</span>\n{{- end -}}\n{{- if $e.CreatedBy.Func.Raw}} <span class=\"created\">Created by: {{template \"RenderCall\" $e.CreatedBy}}</span>\n{{- end -}}\n{{template \"RenderCalls\" $e.Signature.Stack}}\n</details>\n{{- end -}}\n</div>\n<p>\n<div id=\"legend\">\nCreated on {{.Now.String}}:\n<ul>\n<li>{{.Version}}</li>\n<li>GOROOT: {{.GOROOT}}</li>\n<li>GOPATH: {{.GOPATH}}</li>\n<li>GOMAXPROCS: {{.GOMAXPROCS}}</li>\n{{- if .NeedsEnv -}}\n<li>To see all goroutines, visit <a\nhref=https://github.com/maruel/panicparse#gotraceback>github.com/maruel/panicparse</a></li>\n{{- end -}}\n</ul>\n</div>\n{{- block \"footer\" . -}}{{- end -}}\n"
 
 // favicon is the bomb emoji U+1F4A3 in Noto Emoji as a 128x128 base64 encoded
 // PNG.
@@ -4,7 +4,9 @@
 {{- define "RenderArgs" -}}
   <span class="args"><span>
   {{- $elided := .Elided -}}
-  {{- if .Processed -}}
+  {{- if argsFormat -}}
+    {{- .Format (argsFormat) -}}
+  {{- else if .Processed -}}
     {{- $l := len .Processed -}}
     {{- $last := minus $l 1 -}}
     {{- range $i, $e := .Processed -}}
@@ -21,7 +23,7 @@
       {{- if or $elided $isNotLast}}, {{end -}}
     {{- end -}}
   {{- end -}}
-  {{- if $elided}}…{{end -}}
+  {{- if and $elided (not argsFormat)}}…{{end -}}
   </span></span>
 {{- end -}}
 
@@ -51,18 +53,51 @@
         </td>
         <td>
           <span class="{{funcClass $e}}"><a href="{{pkgURL $e}}">{{$e.Func.Name}}</a></span>({{template "RenderArgs" $e.Args}})
+          {{- if $e.Inlined}} <span class="inlined" title="Inlined in the next call">[inlined]</span>{{end}}
         </td>
       </tr>
+      {{- with snippet $e -}}
+      <tr class="src">
+        <td></td>
+        <td colspan="3">
+          <details><summary>Source</summary><pre>
+          {{- range . -}}
+            <span{{if .Current}} class="current"{{end}}>{{printf "%5d" .Line}}  {{.Text}}</span>{{"\n"}}
+          {{- end -}}
+          </pre></details>
+        </td>
+      </tr>
+      {{- end -}}
     {{- end -}}
     {{- if .Elided}}<tr><td>(…)</td><tr>{{end -}}
   </table>
 {{- end -}}
 
+{{- /* Accepts a creationNode */ -}}
+{{- define "RenderCreation" -}}
+  <details open><summary>
+  {{- with .CreatedBy}}Created by {{template "RenderCall" .}}{{else}}No creator{{end}}: {{.Count}} routine{{if ne 1 .Count}}s{{end -}}
+  </summary>
+  <ul>
+    {{- range .Buckets -}}
+      {{- $l := len .IDs}}
+      <li><a class="bucketid" href="#{{.ShortID}}" onclick="showTab('goroutines')">[{{.ShortID}}]</a> {{$l}} routine{{if ne 1 $l}}s{{end}}: <span class="state">{{.State}}</span>
+      {{- with .Stack.Calls}} <span class="call">{{(index . 0).Func.PkgDotName}}</span>{{end -}}
+      </li>
+    {{- end -}}
+    {{- range .Children}}
+      <li>{{template "RenderCreation" .}}</li>
+    {{- end -}}
+  </ul>
+  </details>
+{{- end -}}
+
 <meta charset="UTF-8">
 <meta name="viewport" content="width=device-width, initial-scale=1">
-<title>PanicParse</title>
+<title>{{block "title" .}}PanicParse{{end}}</title>
 <link rel="shortcut icon" type="image/gif" href="data:image/gif;base64,{{.Favicon}}"/>
 <style>
+{{- block "style" . -}}
   {{- /* Minimal CSS reset */ -}}
   * {
     font-family: inherit;
@@ -118,6 +153,14 @@
   .call {
     font-family: monospace;
   }
+  tr.src pre {
+    color: #808080;
+    font-family: monospace;
+  }
+  tr.src .current {
+    color: black;
+    font-weight: bold;
+  }
   @media screen and (max-width: 500px) {
     h1 {
       font-size: 1.3em;
@@ -134,6 +177,23 @@
   .created {
     white-space: nowrap;
   }
+  .annotation, .inlined {
+    color: #808080;
+    font-size: 0.8em;
+  }
+  .pprof {
+    font-size: 0.6em;
+  }
+  .pprof a {
+    color: #0000C0;
+  }
+  .errors {
+    color: #C00000;
+  }
+  .bucketid {
+    color: #808080;
+    font-family: monospace;
+  }
   .topright {
     float: right;
   }
@@ -156,6 +216,39 @@
   #content {
     width: 100%;
   }
+  .bucket > summary {
+    cursor: pointer;
+  }
+  .bucket > summary h1 {
+    display: inline-block;
+  }
+  #flamegraph, #creation {
+    display: none;
+  }
+  #creation {
+    margin: 0.6em;
+  }
+  #creation ul {
+    list-style: none;
+  }
+  #creation summary {
+    cursor: pointer;
+  }
+  #flame {
+    margin: 0.6em;
+    position: relative;
+  }
+  #flame div {
+    border: 1px solid white;
+    cursor: pointer;
+    font-family: monospace;
+    font-size: 0.8em;
+    height: 1.8em;
+    overflow: hidden;
+    padding: 0.2em;
+    position: absolute;
+    white-space: nowrap;
+  }
 
   {{- /* Highlights */ -}}
   .FuncStdLibExported {
@@ -177,8 +270,58 @@
   }
   .Routine {
   }
+{{- end -}}
 </style>
+{{- block "head" . -}}{{- end -}}
 <script>
+const flame = {{flameGraph .Buckets}};
+function showTab(name) {
+  let tabs = {goroutines: "content", flamegraph: "flamegraph", creation: "creation"};
+  for (let t in tabs) {
+    document.getElementById(tabs[t]).style.display = t == name ? "block" : "none";
+  }
+  if (name == "flamegraph") {
+    drawFlame(flame);
+  }
+}
+function frameColor(name) {
+  let h = 0;
+  for (let i=0; i<name.length; i++) {
+    h = (h * 31 + name.charCodeAt(i)) % 360;
+  }
+  return "hsl(" + (h % 55) + ", 80%, " + (60 + h % 20) + "%)";
+}
+{{/* Draws the graph rooted at root, the outermost calls at the top. Clicking a
+     frame zooms on it. */}}
+function drawFlame(root) {
+  let div = document.getElementById("flame");
+  div.innerHTML = "";
+  if (!root.v) {
+    return;
+  }
+  let maxDepth = 0;
+  let add = function(node, x, depth) {
+    if (node.v / root.v < 0.001) {
+      return;
+    }
+    let e = document.createElement("div");
+    e.style.left = (100 * x / root.v) + "%";
+    e.style.width = (100 * node.v / root.v) + "%";
+    e.style.top = (2 * depth) + "em";
+    e.style.backgroundColor = frameColor(node.n);
+    e.textContent = node.n;
+    e.title = node.n + ": " + node.v + " routine" + (node.v == 1 ? "" : "s") + " (" + (100 * node.v / flame.v).toFixed(1) + "%)";
+    e.onclick = function() { drawFlame(node); };
+    div.appendChild(e);
+    maxDepth = Math.max(maxDepth, depth);
+    for (let c of node.c || []) {
+      add(c, x, depth + 1);
+      x += c.v;
+    }
+  };
+  add(root, 0, 0);
+  div.style.height = (2 * (maxDepth + 1)) + "em";
+}
 function getParamByName(name) {
   let query = window.location.search.substring(1);
   let vars = query.split("&");
@@ -194,29 +337,105 @@ function ready() {
     document.getElementById("augment").style.display = "inline";
   }
 }
+{{/* The IDs of the collapsed buckets are remembered across page loads. The
+     bucket IDs are stable across snapshots of the same executable. */}}
+function getCollapsed() {
+  try {
+    return JSON.parse(window.localStorage.getItem("panicparse.collapsed")) || {};
+  } catch (e) {
+    return {};
+  }
+}
+function setCollapsed(id, collapsed) {
+  let c = getCollapsed();
+  if (collapsed) {
+    c[id] = true;
+  } else {
+    delete c[id];
+  }
+  try {
+    window.localStorage.setItem("panicparse.collapsed", JSON.stringify(c));
+  } catch (e) {
+  }
+}
+function restoreState() {
+  let c = getCollapsed();
+  let hash = window.location.hash.substring(1);
+  for (let e of document.querySelectorAll("details.bucket")) {
+    let id = e.dataset.id;
+    {{/* Always expand the bucket linked to. */}}
+    if (c[id] && id != hash) {
+      e.open = false;
+    }
+    e.addEventListener("toggle", function() { setCollapsed(id, !e.open); });
+  }
+  if (hash == "flamegraph" || hash == "creation") {
+    showTab(hash);
+  } else if (hash) {
+    showBucket(hash);
+  }
+  window.addEventListener("hashchange", function() {
+    showBucket(window.location.hash.substring(1));
+  });
+}
+function showBucket(id) {
+  let e = document.querySelector("details.bucket[data-id='" + id + "']");
+  if (e) {
+    e.open = true;
+    e.scrollIntoView();
+  }
+}
+document.addEventListener("DOMContentLoaded", restoreState);
 {{- if .Live -}}
 document.addEventListener("DOMContentLoaded", ready);
-{{- end -}}}
+{{- end -}}
 </script>
+{{- block "header" . -}}{{- end -}}
+{{- if .Errors -}}
+  <ul class="errors">
+  {{- range .Errors -}}
+    <li>{{.}}</li>
+  {{- end -}}
+  </ul>
+{{- end -}}
+<div class="topright">
+  <a class=button href="#" onclick="showTab('goroutines')">Goroutines</a>
+  <a class=button href="#flamegraph" onclick="showTab('flamegraph')">Flamegraph</a>
+  <a class=button href="#creation" onclick="showTab('creation')">Creation tree</a>
+  {{- /* Only shown when augment query parameter is not specified */ -}}
+  <a class=button id=augment href="?augment=1">Analyse sources</a>
+</div>
+<div id="flamegraph">
+  <a class=button href="#flamegraph" onclick="drawFlame(flame)">Reset zoom</a>
+  <div id="flame"></div>
+</div>
+<div id="creation">
+  {{- range creationTree .Buckets}}
+  {{template "RenderCreation" .}}
+  {{- end}}
+</div>
 <div id="content">
-  <div class="topright">
-    {{- /* Only shown when augment query parameter is not specified */ -}}
-    <a class=button id=augment href="?augment=1">Analyse sources</a>
-  </div>
   {{- range $i, $e := .Buckets -}}
     {{$l := len $e.IDs}}
-    <h1>Signature #{{$i}}: <span class="{{routineClass $e}}">{{$l}} routine{{if ne 1 $l}}s{{end}}: <span class="state">{{$e.State}}</span>
+    {{- $id := $e.ShortID}}
+    <details class="bucket" data-id="{{$id}}" open><summary>
+    <h1 id="{{$id}}">Signature #{{$i}} <a class="bucketid" href="#{{$id}}">[{{$id}}]</a>: <span class="{{routineClass $e}}">{{$l}} routine{{if ne 1 $l}}s{{end}}: <span class="state">{{$e.State}}</span>
     {{- if $e.SleepMax -}}
       {{- if ne $e.SleepMin $e.SleepMax}} <span class="sleep">[{{$e.SleepMin}}~{{$e.SleepMax}} mins]</span>
       {{- else}} <span class="sleep">[{{$e.SleepMax}} mins]</span>
       {{- end -}}
     {{- end -}}
-    </h1>
+    {{- with annotate $e}} <span class="annotation">({{.}})</span>{{end -}}
+    {{- with $.Pprof}} <span class="pprof">
+      {{- range pprofLinks . $e}} <a href="{{.URL}}">{{.Name}}</a>{{end -}}
+    </span>{{end -}}
+    </h1></summary>
     {{if $e.Locked}} <span class="locked">[locked]</span>
     {{- end -}}
     {{- if $e.CreatedBy.Func.Raw}} <span class="created">Created by: {{template "RenderCall" $e.CreatedBy}}</span>
     {{- end -}}
     {{template "RenderCalls" $e.Signature.Stack}}
+    </details>
   {{- end -}}
 </div>
 <p>
@@ -233,3 +452,4 @@ document.addEventListener("DOMContentLoaded", ready);
     {{- end -}}
   </ul>
 </div>
+{{- block "footer" . -}}{{- end -}}
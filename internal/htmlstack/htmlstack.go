@@ -15,42 +15,90 @@ import (
 	"os"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/maruel/panicparse/internal/snippet"
 	"github.com/maruel/panicparse/stack"
 )
 
+// Template returns the template set of the page.
+//
+// The following templates can be redefined with Parse() to customize the
+// page:
+//   - "title": the page title.
+//   - "style": the CSS.
+//   - "head": additional content of <head>, e.g. a stylesheet. Empty by
+//     default.
+//   - "header": content shown before the buckets, e.g. branding. Empty by
+//     default.
+//   - "footer": content shown after the legend. Empty by default.
+func Template() *template.Template {
+	m := funcs(nil, nil, nil, nil)
+	return template.Must(template.New("t").Funcs(m).Parse(indexHTML))
+}
+
+// Opts is the options to write the page.
+type Opts struct {
+	// NeedsEnv adds a notice to set GOTRACEBACK=all.
+	NeedsEnv bool
+	// Live enables the controls that need a live process, e.g. to analyse the
+	// sources.
+	Live bool
+	// Src is the number of source lines shown around each call in an
+	// expandable section, when the source file is found locally. 0 disables
+	// it.
+	Src int
+	// Annotate returns a text shown next to the bucket header, e.g. the
+	// number of goroutines per host. It can be nil.
+	Annotate func(b *stack.Bucket) string
+	// Errors is shown at the top of the page, e.g. the hosts that couldn't be
+	// reached.
+	Errors []string
+	// Pprof is the base path of the net/http/pprof handlers, e.g.
+	// "/debug/pprof/". When set, each bucket links to the profiles relevant
+	// to its state.
+	Pprof string
+	// Args controls how the arguments are rendered. The zero value renders
+	// them as is.
+	Args stack.ArgsFormat
+}
+
 // Write writes buckets as HTML to the writer.
-func Write(w io.Writer, buckets []*stack.Bucket, needsEnv, live bool) error {
-	m := template.FuncMap{
-		"funcClass": funcClass,
-		"minus":     minus,
-		"pkgURL":    pkgURL,
-		"srcURL":    srcURL,
-		"symbol":    symbol,
-		// Needs to be a function and not a variable, otherwise it is not
-		// accessible inside inner templates.
-		"isDebug": isDebug,
-	}
-	if len(buckets) > 1 {
-		m["routineClass"] = routineClass
-	} else {
-		m["routineClass"] = func(bucket *stack.Bucket) template.HTML { return "Routine" }
-	}
-	t, err := template.New("t").Funcs(m).Parse(indexHTML)
+//
+// src is the number of source lines shown around each call in an expandable
+// section, when the source file is found locally. 0 disables it.
+func Write(w io.Writer, buckets []*stack.Bucket, needsEnv, live bool, src int) error {
+	return WriteTemplate(w, Template(), buckets, &Opts{NeedsEnv: needsEnv, Live: live, Src: src})
+}
+
+// WriteTemplate is like Write except that it uses t as returned by Template(),
+// possibly customized.
+//
+// t is not modified, so it can be reused.
+func WriteTemplate(w io.Writer, t *template.Template, buckets []*stack.Bucket, o *Opts) error {
+	// Clone to not execute t, so it can still be customized and reused.
+	t, err := t.Clone()
 	if err != nil {
 		return err
 	}
+	var args *stack.ArgsFormat
+	if o.Args != (stack.ArgsFormat{}) {
+		args = &o.Args
+	}
+	t.Funcs(funcs(buckets, snippet.New(o.Src), o.Annotate, args))
 	data := map[string]interface{}{
 		"Buckets":    buckets,
 		"Favicon":    favicon,
 		"GOMAXPROCS": runtime.GOMAXPROCS(0),
 		"GOPATH":     os.Getenv("GOPATH"),
 		"GOROOT":     runtime.GOROOT(),
-		"Live":       live,
-		"NeedsEnv":   needsEnv,
+		"Errors":     o.Errors,
+		"Live":       o.Live,
+		"NeedsEnv":   o.NeedsEnv,
 		"Now":        time.Now().Truncate(time.Second),
+		"Pprof":      o.Pprof,
 		"Version":    runtime.Version(),
 	}
 	if isDebug() {
@@ -58,6 +106,35 @@ func Write(w io.Writer, buckets []*stack.Bucket, needsEnv, live bool) error {
 	return t.Execute(w, data)
 }
 
+// funcs returns the functions used by the template.
+func funcs(buckets []*stack.Bucket, s *snippet.Reader, annotate func(b *stack.Bucket) string, args *stack.ArgsFormat) template.FuncMap {
+	if annotate == nil {
+		annotate = func(b *stack.Bucket) string { return "" }
+	}
+	m := template.FuncMap{
+		"annotate":     annotate,
+		"argsFormat":   func() *stack.ArgsFormat { return args },
+		"creationTree": creationTree,
+		"flameGraph":   flameGraph,
+		"funcClass":    funcClass,
+		"minus":        minus,
+		"pkgURL":       pkgURL,
+		"pprofLinks":   pprofLinks,
+		"snippet":      s.Get,
+		"srcURL":       srcURL,
+		"symbol":       symbol,
+		// Needs to be a function and not a variable, otherwise it is not
+		// accessible inside inner templates.
+		"isDebug": isDebug,
+	}
+	if len(buckets) > 1 {
+		m["routineClass"] = routineClass
+	} else {
+		m["routineClass"] = func(bucket *stack.Bucket) template.HTML { return "Routine" }
+	}
+	return m
+}
+
 //
 
 var reMethodSymbol = regexp.MustCompile(`^\(\*?([^)]+)\)(\..+)$`)
@@ -242,6 +319,131 @@ func symbol(f *stack.Func) template.URL {
 	return template.URL(url.QueryEscape(s))
 }
 
+// pprofLink is a link to a net/http/pprof profile.
+type pprofLink struct {
+	Name string
+	// URL is a string and not a template.URL so it is sanitized.
+	URL string
+}
+
+// pprofLinks returns the links to the profiles relevant to the state of the
+// bucket: the goroutines always, the contention profiles when blocked and the
+// CPU profile when running.
+func pprofLinks(base string, b *stack.Bucket) []pprofLink {
+	out := []pprofLink{{"goroutine", base + "goroutine?debug=1"}}
+	switch st := b.State; {
+	case st == "semacquire" || strings.HasPrefix(st, "sync.Mutex") || strings.HasPrefix(st, "sync.RWMutex"):
+		out = append(out, pprofLink{"mutex", base + "mutex?debug=1"}, pprofLink{"block", base + "block?debug=1"})
+	case strings.HasPrefix(st, "chan ") || st == "select" || strings.HasPrefix(st, "sync.Cond"):
+		out = append(out, pprofLink{"block", base + "block?debug=1"})
+	case st == "running" || st == "runnable":
+		out = append(out, pprofLink{"profile", base + "profile?seconds=30"})
+	}
+	return out
+}
+
+// flameNode is a node of the flame graph: a function and the number of
+// goroutines going through it. The JSON names are short to keep the page
+// small.
+type flameNode struct {
+	Name     string       `json:"n"`
+	Value    int          `json:"v"`
+	Children []*flameNode `json:"c,omitempty"`
+}
+
+// child returns the child node for the function, creating it if needed.
+func (f *flameNode) child(name string) *flameNode {
+	for _, c := range f.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &flameNode{Name: name}
+	f.Children = append(f.Children, c)
+	return c
+}
+
+// sort sorts the children by name recursively, like folded stacks are.
+func (f *flameNode) sort() {
+	sort.Slice(f.Children, func(i, j int) bool { return f.Children[i].Name < f.Children[j].Name })
+	for _, c := range f.Children {
+		c.sort()
+	}
+}
+
+// flameGraph folds the calls of the buckets into a tree starting from the
+// outermost call, weighted by the number of goroutines. It is rendered by the
+// page's javascript.
+func flameGraph(buckets []*stack.Bucket) *flameNode {
+	root := &flameNode{Name: "all"}
+	for _, b := range buckets {
+		n := len(b.IDs)
+		root.Value += n
+		node := root
+		for i := len(b.Stack.Calls) - 1; i >= 0; i-- {
+			node = node.child(b.Stack.Calls[i].Func.PkgDotName())
+			node.Value += n
+		}
+	}
+	root.sort()
+	return root
+}
+
+// creationNode is a node of the creation tree: the buckets created by the
+// same call site, along with the buckets they created in turn.
+type creationNode struct {
+	// CreatedBy is nil for the buckets without a creator, e.g. the main
+	// goroutine.
+	CreatedBy *stack.Call
+	Buckets   []*stack.Bucket
+	Children  []*creationNode
+	// Count is the number of goroutines in this node and all its descendants.
+	Count int
+}
+
+// creationTree organizes the buckets as a forest keyed by the call site that
+// created them, as stack.Context.Ancestry() does for goroutines.
+func creationTree(buckets []*stack.Bucket) []*creationNode {
+	// Use one goroutine per ID of each bucket, so the goroutines are linked to
+	// the bucket of their creator, and to find back the bucket.
+	c := &stack.Context{}
+	byGoroutine := map[*stack.Goroutine]*stack.Bucket{}
+	for _, b := range buckets {
+		for _, id := range b.IDs {
+			g := &stack.Goroutine{Signature: b.Signature, ID: id}
+			byGoroutine[g] = b
+			c.Goroutines = append(c.Goroutines, g)
+		}
+	}
+	var convert func(n *stack.AncestryNode) *creationNode
+	convert = func(n *stack.AncestryNode) *creationNode {
+		out := &creationNode{}
+		if n.CreatedBy.Func.Raw != "" {
+			out.CreatedBy = &n.CreatedBy
+		}
+		for _, g := range n.Goroutines {
+			b := byGoroutine[g]
+			if l := len(out.Buckets); l != 0 && out.Buckets[l-1] == b {
+				continue
+			}
+			out.Buckets = append(out.Buckets, b)
+			out.Count += len(b.IDs)
+		}
+		for _, child := range n.Children {
+			cn := convert(child)
+			out.Children = append(out.Children, cn)
+			out.Count += cn.Count
+		}
+		return out
+	}
+	roots := c.Ancestry()
+	out := make([]*creationNode, 0, len(roots))
+	for _, n := range roots {
+		out = append(out, convert(n))
+	}
+	return out
+}
+
 func routineClass(bucket *stack.Bucket) template.HTML {
 	if bucket.First {
 		return "RoutineFirst"
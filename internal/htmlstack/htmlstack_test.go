@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"html/template"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
 	"strings"
@@ -20,13 +23,13 @@ import (
 
 func TestWrite2Buckets(t *testing.T) {
 	buf := bytes.Buffer{}
-	if err := Write(&buf, getBuckets(), false, false); err != nil {
+	if err := Write(&buf, getBuckets(), false, false, 0); err != nil {
 		t.Fatal(err)
 	}
 	// We expect this to be fairly static across Go versions. We want to know if
 	// it changes significantly, thus assert the approximate size. This is being
 	// tested on travis.
-	if l := buf.Len(); l < 4000 || l > 10000 {
+	if l := buf.Len(); l < 8000 || l > 15000 {
 		t.Fatalf("unexpected length %d", l)
 	}
 }
@@ -34,13 +37,13 @@ func TestWrite2Buckets(t *testing.T) {
 func TestWrite1Bucket(t *testing.T) {
 	// Exercise a condition when there's only one bucket.
 	buf := bytes.Buffer{}
-	if err := Write(&buf, getBuckets()[:1], false, false); err != nil {
+	if err := Write(&buf, getBuckets()[:1], false, false, 0); err != nil {
 		t.Fatal(err)
 	}
 	// We expect this to be fairly static across Go versions. We want to know if
 	// it changes significantly, thus assert the approximate size. This is being
 	// tested on travis.
-	if l := buf.Len(); l < 4000 || l > 10000 {
+	if l := buf.Len(); l < 8000 || l > 15000 {
 		t.Fatalf("unexpected length %d", l)
 	}
 }
@@ -51,7 +54,7 @@ const liveStr = `document.addEventListener("DOMContentLoaded", ready);`
 
 func TestWrite(t *testing.T) {
 	buf := bytes.Buffer{}
-	if err := Write(&buf, getBuckets()[:1], false, false); err != nil {
+	if err := Write(&buf, getBuckets()[:1], false, false, 0); err != nil {
 		t.Fatal(err)
 	}
 	if strings.Contains(buf.String(), needEnvStr) {
@@ -60,11 +63,18 @@ func TestWrite(t *testing.T) {
 	if strings.Contains(buf.String(), liveStr) {
 		t.Fatal("unexpected")
 	}
+	id := getBuckets()[0].ShortID()
+	if !strings.Contains(buf.String(), `<h1 id="`+id+`">`) {
+		t.Fatalf("expected bucket ID %s", id)
+	}
+	if !strings.Contains(buf.String(), `<details class="bucket" data-id="`+id+`" open>`) {
+		t.Fatalf("expected collapsible bucket %s", id)
+	}
 }
 
 func TestWriteNeedEnv(t *testing.T) {
 	buf := bytes.Buffer{}
-	if err := Write(&buf, getBuckets()[:1], true, false); err != nil {
+	if err := Write(&buf, getBuckets()[:1], true, false, 0); err != nil {
 		t.Fatal(err)
 	}
 	if !strings.Contains(buf.String(), needEnvStr) {
@@ -77,7 +87,7 @@ func TestWriteNeedEnv(t *testing.T) {
 
 func TestWriteLive(t *testing.T) {
 	buf := bytes.Buffer{}
-	if err := Write(&buf, getBuckets()[:1], false, true); err != nil {
+	if err := Write(&buf, getBuckets()[:1], false, true, 0); err != nil {
 		t.Fatal(err)
 	}
 	if strings.Contains(buf.String(), needEnvStr) {
@@ -88,6 +98,247 @@ func TestWriteLive(t *testing.T) {
 	}
 }
 
+func TestWriteTemplate(t *testing.T) {
+	t.Parallel()
+	tmpl := Template()
+	if _, err := tmpl.Parse(`{{define "title"}}ACME{{end}}{{define "header"}}<div class="brand">ACME</div>{{end}}{{define "head"}}<link rel="stylesheet" href="/dark.css">{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	// The template can be reused.
+	for i := 0; i < 2; i++ {
+		buf := bytes.Buffer{}
+		if err := WriteTemplate(&buf, tmpl, getBuckets()[:1], &Opts{}); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"<title>ACME</title>", `<div class="brand">ACME</div>`, `<link rel="stylesheet" href="/dark.css">`, ".FuncMain {"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Fatalf("#%d: expected %q", i, want)
+			}
+		}
+	}
+	buf := bytes.Buffer{}
+	if err := Write(&buf, getBuckets()[:1], false, false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<title>PanicParse</title>") || strings.Contains(buf.String(), "ACME") {
+		t.Fatal("the default template was modified")
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	t.Parallel()
+	buf := bytes.Buffer{}
+	if err := WriteTemplate(&buf, Template(), getBuckets()[:1], &Opts{Pprof: "/debug/pprof/"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<a href="/debug/pprof/goroutine?debug=1">goroutine</a>`; !strings.Contains(buf.String(), want) {
+		t.Fatalf("expected %q", want)
+	}
+	buf.Reset()
+	if err := WriteTemplate(&buf, Template(), getBuckets()[:1], &Opts{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "goroutine?debug=1") {
+		t.Fatal("unexpected pprof link")
+	}
+}
+
+func TestWriteArgs(t *testing.T) {
+	t.Parallel()
+	buf := bytes.Buffer{}
+	if err := WriteTemplate(&buf, Template(), getBuckets()[:1], &Opts{Args: stack.ArgsFormat{Decimal: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<span>285212672, 2</span>"; !strings.Contains(buf.String(), want) {
+		t.Fatalf("expected %q", want)
+	}
+	buf.Reset()
+	if err := WriteTemplate(&buf, Template(), getBuckets()[:1], &Opts{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<span>0x11000000, 2</span>"; !strings.Contains(buf.String(), want) {
+		t.Fatalf("expected %q", want)
+	}
+}
+
+func TestPprofLinks(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		state string
+		want  []string
+	}{
+		{"IO wait", []string{"goroutine"}},
+		{"semacquire", []string{"goroutine", "mutex", "block"}},
+		{"sync.Mutex.Lock", []string{"goroutine", "mutex", "block"}},
+		{"chan receive", []string{"goroutine", "block"}},
+		{"select", []string{"goroutine", "block"}},
+		{"running", []string{"goroutine", "profile"}},
+	}
+	for _, line := range data {
+		var got []string
+		for _, l := range pprofLinks("/p/", &stack.Bucket{Signature: stack.Signature{State: line.state}}) {
+			if !strings.HasPrefix(l.URL, "/p/"+l.Name+"?") {
+				t.Fatalf("%s: unexpected URL %q", line.state, l.URL)
+			}
+			got = append(got, l.Name)
+		}
+		if !reflect.DeepEqual(line.want, got) {
+			t.Fatalf("%s: %v != %v", line.state, line.want, got)
+		}
+	}
+}
+
+func TestFlameGraph(t *testing.T) {
+	t.Parallel()
+	bucket := func(n int, funcs ...string) *stack.Bucket {
+		b := &stack.Bucket{IDs: make([]int, n)}
+		for _, f := range funcs {
+			b.Stack.Calls = append(b.Stack.Calls, stack.Call{Func: newFunc(f)})
+		}
+		return b
+	}
+	buckets := []*stack.Bucket{
+		bucket(2, "main.worker", "main.main"),
+		bucket(3, "main.b", "main.a", "main.main"),
+		bucket(1, "main.a", "main.main"),
+	}
+	want := &flameNode{Name: "all", Value: 6, Children: []*flameNode{
+		{Name: "main.main", Value: 6, Children: []*flameNode{
+			{Name: "main.a", Value: 4, Children: []*flameNode{
+				{Name: "main.b", Value: 3},
+			}},
+			{Name: "main.worker", Value: 2},
+		}},
+	}}
+	if got := flameGraph(buckets); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %#v, got %#v", want, got)
+	}
+	buf := bytes.Buffer{}
+	if err := Write(&buf, buckets, false, false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := `const flame = {"n":"all","v":6,"c":[{"n":"main.main"`; !strings.Contains(buf.String(), want) {
+		t.Fatalf("expected %q in:\n%s", want, buf.String())
+	}
+}
+
+func TestCreationTree(t *testing.T) {
+	t.Parallel()
+	main := &stack.Bucket{
+		Signature: stack.Signature{Stack: stack.Stack{Calls: []stack.Call{{Func: newFunc("main.main")}}}},
+		IDs:       []int{1},
+	}
+	worker := &stack.Bucket{
+		Signature: stack.Signature{
+			CreatedBy: stack.Call{Func: newFunc("main.main")},
+			Stack:     stack.Stack{Calls: []stack.Call{{Func: newFunc("main.worker")}}},
+		},
+		IDs: []int{2, 3},
+	}
+	roots := creationTree([]*stack.Bucket{main, worker})
+	if len(roots) != 1 {
+		t.Fatalf("unexpected roots %v", roots)
+	}
+	r := roots[0]
+	if r.CreatedBy != nil || r.Count != 3 || len(r.Buckets) != 1 || r.Buckets[0] != main || len(r.Children) != 1 {
+		t.Fatalf("unexpected root %#v", r)
+	}
+	c := r.Children[0]
+	if c.CreatedBy == nil || c.CreatedBy.Func.Raw != "main.main" || c.Count != 2 || len(c.Buckets) != 1 || c.Buckets[0] != worker || len(c.Children) != 0 {
+		t.Fatalf("unexpected child %#v", c)
+	}
+	buf := bytes.Buffer{}
+	if err := Write(&buf, []*stack.Bucket{main, worker}, false, false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<details open><summary>No creator: 3 routines</summary>`; !strings.Contains(buf.String(), want) {
+		t.Fatalf("expected %q in:\n%s", want, buf.String())
+	}
+}
+
+func TestCreationTreeCreatorID(t *testing.T) {
+	t.Parallel()
+	main := &stack.Bucket{
+		Signature: stack.Signature{Stack: stack.Stack{Calls: []stack.Call{{Func: newFunc("main.main")}}}},
+		IDs:       []int{1},
+	}
+	server := &stack.Bucket{
+		Signature: stack.Signature{
+			CreatedBy:   stack.Call{Func: newFunc("main.main")},
+			CreatedByID: 1,
+			Stack:       stack.Stack{Calls: []stack.Call{{Func: newFunc("main.server")}}},
+		},
+		IDs: []int{5},
+	}
+	admin := &stack.Bucket{
+		Signature: stack.Signature{
+			CreatedBy:   stack.Call{Func: newFunc("main.admin")},
+			CreatedByID: 1,
+			Stack:       stack.Stack{Calls: []stack.Call{{Func: newFunc("main.server")}}},
+		},
+		IDs: []int{9},
+	}
+	handler := &stack.Bucket{
+		Signature: stack.Signature{
+			CreatedBy:   stack.Call{Func: newFunc("main.server")},
+			CreatedByID: 9,
+			Stack:       stack.Stack{Calls: []stack.Call{{Func: newFunc("main.handle")}}},
+		},
+		IDs: []int{6, 7},
+	}
+	roots := creationTree([]*stack.Bucket{main, server, admin, handler})
+	if len(roots) != 1 || len(roots[0].Children) != 2 {
+		t.Fatalf("unexpected roots %#v", roots)
+	}
+	if c := roots[0].Children[0]; len(c.Children) != 0 {
+		t.Fatalf("unexpected children %#v", c.Children)
+	}
+	c := roots[0].Children[1]
+	if len(c.Buckets) != 1 || c.Buckets[0] != admin || len(c.Children) != 1 {
+		t.Fatalf("unexpected child %#v", c)
+	}
+	if h := c.Children[0]; len(h.Buckets) != 1 || h.Buckets[0] != handler || h.Count != 2 {
+		t.Fatalf("unexpected grandchild %#v", h)
+	}
+}
+
+func TestWriteSource(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "htmlstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	p := filepath.Join(d, "main.go")
+	if err := ioutil.WriteFile(p, []byte("package main\n\nfunc main() {\n\tpanic(\"<boom>\")\n}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	buckets := []*stack.Bucket{
+		{
+			Signature: stack.Signature{
+				State: "running",
+				Stack: stack.Stack{Calls: []stack.Call{newCall("main.main", stack.Args{}, p, 4)}},
+			},
+			IDs: []int{1},
+		},
+	}
+	buf := bytes.Buffer{}
+	if err := Write(&buf, buckets, false, false, 1); err != nil {
+		t.Fatal(err)
+	}
+	want := "<pre><span>    3  func main() {</span>\n<span class=\"current\">    4  \tpanic(&#34;&lt;boom&gt;&#34;)</span>\n<span>    5  }</span>\n</pre>"
+	if !strings.Contains(buf.String(), want) {
+		t.Fatalf("expected %q in:\n%s", want, buf.String())
+	}
+	buf.Reset()
+	if err := Write(&buf, buckets, false, false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "<details>") {
+		t.Fatal("unexpected source")
+	}
+}
+
 func TestGenerate(t *testing.T) {
 	t.Parallel()
 	// Confirms that nobody forgot to regenate data.go.
@@ -253,7 +504,7 @@ func BenchmarkWrite(b *testing.B) {
 	buckets := stack.Aggregate(c.Goroutines, stack.AnyPointer)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		if err := Write(ioutil.Discard, buckets, false, false); err != nil {
+		if err := Write(ioutil.Discard, buckets, false, false, 0); err != nil {
 			b.Fatal(err)
 		}
 	}
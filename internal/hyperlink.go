@@ -0,0 +1,58 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// fileLinkURL is the link template used when the terminal supports
+// hyperlinks and none was specified.
+const fileLinkURL = "file://{path}"
+
+// supportsHyperlinks returns true if the terminal is known to support OSC 8
+// hyperlinks.
+func supportsHyperlinks() bool {
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "vscode":
+		return true
+	}
+	if os.Getenv("WT_SESSION") != "" || os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("DOMTERM") != "" {
+		return true
+	}
+	// VTE based terminals, e.g. GNOME Terminal, support it since 0.50.
+	v, _ := strconv.Atoi(os.Getenv("VTE_VERSION"))
+	return v >= 5000
+}
+
+// linkURL returns the URL of the call's source file from the template tmpl.
+//
+// "{path}" is replaced with the local path of the file, "{relpath}" with the
+// path relative to GOROOT or GOPATH and "{line}" with the line number. The
+// path is URL escaped for "file://" templates.
+func linkURL(tmpl string, c *stack.Call) string {
+	path := c.LocalSrcPath
+	if path == "" {
+		path = c.SrcPath
+	}
+	rel := c.RelSrcPath
+	if rel == "" {
+		rel = path
+	}
+	if strings.HasPrefix(tmpl, "file://") {
+		path = (&url.URL{Path: path}).EscapedPath()
+	}
+	return strings.NewReplacer("{path}", path, "{relpath}", rel, "{line}", strconv.Itoa(c.Line)).Replace(tmpl)
+}
+
+// hyperlink wraps text in an OSC 8 hyperlink escape sequence.
+func hyperlink(u, text string) string {
+	return "\033]8;;" + u + "\033\\" + text + "\033]8;;\033\\"
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"os"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestLinkURL(t *testing.T) {
+	t.Parallel()
+	c := &stack.Call{
+		SrcPath:      "/build/src/github.com/foo/bar/my file.go",
+		LocalSrcPath: "/home/user/go/src/github.com/foo/bar/my file.go",
+		RelSrcPath:   "github.com/foo/bar/my file.go",
+		Line:         42,
+	}
+	compareString(t, "file:///home/user/go/src/github.com/foo/bar/my%20file.go", linkURL("file://{path}", c))
+	compareString(t, "https://example.com/blob/abc/github.com/foo/bar/my file.go#L42", linkURL("https://example.com/blob/abc/{relpath}#L{line}", c))
+	c = &stack.Call{SrcPath: "/tmp/main.go", Line: 3}
+	compareString(t, "vscode://file/tmp/main.go:3", linkURL("vscode://file{relpath}:{line}", c))
+}
+
+func TestCallLineHyperlink(t *testing.T) {
+	t.Parallel()
+	c := &stack.Call{
+		Func:    stack.Func{Raw: "main.main"},
+		SrcPath: "/tmp/main.go",
+		Line:    3,
+	}
+	p := &Palette{LinkURL: "file://{path}"}
+	expected := "    main \033]8;;file:///tmp/main.go\033\\main.go:3\033]8;;\033\\     main()"
+	compareString(t, expected, p.callLine(c, 13, 4, basePath))
+}
+
+func TestSupportsHyperlinks(t *testing.T) {
+	vars := []string{"TERM_PROGRAM", "WT_SESSION", "KITTY_WINDOW_ID", "DOMTERM", "VTE_VERSION"}
+	old := map[string]string{}
+	for _, k := range vars {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, "")
+	}
+	defer func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}()
+	data := []struct {
+		key, value string
+		want       bool
+	}{
+		{"", "", false},
+		{"TERM_PROGRAM", "Apple_Terminal", false},
+		{"TERM_PROGRAM", "iTerm.app", true},
+		{"WT_SESSION", "1234", true},
+		{"VTE_VERSION", "4803", false},
+		{"VTE_VERSION", "6003", true},
+	}
+	for i, line := range data {
+		if line.key != "" {
+			os.Setenv(line.key, line.value)
+		}
+		if got := supportsHyperlinks(); got != line.want {
+			t.Fatalf("#%d: %s=%s: expected %t, got %t", i, line.key, line.value, line.want, got)
+		}
+		if line.key != "" {
+			os.Setenv(line.key, "")
+		}
+	}
+}
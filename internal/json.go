@@ -0,0 +1,38 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// jsonDump is the document written by -json.
+//
+// The fields use the names of the stack package types as is, so the schema is
+// the same as serializing them with encoding/json.
+type jsonDump struct {
+	GOROOT  string
+	GOPATHs map[string]string
+	Panics  []stack.PanicDetail
+	Signal  *stack.SignalInfo
+	Buckets []*stack.Bucket
+}
+
+// writeJSON writes the buckets of the stack dump as an indented JSON
+// document.
+func writeJSON(out io.Writer, c *stack.Context, buckets []*stack.Bucket) error {
+	e := json.NewEncoder(out)
+	e.SetIndent("", "  ")
+	return e.Encode(&jsonDump{
+		GOROOT:  c.GOROOT,
+		GOPATHs: c.GOPATHs,
+		Panics:  c.Panics,
+		Signal:  c.Signal,
+		Buckets: buckets,
+	})
+}
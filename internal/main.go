@@ -26,12 +26,14 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/maruel/panicparse/internal/htmlstack"
+	"github.com/maruel/panicparse/internal/origin"
 	"github.com/maruel/panicparse/stack"
-	"github.com/mattn/go-colorable"
-	"github.com/mattn/go-isatty"
+	"github.com/maruel/panicparse/terminal"
 	"github.com/mgutz/ansi"
 )
 
@@ -46,6 +48,7 @@ var defaultPalette = Palette{
 	EOLReset:           resetFG,
 	RoutineFirst:       ansi.ColorCode("magenta+b"),
 	CreatedBy:          ansi.LightBlack,
+	BucketID:           ansi.LightBlack,
 	Package:            ansi.ColorCode("default+b"),
 	SrcFile:            resetFG,
 	FuncStdLib:         ansi.Green,
@@ -54,9 +57,36 @@ var defaultPalette = Palette{
 	FuncOther:          ansi.Red,
 	FuncOtherExported:  ansi.ColorCode("red+b"),
 	Arguments:          resetFG,
+	Source:             ansi.LightBlack,
 }
 
-func writeToConsole(out io.Writer, p *Palette, buckets []*stack.Bucket, pf pathFormat, needsEnv bool, filter, match *regexp.Regexp) error {
+// matchHeaders returns the buckets which header, as printed without colors,
+// is selected by filter and match, for the outputs that don't print it, e.g.
+// -json.
+func matchHeaders(buckets []*stack.Bucket, pf pathFormat, filter, match *regexp.Regexp) []*stack.Bucket {
+	if filter == nil && match == nil {
+		return buckets
+	}
+	p := &Palette{}
+	out := make([]*stack.Bucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		header := p.BucketHeader(bucket, pf, len(buckets) > 1)
+		if filter != nil && filter.MatchString(header) {
+			continue
+		}
+		if match != nil && !match.MatchString(header) {
+			continue
+		}
+		out = append(out, bucket)
+	}
+	return out
+}
+
+// writeToConsole writes the buckets to out. If blame is not nil, each bucket
+// is annotated with the last commit that touched its top first-party call. If
+// files is not nil, each bucket is annotated with its number of goroutines per
+// input. If src is not nil, each call is followed by its source lines.
+func writeToConsole(out io.Writer, p *Palette, buckets []*stack.Bucket, pf pathFormat, needsEnv bool, blame *blamer, files *origin.Origins, src *snippeter, filter, match *regexp.Regexp) error {
 	if needsEnv {
 		_, _ = io.WriteString(out, "\nTo see all goroutines, visit https://github.com/maruel/panicparse#gotraceback\n\n")
 	}
@@ -70,36 +100,209 @@ func writeToConsole(out io.Writer, p *Palette, buckets []*stack.Bucket, pf pathF
 			continue
 		}
 		_, _ = io.WriteString(out, header)
-		_, _ = io.WriteString(out, p.StackLines(&bucket.Signature, srcLen, pkgLen, pf))
+		if blame != nil {
+			if b := blame.annotate(bucket); b != "" {
+				_, _ = io.WriteString(out, "    "+p.CreatedBy+"blame: "+b+p.EOLReset+"\n")
+			}
+		}
+		if files != nil {
+			_, _ = io.WriteString(out, "    "+p.CreatedBy+"files: "+files.Annotate(bucket)+p.EOLReset+"\n")
+		}
+		if src != nil {
+			_, _ = io.WriteString(out, src.stackLines(p, &bucket.Signature, srcLen, pkgLen, pf))
+		} else {
+			_, _ = io.WriteString(out, p.StackLines(&bucket.Signature, srcLen, pkgLen, pf))
+		}
 	}
 	return nil
 }
 
+// processOpts is the configuration of process(), built once from the flags.
+type processOpts struct {
+	p  *Palette
+	s  stack.Similarity
+	pf pathFormat
+	// parse enables stack.Augment.
+	parse bool
+	// rebase guesses GOROOT and GOPATH.
+	rebase bool
+	// hideStdlib ignores the calls into the standard library.
+	hideStdlib bool
+	// paths rewrites the source paths, if not nil, before they are guessed.
+	paths *pathMapper
+	// html is the file to write an HTML page to instead of the console.
+	html string
+	// columns are the columns of the table to write instead of the full
+	// stacks, if not empty.
+	columns []string
+	// packages writes the number of goroutines per package instead of the
+	// buckets.
+	packages bool
+	// asJSON writes the buckets as a JSON document, see writeJSON().
+	asJSON bool
+	// asMarkdown writes the buckets as markdown, see writeMarkdown().
+	asMarkdown bool
+	// bucketID only keeps the buckets which ID starts with it, if not empty.
+	bucketID string
+	// first only keeps the bucket of the goroutine that crashed, followed on
+	// the console by the count of the others.
+	first bool
+	// opts further selects the buckets.
+	opts stack.FilterOpts
+	// frames selects the goroutines before they are aggregated.
+	frames stack.Filter
+	// blame annotates the buckets printed to the console with git blame, if
+	// not nil.
+	blame *blamer
+	// src prints the source lines after the calls printed to the console, if
+	// not nil.
+	src *snippeter
+	// edit opens a call in an editor after printing, if not nil.
+	edit *editor
+	// rank sorts the buckets instead of the library provided order, if not
+	// nil.
+	rank stack.Ranker
+	// filter and match select the buckets printed by their header.
+	filter *regexp.Regexp
+	match  *regexp.Regexp
+	// fail is when to return an ExitError.
+	fail failPolicy
+}
+
+// goroutines returns the goroutines of c selected by o.frames, augmented and
+// without the calls into the standard library as requested.
+func (o *processOpts) goroutines(c *stack.Context) []*stack.Goroutine {
+	goroutines := o.frames.Apply(c.Goroutines)
+	if o.parse {
+		stack.Augment(goroutines)
+	}
+	if o.hideStdlib {
+		goroutines = stack.HideStdlib(goroutines)
+	}
+	return goroutines
+}
+
+// buckets aggregates the goroutines of c and returns the buckets selected and
+// sorted as requested in o, and all the buckets before they were selected.
+//
+// files is the input of each goroutine of merged stack dumps, or nil.
+func (o *processOpts) buckets(c *stack.Context, files *origin.Origins) ([]*stack.Bucket, []*stack.Bucket) {
+	buckets := stack.Aggregate(o.goroutines(c), o.s)
+	files.Restore(c.Goroutines, buckets)
+	all := buckets
+	if o.bucketID != "" {
+		var selected []*stack.Bucket
+		for _, b := range buckets {
+			if b.MatchID(o.bucketID) {
+				selected = append(selected, b)
+			}
+		}
+		buckets = selected
+	}
+	if o.first {
+		var selected []*stack.Bucket
+		if b := crashedBucket(c, buckets); b != nil {
+			selected = append(selected, b)
+		}
+		buckets = selected
+	}
+	if o.rank != nil {
+		stack.Buckets(buckets).Sort(o.rank)
+	}
+	return stack.Buckets(buckets).Filter(o.opts), all
+}
+
 // process copies stdin to stdout and processes any "panic: " line found.
 //
-// If html is used, a stack trace is written to this file instead.
-func process(in io.Reader, out io.Writer, p *Palette, s stack.Similarity, pf pathFormat, parse, rebase bool, html string, filter, match *regexp.Regexp) error {
-	c, err := stack.ParseDump(in, out, rebase)
+// When there is more than one input, their goroutines are aggregated together
+// and the buckets printed to the console are annotated with their number of
+// goroutines per input, see parseInputs().
+//
+// When there is more than one bucket, the console output starts with a
+// summary of all the buckets, see Palette.Summary().
+//
+// Once the output is written, an ExitError is returned if a panic or a data
+// race was found and o.fail asks for it.
+func process(inputs []input, out io.Writer, o *processOpts) (err error) {
+	// Keep the output valid JSON or markdown; the panic is in the document.
+	junk := out
+	if o.asJSON || o.asMarkdown {
+		junk = os.Stderr
+	}
+	var races *raceDetector
+	if o.fail.onRace {
+		races = &raceDetector{w: junk}
+		junk = races
+	}
+	var c *stack.Context
+	defer func() {
+		if err == nil && o.fail.failed(c, races) {
+			err = &ExitError{Code: 2}
+		}
+	}()
+	c, files, err := parseInputs(inputs, junk, o.paths.opts(o.rebase))
 	if c == nil || err != nil {
 		return err
 	}
-	if rebase {
+	if o.rebase {
 		log.Printf("GOROOT=%s", c.GOROOT)
 		log.Printf("GOPATH=%s", c.GOPATHs)
 	}
+	if c.Wrapped != 0 {
+		// The joining is a heuristic; always tell the user it was used.
+		_, _ = fmt.Fprintf(os.Stderr, "warning: joined %d wrapped lines\n", c.Wrapped)
+	}
+	if c.Truncated {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: dump truncated after %d goroutines\n", len(c.Goroutines))
+	}
 	needsEnv := len(c.Goroutines) == 1 && showBanner()
-	if parse {
-		stack.Augment(c.Goroutines)
+	if o.packages {
+		return writePackages(out, stack.CountByPackage(o.goroutines(c)))
+	}
+	buckets, all := o.buckets(c, files)
+	if o.asJSON {
+		return writeJSON(out, c, matchHeaders(buckets, o.pf, o.filter, o.match))
 	}
-	buckets := stack.Aggregate(c.Goroutines, s)
-	if html == "" {
-		return writeToConsole(out, p, buckets, pf, needsEnv, filter, match)
+	if o.asMarkdown {
+		return writeMarkdown(out, c, buckets, o.pf, o.filter, o.match)
 	}
-	f, err := os.Create(html)
+	if o.html == "" {
+		if len(o.columns) != 0 {
+			return writeTable(out, buckets, o.pf, o.columns, o.filter, o.match)
+		}
+		if o.first {
+			if err := writeToConsole(out, o.p, buckets, o.pf, needsEnv, o.blame, files, o.src, o.filter, o.match); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(out, othersLine(o.p, all, buckets)); err != nil {
+				return err
+			}
+		} else {
+			if len(all) > 1 {
+				_, _ = io.WriteString(out, o.p.Summary(all)+"\n")
+			}
+			if err := writeToConsole(out, o.p, buckets, o.pf, needsEnv, o.blame, files, o.src, o.filter, o.match); err != nil {
+				return err
+			}
+		}
+		if o.edit == nil || len(buckets) == 0 {
+			return nil
+		}
+		b := crashedBucket(c, buckets)
+		if b == nil {
+			b = buckets[0]
+		}
+		return o.edit.edit(o.p, o.pf, b)
+	}
+	f, err := os.Create(o.html)
 	if err != nil {
 		return err
 	}
-	err = htmlstack.Write(f, buckets, needsEnv, false)
+	lines := 0
+	if o.src != nil {
+		lines = o.src.Context
+	}
+	err = htmlstack.WriteTemplate(f, htmlstack.Template(), buckets, &htmlstack.Opts{NeedsEnv: needsEnv, Src: lines, Args: o.p.Args})
 	if err2 := f.Close(); err == nil {
 		err = err2
 	}
@@ -117,20 +320,88 @@ func showBanner() bool {
 // Main is implemented here so both 'pp' and 'panicparse' executables can be
 // compiled. This is to work around the Perl Package manager 'pp' that is
 // preinstalled on some OSes.
+//
+// "pp split", "pp bisect", "pp watch", "pp run", "pp attach" and "pp serve"
+// are handled as subcommands, see splitMain(), bisectMain(), watchMain(),
+// runMain(), attachMain() and serveMain().
 func Main() error {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "split":
+			return splitMain(os.Args[2:])
+		case "bisect":
+			return bisectMain(os.Args[2:])
+		case "watch":
+			return watchMain(os.Args[2:])
+		case "run":
+			return runMain(os.Args[2:])
+		case "attach":
+			return attachMain(os.Args[2:])
+		case "serve":
+			return serveMain(os.Args[2:])
+		}
+	}
 	aggressive := flag.Bool("aggressive", false, "Aggressive deduplication including non pointers")
 	parse := flag.Bool("parse", true, "Parses source files to deduct types; use -parse=false to work around bugs in source parser")
 	rebase := flag.Bool("rebase", true, "Guess GOROOT and GOPATH")
+	hideStdlib := flag.Bool("hide-stdlib", false, "Ignore the calls into the standard library when aggregating and printing; implies -rebase")
 	verboseFlag := flag.Bool("v", false, "Enables verbose logging output")
 	filterFlag := flag.String("f", "", "Regexp to filter out headers that match, ex: -f 'IO wait|syscall'")
 	matchFlag := flag.String("m", "", "Regexp to filter by only headers that match, ex: -m 'semacquire'")
+	firstFlag := flag.Bool("first", false, "Only print the bucket of the goroutine that crashed, with its source lines, and the count of the others")
+	bucketID := flag.String("bucket", "", "Only print the buckets which ID starts with this value, ex: -bucket ab12")
+	top := flag.Int("top", 0, "Only print the N buckets with the most goroutines")
+	minCount := flag.Int("min-count", 0, "Only print the buckets with at least N goroutines")
+	statesFlag := flag.String("state", "", "Only print the buckets in one of these comma separated states, ex: -state 'chan receive,select'")
+	includeFlag := flag.String("include", "", "Regexp to keep only the goroutines with a function name or source path matching in any call, ex: -include 'mypkg'")
+	excludeFlag := flag.String("exclude", "", "Regexp to drop the goroutines with a function name or source path matching in any call, ex: -exclude 'net/http\\.'")
 	// Console only.
+	blameFlag := flag.Bool("blame", false, "Annotate each bucket with the last commit that touched its top first-party call, using git blame")
+	var mapPaths remapFlag
+	flag.Var(&mapPaths, "map-path", "Source path prefix to replace to find the files locally, for a stack dump produced in a container or on a build machine, ex: -map-path /go/src=/home/me/go/src; can be repeated; implies -rebase")
+	var stripPrefixes stringsFlag
+	flag.Var(&stripPrefixes, "strip-prefix", "Source path prefix to remove to find the files locally, when no -map-path matched; can be repeated; implies -rebase")
+	flag.Var(&mapPaths, "blame-remap", "Deprecated: use -map-path")
+	editFlag := flag.Bool("edit", false, "After printing, list the calls of the goroutine that crashed and open the selected one in $VISUAL or $EDITOR")
+	srcFlag := flag.Int("src", 0, "Print N lines of source around each call, when the source file is found locally; with -html, in an expandable section")
 	fullPathArg := flag.Bool("full-path", false, "Print full sources path")
 	relPathArg := flag.Bool("rel-path", false, "Print sources path relative to GOROOT or GOPATH; implies -rebase")
-	noColor := flag.Bool("no-color", !isatty.IsTerminal(os.Stdout.Fd()) || os.Getenv("TERM") == "dumb", "Disable coloring")
-	forceColor := flag.Bool("force-color", false, "Forcibly enable coloring when with stdout is redirected")
+	color := colorFlags(flag.CommandLine)
+	linkFlag := flag.String("link-url", "", "Template of the hyperlink on each source file, using {path}, {relpath} and {line}, ex: -link-url 'https://github.com/me/proj/blob/abc123/{relpath}#L{line}'; defaults to file://{path} when the terminal supports hyperlinks, use 'off' to disable")
+	forceColor := flag.Bool("force-color", false, "Deprecated: use -color=always")
+	sortFlag := flag.String("sort", "stack", "Order of the buckets; one of: stack, interest")
+	format := flag.String("format", "console", "Output format; one of: console, table, packages")
+	asJSON := flag.Bool("json", false, "Output the buckets as JSON, for post processing")
+	asMarkdown := flag.Bool("md", false, "Output the buckets as GitHub flavored markdown, to paste in an issue")
+	argsFlag := flag.String("args", "", "Formatting of the arguments; comma separated list of: dec, nozero, collapse; or off to hide them")
+	columnsFlag := flag.String("columns", strings.Join(tableColumns, ","), "Columns to print with -format table; any of: "+strings.Join(tableColumns, ", "))
+	// URL only.
+	timeout := flag.Duration("timeout", 30*time.Second, "Timeout to fetch the stack dump when passed a URL, ex: pp http://localhost:6060/debug/pprof/goroutine?debug=2")
+	insecure := flag.Bool("insecure", false, "Do not verify the TLS certificate of the server when passed a https URL")
+
+	streamFlag := flag.Bool("stream", false, "Pass the output through as it is read and print each stack trace aggregated as soon as it ended, instead of at the end of the input; useful with long running processes")
+	execFlag := flag.String("exec", "", "Command to run with the shell on each panic found with -stream, receiving the -json document on stdin, ex: -exec 'notify-send panic'")
+	timestamp := flag.Bool("timestamp", false, "Prefix each line passed through with the time it was read; implies -stream")
+	failOnPanic := flag.Bool("fail-on-panic", false, "Exit with code 2 when a panic is found, for when the exit code of the process piped into pp is lost")
+	failOnRace := flag.Bool("fail-on-race", false, "Exit with code 2 when a data race is found, for when the exit code of the process piped into pp is lost")
+	merge := flag.Bool("merge", false, "When passed multiple files or URLs, aggregate their goroutines together instead of processing them one after the other")
+	last := flag.Bool("last", false, "Only process the last stack dump of each file, found by reading the file from its end; useful with huge log files")
+
 	// HTML only.
 	html := flag.String("html", "", "Output an HTML file")
+	flag.String("config", defaultConfigFile(), "Configuration file with the default value of the flags and the colors")
+
+	cfgPath, explicit := configFlagValue(os.Args[1:])
+	if !explicit {
+		cfgPath = defaultConfigFile()
+	}
+	cfg, err := loadConfig(cfgPath, explicit)
+	if err != nil {
+		return err
+	}
+	if err := cfg.apply(flag.CommandLine); err != nil {
+		return err
+	}
 	flag.Parse()
 
 	log.SetFlags(log.Lmicroseconds)
@@ -138,7 +409,6 @@ func Main() error {
 		log.SetOutput(ioutil.Discard)
 	}
 
-	var err error
 	var filter *regexp.Regexp
 	if *filterFlag != "" {
 		if filter, err = regexp.Compile(*filterFlag); err != nil {
@@ -153,6 +423,69 @@ func Main() error {
 		}
 	}
 
+	var frames stack.Filter
+	if *includeFlag != "" {
+		if frames.Include, err = regexp.Compile(*includeFlag); err != nil {
+			return err
+		}
+	}
+	if *excludeFlag != "" {
+		if frames.Exclude, err = regexp.Compile(*excludeFlag); err != nil {
+			return err
+		}
+	}
+
+	var rank stack.Ranker
+	switch *sortFlag {
+	case "interest":
+		rank = stack.ByInterest
+	case "stack":
+	default:
+		return fmt.Errorf("invalid -sort %q", *sortFlag)
+	}
+
+	args, err := parseArgsFormat(*argsFlag)
+	if err != nil {
+		return err
+	}
+
+	var columns []string
+	packages := false
+	switch *format {
+	case "console":
+	case "table":
+		if columns, err = parseColumns(*columnsFlag); err != nil {
+			return err
+		}
+	case "packages":
+		packages = true
+	default:
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+	if *asJSON && (*format != "console" || *html != "") {
+		return errors.New("can't use -json with -format or -html")
+	}
+	if *asMarkdown && (*asJSON || *format != "console" || *html != "") {
+		return errors.New("can't use -md with -json, -format or -html")
+	}
+	if *timestamp {
+		*streamFlag = true
+	}
+	if *execFlag != "" && !*streamFlag {
+		return errors.New("-exec requires -stream")
+	}
+	if *streamFlag && (*asJSON || *asMarkdown || *format != "console" || *html != "" || *merge || *last || *failOnPanic || *failOnRace) {
+		return errors.New("can't use -stream with -json, -md, -format, -html, -merge, -last, -fail-on-panic or -fail-on-race")
+	}
+	fail := failPolicy{onPanic: *failOnPanic, onRace: *failOnRace}
+
+	opts := stack.FilterOpts{Top: *top, MinCount: *minCount}
+	if *statesFlag != "" {
+		for _, st := range strings.Split(*statesFlag, ",") {
+			opts.States = append(opts.States, strings.TrimSpace(st))
+		}
+	}
+
 	s := stack.AnyPointer
 	if *aggressive {
 		s = stack.AnyValue
@@ -161,17 +494,31 @@ func Main() error {
 	var out io.Writer = os.Stdout
 	p := &defaultPalette
 	if *html == "" {
-		if *noColor && !*forceColor {
+		if (!color() && !*forceColor) || columns != nil || packages || *asJSON || *asMarkdown {
 			p = &Palette{}
 		} else {
-			out = colorable.NewColorableStdout()
+			var err error
+			if p, err = loadPalette(cfg.colors); err != nil {
+				return err
+			}
+			switch *linkFlag {
+			case "":
+			case "off":
+				p.LinkURL = ""
+			default:
+				p.LinkURL = *linkFlag
+			}
+			out = terminal.NewWriter(os.Stdout)
 		}
 	}
+	if args != (stack.ArgsFormat{}) {
+		// Do not modify defaultPalette.
+		c := *p
+		c.Args = args
+		p = &c
+	}
 
-	var in *os.File
-	switch flag.NArg() {
-	case 0:
-		in = os.Stdin
+	if flag.NArg() == 0 {
 		// Explicitly silence SIGQUIT, as it is useful to gather the stack dump
 		// from the piped command..
 		signals := make(chan os.Signal)
@@ -181,17 +528,11 @@ func Main() error {
 			}
 		}()
 		signal.Notify(signals, os.Interrupt, syscall.SIGQUIT)
-
-	case 1:
-		// Do not handle SIGQUIT when passed a file to process.
-		name := flag.Arg(0)
-		if in, err = os.Open(name); err != nil {
-			return fmt.Errorf("did you mean to specify a valid stack dump file name? "+wrap, err)
-		}
-		defer in.Close()
-
-	default:
-		return errors.New("pipe from stdin or specify a single file")
+	} else if flag.NArg() > 1 && !*merge && *html != "" {
+		return errors.New("can't use -html with multiple files or URLs without -merge")
+	} else if flag.NArg() > 1 && !*merge && *asJSON {
+		// The output must be a single JSON document.
+		return errors.New("can't use -json with multiple files or URLs without -merge")
 	}
 	pf := basePath
 	if *fullPathArg {
@@ -203,5 +544,116 @@ func Main() error {
 		pf = relPath
 		*rebase = true
 	}
-	return process(in, out, p, s, pf, *parse, *rebase, *html, filter, match)
+	if *hideStdlib {
+		// IsStdlib is only set when the paths are guessed.
+		*rebase = true
+	}
+	paths := newPathMapper(mapPaths, stripPrefixes)
+	var blame *blamer
+	if *blameFlag {
+		blame = newBlamer()
+	}
+	var src *snippeter
+	if *srcFlag > 0 {
+		src = newSnippeter(*srcFlag)
+	} else if *firstFlag {
+		src = newSnippeter(3)
+	}
+	var edit *editor
+	if *editFlag {
+		if *asJSON || *asMarkdown || *format != "console" || *html != "" || *streamFlag {
+			return errors.New("can't use -edit with -json, -md, -format, -html or -stream")
+		}
+		if edit, err = newEditor(); err != nil {
+			return err
+		}
+	}
+	o := &processOpts{
+		p:          p,
+		s:          s,
+		pf:         pf,
+		parse:      *parse,
+		rebase:     *rebase,
+		hideStdlib: *hideStdlib,
+		paths:      paths,
+		html:       *html,
+		columns:    columns,
+		packages:   packages,
+		asJSON:     *asJSON,
+		asMarkdown: *asMarkdown,
+		bucketID:   *bucketID,
+		first:      *firstFlag,
+		opts:       opts,
+		frames:     frames,
+		blame:      blame,
+		src:        src,
+		edit:       edit,
+		rank:       rank,
+		filter:     filter,
+		match:      match,
+		fail:       fail,
+	}
+	if *streamFlag {
+		hook := newHook(*execFlag)
+		var now func() time.Time
+		if *timestamp {
+			now = time.Now
+		}
+		if flag.NArg() == 0 {
+			return stream(os.Stdin, out, o, hook, now)
+		}
+		if flag.NArg() != 1 {
+			return errors.New("can't use -stream with multiple files or URLs")
+		}
+		r, err := openInput(newHTTPClient(*timeout, *insecure), flag.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return stream(r, out, o, hook, now)
+	}
+	if flag.NArg() == 0 {
+		var r io.Reader = os.Stdin
+		if *last {
+			if r, err = lastDump(r); err != nil {
+				return err
+			}
+		}
+		return process([]input{{name: "stdin", r: r}}, out, o)
+	}
+	// Do not handle SIGQUIT when passed files or URLs to process.
+	c := newHTTPClient(*timeout, *insecure)
+	var inputs []input
+	for _, name := range flag.Args() {
+		r, err := openInput(c, name)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		in := input{name: name, r: r}
+		if *last {
+			if in.r, err = lastDump(r); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		inputs = append(inputs, in)
+	}
+	if *merge || len(inputs) == 1 {
+		return process(inputs, out, o)
+	}
+	var failed error
+	for i, in := range inputs {
+		if i != 0 {
+			_, _ = io.WriteString(out, "\n")
+		}
+		_, _ = fmt.Fprintf(out, "==> %s <==\n", in.name)
+		if err := process([]input{in}, out, o); err != nil {
+			if _, ok := err.(*ExitError); !ok {
+				return fmt.Errorf("%s: %v", in.name, err)
+			}
+			// Process the remaining inputs before failing.
+			failed = err
+		}
+	}
+	return failed
 }
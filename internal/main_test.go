@@ -6,6 +6,7 @@ package internal
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -25,17 +26,17 @@ import (
 func TestProcess(t *testing.T) {
 	t.Parallel()
 	out := &bytes.Buffer{}
-	if err := process(getReader(t), out, testPalette, stack.AnyPointer, basePath, false, true, "", nil, nil); err != nil {
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true}); err != nil {
 		t.Fatal(err)
 	}
-	want := "GOTRACEBACK=all\npanic: simple\n\nC1: runningA\n    Emain Fmain.go:52 ImainL()A\n"
+	want := "GOTRACEBACK=all\npanic: simple\n\nC1: runningM [6251eac3]A\n    Emain Fmain.go:52 ImainL()A\n"
 	compareString(t, want, out.String())
 }
 
 func TestProcessFullPath(t *testing.T) {
 	t.Parallel()
 	out := &bytes.Buffer{}
-	if err := process(getReader(t), out, testPalette, stack.AnyValue, fullPath, false, true, "", nil, nil); err != nil {
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyValue, pf: fullPath, rebase: true}); err != nil {
 		t.Fatal(err)
 	}
 	d, err := os.Getwd()
@@ -44,24 +45,24 @@ func TestProcessFullPath(t *testing.T) {
 	}
 	// "/" is used even on Windows.
 	p := strings.Replace(filepath.Join(filepath.Dir(d), "cmd", "panic", "main.go"), "\\", "/", -1)
-	want := fmt.Sprintf("GOTRACEBACK=all\npanic: simple\n\nC1: runningA\n    Emain F%s:52 ImainL()A\n", p)
+	want := fmt.Sprintf("GOTRACEBACK=all\npanic: simple\n\nC1: runningM [6251eac3]A\n    Emain F%s:52 ImainL()A\n", p)
 	compareString(t, want, out.String())
 }
 
 func TestProcessNoColor(t *testing.T) {
 	t.Parallel()
 	out := &bytes.Buffer{}
-	if err := process(getReader(t), out, testPalette, stack.AnyPointer, basePath, false, true, "", nil, nil); err != nil {
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true}); err != nil {
 		t.Fatal(err)
 	}
-	want := "GOTRACEBACK=all\npanic: simple\n\nC1: runningA\n    Emain Fmain.go:52 ImainL()A\n"
+	want := "GOTRACEBACK=all\npanic: simple\n\nC1: runningM [6251eac3]A\n    Emain Fmain.go:52 ImainL()A\n"
 	compareString(t, want, out.String())
 }
 
 func TestProcessMatch(t *testing.T) {
 	t.Parallel()
 	out := &bytes.Buffer{}
-	err := process(getReader(t), out, testPalette, stack.AnyPointer, basePath, false, true, "", nil, regexp.MustCompile(`notpresent`))
+	err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, match: regexp.MustCompile(`notpresent`)})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -72,11 +73,138 @@ func TestProcessMatch(t *testing.T) {
 func TestProcessFilter(t *testing.T) {
 	t.Parallel()
 	out := &bytes.Buffer{}
-	err := process(getReader(t), out, testPalette, stack.AnyPointer, basePath, false, true, "", regexp.MustCompile(`notpresent`), nil)
+	err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, filter: regexp.MustCompile(`notpresent`)})
 	if err != nil {
 		t.Fatal(err)
 	}
-	want := "GOTRACEBACK=all\npanic: simple\n\nC1: runningA\n    Emain Fmain.go:52 ImainL()A\n"
+	want := "GOTRACEBACK=all\npanic: simple\n\nC1: runningM [6251eac3]A\n    Emain Fmain.go:52 ImainL()A\n"
+	compareString(t, want, out.String())
+}
+
+func TestProcessTable(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, columns: []string{"id", "count", "state", "top", "created"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "GOTRACEBACK=all\npanic: simple\n\nID        COUNT  STATE    TOP FRAME               CREATED BY\n6251eac3  1      running  main.main @ main.go:52  -\n"
+	compareString(t, want, out.String())
+}
+
+func TestProcessPackages(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, packages: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := "GOTRACEBACK=all\npanic: simple\n\nPACKAGE  COUNT  STATES\nmain     1      running: 1\n"
+	compareString(t, want, out.String())
+}
+
+func TestProcessJSON(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, asJSON: true}); err != nil {
+		t.Fatal(err)
+	}
+	var got jsonDump
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+	if len(got.Panics) != 1 || got.Panics[0].Message != "simple" {
+		t.Fatalf("unexpected panics %v", got.Panics)
+	}
+	if len(got.Buckets) != 1 || got.Buckets[0].State != "running" || !got.Buckets[0].First {
+		t.Fatalf("unexpected buckets %s", out.String())
+	}
+	if f := got.Buckets[0].Stack.Calls[0].Func.Raw; f != "main.main" {
+		t.Fatalf("unexpected call %q", f)
+	}
+}
+
+func TestProcessJSONFilter(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		filter, match string
+		want          int
+	}{
+		{"running", "", 0},
+		{"", "running", 1},
+		{"", "select", 0},
+	}
+	for i, line := range data {
+		o := &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, asJSON: true}
+		if line.filter != "" {
+			o.filter = regexp.MustCompile(line.filter)
+		}
+		if line.match != "" {
+			o.match = regexp.MustCompile(line.match)
+		}
+		out := &bytes.Buffer{}
+		if err := process([]input{{r: getReader(t)}}, out, o); err != nil {
+			t.Fatal(err)
+		}
+		var got jsonDump
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("#%d: %v\n%s", i, err, out.String())
+		}
+		if len(got.Buckets) != line.want {
+			t.Fatalf("#%d: expected %d buckets, got %s", i, line.want, out.String())
+		}
+	}
+}
+
+func TestProcessBucketID(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, bucketID: "6251"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "GOTRACEBACK=all\npanic: simple\n\nC1: runningM [6251eac3]A\n    Emain Fmain.go:52 ImainL()A\n"
+	compareString(t, want, out.String())
+
+	out.Reset()
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, bucketID: "ffff"}); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "GOTRACEBACK=all\npanic: simple\n\n", out.String())
+}
+
+func TestProcessFilterOpts(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	opts := stack.FilterOpts{States: []string{"running"}, Top: 1}
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, opts: opts}); err != nil {
+		t.Fatal(err)
+	}
+	want := "GOTRACEBACK=all\npanic: simple\n\nC1: runningM [6251eac3]A\n    Emain Fmain.go:52 ImainL()A\n"
+	compareString(t, want, out.String())
+
+	out.Reset()
+	opts = stack.FilterOpts{MinCount: 2}
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, opts: opts}); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "GOTRACEBACK=all\npanic: simple\n\n", out.String())
+}
+
+func TestProcessFrames(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	frames := stack.Filter{Exclude: regexp.MustCompile(`^main\.main$`)}
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, frames: frames}); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "GOTRACEBACK=all\npanic: simple\n\n", out.String())
+}
+
+func TestProcessRank(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	if err := process([]input{{r: getReader(t)}}, out, &processOpts{p: testPalette, s: stack.AnyPointer, pf: basePath, rebase: true, rank: stack.ByInterest}); err != nil {
+		t.Fatal(err)
+	}
+	want := "GOTRACEBACK=all\npanic: simple\n\nC1: runningM [6251eac3]A\n    Emain Fmain.go:52 ImainL()A\n"
 	compareString(t, want, out.String())
 }
 
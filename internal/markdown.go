@@ -0,0 +1,76 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// writeMarkdown writes the buckets as GitHub flavored markdown, one
+// collapsible section per bucket, so it can be pasted in an issue.
+//
+// The first bucket is expanded.
+func writeMarkdown(out io.Writer, c *stack.Context, buckets []*stack.Bucket, pf pathFormat, filter, match *regexp.Regexp) error {
+	for _, pd := range c.Panics {
+		if _, err := fmt.Fprintf(out, "**%s:** %s\n\n", pd.Kind, codeSpan(pd.Message)); err != nil {
+			return err
+		}
+	}
+	p := &Palette{}
+	srcLen, pkgLen := calcLengths(buckets, pf)
+	for i, bucket := range buckets {
+		header := strings.TrimSuffix(p.BucketHeader(bucket, pf, len(buckets) > 1), "\n")
+		if filter != nil && filter.MatchString(header) {
+			continue
+		}
+		if match != nil && !match.MatchString(header) {
+			continue
+		}
+		open := ""
+		if i == 0 {
+			open = " open"
+		}
+		lines := make([]string, 0, len(bucket.Stack.Calls)+1)
+		for j := range bucket.Stack.Calls {
+			lines = append(lines, strings.TrimPrefix(p.callLine(&bucket.Stack.Calls[j], srcLen, pkgLen, pf), "    "))
+		}
+		if bucket.Stack.Elided {
+			lines = append(lines, "(...)")
+		}
+		if _, err := fmt.Fprintf(out, "<details%s><summary>%s</summary>\n\n```\n%s\n```\n\n</details>\n\n", open, html.EscapeString(header), strings.Join(lines, "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codeSpan returns s as a markdown code span, so it is printed as is.
+//
+// The span is delimited with more backticks than the longest run of backticks
+// in s, padded with a space when s starts or ends with a backtick or a space,
+// as one space on each side is stripped.
+func codeSpan(s string) string {
+	longest, n := 0, 0
+	for _, c := range s {
+		if c == '`' {
+			if n++; n > longest {
+				longest = n
+			}
+		} else {
+			n = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if s != "" && (s[0] == '`' || s[0] == ' ' || s[len(s)-1] == '`' || s[len(s)-1] == ' ') {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
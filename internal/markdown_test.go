@@ -0,0 +1,69 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	t.Parallel()
+	const dump = "panic: a < b\n\n" +
+		"goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n\n" +
+		"goroutine 6 [chan receive]:\n" +
+		"main.worker()\n" +
+		"\t/gopath/src/foo/main.go:20 +0x20\n" +
+		"created by main.main\n" +
+		"\t/gopath/src/foo/main.go:8 +0x20\n"
+	c, err := stack.ParseDump(strings.NewReader(dump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets := stack.Aggregate(c.Goroutines, stack.AnyPointer)
+	out := &bytes.Buffer{}
+	if err := writeMarkdown(out, c, buckets, basePath, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "**panic:** `a < b`\n\n" +
+		"<details open><summary>1: running [" + buckets[0].ShortID() + "]</summary>\n\n" +
+		"```\nmain main.go:10 main()\n```\n\n</details>\n\n" +
+		"<details><summary>1: chan receive [Created by main.main @ main.go:8] [" + buckets[1].ShortID() + "]</summary>\n\n" +
+		"```\nmain main.go:20 worker()\n```\n\n</details>\n\n"
+	compareString(t, want, out.String())
+
+	out.Reset()
+	if err := writeMarkdown(out, c, buckets, basePath, regexp.MustCompile("running"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); strings.Contains(s, "running") || !strings.Contains(s, "chan receive") {
+		t.Fatalf("unexpected output:\n%s", s)
+	}
+}
+
+func TestCodeSpan(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in, want string
+	}{
+		{"a < b", "`a < b`"},
+		{"*boom* [x](y)", "`*boom* [x](y)`"},
+		{"use `go vet`", "`` use `go vet` ``"},
+		{"``` fence", "```` ``` fence ````"},
+		{"`x`", "`` `x` ``"},
+		{" a", "`  a `"},
+		{"", "``"},
+	}
+	for _, line := range data {
+		compareString(t, line.want, codeSpan(line.in))
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/maruel/panicparse/internal/origin"
+	"github.com/maruel/panicparse/stack"
+)
+
+// input is a stack dump to process.
+type input struct {
+	// name is the file name or URL. It is only used for display.
+	name string
+	r    io.Reader
+}
+
+// openInput opens the file or starts fetching the URL name. The caller must
+// close the returned reader.
+func openInput(c *http.Client, name string) (io.ReadCloser, error) {
+	if isURL(name) {
+		return fetchURL(c, name)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("did you mean to specify a valid stack dump file name? "+wrap, err)
+	}
+	return f, nil
+}
+
+// lastDump returns the part of the file r starting at its last stack dump,
+// so it is found without reading the whole file. r must be a regular file.
+func lastDump(r io.Reader) (io.Reader, error) {
+	f, ok := r.(*os.File)
+	if !ok {
+		return nil, errors.New("-last requires a file")
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, errors.New("-last requires a file")
+	}
+	off, err := stack.LastDump(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("last stack dump of %s at offset %d", f.Name(), off)
+	return io.NewSectionReader(f, off, fi.Size()-off), nil
+}
+
+// parseInputs parses the stack dumps and merges them into a single Context.
+//
+// When there is more than one input, the returned Origins tells which input
+// each goroutine comes from. Call Origins.Restore() once aggregated to set
+// back their original IDs. The GOROOT and GOPATHs are the ones of the
+// first stack dump found. The lines of the Warnings are the ones of their
+// input, which name prefixes their Reason.
+//
+// It returns a nil Context if no stack dump was found.
+func parseInputs(inputs []input, junk io.Writer, opts *stack.Opts) (*stack.Context, *origin.Origins, error) {
+	if len(inputs) == 1 {
+		c, err := stack.ParseDumpWithOpts(inputs[0].r, junk, opts)
+		return c, nil, err
+	}
+	var merged *stack.Context
+	files := &origin.Origins{}
+	for _, in := range inputs {
+		c, err := stack.ParseDumpWithOpts(in.r, junk, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", in.name, err)
+		}
+		if c == nil {
+			files.Add(in.name, nil)
+			continue
+		}
+		if merged == nil {
+			merged = &stack.Context{GOROOT: c.GOROOT, GOPATHs: c.GOPATHs, Signal: c.Signal}
+		}
+		files.Add(in.name, c.Goroutines)
+		merged.Goroutines = append(merged.Goroutines, c.Goroutines...)
+		for _, w := range c.Warnings {
+			merged.Warnings = append(merged.Warnings, stack.ParseWarning{Line: w.Line, Reason: in.name + ": " + w.Reason})
+		}
+		merged.Panics = append(merged.Panics, c.Panics...)
+		merged.Wrapped += c.Wrapped
+		merged.Truncated = merged.Truncated || c.Truncated
+	}
+	return merged, files, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+const mergeDump = "panic: boom\n\n" +
+	"goroutine 1 [running]:\n" +
+	"main.main()\n" +
+	"\t/gopath/src/foo/main.go:10 +0x20\n\n" +
+	"goroutine 6 [chan receive]:\n" +
+	"main.worker()\n" +
+	"\t/gopath/src/foo/main.go:20 +0x20\n" +
+	"created by main.main\n" +
+	"\t/gopath/src/foo/main.go:8 +0x20\n"
+
+func TestParseInputs(t *testing.T) {
+	t.Parallel()
+	inputs := []input{
+		{name: "crash1.txt", r: strings.NewReader(mergeDump)},
+		{name: "empty.txt", r: strings.NewReader("nothing to see\n")},
+		{name: "crash2.txt", r: strings.NewReader(mergeDump)},
+	}
+	c, files, err := parseInputs(inputs, ioutil.Discard, &stack.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareInt(t, 4, len(c.Goroutines))
+	compareInt(t, 2, len(c.Panics))
+	buckets := stack.Aggregate(c.Goroutines, stack.AnyPointer)
+	files.Restore(c.Goroutines, buckets)
+	for i, g := range c.Goroutines {
+		compareInt(t, []int{1, 6, 1, 6}[i], g.ID)
+	}
+	compareInt(t, 2, len(buckets))
+	for _, b := range buckets {
+		compareString(t, "crash1.txt: 1, crash2.txt: 1", files.Annotate(b))
+		if b.IDs[0] != b.IDs[1] {
+			t.Fatalf("expected the original IDs, got %v", b.IDs)
+		}
+	}
+
+	// A single input is not renumbered.
+	c, files, err = parseInputs([]input{{name: "crash1.txt", r: strings.NewReader(mergeDump)}}, ioutil.Discard, &stack.Opts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != nil {
+		t.Fatal("expected no Origins")
+	}
+	compareInt(t, 6, c.Goroutines[1].ID)
+}
+
+func TestParseInputsWarnings(t *testing.T) {
+	t.Parallel()
+	broken := "goroutine 1 [running]:\nmain.main()\nnot a file\n\n" + mergeDump
+	inputs := []input{
+		{name: "crash1.txt", r: strings.NewReader(mergeDump)},
+		{name: "crash2.txt", r: strings.NewReader(broken)},
+	}
+	c, _, err := parseInputs(inputs, ioutil.Discard, &stack.Opts{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Warnings) != 1 || c.Warnings[0].Line != 3 || !strings.HasPrefix(c.Warnings[0].Reason, "crash2.txt: ") {
+		t.Fatalf("unexpected warnings %v", c.Warnings)
+	}
+}
+
+func TestProcessMerge(t *testing.T) {
+	t.Parallel()
+	inputs := []input{
+		{name: "crash1.txt", r: strings.NewReader(mergeDump)},
+		{name: "crash2.txt", r: strings.NewReader(mergeDump)},
+	}
+	out := &bytes.Buffer{}
+	if err := process(inputs, out, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: basePath}); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); strings.Count(s, "    files: crash1.txt: 1, crash2.txt: 1\n") != 2 {
+		t.Fatalf("unexpected output:\n%s", s)
+	}
+}
+
+func TestOpenInput(t *testing.T) {
+	t.Parallel()
+	if _, err := openInput(http.DefaultClient, "/nonexistent/crash.txt"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLastDump(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "pp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	p := filepath.Join(d, "service.log")
+	old := strings.Replace(mergeDump, "boom", "old", 1)
+	if err := ioutil.WriteFile(p, []byte(old+"restarted\n"+mergeDump+"exit status 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := lastDump(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != mergeDump+"exit status 2\n" {
+		t.Fatalf("unexpected section:\n%s", s)
+	}
+	if _, err := lastDump(strings.NewReader(mergeDump)); err == nil {
+		t.Fatal("expected error")
+	}
+}
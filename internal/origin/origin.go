@@ -0,0 +1,76 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package origin tracks the stack dump each goroutine comes from when
+// multiple stack dumps are merged, e.g. multiple files or hosts.
+package origin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// Origins is the stack dump of each goroutine of merged stack dumps.
+//
+// The goroutine IDs collide across stack dumps, so Add assigns temporary
+// unique IDs to the goroutines. Call Restore once they are aggregated to set
+// back their original IDs.
+type Origins struct {
+	names []string
+	// dump and id are the index in names and the original ID of each
+	// goroutine, indexed by the ID assigned by Add minus one.
+	dump []int
+	id   []int
+	// counts is the number of goroutines of each bucket per stack dump, see
+	// Restore().
+	counts map[*stack.Bucket][]int
+}
+
+// Add records the goroutines of the stack dump name. Their IDs are replaced
+// with temporary unique ones.
+func (o *Origins) Add(name string, goroutines []*stack.Goroutine) {
+	o.names = append(o.names, name)
+	for _, g := range goroutines {
+		o.dump = append(o.dump, len(o.names)-1)
+		o.id = append(o.id, g.ID)
+		g.ID = len(o.id)
+	}
+}
+
+// Restore sets back the original IDs of the goroutines and of the buckets
+// aggregated from them, and counts the goroutines of each bucket per stack
+// dump. o can be nil.
+func (o *Origins) Restore(goroutines []*stack.Goroutine, buckets []*stack.Bucket) {
+	if o == nil {
+		return
+	}
+	o.counts = make(map[*stack.Bucket][]int, len(buckets))
+	for _, b := range buckets {
+		counts := make([]int, len(o.names))
+		for i, id := range b.IDs {
+			counts[o.dump[id-1]]++
+			b.IDs[i] = o.id[id-1]
+		}
+		sort.Ints(b.IDs)
+		o.counts[b] = counts
+	}
+	for _, g := range goroutines {
+		g.ID = o.id[g.ID-1]
+	}
+}
+
+// Annotate returns the number of goroutines of the bucket found in each stack
+// dump, e.g. "crash1.txt: 3, crash3.txt: 1". Restore() must have been called.
+func (o *Origins) Annotate(b *stack.Bucket) string {
+	var out []string
+	for i, n := range o.counts[b] {
+		if n != 0 {
+			out = append(out, fmt.Sprintf("%s: %d", o.names[i], n))
+		}
+	}
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package origin
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestOrigins(t *testing.T) {
+	t.Parallel()
+	dump := func() []*stack.Goroutine {
+		return []*stack.Goroutine{
+			{Signature: stack.Signature{State: "running"}, ID: 1},
+			{Signature: stack.Signature{State: "select"}, ID: 6},
+		}
+	}
+	o := &Origins{}
+	var all []*stack.Goroutine
+	for _, name := range []string{"host1", "empty", "host2"} {
+		var g []*stack.Goroutine
+		if name != "empty" {
+			g = dump()
+		}
+		o.Add(name, g)
+		all = append(all, g...)
+	}
+	for i, g := range all {
+		if g.ID != i+1 {
+			t.Fatalf("expected unique IDs, got %d for %d", g.ID, i)
+		}
+	}
+	buckets := stack.Aggregate(all, stack.AnyPointer)
+	o.Restore(all, buckets)
+	var ids []int
+	for _, g := range all {
+		ids = append(ids, g.ID)
+	}
+	if want := []int{1, 6, 1, 6}; !reflect.DeepEqual(want, ids) {
+		t.Fatalf("%v != %v", want, ids)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("unexpected buckets %v", buckets)
+	}
+	for _, b := range buckets {
+		if b.IDs[0] != b.IDs[1] {
+			t.Fatalf("expected the original IDs, got %v", b.IDs)
+		}
+		if s := o.Annotate(b); s != "host1: 1, host2: 1" {
+			t.Fatalf("unexpected %q", s)
+		}
+	}
+	// nil is a no-op.
+	(*Origins)(nil).Restore(all, buckets)
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/panicparse/terminal"
+	"github.com/mgutz/ansi"
+)
+
+// paletteEnv is the environment variable overriding the colors, ex:
+// PANICPARSE_COLORS="funcmain=#ffaf00+b,createdby=244".
+const paletteEnv = "PANICPARSE_COLORS"
+
+// colorFlags defines -color and the deprecated -no-color on fs. The returned
+// function tells whether to color stdout once fs is parsed.
+func colorFlags(fs *flag.FlagSet) func() bool {
+	var m terminal.Mode
+	fs.Var(&m, "color", "When to color the output; one of: always, auto, never; auto honors NO_COLOR, CLICOLOR_FORCE and TERM=dumb")
+	noColor := fs.Bool("no-color", false, "Deprecated: use -color=never")
+	return func() bool {
+		return !*noColor && terminal.Color(m, os.Stdout)
+	}
+}
+
+// loadPalette returns the default palette with the colors overridden by
+// colors, the [colors] table of the configuration file, then by the
+// environment variable.
+//
+// The source files are hyperlinked when the terminal supports it.
+func loadPalette(colors string) (*Palette, error) {
+	p := defaultPalette
+	if supportsHyperlinks() {
+		p.LinkURL = fileLinkURL
+	}
+	if err := p.applyColors(colors); err != nil {
+		return nil, err
+	}
+	if err := p.applyColors(os.Getenv(paletteEnv)); err != nil {
+		return nil, fmt.Errorf("%s: %v", paletteEnv, err)
+	}
+	return &p, nil
+}
+
+// applyColors overrides the colors listed in spec.
+//
+// spec is a list of "element=color" separated by commas or new lines. Lines
+// starting with '#' are ignored.
+func (p *Palette) applyColors(spec string) error {
+	fields := map[string]*string{
+		"routinefirst":       &p.RoutineFirst,
+		"routine":            &p.Routine,
+		"createdby":          &p.CreatedBy,
+		"bucketid":           &p.BucketID,
+		"package":            &p.Package,
+		"srcfile":            &p.SrcFile,
+		"funcstdlib":         &p.FuncStdLib,
+		"funcstdlibexported": &p.FuncStdLibExported,
+		"funcmain":           &p.FuncMain,
+		"funcother":          &p.FuncOther,
+		"funcotherexported":  &p.FuncOtherExported,
+		"arguments":          &p.Arguments,
+		"source":             &p.Source,
+	}
+	for _, line := range strings.Split(spec, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, item := range strings.Split(line, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			i := strings.IndexByte(item, '=')
+			if i == -1 {
+				return fmt.Errorf("invalid color %q; expected element=color", item)
+			}
+			key := strings.ToLower(strings.TrimSpace(item[:i]))
+			f, ok := fields[key]
+			if !ok {
+				return fmt.Errorf("unknown element %q", key)
+			}
+			c, err := parseColor(strings.TrimSpace(item[i+1:]))
+			if err != nil {
+				return err
+			}
+			*f = c
+		}
+	}
+	return nil
+}
+
+// parseColor returns the escape sequence for a color.
+//
+// It is either a truecolor "#rrggbb" optionally followed by "+b" for bold, or
+// any color accepted by ansi.ColorCode, e.g. "red+b", "214" for the 256 color
+// palette or "white:blue" for a background.
+func parseColor(s string) (string, error) {
+	if strings.HasPrefix(s, "#") {
+		hex, style := s[1:], ""
+		if i := strings.IndexByte(hex, '+'); i != -1 {
+			hex, style = hex[:i], hex[i+1:]
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if len(hex) != 6 || err != nil || (style != "" && style != "b") {
+			return "", fmt.Errorf("invalid color %q; expected #rrggbb or #rrggbb+b", s)
+		}
+		prefix := "\033["
+		if style == "b" {
+			prefix += "1;"
+		}
+		return fmt.Sprintf("%s38;2;%d;%d;%dm", prefix, v>>16, (v>>8)&0xff, v&0xff), nil
+	}
+	fg := s
+	if i := strings.IndexAny(fg, "+:"); i != -1 {
+		fg = fg[:i]
+	}
+	if fg != "" {
+		// ansi.Colors also contains "0" to "255".
+		if _, ok := ansi.Colors[fg]; !ok {
+			return "", fmt.Errorf("unknown color %q", s)
+		}
+	}
+	return ansi.ColorCode(s), nil
+}
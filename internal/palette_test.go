@@ -0,0 +1,86 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mgutz/ansi"
+)
+
+func TestParseColor(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"red", ansi.Red, false},
+		{"green+b", ansi.ColorCode("green+b"), false},
+		{"214", "\033[38;5;214m", false},
+		{"white:blue", ansi.ColorCode("white:blue"), false},
+		{"#ffaf00", "\033[38;2;255;175;0m", false},
+		{"#FFAF00+b", "\033[1;38;2;255;175;0m", false},
+		{"#fff", "", true},
+		{"#ffaf00+u", "", true},
+		{"#gggggg", "", true},
+		{"purple", "", true},
+		{"256", "", true},
+	}
+	for i, line := range data {
+		got, err := parseColor(line.in)
+		if (err != nil) != line.err {
+			t.Fatalf("#%d: %q: unexpected error %v", i, line.in, err)
+		}
+		compareString(t, line.want, got)
+	}
+}
+
+func TestPaletteApplyColors(t *testing.T) {
+	t.Parallel()
+	p := defaultPalette
+	spec := "# Comment.\nfuncmain=#ffaf00, createdby=244\n\n  Arguments = blue\n"
+	if err := p.applyColors(spec); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "\033[38;2;255;175;0m", p.FuncMain)
+	compareString(t, "\033[38;5;244m", p.CreatedBy)
+	compareString(t, ansi.Blue, p.Arguments)
+	compareString(t, defaultPalette.FuncOther, p.FuncOther)
+
+	for _, spec := range []string{"funcmain", "foo=red", "funcmain=foo"} {
+		if err := p.applyColors(spec); err == nil {
+			t.Fatalf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestLoadPalette(t *testing.T) {
+	oldEnv := os.Getenv(paletteEnv)
+	defer os.Setenv(paletteEnv, oldEnv)
+	os.Setenv(paletteEnv, "")
+
+	p, err := loadPalette("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, defaultPalette.FuncMain, p.FuncMain)
+
+	// The environment variable has precedence over the colors argument.
+	os.Setenv(paletteEnv, "funcother=magenta")
+	if p, err = loadPalette("funcmain=cyan\nfuncother=green\ncreatedby=red"); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, ansi.Cyan, p.FuncMain)
+	compareString(t, ansi.Magenta, p.FuncOther)
+	compareString(t, ansi.Red, p.CreatedBy)
+	compareString(t, defaultPalette.BucketID, p.BucketID)
+
+	os.Setenv(paletteEnv, "funcother=nope")
+	if _, err = loadPalette(""); err == nil {
+		t.Fatal("expected error")
+	}
+}
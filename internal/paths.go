@@ -0,0 +1,70 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// stringsFlag implements flag.Value for a repeatable string flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// pathMapper maps the source paths of a stack dump to the local ones, for
+// stack dumps produced in a container or on a build machine with a different
+// file system layout.
+type pathMapper struct {
+	// remaps is applied in order. The first matching prefix wins.
+	remaps []remap
+	// strip is the prefixes to remove when no remap matched.
+	strip []string
+}
+
+// newPathMapper returns nil if there is nothing to map.
+func newPathMapper(remaps []remap, strip []string) *pathMapper {
+	if len(remaps) == 0 && len(strip) == 0 {
+		return nil
+	}
+	return &pathMapper{remaps: remaps, strip: strip}
+}
+
+// remap returns the local path and the path relative to the prefix matched,
+// or empty strings if no prefix matched. It implements stack.Env.Remap.
+func (m *pathMapper) remap(p string) (string, string) {
+	for _, r := range m.remaps {
+		if strings.HasPrefix(p, r.from) {
+			return r.to + p[len(r.from):], strings.TrimPrefix(p[len(r.from):], "/")
+		}
+	}
+	for _, s := range m.strip {
+		if strings.HasPrefix(p, s) {
+			return p[len(s):], strings.TrimPrefix(p[len(s):], "/")
+		}
+	}
+	return "", ""
+}
+
+// opts returns the options to parse a stack dump. m can be nil.
+//
+// The paths are always guessed when there is something to map, since the
+// local paths are only set then.
+func (m *pathMapper) opts(rebase bool) *stack.Opts {
+	o := &stack.Opts{GuessPaths: rebase}
+	if m != nil {
+		o.GuessPaths = true
+		o.Env = &stack.Env{Remap: m.remap}
+	}
+	return o
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestPathMapper(t *testing.T) {
+	t.Parallel()
+	if m := newPathMapper(nil, nil); m != nil {
+		t.Fatal("expected nil")
+	}
+	if o := (*pathMapper)(nil).opts(true); !o.GuessPaths || o.Env != nil {
+		t.Fatalf("unexpected opts %v", o)
+	}
+	m := newPathMapper([]remap{{"/go/src/", "/home/me/go/src/"}, {"/go/", "/other/"}}, []string{"/build/ws"})
+	data := []struct {
+		in, local, rel string
+	}{
+		{"/go/src/foo/main.go", "/home/me/go/src/foo/main.go", "foo/main.go"},
+		{"/go/pkg/mod/foo/main.go", "/other/pkg/mod/foo/main.go", "pkg/mod/foo/main.go"},
+		{"/build/ws/foo/main.go", "/foo/main.go", "foo/main.go"},
+		{"/usr/local/go/src/runtime/proc.go", "", ""},
+	}
+	for _, line := range data {
+		local, rel := m.remap(line.in)
+		compareString(t, line.local, local)
+		compareString(t, line.rel, rel)
+	}
+	// Mapping the paths requires guessing them.
+	if o := m.opts(false); !o.GuessPaths || o.Env == nil || o.Env.Remap == nil {
+		t.Fatalf("unexpected opts %v", o)
+	}
+}
+
+func TestStringsFlag(t *testing.T) {
+	t.Parallel()
+	var s stringsFlag
+	for _, v := range []string{"/a", "/b"} {
+		if err := s.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compareString(t, "/a,/b", s.String())
+}
+
+func TestProcessMapPath(t *testing.T) {
+	t.Parallel()
+	const dump = "goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/build/src/foo/main.go:10 +0x20\n\n"
+	out := &bytes.Buffer{}
+	m := newPathMapper([]remap{{"/build/", "/home/me/"}}, nil)
+	if err := process([]input{{r: strings.NewReader(dump)}}, out, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: fullPath, paths: m}); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "1: running [24d1d4d2]\n    main /home/me/src/foo/main.go:10 main()\n", out.String())
+}
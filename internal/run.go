@@ -0,0 +1,129 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/maruel/panicparse/stack"
+	"github.com/maruel/panicparse/terminal"
+)
+
+// ExitError is returned by Main when the process must exit with a specific
+// code, e.g. the exit code of the command started by "pp run".
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// runMain implements "pp run -- cmd args...", which starts a command and
+// prints the aggregated stack traces it wrote to stderr once it exits.
+func runMain(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	aggressive := fs.Bool("aggressive", false, "Aggressive deduplication including non pointers")
+	color := colorFlags(fs)
+	cfg, err := subcommandConfig(fs)
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("specify the command to run, ex: pp run -- ./myserver -port 8080")
+	}
+	s := stack.AnyPointer
+	if *aggressive {
+		s = stack.AnyValue
+	}
+	var out io.Writer = os.Stdout
+	p := &Palette{}
+	if color() {
+		if p, err = loadPalette(cfg.colors); err != nil {
+			return err
+		}
+		out = terminal.NewWriter(os.Stdout)
+	}
+	code, err := run(fs.Args(), out, os.Stderr, p, s)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
+// forwardedSignals is the signals received by pp that are passed to the
+// command started by "pp run".
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM}
+
+// run starts the command in args and returns its exit code.
+//
+// The stdout of the command is passed through to out as is. Its stderr is
+// streamed to stderr except for the stack traces, which are aggregated and
+// written to out once the command exited, e.g. after it panicked or received
+// SIGQUIT. The stack traces are only parsed from stderr, so the output written
+// to stdout at the same time can't split their lines.
+func run(args []string, out, stderr io.Writer, p *Palette, s stack.Similarity) (int, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = out
+	r, w := io.Pipe()
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go func() {
+		for sig := range signals {
+			_ = cmd.Process.Signal(sig)
+		}
+	}()
+	done := make(chan error)
+	go func() {
+		err := cmd.Wait()
+		_ = w.Close()
+		done <- err
+	}()
+
+	c, err := stack.ParseDumpWithOpts(r, stderr, &stack.Opts{Lenient: true})
+	// Drain stderr if the parsing stopped early, so the command doesn't block.
+	_, _ = io.Copy(stderr, r)
+	werr := <-done
+	if c != nil {
+		if err2 := writeToConsole(out, p, stack.Aggregate(c.Goroutines, s), basePath, false, nil, nil, nil, nil, nil); err == nil {
+			err = err2
+		}
+	}
+	if e, ok := werr.(*exec.ExitError); ok {
+		if ws, ok := e.Sys().(syscall.WaitStatus); ok {
+			if ws.Signaled() {
+				return 128 + int(ws.Signal()), err
+			}
+			return ws.ExitStatus(), err
+		}
+		return 1, err
+	}
+	if werr != nil && err == nil {
+		err = werr
+	}
+	return 0, err
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	args := []string{os.Args[0], "-test.run=^TestRunHelper$"}
+	os.Setenv("PANICPARSE_RUN_HELPER", "1")
+	code, err := run(args, out, stderr, &Palette{}, stack.AnyPointer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 2 {
+		t.Fatalf("expected exit code 2, got %d\n%s", code, stderr.String())
+	}
+	compareString(t, "log line\npanic: helper\n\nexit status 2\n", stderr.String())
+	// The stack trace is parsed from stderr only, so the lines written to
+	// stdout at the same time neither break it nor are reordered.
+	compareString(t, "out 0\nout 1\nout 2\nout 3\nout 4\nout 5\nout 6\n1: running [24d1d4d2]\n    main main.go:10 main()\n", out.String())
+
+	if _, err := run([]string{"/does/not/exist"}, out, stderr, &Palette{}, stack.AnyPointer); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// TestRunHelper is the command started by TestRun.
+func TestRunHelper(t *testing.T) {
+	if os.Getenv("PANICPARSE_RUN_HELPER") != "1" {
+		t.Skip("only run by TestRun")
+	}
+	// Do not panic for real, as the format of the stack trace depends on the
+	// Go version used to run the test.
+	lines := []string{"log line", "panic: helper", "", "goroutine 1 [running]:", "main.main()", "\t/gopath/src/foo/main.go:10 +0x20", "", "exit status 2"}
+	for i, l := range lines {
+		// Interleave the output on stdout with the stack trace.
+		if i < len(lines)-1 {
+			fmt.Fprintf(os.Stdout, "out %d\n", i)
+		}
+		os.Stderr.WriteString(l + "\n")
+	}
+	os.Exit(2)
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/maruel/panicparse/stack"
+	"github.com/maruel/panicparse/stack/webstack"
+)
+
+// serveMain implements "pp serve", which serves a stack dump file as HTML on
+// a local HTTP server.
+func serveMain(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("http", "localhost:8080", "Address to listen on")
+	parse := fs.Bool("parse", true, "Parses source files to deduct types; use -parse=false to work around bugs in source parser")
+	rebase := fs.Bool("rebase", true, "Guess GOROOT and GOPATH")
+	if _, err := subcommandConfig(fs); err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Permit "pp serve crash.txt -http :8080" since flag stops at the first
+	// non-flag argument.
+	var files []string
+	for fs.NArg() != 0 {
+		files = append(files, fs.Arg(0))
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if len(files) != 1 {
+		return errors.New("specify a single file to serve")
+	}
+	c, err := loadDump(files[0], *parse, *rebase)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Serving %d goroutines on http://%s/\n", len(c.Goroutines), l.Addr())
+	fmt.Printf("Form values, e.g. http://%s/?sort=interest&top=10, are documented at https://pkg.go.dev/github.com/maruel/panicparse/stack/webstack\n", l.Addr())
+	return http.Serve(l, webstack.ContextHandler(c))
+}
+
+// loadDump parses the stack dump in the file p.
+func loadDump(p string, parse, rebase bool) (*stack.Context, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("did you mean to specify a valid stack dump file name? "+wrap, err)
+	}
+	defer f.Close()
+	c, err := stack.ParseDump(f, ioutil.Discard, rebase)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, fmt.Errorf("no stack trace found in %s", p)
+	}
+	if parse {
+		stack.Augment(c.Goroutines)
+	}
+	return c, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadDump(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	p := filepath.Join(d, "crash.txt")
+	if err := ioutil.WriteFile(p, []byte("panic: oh no\n\n"+attachDump), 0666); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadDump(p, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Goroutines) != 1 {
+		t.Fatalf("unexpected %d goroutines", len(c.Goroutines))
+	}
+
+	if err := ioutil.WriteFile(p, []byte("nothing\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadDump(p, false, false); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := loadDump(filepath.Join(d, "missing.txt"), false, false); err == nil {
+		t.Fatal("expected error")
+	}
+}
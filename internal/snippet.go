@@ -0,0 +1,58 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/maruel/panicparse/internal/snippet"
+	"github.com/maruel/panicparse/stack"
+)
+
+// snippeter prints the source lines around each call, when the source file
+// is found locally.
+type snippeter struct {
+	*snippet.Reader
+}
+
+func newSnippeter(context int) *snippeter {
+	return &snippeter{snippet.New(context)}
+}
+
+// snippet returns the source lines around the call, or an empty string if the
+// source file is not available.
+//
+// The line of the call is marked with '>'. The other lines are dimmed.
+func (s *snippeter) snippet(p *Palette, c *stack.Call) string {
+	lines := s.Get(c)
+	if len(lines) == 0 {
+		return ""
+	}
+	width := len(strconv.Itoa(lines[len(lines)-1].Line))
+	out := ""
+	for _, l := range lines {
+		if l.Current {
+			out += fmt.Sprintf("      %s> %*d  %s%s\n", p.SrcFile, width, l.Line, l.Text, p.EOLReset)
+		} else {
+			out += fmt.Sprintf("      %s  %*d  %s%s\n", p.Source, width, l.Line, l.Text, p.EOLReset)
+		}
+	}
+	return out
+}
+
+// stackLines is like Palette.StackLines except that each call is followed by
+// its source lines.
+func (s *snippeter) stackLines(p *Palette, signature *stack.Signature, srcLen, pkgLen int, pf pathFormat) string {
+	out := ""
+	for i := range signature.Stack.Calls {
+		out += p.callLine(&signature.Stack.Calls[i], srcLen, pkgLen, pf) + "\n"
+		out += s.snippet(p, &signature.Stack.Calls[i])
+	}
+	if signature.Stack.Elided {
+		out += "    (...)\n"
+	}
+	return out
+}
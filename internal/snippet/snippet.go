@@ -0,0 +1,82 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package snippet reads the source lines around the calls of a stack trace,
+// for both the console and the HTML outputs.
+package snippet
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// Line is a line of a source file.
+type Line struct {
+	Line int
+	Text string
+	// Current is true for the line of the call.
+	Current bool
+}
+
+// Reader reads the source lines around each call, when the source file is
+// found locally. Each file is read once.
+type Reader struct {
+	// Context is the number of lines before and after the line of the call.
+	Context int
+	// files is the lines of each source file already read; nil if it couldn't
+	// be read.
+	files map[string][]string
+}
+
+// New returns a Reader returning context lines before and after the line of
+// each call.
+func New(context int) *Reader {
+	return &Reader{Context: context, files: map[string][]string{}}
+}
+
+// Get returns the source lines around the call, or nil if the source file is
+// not available. r can be nil.
+//
+// The file is LocalSrcPath if set, SrcPath otherwise.
+func (r *Reader) Get(c *stack.Call) []Line {
+	if r == nil || r.Context <= 0 {
+		return nil
+	}
+	lines := r.lines(c)
+	if c.Line <= 0 || c.Line > len(lines) {
+		return nil
+	}
+	first := c.Line - r.Context
+	if first < 1 {
+		first = 1
+	}
+	last := c.Line + r.Context
+	if last > len(lines) {
+		last = len(lines)
+	}
+	out := make([]Line, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		out = append(out, Line{Line: i, Text: lines[i-1], Current: i == c.Line})
+	}
+	return out
+}
+
+// lines returns the lines of the source file of the call.
+func (r *Reader) lines(c *stack.Call) []string {
+	path := c.LocalSrcPath
+	if path == "" {
+		path = c.SrcPath
+	}
+	if l, ok := r.files[path]; ok {
+		return l
+	}
+	var l []string
+	if b, err := ioutil.ReadFile(path); err == nil {
+		l = strings.Split(strings.TrimSuffix(strings.Replace(string(b), "\r\n", "\n", -1), "\n"), "\n")
+	}
+	r.files[path] = l
+	return l
+}
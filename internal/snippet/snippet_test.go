@@ -0,0 +1,64 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package snippet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	p := filepath.Join(d, "a.go")
+	if err := ioutil.WriteFile(p, []byte("a\r\nb\r\nc\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := New(1)
+	data := []struct {
+		name string
+		c    stack.Call
+		want []Line
+	}{
+		{"first", stack.Call{SrcPath: p, Line: 1}, []Line{{1, "a", true}, {2, "b", false}}},
+		{"middle", stack.Call{SrcPath: p, Line: 2}, []Line{{1, "a", false}, {2, "b", true}, {3, "c", false}}},
+		{"local", stack.Call{SrcPath: "/nonexistent/a.go", LocalSrcPath: p, Line: 3}, []Line{{2, "b", false}, {3, "c", true}}},
+		{"past_end", stack.Call{SrcPath: p, Line: 4}, nil},
+		{"missing", stack.Call{SrcPath: "/nonexistent/a.go", Line: 1}, nil},
+	}
+	for _, line := range data {
+		if got := r.Get(&line.c); !reflect.DeepEqual(line.want, got) {
+			t.Errorf("%s: %v != %v", line.name, line.want, got)
+		}
+	}
+	// The file is cached.
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Get(&stack.Call{SrcPath: p, Line: 1}); len(got) != 2 {
+		t.Errorf("expected the cached file, got %v", got)
+	}
+	// No context or no Reader disables the snippets.
+	if got := New(0).Get(&stack.Call{SrcPath: "/nonexistent/a.go", Line: 1}); got != nil {
+		t.Errorf("unexpected %v", got)
+	}
+	var n *Reader
+	if got := n.Get(&stack.Call{SrcPath: p, Line: 1}); got != nil {
+		t.Errorf("unexpected %v", got)
+	}
+}
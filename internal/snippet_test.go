@@ -0,0 +1,57 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestSnippeter(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	p := filepath.Join(d, "main.go")
+	src := "package main\n\nfunc main() {\n\tpanic(42)\n}\n"
+	if err := ioutil.WriteFile(p, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pal := &Palette{SrcFile: "F", Source: "S", EOLReset: "A"}
+	s := newSnippeter(1)
+
+	c := &stack.Call{SrcPath: p, Line: 4}
+	expected := "      S  3  func main() {A\n" +
+		"      F> 4  \tpanic(42)A\n" +
+		"      S  5  }A\n"
+	compareString(t, expected, s.snippet(pal, c))
+
+	// Clamped to the start of the file.
+	c = &stack.Call{SrcPath: p, Line: 1}
+	expected = "      F> 1  package mainA\n" +
+		"      S  2  A\n"
+	compareString(t, expected, s.snippet(pal, c))
+
+	// LocalSrcPath has precedence.
+	c = &stack.Call{SrcPath: "/nonexistent/main.go", LocalSrcPath: p, Line: 3}
+	expected = "      S  2  A\n" +
+		"      F> 3  func main() {A\n" +
+		"      S  4  \tpanic(42)A\n"
+	compareString(t, expected, s.snippet(pal, c))
+
+	// Unknown file or line.
+	compareString(t, "", s.snippet(pal, &stack.Call{SrcPath: "/nonexistent/main.go", Line: 3}))
+	compareString(t, "", s.snippet(pal, &stack.Call{SrcPath: p, Line: 10}))
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// splitMain implements "pp split", which writes each stack trace found in
+// the input to its own file, as raw text.
+func splitMain(args []string) error {
+	fs := flag.NewFlagSet("split", flag.ContinueOnError)
+	outDir := fs.String("o", "", "Directory to write each stack trace to; it is created if missing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Permit "pp split big.log -o dir" since flag stops at the first non-flag
+	// argument.
+	var files []string
+	for fs.NArg() != 0 {
+		files = append(files, fs.Arg(0))
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if *outDir == "" {
+		return errors.New("-o is required")
+	}
+
+	var in io.Reader
+	switch len(files) {
+	case 0:
+		in = os.Stdin
+	case 1:
+		f, err := os.Open(files[0])
+		if err != nil {
+			return fmt.Errorf("did you mean to specify a valid stack dump file name? "+wrap, err)
+		}
+		defer f.Close()
+		in = f
+	default:
+		return errors.New("pipe from stdin or specify a single file")
+	}
+	if err := os.MkdirAll(*outDir, 0777); err != nil {
+		return err
+	}
+	return split(in, os.Stdout, *outDir, time.Now())
+}
+
+// split writes each stack trace found in r to a file in outDir, prefixed with
+// the timestamp now. The name of each file written is printed to out.
+func split(r io.Reader, out io.Writer, outDir string, now time.Time) error {
+	prefix := now.Format("20060102-150405")
+	i := 0
+	return stack.SplitDump(r, ioutil.Discard, func(s *stack.Section) error {
+		p := filepath.Join(outDir, fmt.Sprintf("%s-%03d.txt", prefix, i))
+		i++
+		if err := ioutil.WriteFile(p, s.Raw, 0666); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(out, "%s: line %d\n", p, s.Line)
+		return err
+	})
+}
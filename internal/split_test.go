@@ -0,0 +1,52 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	dump := strings.Join([]string{
+		"panic: simple",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/maruel/panicparse/cmd/panic/main.go:52 +0x49",
+		"",
+	}, "\n")
+	data := "junk\n" + dump + "junk\n" + dump
+	out := &bytes.Buffer{}
+	now := time.Date(2020, 5, 10, 12, 30, 0, 0, time.UTC)
+	if err := split(strings.NewReader(data), out, d, now); err != nil {
+		t.Fatal(err)
+	}
+	p0 := filepath.Join(d, "20200510-123000-000.txt")
+	p1 := filepath.Join(d, "20200510-123000-001.txt")
+	compareString(t, p0+": line 2\n"+p1+": line 8\n", out.String())
+	for _, p := range []string{p0, p1} {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareString(t, dump, string(b))
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// stream copies r to out as it is read and prints each stack trace found in
+// it aggregated, in place of the raw stack trace, as soon as it ended.
+//
+// The buckets are selected and printed to the console as requested in o. hook
+// is run on each panic, if not nil.
+//
+// If now is not nil, each line that is not part of a stack trace is prefixed
+// with the time returned by now.
+//
+// A stack trace is considered ended on the first line that is not part of it
+// or at the end of r.
+func stream(r io.Reader, out io.Writer, o *processOpts, hook *hook, now func() time.Time) error {
+	var logs io.Writer = out
+	if now != nil {
+		logs = &timestampWriter{w: out, now: now, bol: true}
+	}
+	return stack.SplitDump(r, logs, func(sec *stack.Section) error {
+		c, err := stack.ParseDumpWithOpts(bytes.NewReader(sec.Raw), ioutil.Discard, o.paths.opts(o.rebase))
+		if c == nil || err != nil {
+			// Do not lose the stack trace.
+			_, _ = out.Write(sec.Raw)
+			return nil
+		}
+		buckets, all := o.buckets(c, nil)
+		if err := writeToConsole(out, o.p, buckets, o.pf, false, o.blame, nil, o.src, o.filter, o.match); err != nil {
+			return err
+		}
+		if o.first {
+			if _, err := io.WriteString(out, othersLine(o.p, all, buckets)); err != nil {
+				return err
+			}
+		}
+		hook.fire(c, matchHeaders(buckets, o.pf, o.filter, o.match))
+		return nil
+	})
+}
+
+// timestampWriter prefixes each line written with the current time.
+type timestampWriter struct {
+	w   io.Writer
+	now func() time.Time
+	// bol is true when the next byte written starts a line.
+	bol bool
+}
+
+func (t *timestampWriter) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) != 0 {
+		if t.bol {
+			if _, err := io.WriteString(t.w, t.now().Format("15:04:05.000 ")); err != nil {
+				return n, err
+			}
+			t.bol = false
+		}
+		l := len(b)
+		if i := bytes.IndexByte(b, '\n'); i != -1 {
+			l = i + 1
+			t.bol = true
+		}
+		m, err := t.w.Write(b[:l])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		b = b[l:]
+	}
+	return n, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+	const dump = "goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n\n"
+	in := "starting\n" + "panic: boom\n\n" + dump + "restarted\n" + dump
+	out := &bytes.Buffer{}
+	if err := stream(strings.NewReader(in), out, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: basePath}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	bucket := "1: running [24d1d4d2]\n    main main.go:10 main()\n"
+	want := "starting\npanic: boom\n\n" + bucket + "restarted\n" + bucket
+	compareString(t, want, out.String())
+}
+
+func TestStreamFilter(t *testing.T) {
+	t.Parallel()
+	const dump = "goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n\n" +
+		"goroutine 6 [chan receive]:\n" +
+		"main.worker()\n" +
+		"\t/gopath/src/foo/main.go:20 +0x20\n\n"
+	data := []struct {
+		name string
+		o    processOpts
+		want string
+	}{
+		{"f", processOpts{filter: regexp.MustCompile("running")}, "1: chan receive [4674a207]\n    main main.go:20 worker()\n"},
+		{"m", processOpts{match: regexp.MustCompile("running")}, "1: running [24d1d4d2]\n    main main.go:10 main()\n"},
+		{"state", processOpts{opts: stack.FilterOpts{States: []string{"chan receive"}}}, "1: chan receive [4674a207]\n    main main.go:20 worker()\n"},
+		{"exclude", processOpts{frames: stack.Filter{Exclude: regexp.MustCompile(`worker`)}}, "1: running [24d1d4d2]\n    main main.go:10 main()\n"},
+	}
+	for _, line := range data {
+		o := line.o
+		o.p = &Palette{}
+		o.s = stack.AnyPointer
+		o.pf = basePath
+		out := &bytes.Buffer{}
+		if err := stream(strings.NewReader("starting\n"+dump), out, &o, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		compareString(t, "starting\n"+line.want, out.String())
+	}
+}
+
+func TestStreamTimestamp(t *testing.T) {
+	t.Parallel()
+	now := func() time.Time {
+		return time.Date(2020, 3, 4, 5, 6, 7, 8000000, time.UTC)
+	}
+	in := "starting\nready\n"
+	out := &bytes.Buffer{}
+	if err := stream(strings.NewReader(in), out, &processOpts{p: &Palette{}, s: stack.AnyPointer, pf: basePath}, nil, now); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "05:06:07.008 starting\n05:06:07.008 ready\n", out.String())
+}
+
+func TestTimestampWriter(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	w := &timestampWriter{w: out, now: func() time.Time { return time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC) }, bol: true}
+	for _, s := range []string{"a", "b\nc\n", "d\n\n"} {
+		if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("%d, %v", n, err)
+		}
+	}
+	compareString(t, "05:06:07.000 ab\n05:06:07.000 c\n05:06:07.000 d\n05:06:07.000 \n", out.String())
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// tableColumns lists the columns supported by -format table, in their default
+// order.
+var tableColumns = []string{"id", "count", "state", "wait", "top", "created"}
+
+// tableHeaders is the header to print for each column.
+var tableHeaders = map[string]string{
+	"id":      "ID",
+	"count":   "COUNT",
+	"state":   "STATE",
+	"wait":    "WAIT",
+	"top":     "TOP FRAME",
+	"created": "CREATED BY",
+}
+
+// parseColumns parses a comma separated list of columns for -format table.
+func parseColumns(s string) ([]string, error) {
+	var out []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if _, ok := tableHeaders[c]; !ok {
+			return nil, fmt.Errorf("invalid column %q; valid columns are: %s", c, strings.Join(tableColumns, ", "))
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// tableCell returns the value of a column for a bucket.
+//
+// It never returns an empty string so the output stays usable by tools
+// splitting on whitespace.
+func tableCell(bucket *stack.Bucket, column string, pf pathFormat) string {
+	s := ""
+	switch column {
+	case "id":
+		s = bucket.ShortID()
+	case "count":
+		s = strconv.Itoa(len(bucket.IDs))
+	case "state":
+		s = bucket.State
+		if bucket.Locked {
+			s += " [locked]"
+		}
+	case "wait":
+		s = bucket.SleepString()
+	case "top":
+		if len(bucket.Stack.Calls) != 0 {
+			c := &bucket.Stack.Calls[0]
+			s = c.Func.PkgDotName() + " @ " + pf.formatCall(c)
+		}
+	case "created":
+		s = pf.createdByString(&bucket.Signature)
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// writeTable writes one line per bucket as an aligned borderless table.
+//
+// Colors are not used, so the output can be copy-pasted as-is.
+func writeTable(out io.Writer, buckets []*stack.Bucket, pf pathFormat, columns []string, filter, match *regexp.Regexp) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	line := make([]string, len(columns))
+	for i, c := range columns {
+		line[i] = tableHeaders[c]
+	}
+	if _, err := io.WriteString(w, strings.Join(line, "\t")+"\n"); err != nil {
+		return err
+	}
+	p := &Palette{}
+	for _, bucket := range buckets {
+		header := p.BucketHeader(bucket, pf, len(buckets) > 1)
+		if filter != nil && filter.MatchString(header) {
+			continue
+		}
+		if match != nil && !match.MatchString(header) {
+			continue
+		}
+		for i, c := range columns {
+			line[i] = tableCell(bucket, c, pf)
+		}
+		if _, err := io.WriteString(w, strings.Join(line, "\t")+"\n"); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// writePackages writes the number of goroutines per package as an aligned
+// borderless table.
+func writePackages(out io.Writer, counts []stack.PackageCount) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if _, err := io.WriteString(w, "PACKAGE\tCOUNT\tSTATES\n"); err != nil {
+		return err
+	}
+	for _, c := range counts {
+		p := c.ImportPath
+		if p == "" {
+			p = "(stdlib)"
+		}
+		states := make([]string, 0, len(c.States))
+		for s := range c.States {
+			states = append(states, s)
+		}
+		sort.Strings(states)
+		for i, s := range states {
+			states[i] = s + ": " + strconv.Itoa(c.States[s])
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%s\n", p, len(c.IDs), strings.Join(states, ", ")); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -6,6 +6,7 @@ package internal
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/maruel/panicparse/stack"
@@ -21,6 +22,7 @@ type Palette struct {
 	RoutineFirst string // The first routine printed.
 	Routine      string // Following routines.
 	CreatedBy    string
+	BucketID     string
 
 	// Call line.
 	Package            string
@@ -31,6 +33,16 @@ type Palette struct {
 	FuncOther          string
 	FuncOtherExported  string
 	Arguments          string
+
+	// Source lines printed with -src, except the line of the call.
+	Source string
+
+	// LinkURL is the template of the OSC 8 hyperlink on each source file, see
+	// linkURL(). No link is printed when empty.
+	LinkURL string
+
+	// Args controls how the arguments are printed.
+	Args stack.ArgsFormat
 }
 
 // pathFormat determines how much to show.
@@ -120,6 +132,7 @@ func (p *Palette) BucketHeader(bucket *stack.Bucket, pf pathFormat, multipleBuck
 	if c := pf.createdByString(&bucket.Signature); c != "" {
 		extra += p.CreatedBy + " [Created by " + c + "]"
 	}
+	extra += p.BucketID + " [" + bucket.ShortID() + "]"
 	return fmt.Sprintf(
 		"%s%d: %s%s%s\n",
 		p.routineColor(bucket, multipleBuckets), len(bucket.IDs),
@@ -127,17 +140,89 @@ func (p *Palette) BucketHeader(bucket *stack.Bucket, pf pathFormat, multipleBuck
 		p.EOLReset)
 }
 
+// parseArgsFormat parses the comma separated list of options of -args.
+func parseArgsFormat(s string) (stack.ArgsFormat, error) {
+	var f stack.ArgsFormat
+	if s == "" {
+		return f, nil
+	}
+	for _, o := range strings.Split(s, ",") {
+		switch strings.TrimSpace(o) {
+		case "off":
+			f.Off = true
+		case "dec":
+			f.Decimal = true
+		case "nozero":
+			f.ElideZero = true
+		case "collapse":
+			f.CollapseRepeated = true
+		default:
+			return f, fmt.Errorf("invalid -args %q; valid options are: dec, nozero, collapse, off", o)
+		}
+	}
+	return f, nil
+}
+
 // callLine prints one stack line.
 func (p *Palette) callLine(line *stack.Call, srcLen, pkgLen int, pf pathFormat) string {
+	src := pf.formatCall(line)
+	if p.LinkURL != "" {
+		// Pad outside of the link so the escape sequence doesn't count.
+		pad := ""
+		if l := srcLen - len(src); l > 0 {
+			pad = strings.Repeat(" ", l)
+		}
+		src = hyperlink(linkURL(p.LinkURL, line), src) + pad
+		srcLen = 0
+	}
+	inlined := ""
+	if line.Inlined {
+		inlined = " [inlined]"
+	}
 	return fmt.Sprintf(
-		"    %s%-*s %s%-*s %s%s%s(%s)%s",
+		"    %s%-*s %s%-*s %s%s%s(%s)%s%s",
 		p.Package, pkgLen, line.Func.PkgName(),
-		p.SrcFile, srcLen, pf.formatCall(line),
+		p.SrcFile, srcLen, src,
 		p.functionColor(line), line.Func.Name(),
-		p.Arguments, &line.Args,
+		p.Arguments, line.Args.Format(&p.Args), inlined,
 		p.EOLReset)
 }
 
+// Summary prints the number of goroutines and buckets followed by the number of
+// goroutines in each state, the most common first.
+func (p *Palette) Summary(buckets []*stack.Bucket) string {
+	total := 0
+	states := map[string]int{}
+	for _, b := range buckets {
+		for state, n := range b.Stats.States {
+			states[state] += n
+			total += n
+		}
+	}
+	names := make([]string, 0, len(states))
+	for state := range states {
+		names = append(names, state)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if states[names[i]] != states[names[j]] {
+			return states[names[i]] > states[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for i, state := range names {
+		names[i] = fmt.Sprintf("%d %s", states[state], state)
+	}
+	return fmt.Sprintf("%s%s, %s: %s%s\n", p.Routine, plural(total, "goroutine"), plural(len(buckets), "bucket"), strings.Join(names, ", "), p.EOLReset)
+}
+
+// plural returns n followed by noun, in the plural form when n is not 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
 // StackLines prints one complete stack trace, without the header.
 func (p *Palette) StackLines(signature *stack.Signature, srcLen, pkgLen int, pf pathFormat) string {
 	out := make([]string, len(signature.Stack.Calls))
@@ -16,6 +16,7 @@ var testPalette = &Palette{
 	RoutineFirst:       "B",
 	Routine:            "C",
 	CreatedBy:          "D",
+	BucketID:           "M",
 	Package:            "E",
 	SrcFile:            "F",
 	FuncStdLib:         "G",
@@ -69,12 +70,12 @@ func TestBucketHeader(t *testing.T) {
 		First: true,
 	}
 	// When printing, it prints the remote path, not the transposed local path.
-	compareString(t, "B2: chan receive [2~6 minutes]D [Created by main.mainImpl @ /home/user/go/src/github.com/foo/bar/baz.go:74]A\n", testPalette.BucketHeader(b, fullPath, true))
-	compareString(t, "C2: chan receive [2~6 minutes]D [Created by main.mainImpl @ /home/user/go/src/github.com/foo/bar/baz.go:74]A\n", testPalette.BucketHeader(b, fullPath, false))
-	compareString(t, "B2: chan receive [2~6 minutes]D [Created by main.mainImpl @ github.com/foo/bar/baz.go:74]A\n", testPalette.BucketHeader(b, relPath, true))
-	compareString(t, "C2: chan receive [2~6 minutes]D [Created by main.mainImpl @ github.com/foo/bar/baz.go:74]A\n", testPalette.BucketHeader(b, relPath, false))
-	compareString(t, "B2: chan receive [2~6 minutes]D [Created by main.mainImpl @ baz.go:74]A\n", testPalette.BucketHeader(b, basePath, true))
-	compareString(t, "C2: chan receive [2~6 minutes]D [Created by main.mainImpl @ baz.go:74]A\n", testPalette.BucketHeader(b, basePath, false))
+	compareString(t, "B2: chan receive [2~6 minutes]D [Created by main.mainImpl @ /home/user/go/src/github.com/foo/bar/baz.go:74]M [dacae300]A\n", testPalette.BucketHeader(b, fullPath, true))
+	compareString(t, "C2: chan receive [2~6 minutes]D [Created by main.mainImpl @ /home/user/go/src/github.com/foo/bar/baz.go:74]M [dacae300]A\n", testPalette.BucketHeader(b, fullPath, false))
+	compareString(t, "B2: chan receive [2~6 minutes]D [Created by main.mainImpl @ github.com/foo/bar/baz.go:74]M [dacae300]A\n", testPalette.BucketHeader(b, relPath, true))
+	compareString(t, "C2: chan receive [2~6 minutes]D [Created by main.mainImpl @ github.com/foo/bar/baz.go:74]M [dacae300]A\n", testPalette.BucketHeader(b, relPath, false))
+	compareString(t, "B2: chan receive [2~6 minutes]D [Created by main.mainImpl @ baz.go:74]M [dacae300]A\n", testPalette.BucketHeader(b, basePath, true))
+	compareString(t, "C2: chan receive [2~6 minutes]D [Created by main.mainImpl @ baz.go:74]M [dacae300]A\n", testPalette.BucketHeader(b, basePath, false))
 
 	b = &stack.Bucket{
 		Signature: stack.Signature{
@@ -86,7 +87,39 @@ func TestBucketHeader(t *testing.T) {
 		IDs:   []int{},
 		First: true,
 	}
-	compareString(t, "C0: b0rked [6 minutes] [locked]A\n", testPalette.BucketHeader(b, basePath, false))
+	compareString(t, "C0: b0rked [6 minutes] [locked]M [4ea9a68c]A\n", testPalette.BucketHeader(b, basePath, false))
+}
+
+func TestSummary(t *testing.T) {
+	t.Parallel()
+	buckets := []*stack.Bucket{
+		{Stats: stack.BucketStats{States: map[string]int{"chan receive": 80}}},
+		{Stats: stack.BucketStats{States: map[string]int{"IO wait": 40, "select": 12}}},
+		{Stats: stack.BucketStats{States: map[string]int{"running": 1, "chan receive": 9}}},
+	}
+	compareString(t, "C142 goroutines, 3 buckets: 89 chan receive, 40 IO wait, 12 select, 1 runningA\n", testPalette.Summary(buckets))
+	buckets = []*stack.Bucket{{Stats: stack.BucketStats{States: map[string]int{"running": 1}}}}
+	compareString(t, "C1 goroutine, 1 bucket: 1 runningA\n", testPalette.Summary(buckets))
+}
+
+func TestParseArgsFormat(t *testing.T) {
+	t.Parallel()
+	f, err := parseArgsFormat("dec, nozero,collapse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (stack.ArgsFormat{Decimal: true, ElideZero: true, CollapseRepeated: true}); f != want {
+		t.Fatalf("unexpected %+v", f)
+	}
+	if f, err = parseArgsFormat("off"); err != nil || !f.Off {
+		t.Fatalf("unexpected %+v, %v", f, err)
+	}
+	if f, err = parseArgsFormat(""); err != nil || f != (stack.ArgsFormat{}) {
+		t.Fatalf("unexpected %+v, %v", f, err)
+	}
+	if _, err = parseArgsFormat("hex"); err == nil {
+		t.Fatal("expected error")
+	}
 }
 
 func TestStackLines(t *testing.T) {
@@ -138,12 +171,13 @@ func TestStackLines(t *testing.T) {
 			Elided: true,
 		},
 	}
+	s.Stack.Calls[3].Inlined = true
 	// When printing, it prints the remote path, not the transposed local path.
 	want := "" +
 		"    Eruntime    F/goroot/src/runtime/sys_linux_amd64.s:400 HEpollwaitL(4, 0x7fff671c7118, 0xffffffff00000080, 0, 0xffffffff0028c1be, 0, 0, 0, 0, 0, ...)A\n" +
 		"    Eruntime    F/goroot/src/runtime/netpoll_epoll.go:68 GnetpollL(0x901b01, 0)A\n" +
 		"    Emain       F/home/user/go/src/main.go:1472 IMainL(0xc208012000)A\n" +
-		"    Efoo        F/home/user/go/src/foo/bar.go:1575 KOtherExportedL()A\n" +
+		"    Efoo        F/home/user/go/src/foo/bar.go:1575 KOtherExportedL() [inlined]A\n" +
 		"    Efoo        F/home/user/go/src/foo/bar.go:10 JotherPrivateL()A\n" +
 		"    (...)\n"
 	compareString(t, want, testPalette.StackLines(s, 10, 10, fullPath))
@@ -151,10 +185,21 @@ func TestStackLines(t *testing.T) {
 		"    Eruntime    Fsys_linux_amd64.s:400 HEpollwaitL(4, 0x7fff671c7118, 0xffffffff00000080, 0, 0xffffffff0028c1be, 0, 0, 0, 0, 0, ...)A\n" +
 		"    Eruntime    Fnetpoll_epoll.go:68 GnetpollL(0x901b01, 0)A\n" +
 		"    Emain       Fmain.go:1472 IMainL(0xc208012000)A\n" +
-		"    Efoo        Fbar.go:1575 KOtherExportedL()A\n" +
+		"    Efoo        Fbar.go:1575 KOtherExportedL() [inlined]A\n" +
 		"    Efoo        Fbar.go:10  JotherPrivateL()A\n" +
 		"    (...)\n"
 	compareString(t, want, testPalette.StackLines(s, 10, 10, basePath))
+
+	p := *testPalette
+	p.Args = stack.ArgsFormat{Off: true}
+	want = "" +
+		"    Eruntime    Fsys_linux_amd64.s:400 HEpollwaitL(...)A\n" +
+		"    Eruntime    Fnetpoll_epoll.go:68 GnetpollL(...)A\n" +
+		"    Emain       Fmain.go:1472 IMainL(...)A\n" +
+		"    Efoo        Fbar.go:1575 KOtherExportedL() [inlined]A\n" +
+		"    Efoo        Fbar.go:10  JotherPrivateL()A\n" +
+		"    (...)\n"
+	compareString(t, want, p.StackLines(s, 10, 10, basePath))
 }
 
 //
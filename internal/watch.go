@@ -0,0 +1,218 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+	"github.com/maruel/panicparse/terminal"
+)
+
+// maxWatchGoroutines is the maximum number of goroutines kept by "pp watch".
+// The oldest ones are dropped first.
+const maxWatchGoroutines = 1 << 16
+
+// watchMain implements "pp watch", which follows a log file like "tail -f"
+// and prints the aggregated stack traces found in it each time a new one
+// appears.
+func watchMain(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("interval", time.Second, "How often to check the file for new data")
+	all := fs.Bool("all", false, "Also process the content already in the file, instead of only what is appended")
+	aggressive := fs.Bool("aggressive", false, "Aggressive deduplication including non pointers")
+	color := colorFlags(fs)
+	execFlag := fs.String("exec", "", "Command to run with the shell on each new panic, receiving the -json document on stdin, ex: -exec 'notify-send panic'")
+	cfg, err := subcommandConfig(fs)
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Permit "pp watch service.log -all" since flag stops at the first non-flag
+	// argument.
+	var files []string
+	for fs.NArg() != 0 {
+		files = append(files, fs.Arg(0))
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if len(files) != 1 {
+		return errors.New("specify a single file to watch")
+	}
+	w := newWatcher(files[0], newHook(*execFlag))
+	if !*all {
+		if err := w.skip(); err != nil {
+			return err
+		}
+	}
+	s := stack.AnyPointer
+	if *aggressive {
+		s = stack.AnyValue
+	}
+	var out io.Writer = os.Stdout
+	p := &Palette{}
+	useColor := color()
+	if useColor {
+		if p, err = loadPalette(cfg.colors); err != nil {
+			return err
+		}
+		out = terminal.NewWriter(os.Stdout)
+	}
+	for {
+		changed, err := w.poll()
+		if err != nil {
+			return err
+		}
+		if changed {
+			if err := w.render(out, p, s, useColor); err != nil {
+				return err
+			}
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// watcher follows a log file, handling rotation and truncation.
+type watcher struct {
+	path   string
+	f      *os.File
+	offset int64
+	// parser parses the data as it is read, so only the new data is parsed.
+	parser *stack.IncrementalParser
+	// dropped is the number of goroutines dropped to keep up to
+	// maxWatchGoroutines.
+	dropped int
+	// seen is the number of goroutines found the last time they were rendered,
+	// including the ones dropped.
+	seen int
+	// hook is run when a new panic is found, if not nil.
+	hook *hook
+	// panicLine is the line of the last panic the hook was run for.
+	panicLine int
+}
+
+// newWatcher returns a watcher following the log file path.
+func newWatcher(path string, h *hook) *watcher {
+	// Resync so a stack trace still being written doesn't stop the parsing.
+	p := stack.NewIncrementalParser(ioutil.Discard, &stack.Opts{Resync: true})
+	return &watcher{path: path, parser: p, hook: h}
+}
+
+// skip moves to the end of the file, so only the data appended afterward is
+// processed.
+func (w *watcher) skip() error {
+	f, err := os.Open(w.path)
+	if err != nil {
+		return fmt.Errorf("did you mean to specify a valid log file name? "+wrap, err)
+	}
+	if w.offset, err = f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+	w.f = f
+	return nil
+}
+
+// poll reads the data appended to the file since the last call. It returns
+// true if there was any.
+//
+// When the file was rotated, the rest of the old file is read before
+// switching to the new one. When the file was truncated, it is read from the
+// start.
+func (w *watcher) poll() (bool, error) {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// In the middle of a rotation.
+			return false, nil
+		}
+		return false, err
+	}
+	changed := false
+	if w.f != nil {
+		cur, err := w.f.Stat()
+		if err != nil {
+			return false, err
+		}
+		if !os.SameFile(fi, cur) {
+			if changed, err = w.read(); err != nil {
+				return changed, err
+			}
+			w.f.Close()
+			w.f = nil
+		} else if fi.Size() < w.offset {
+			if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+				return false, err
+			}
+			w.offset = 0
+		}
+	}
+	if w.f == nil {
+		if w.f, err = os.Open(w.path); err != nil {
+			return changed, err
+		}
+		w.offset = 0
+	}
+	c, err := w.read()
+	return changed || c, err
+}
+
+// read parses what is left to read in the current file.
+func (w *watcher) read() (bool, error) {
+	b, err := ioutil.ReadAll(w.f)
+	if len(b) == 0 {
+		return false, err
+	}
+	w.offset += int64(len(b))
+	if err := w.add(b); err != nil {
+		return true, err
+	}
+	return true, err
+}
+
+// add parses the data b, keeping up to maxWatchGoroutines goroutines.
+func (w *watcher) add(b []byte) error {
+	if _, err := w.parser.Write(b); err != nil {
+		return err
+	}
+	w.dropped += w.parser.Keep(maxWatchGoroutines)
+	return nil
+}
+
+// render prints the aggregated stack traces found so far, if there is a new
+// one since the last call. If clear is true, the terminal is cleared first.
+func (w *watcher) render(out io.Writer, p *Palette, s stack.Similarity, clear bool) error {
+	c := w.parser.Context()
+	if len(c.Goroutines) == 0 || w.dropped+len(c.Goroutines) == w.seen {
+		return nil
+	}
+	w.seen = w.dropped + len(c.Goroutines)
+	if clear {
+		_, _ = io.WriteString(out, "\033[H\033[2J")
+	}
+	if _, err := fmt.Fprintf(out, "%s: %d goroutines\n", time.Now().Format("15:04:05"), len(c.Goroutines)); err != nil {
+		return err
+	}
+	buckets := stack.Aggregate(c.Goroutines, s)
+	if err := writeToConsole(out, p, buckets, basePath, false, nil, nil, nil, nil, nil); err != nil {
+		return err
+	}
+	// The panics are the ones of the last stack dump in the log, only fire
+	// once per dump.
+	if len(c.Panics) != 0 && c.Panics[0].Line != w.panicLine {
+		w.panicLine = c.Panics[0].Line
+		w.hook.fire(c, buckets)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/internal/internaltest"
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "panicparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(d); err != nil {
+			t.Error(err)
+		}
+	}()
+	p := filepath.Join(d, "service.log")
+	if err := ioutil.WriteFile(p, []byte("old\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	appendFile := func(s string) {
+		f, err := os.OpenFile(p, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// want is the data parsed so far.
+	poll := func(w *watcher, changed bool, want string) {
+		c, err := w.poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != changed {
+			t.Fatalf("expected changed=%t", changed)
+		}
+		if o := w.parser.Offset(); o != int64(len(want)) {
+			t.Fatalf("expected %q to be parsed, got %d bytes", want, o)
+		}
+	}
+
+	w := newWatcher(p, nil)
+	if err := w.skip(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.f.Close()
+	poll(w, false, "")
+	appendFile("a\n")
+	poll(w, true, "a\n")
+	poll(w, false, "a\n")
+
+	// Rotation; the data appended to the old file before is kept.
+	appendFile("b\n")
+	if err := os.Rename(p, p+".1"); err != nil {
+		t.Fatal(err)
+	}
+	poll(w, false, "a\n")
+	appendFile("ccc\n")
+	poll(w, true, "a\nb\nccc\n")
+
+	// Truncation, detected as the file is smaller than what was read.
+	if err := ioutil.WriteFile(p, []byte("d\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	poll(w, true, "a\nb\nccc\nd\n")
+}
+
+func TestWatcherRender(t *testing.T) {
+	t.Parallel()
+	w := newWatcher("", nil)
+	add := func(s string) {
+		if err := w.add([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("junk\n")
+	out := &bytes.Buffer{}
+	if err := w.render(out, &Palette{}, stack.AnyPointer, false); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "", out.String())
+
+	add(string(internaltest.PanicOutputs()["simple"]))
+	if err := w.render(out, &Palette{}, stack.AnyPointer, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), ": 1 goroutines\n") || !strings.Contains(out.String(), "main.go:52") {
+		t.Fatalf("unexpected %q", out.String())
+	}
+
+	// Not rendered again when there is no new goroutine.
+	out.Reset()
+	add("more junk\n")
+	if err := w.render(out, &Palette{}, stack.AnyPointer, false); err != nil {
+		t.Fatal(err)
+	}
+	compareString(t, "", out.String())
+}
+
+func TestWatcherKeep(t *testing.T) {
+	t.Parallel()
+	w := newWatcher("", nil)
+	g := "goroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:10 +0x20\n\n"
+	if err := w.add([]byte(strings.Repeat(g, maxWatchGoroutines+2))); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(w.parser.Context().Goroutines); n != maxWatchGoroutines || w.dropped != 2 {
+		t.Fatalf("unexpected %d goroutines, %d dropped", n, w.dropped)
+	}
+	out := &bytes.Buffer{}
+	if err := w.render(out, &Palette{}, stack.AnyPointer, false); err != nil {
+		t.Fatal(err)
+	}
+	if w.seen != maxWatchGoroutines+2 {
+		t.Fatalf("unexpected seen %d", w.seen)
+	}
+	// A new goroutine is rendered even if the number kept doesn't change.
+	out.Reset()
+	if err := w.add([]byte("goroutine 2 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:10 +0x20\n\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.render(out, &Palette{}, stack.AnyPointer, false); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() == 0 {
+		t.Fatal("expected output")
+	}
+}
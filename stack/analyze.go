@@ -0,0 +1,360 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// This file contains heuristics to find problems in a snapshot of goroutines.
+
+package stack
+
+import (
+	"sort"
+	"strings"
+)
+
+// Analysis is the result of heuristics run over the goroutines of a stack
+// dump.
+//
+// Everything reported is a guess; the stack dump doesn't contain enough
+// information to be certain.
+type Analysis struct {
+	// Deadlocks is the probable deadlocks found.
+	Deadlocks []Deadlock
+	// Leaks is the probable goroutine leaks found, the largest first.
+	Leaks []LeakSuspect
+	// WaitGroupings is the goroutines blocked on each channel or mutex, the
+	// largest first.
+	WaitGroupings []WaitGrouping
+}
+
+// Deadlock is a group of goroutines that are probably waiting on each other.
+type Deadlock struct {
+	// IDs is the ID of each goroutine in the cycle, sorted.
+	IDs []int
+	// Addrs is the address of the channel or mutex each goroutine in IDs is
+	// blocked on, in the same order as IDs.
+	Addrs []uint64
+}
+
+// WaitGrouping is the goroutines blocked on the same channel or mutex, along
+// with the goroutines that can probably unblock them.
+type WaitGrouping struct {
+	// Addr is the address of the channel or mutex.
+	Addr uint64
+	// Waiters is the ID of each goroutine blocked on Addr, sorted.
+	Waiters []int
+	// Holders is the ID of each goroutine referencing Addr in its calls'
+	// arguments without being blocked on it, sorted. These are the goroutines
+	// that can probably send to the channel or unlock the mutex.
+	Holders []int
+}
+
+// LeakKind is the heuristic that flagged a LeakSuspect.
+type LeakKind int
+
+const (
+	// LeakBlocked is many goroutines blocked with the same stack for a long
+	// time.
+	LeakBlocked LeakKind = iota
+	// LeakCreatedBy is many goroutines created by the same call site.
+	LeakCreatedBy
+)
+
+func (l LeakKind) String() string {
+	switch l {
+	case LeakBlocked:
+		return "blocked"
+	case LeakCreatedBy:
+		return "created by"
+	default:
+		return "unknown"
+	}
+}
+
+// LeakSuspect is a group of goroutines that are probably leaked.
+type LeakSuspect struct {
+	// Kind is the heuristic that flagged these goroutines.
+	Kind LeakKind
+	// Call is the top of the stack the goroutines are blocked in for
+	// LeakBlocked, or the call site that created them for LeakCreatedBy.
+	Call Call
+	// State is the state of the goroutines. Only set for LeakBlocked.
+	State string
+	// SleepMin is the minimum wait time in minutes across the goroutines. Only
+	// set for LeakBlocked.
+	SleepMin int
+	// IDs is the ID of each goroutine, sorted.
+	IDs []int
+}
+
+// Analyze runs heuristics over the goroutines to find probable problems.
+//
+// Goroutines blocked on a channel or a mutex are detected by looking at the
+// runtime and sync package frames, whose first argument is the address of
+// the channel or mutex. Another goroutine referencing the same address in one
+// of its calls' arguments is assumed to be the one that could unblock it. This
+// builds a wait-for graph, and the cycles in this graph are reported as
+// probable deadlocks.
+//
+// It is much more useful when the code was compiled with inlining disabled,
+// as pointers are less likely to be optimized away from the arguments.
+//
+// Goroutines blocked on the same channel or mutex are grouped together, with
+// the goroutines referencing it. A grouping is reported when there is more
+// than one waiter or when at least one other goroutine references it.
+//
+// Goroutines are suspected to be leaked when at least 100 of them have been
+// blocked with the same stack for 10 minutes or more, or when at least 100 of
+// them were created by the same call site. A single stack dump can't tell if
+// their number is growing, so compare the suspects of multiple dumps to be
+// sure.
+func Analyze(goroutines []*Goroutine) *Analysis {
+	return &Analysis{
+		Deadlocks:     findDeadlocks(goroutines),
+		Leaks:         findLeaks(goroutines),
+		WaitGroupings: findWaitGroupings(goroutines),
+	}
+}
+
+// Private stuff.
+
+const (
+	// leakMinGoroutines is the minimum number of similar goroutines to be
+	// suspected of leaking.
+	leakMinGoroutines = 100
+	// leakMinSleep is the minimum wait time in minutes of blocked goroutines to
+	// be suspected of leaking.
+	leakMinSleep = 10
+)
+
+// blockingFuncs is the functions that block on the object passed as their
+// first argument.
+var blockingFuncs = map[string]struct{}{
+	"runtime.chanrecv":       {},
+	"runtime.chanrecv1":      {},
+	"runtime.chanrecv2":      {},
+	"runtime.chansend":       {},
+	"runtime.chansend1":      {},
+	"sync.(*Mutex).Lock":     {},
+	"sync.(*Mutex).lockSlow": {},
+	"sync.(*RWMutex).Lock":   {},
+	"sync.(*RWMutex).RLock":  {},
+}
+
+// blockedOn returns the address of the channel or mutex the goroutine is
+// blocked on, if any.
+func blockedOn(g *Goroutine) (uint64, bool) {
+	if !strings.HasPrefix(g.State, "chan ") && !strings.HasPrefix(g.State, "semacquire") && !strings.HasPrefix(g.State, "sync.") {
+		return 0, false
+	}
+	for i := range g.Stack.Calls {
+		c := &g.Stack.Calls[i]
+		if _, ok := blockingFuncs[c.Func.Raw]; ok && len(c.Args.Values) != 0 && c.Args.Values[0].IsPtr() {
+			return c.Args.Values[0].Value, true
+		}
+	}
+	return 0, false
+}
+
+// findDeadlocks builds the wait-for graph and returns its strongly connected
+// components that have more than one goroutine.
+func findDeadlocks(goroutines []*Goroutine) []Deadlock {
+	addrs := make([]uint64, len(goroutines))
+	blocked := make([]bool, len(goroutines))
+	for i, g := range goroutines {
+		addrs[i], blocked[i] = blockedOn(g)
+	}
+	// refs lists the blocked goroutines referencing each address, since only
+	// blocked goroutines can be part of a deadlock.
+	refs := map[uint64][]int{}
+	for i, g := range goroutines {
+		if !blocked[i] {
+			continue
+		}
+		for j := range g.Stack.Calls {
+			for _, a := range g.Stack.Calls[j].Args.Values {
+				if l := refs[a.Value]; a.IsPtr() && (len(l) == 0 || l[len(l)-1] != i) {
+					refs[a.Value] = append(l, i)
+				}
+			}
+		}
+	}
+	// edges[i] lists the goroutines that i is waiting on. A goroutine blocked on
+	// the same object is not considered to be holding it.
+	edges := make([][]int, len(goroutines))
+	for i := range goroutines {
+		if !blocked[i] {
+			continue
+		}
+		for _, j := range refs[addrs[i]] {
+			if addrs[j] != addrs[i] {
+				edges[i] = append(edges[i], j)
+			}
+		}
+	}
+
+	// Tarjan's strongly connected components algorithm.
+	index := make([]int, len(goroutines))
+	low := make([]int, len(goroutines))
+	onStack := make([]bool, len(goroutines))
+	for i := range index {
+		index[i] = -1
+	}
+	var stack []int
+	var out []Deadlock
+	next := 0
+	var visit func(v int)
+	visit = func(v int) {
+		index[v] = next
+		low[v] = next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range edges[v] {
+			if index[w] == -1 {
+				visit(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
+				}
+			} else if onStack[w] && index[w] < low[v] {
+				low[v] = index[w]
+			}
+		}
+		if low[v] != index[v] {
+			return
+		}
+		var scc []int
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			scc = append(scc, w)
+			if w == v {
+				break
+			}
+		}
+		if len(scc) < 2 {
+			return
+		}
+		sort.Slice(scc, func(i, j int) bool { return goroutines[scc[i]].ID < goroutines[scc[j]].ID })
+		d := Deadlock{IDs: make([]int, len(scc)), Addrs: make([]uint64, len(scc))}
+		for i, w := range scc {
+			d.IDs[i] = goroutines[w].ID
+			d.Addrs[i] = addrs[w]
+		}
+		out = append(out, d)
+	}
+	for i := range goroutines {
+		if blocked[i] && index[i] == -1 {
+			visit(i)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].IDs[0] < out[j].IDs[0] })
+	return out
+}
+
+// findLeaks returns the groups of goroutines that are probably leaked, the
+// largest first.
+func findLeaks(goroutines []*Goroutine) []LeakSuspect {
+	var out []LeakSuspect
+	for _, b := range Aggregate(goroutines, AnyValue) {
+		if len(b.IDs) < leakMinGoroutines || b.Stats.SleepMin < leakMinSleep || len(b.Stack.Calls) == 0 {
+			continue
+		}
+		if b.State == "running" || b.State == "runnable" {
+			continue
+		}
+		ids := make([]int, len(b.IDs))
+		copy(ids, b.IDs)
+		sort.Ints(ids)
+		out = append(out, LeakSuspect{Kind: LeakBlocked, Call: b.Stack.Calls[0], State: b.State, SleepMin: b.Stats.SleepMin, IDs: ids})
+	}
+
+	// Group by the creator's call site. The arguments are not printed for
+	// "created by" so it is not taken into account.
+	type site struct {
+		fn   string
+		path string
+		line int
+	}
+	var order []site
+	created := map[site][]*Goroutine{}
+	for _, g := range goroutines {
+		if g.CreatedBy.Func.Raw == "" {
+			continue
+		}
+		k := site{g.CreatedBy.Func.Raw, g.CreatedBy.SrcPath, g.CreatedBy.Line}
+		if _, ok := created[k]; !ok {
+			order = append(order, k)
+		}
+		created[k] = append(created[k], g)
+	}
+	for _, k := range order {
+		l := created[k]
+		if len(l) < leakMinGoroutines {
+			continue
+		}
+		ids := make([]int, len(l))
+		for i, g := range l {
+			ids[i] = g.ID
+		}
+		sort.Ints(ids)
+		out = append(out, LeakSuspect{Kind: LeakCreatedBy, Call: l[0].CreatedBy, IDs: ids})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if len(out[i].IDs) != len(out[j].IDs) {
+			return len(out[i].IDs) > len(out[j].IDs)
+		}
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].IDs[0] < out[j].IDs[0]
+	})
+	return out
+}
+
+// findWaitGroupings groups the blocked goroutines by the channel or mutex they
+// are blocked on, and cross-links them with the goroutines referencing it.
+func findWaitGroupings(goroutines []*Goroutine) []WaitGrouping {
+	addrs := make([]uint64, len(goroutines))
+	blocked := make([]bool, len(goroutines))
+	waiters := map[uint64][]int{}
+	for i, g := range goroutines {
+		if addrs[i], blocked[i] = blockedOn(g); blocked[i] {
+			waiters[addrs[i]] = append(waiters[addrs[i]], g.ID)
+		}
+	}
+	holders := map[uint64][]int{}
+	for i, g := range goroutines {
+		for j := range g.Stack.Calls {
+			for _, a := range g.Stack.Calls[j].Args.Values {
+				if !a.IsPtr() || (blocked[i] && addrs[i] == a.Value) {
+					continue
+				}
+				if _, ok := waiters[a.Value]; !ok {
+					continue
+				}
+				if l := holders[a.Value]; len(l) == 0 || l[len(l)-1] != g.ID {
+					holders[a.Value] = append(l, g.ID)
+				}
+			}
+		}
+	}
+	var out []WaitGrouping
+	for addr, w := range waiters {
+		h := holders[addr]
+		if len(w) < 2 && len(h) == 0 {
+			continue
+		}
+		sort.Ints(w)
+		sort.Ints(h)
+		out = append(out, WaitGrouping{Addr: addr, Waiters: w, Holders: h})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if len(out[i].Waiters) != len(out[j].Waiters) {
+			return len(out[i].Waiters) > len(out[j].Waiters)
+		}
+		return out[i].Addr < out[j].Addr
+	})
+	return out
+}
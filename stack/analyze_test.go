@@ -0,0 +1,171 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnalyzeDeadlock(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [semacquire]:",
+		"sync.runtime_SemacquireMutex(0xc000010014, 0x0, 0x1)",
+		"	/goroot/src/runtime/sema.go:71 +0x47",
+		"sync.(*Mutex).lockSlow(0xc000010010)",
+		"	/goroot/src/sync/mutex.go:138 +0xfc",
+		"sync.(*Mutex).Lock(...)",
+		"	/goroot/src/sync/mutex.go:81",
+		"main.lockBoth(0xc000010000, 0xc000010010)",
+		"	/gopath/src/foo/main.go:12 +0x5b",
+		"",
+		"goroutine 6 [semacquire]:",
+		"sync.runtime_SemacquireMutex(0xc000010004, 0x0, 0x1)",
+		"	/goroot/src/runtime/sema.go:71 +0x47",
+		"sync.(*Mutex).lockSlow(0xc000010000)",
+		"	/goroot/src/sync/mutex.go:138 +0xfc",
+		"sync.(*Mutex).Lock(...)",
+		"	/goroot/src/sync/mutex.go:81",
+		"main.lockBoth(0xc000010010, 0xc000010000)",
+		"	/gopath/src/foo/main.go:12 +0x5b",
+		"",
+		"goroutine 7 [chan receive]:",
+		"runtime.chanrecv1(0xc000020000, 0x0)",
+		"	/goroot/src/runtime/chan.go:414 +0x2b",
+		"main.wait(0xc000020000, 0xc000010000)",
+		"	/gopath/src/foo/main.go:20 +0x2b",
+		"",
+		"goroutine 8 [running]:",
+		"main.send(0xc000020000)",
+		"	/gopath/src/foo/main.go:30 +0x2b",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Analysis{
+		Deadlocks: []Deadlock{
+			{IDs: []int{1, 6}, Addrs: []uint64{0xc000010010, 0xc000010000}},
+		},
+		WaitGroupings: []WaitGrouping{
+			{Addr: 0xc000010000, Waiters: []int{6}, Holders: []int{1, 7}},
+			{Addr: 0xc000010010, Waiters: []int{1}, Holders: []int{6}},
+			{Addr: 0xc000020000, Waiters: []int{7}, Holders: []int{8}},
+		},
+	}
+	if diff := cmp.Diff(want, Analyze(c.Goroutines)); diff != "" {
+		t.Fatalf("Analysis mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyzeNoDeadlock(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [chan receive]:",
+		"runtime.chanrecv1(0xc000020000, 0x0)",
+		"	/goroot/src/runtime/chan.go:414 +0x2b",
+		"main.wait(0xc000020000)",
+		"	/gopath/src/foo/main.go:20 +0x2b",
+		"",
+		"goroutine 2 [chan receive]:",
+		"runtime.chanrecv1(0xc000020000, 0x0)",
+		"	/goroot/src/runtime/chan.go:414 +0x2b",
+		"main.wait(0xc000020000)",
+		"	/gopath/src/foo/main.go:20 +0x2b",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Analysis{
+		WaitGroupings: []WaitGrouping{
+			{Addr: 0xc000020000, Waiters: []int{1, 2}},
+		},
+	}
+	if diff := cmp.Diff(want, Analyze(c.Goroutines)); diff != "" {
+		t.Fatalf("Analysis mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyzeLeaks(t *testing.T) {
+	t.Parallel()
+	recv := Call{
+		SrcPath: "/goroot/src/runtime/chan.go",
+		Line:    414,
+		Func:    Func{Raw: "runtime.chanrecv1"},
+		Args:    Args{Values: []Arg{{Value: 0xc000020000}, {}}},
+	}
+	creator := Call{
+		SrcPath: "/gopath/src/foo/main.go",
+		Line:    42,
+		Func:    Func{Raw: "main.serve"},
+	}
+	var goroutines []*Goroutine
+	// 120 goroutines blocked for a long time.
+	for i := 0; i < 120; i++ {
+		goroutines = append(goroutines, &Goroutine{
+			Signature: Signature{
+				State:    "chan receive",
+				SleepMin: 11 + i%3,
+				SleepMax: 11 + i%3,
+				Stack:    Stack{Calls: []Call{recv}},
+			},
+			ID: 10 + i,
+		})
+	}
+	// 150 goroutines created by the same call site, doing work.
+	for i := 0; i < 150; i++ {
+		goroutines = append(goroutines, &Goroutine{
+			Signature: Signature{
+				State:     "running",
+				CreatedBy: creator,
+				Stack:     Stack{Calls: []Call{{SrcPath: "/gopath/src/foo/main.go", Line: 50, Func: Func{Raw: "main.handle"}}}},
+			},
+			ID: 1000 + i,
+		})
+	}
+	// 120 goroutines blocked recently; not suspect.
+	for i := 0; i < 120; i++ {
+		goroutines = append(goroutines, &Goroutine{
+			Signature: Signature{
+				State:    "select",
+				SleepMin: 2,
+				SleepMax: 2,
+				Stack:    Stack{Calls: []Call{{SrcPath: "/gopath/src/foo/main.go", Line: 60, Func: Func{Raw: "main.loop"}}}},
+			},
+			ID: 2000 + i,
+		})
+	}
+	want := []LeakSuspect{
+		{Kind: LeakCreatedBy, Call: creator, IDs: seqIDs(1000, 150)},
+		{Kind: LeakBlocked, Call: recv, State: "chan receive", SleepMin: 11, IDs: seqIDs(10, 120)},
+	}
+	if diff := cmp.Diff(want, Analyze(goroutines).Leaks); diff != "" {
+		t.Fatalf("LeakSuspect mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLeakKind(t *testing.T) {
+	t.Parallel()
+	compareString(t, "blocked", LeakBlocked.String())
+	compareString(t, "created by", LeakCreatedBy.String())
+	compareString(t, "unknown", LeakKind(-1).String())
+}
+
+// seqIDs returns n sequential IDs starting at start.
+func seqIDs(start, n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = start + i
+	}
+	return out
+}
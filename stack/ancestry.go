@@ -0,0 +1,125 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+// AncestryNode is the goroutines created by the same call site, along with the
+// goroutines they created in turn.
+type AncestryNode struct {
+	// CreatedBy is the call site that created the goroutines. It is the zero
+	// value for goroutines without a creator, e.g. the main goroutine.
+	CreatedBy Call
+	// Goroutines is the goroutines created by CreatedBy, in the order they were
+	// printed.
+	Goroutines []*Goroutine
+	// Children is the nodes for the goroutines created by Goroutines, in the
+	// order they were printed.
+	Children []*AncestryNode
+	// Count is the number of goroutines in this node and all its descendants.
+	Count int
+}
+
+// Ancestry organizes the goroutines into a forest keyed by the call site that
+// created them.
+//
+// Starting with Go 1.21, the stack dump contains the ID of the goroutine that
+// created each goroutine, see Signature.CreatedByID, so a node is the parent
+// of another when it contains the goroutine that created the other's
+// goroutines. With older versions, a node is deemed to be the parent of
+// another when the function that started its goroutines is the one that
+// created the other's goroutines. Nodes whose creator can't be found, e.g.
+// because it exited, are roots.
+//
+// The roots are returned in the order they were printed.
+func (c *Context) Ancestry() []*AncestryNode {
+	type site struct {
+		fn   string
+		path string
+		line int
+	}
+	var nodes []*AncestryNode
+	bySite := map[site]*AncestryNode{}
+	// byID is the node of each goroutine.
+	byID := map[int]*AncestryNode{}
+	for _, g := range c.Goroutines {
+		k := site{g.CreatedBy.Func.Raw, g.CreatedBy.SrcPath, g.CreatedBy.Line}
+		n := bySite[k]
+		if n == nil {
+			n = &AncestryNode{CreatedBy: g.CreatedBy}
+			bySite[k] = n
+			nodes = append(nodes, n)
+		}
+		n.Goroutines = append(n.Goroutines, g)
+		if _, ok := byID[g.ID]; !ok {
+			byID[g.ID] = n
+		}
+	}
+
+	// entry is the node for the first goroutines started at each function.
+	entry := map[string]*AncestryNode{}
+	for _, n := range nodes {
+		for _, g := range n.Goroutines {
+			if g.Stack.Elided || len(g.Stack.Calls) == 0 {
+				continue
+			}
+			f := g.Stack.Calls[len(g.Stack.Calls)-1].Func.Raw
+			if _, ok := entry[f]; !ok {
+				entry[f] = n
+			}
+		}
+	}
+
+	parents := map[*AncestryNode]*AncestryNode{}
+	var roots []*AncestryNode
+	for _, n := range nodes {
+		var p *AncestryNode
+		if id := n.creatorID(); id != 0 {
+			p = byID[id]
+		} else {
+			p = entry[n.CreatedBy.Func.Raw]
+		}
+		if n.CreatedBy.Func.Raw == "" || p == nil || isAncestor(parents, n, p) {
+			roots = append(roots, n)
+			continue
+		}
+		parents[n] = p
+		p.Children = append(p.Children, n)
+	}
+	for _, n := range roots {
+		n.count()
+	}
+	return roots
+}
+
+// Private stuff.
+
+// isAncestor returns true if a is p or one of its ancestors.
+func isAncestor(parents map[*AncestryNode]*AncestryNode, a, p *AncestryNode) bool {
+	for ; p != nil; p = parents[p] {
+		if p == a {
+			return true
+		}
+	}
+	return false
+}
+
+// creatorID returns the ID of the goroutine that created the first goroutine
+// of n, or 0 if unknown.
+func (n *AncestryNode) creatorID() int {
+	for _, g := range n.Goroutines {
+		if g.CreatedByID != 0 {
+			return g.CreatedByID
+		}
+	}
+	return 0
+}
+
+// count updates Count recursively and returns it.
+func (n *AncestryNode) count() int {
+	n.Count = len(n.Goroutines)
+	for _, c := range n.Children {
+		n.Count += c.count()
+	}
+	return n.Count
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAncestry(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"	/gopath/src/foo/main.go:12 +0x49",
+		"",
+		"goroutine 5 [select]:",
+		"main.server()",
+		"	/gopath/src/foo/main.go:25 +0x49",
+		"created by main.main",
+		"	/gopath/src/foo/main.go:10 +0x49",
+		"",
+		"goroutine 6 [IO wait]:",
+		"main.handle()",
+		"	/gopath/src/foo/main.go:40 +0x49",
+		"created by main.server",
+		"	/gopath/src/foo/main.go:30 +0x49",
+		"",
+		"goroutine 7 [IO wait]:",
+		"main.handle()",
+		"	/gopath/src/foo/main.go:40 +0x49",
+		"created by main.server",
+		"	/gopath/src/foo/main.go:30 +0x49",
+		"",
+		"goroutine 8 [sleep]:",
+		"foo.bar()",
+		"	/gopath/src/foo/foo.go:5 +0x49",
+		"created by foo.init.0",
+		"	/gopath/src/foo/foo.go:1 +0x49",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		" 1 4",
+		"  main.main 5 3",
+		"    main.server 6,7 2",
+		"foo.init.0 8 1",
+	}
+	compareString(t, strings.Join(want, "\n"), ancestryString(c.Ancestry()))
+}
+
+func TestAncestryCreatorID(t *testing.T) {
+	t.Parallel()
+	// main.server runs in two goroutines started at different call sites; the
+	// ID of the creator tells which one created the handlers.
+	data := []string{
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"	/gopath/src/foo/main.go:12 +0x49",
+		"",
+		"goroutine 5 [select]:",
+		"main.server()",
+		"	/gopath/src/foo/main.go:25 +0x49",
+		"created by main.main in goroutine 1",
+		"	/gopath/src/foo/main.go:10 +0x49",
+		"",
+		"goroutine 9 [select]:",
+		"main.server()",
+		"	/gopath/src/foo/main.go:25 +0x49",
+		"created by main.admin in goroutine 1",
+		"	/gopath/src/foo/admin.go:10 +0x49",
+		"",
+		"goroutine 6 [IO wait]:",
+		"main.handle()",
+		"	/gopath/src/foo/main.go:40 +0x49",
+		"created by main.server in goroutine 9",
+		"	/gopath/src/foo/main.go:30 +0x49",
+		"",
+		"goroutine 7 [IO wait]:",
+		"main.work()",
+		"	/gopath/src/foo/main.go:50 +0x49",
+		"created by main.handle in goroutine 42",
+		"	/gopath/src/foo/main.go:45 +0x49",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := c.Goroutines[3].CreatedByID; id != 9 {
+		t.Fatalf("expected 9, got %d", id)
+	}
+	// Goroutine 42 exited, so goroutine 7 is a root even if main.handle runs in
+	// goroutine 6.
+	want := []string{
+		" 1 4",
+		"  main.main 5 1",
+		"  main.admin 9 2",
+		"    main.server 6 1",
+		"main.handle 7 1",
+	}
+	compareString(t, strings.Join(want, "\n"), ancestryString(c.Ancestry()))
+}
+
+func TestAncestryCycle(t *testing.T) {
+	t.Parallel()
+	// Goroutines creating each other. It's unlikely to happen in practice but it
+	// must not loop forever.
+	c := &Context{
+		Goroutines: []*Goroutine{
+			{
+				Signature: Signature{
+					Stack:     Stack{Calls: []Call{{Func: Func{Raw: "main.a"}}}},
+					CreatedBy: Call{Func: Func{Raw: "main.b"}},
+				},
+				ID: 1,
+			},
+			{
+				Signature: Signature{
+					Stack:     Stack{Calls: []Call{{Func: Func{Raw: "main.b"}}}},
+					CreatedBy: Call{Func: Func{Raw: "main.a"}},
+				},
+				ID: 2,
+			},
+		},
+	}
+	roots := c.Ancestry()
+	if len(roots) != 1 || roots[0].Count != 2 || len(roots[0].Children) != 1 {
+		t.Fatalf("unexpected %#v", roots)
+	}
+}
+
+// ancestryString serializes the forest to make it easy to compare.
+func ancestryString(roots []*AncestryNode) string {
+	var lines []string
+	var walk func(n *AncestryNode, indent string)
+	walk = func(n *AncestryNode, indent string) {
+		ids := make([]string, 0, len(n.Goroutines))
+		for _, g := range n.Goroutines {
+			ids = append(ids, strconv.Itoa(g.ID))
+		}
+		lines = append(lines, indent+n.CreatedBy.Func.Raw+" "+strings.Join(ids, ",")+" "+strconv.Itoa(n.Count))
+		for _, c := range n.Children {
+			walk(c, indent+"  ")
+		}
+	}
+	for _, r := range roots {
+		walk(r, "")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -6,6 +6,7 @@ package stack
 
 import (
 	"sort"
+	"strings"
 )
 
 // Similarity is the level at which two call lines arguments must match to be
@@ -28,26 +29,63 @@ const (
 // The buckets are ordered in library provided order of relevancy. You can
 // reorder at your choosing.
 func Aggregate(goroutines []*Goroutine, similar Similarity) []*Bucket {
+	return aggregate(goroutines, (*Signature).Hash, func(l, r *Signature) bool {
+		return l.similar(r, similar)
+	})
+}
+
+// AggregateFunc merges similar goroutines into buckets, using a user provided
+// function to decide if two calls are similar enough to coalesce them.
+//
+// similar is called on each pair of calls at the same depth of both stacks,
+// and on the calls that created the goroutines. The goroutines must still be
+// in the same state and their stacks must have the same length to be
+// considered similar. This enables custom rules like ignoring arguments
+// altogether or only comparing the package of each call.
+//
+// When two calls are similar but not equal, the differing arguments are zapped
+// out and the other differences are dropped in favor of the first goroutine
+// listed.
+//
+// The buckets are ordered in library provided order of relevancy. You can
+// reorder at your choosing.
+func AggregateFunc(goroutines []*Goroutine, similar func(l, r *Call) bool) []*Bucket {
+	return aggregate(goroutines, shapeHash, func(l, r *Signature) bool {
+		return l.similarFunc(r, similar)
+	})
+}
+
+// aggregate merges goroutines which signatures are deemed similar by the
+// provided function.
+//
+// The goroutines are first grouped by hash, so similar is only called on the
+// signatures with the same hash. Two similar signatures must have the same
+// hash.
+func aggregate(goroutines []*Goroutine, hash func(s *Signature) uint64, similar func(l, r *Signature) bool) []*Bucket {
 	type count struct {
-		ids   []int
-		first bool
+		key      *Signature
+		ids      []int
+		first    bool
+		routines []*Goroutine
 	}
-	b := map[*Signature]*count{}
-	// O(n²). Fix eventually.
+	b := map[uint64][]*count{}
+	// all is in the order the signatures were found, so the output is
+	// deterministic.
+	var all []*count
 	for _, routine := range goroutines {
+		h := hash(&routine.Signature)
 		found := false
-		for key, c := range b {
+		for _, c := range b[h] {
 			// When a match is found, this effectively drops the other goroutine ID.
-			if key.similar(&routine.Signature, similar) {
+			if similar(c.key, &routine.Signature) {
 				found = true
 				c.ids = append(c.ids, routine.ID)
 				c.first = c.first || routine.First
-				if !key.equal(&routine.Signature) {
+				c.routines = append(c.routines, routine)
+				if !c.key.equal(&routine.Signature) {
 					// Almost but not quite equal. There's different pointers passed
 					// around but the same values. Zap out the different values.
-					newKey := key.merge(&routine.Signature)
-					b[newKey] = c
-					delete(b, key)
+					c.key = c.key.merge(&routine.Signature)
 				}
 				break
 			}
@@ -56,18 +94,31 @@ func Aggregate(goroutines []*Goroutine, similar Similarity) []*Bucket {
 			// Create a copy of the Signature, since it will be mutated.
 			key := &Signature{}
 			*key = routine.Signature
-			b[key] = &count{ids: []int{routine.ID}, first: routine.First}
+			c := &count{key: key, ids: []int{routine.ID}, first: routine.First, routines: []*Goroutine{routine}}
+			b[h] = append(b[h], c)
+			all = append(all, c)
 		}
 	}
-	out := make(buckets, 0, len(b))
-	for signature, c := range b {
+	out := make(buckets, 0, len(all))
+	for _, c := range all {
 		sort.Ints(c.ids)
-		out = append(out, &Bucket{Signature: *signature, IDs: c.ids, First: c.first})
+		out = append(out, &Bucket{Signature: *c.key, IDs: c.ids, First: c.first, Stats: newBucketStats(c.routines)})
 	}
 	sort.Sort(out)
 	return out
 }
 
+// shapeHash hashes the fields of the Signature that AggregateFunc requires to
+// be equal, since the calls are compared by a user provided function.
+func shapeHash(s *Signature) uint64 {
+	h := hashString(fnvOffset, s.State)
+	h = hashInt(h, len(s.Stack.Calls))
+	if s.Stack.Elided {
+		h = hashInt(h, 1)
+	}
+	return h
+}
+
 // Bucket is a stack trace signature and the list of goroutines that fits this
 // signature.
 type Bucket struct {
@@ -78,6 +129,8 @@ type Bucket struct {
 	// First is true if this Bucket contains the first goroutine, e.g. the one
 	// Signature that likely generated the panic() call, if any.
 	First bool
+	// Stats is statistics about the goroutines in this Bucket.
+	Stats BucketStats
 }
 
 // less does reverse sort.
@@ -104,3 +157,191 @@ func (b buckets) Less(i, j int) bool {
 func (b buckets) Swap(i, j int) {
 	b[j], b[i] = b[i], b[j]
 }
+
+// HideStdlib returns the goroutines with the calls into the standard library
+// removed from their stack, so Aggregate() coalesces goroutines that differ
+// only in internal runtime frames, e.g. runtime.park_m vs runtime.selectgo.
+//
+// Call.IsStdlib is only set when the stack dump was parsed with guesspaths,
+// otherwise no call is removed. A stack with only calls into the standard
+// library is kept as-is. The goroutines passed in are not modified.
+func HideStdlib(goroutines []*Goroutine) []*Goroutine {
+	out := make([]*Goroutine, len(goroutines))
+	for i, g := range goroutines {
+		out[i] = g
+		calls := make([]Call, 0, len(g.Stack.Calls))
+		for _, c := range g.Stack.Calls {
+			if !c.IsStdlib {
+				calls = append(calls, c)
+			}
+		}
+		if len(calls) == 0 || len(calls) == len(g.Stack.Calls) {
+			continue
+		}
+		n := *g
+		n.Stack.Calls = calls
+		out[i] = &n
+	}
+	return out
+}
+
+// ShortIDLen is the length of the ID returned by Bucket.ShortID().
+const ShortIDLen = 8
+
+// ShortID returns a short ID to refer to this Bucket. It is a prefix of
+// Signature.Fingerprint(), so it is stable across stack dumps of the same
+// executable.
+func (b *Bucket) ShortID() string {
+	return b.Fingerprint()[:ShortIDLen]
+}
+
+// MatchID returns true if id is a prefix of the Bucket fingerprint.
+//
+// It accepts an ID of any length, so "ab12" matches the Bucket with the short
+// ID "ab12cd34". An empty id never matches.
+func (b *Bucket) MatchID(id string) bool {
+	return id != "" && strings.HasPrefix(b.Fingerprint(), strings.ToLower(id))
+}
+
+// BucketStats is statistics computed over the goroutines of a Bucket.
+//
+// They are computed from the original goroutines, before their signatures are
+// merged.
+type BucketStats struct {
+	// States is the number of goroutines for each State.
+	States map[string]int
+	// SleepMin is the minimum wait time in minutes across the goroutines.
+	SleepMin int
+	// SleepMax is the maximum wait time in minutes across the goroutines.
+	SleepMax int
+	// SleepMedian is the median wait time in minutes across the goroutines. It
+	// is rounded down when there's an even number of goroutines.
+	SleepMedian int
+	// Locked is the number of goroutines locked to an OS thread.
+	Locked int
+	// FirstID is the ID of the goroutine of this Bucket that was printed first in
+	// the stack dump.
+	FirstID int
+}
+
+// newBucketStats computes the statistics for the goroutines, in the order
+// they were printed.
+func newBucketStats(goroutines []*Goroutine) BucketStats {
+	s := BucketStats{States: map[string]int{}}
+	if len(goroutines) == 0 {
+		return s
+	}
+	s.FirstID = goroutines[0].ID
+	sleeps := make([]int, 0, len(goroutines))
+	for _, g := range goroutines {
+		s.States[g.State]++
+		if g.Locked {
+			s.Locked++
+		}
+		// SleepMin and SleepMax are the same on a goroutine that has not been
+		// merged, but be defensive.
+		sleeps = append(sleeps, (g.SleepMin+g.SleepMax)/2)
+	}
+	sort.Ints(sleeps)
+	s.SleepMin = sleeps[0]
+	s.SleepMax = sleeps[len(sleeps)-1]
+	if n := len(sleeps); n&1 == 1 {
+		s.SleepMedian = sleeps[n/2]
+	} else {
+		s.SleepMedian = (sleeps[n/2-1] + sleeps[n/2]) / 2
+	}
+	return s
+}
+
+// Buckets is a list of Bucket.
+type Buckets []*Bucket
+
+// FilterOpts is the options for Buckets.Filter.
+//
+// The zero value keeps all the buckets.
+type FilterOpts struct {
+	// Top keeps only the Top buckets with the most goroutines, after the other
+	// filters are applied. Buckets with the same count are kept in order. 0
+	// means no limit.
+	Top int
+	// MinCount drops the buckets with fewer goroutines.
+	MinCount int
+	// States keeps only the buckets with one of these states, e.g. "chan
+	// receive". Empty keeps all states.
+	States []string
+}
+
+// Filter returns the buckets selected by opts, in the same order.
+func (b Buckets) Filter(opts FilterOpts) Buckets {
+	out := make(Buckets, 0, len(b))
+	for _, bucket := range b {
+		if len(bucket.IDs) < opts.MinCount {
+			continue
+		}
+		if len(opts.States) != 0 {
+			found := false
+			for _, s := range opts.States {
+				if bucket.State == s {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		out = append(out, bucket)
+	}
+	if opts.Top <= 0 || len(out) <= opts.Top {
+		return out
+	}
+	// Select the buckets with the most goroutines, then keep them in order.
+	top := make(Buckets, len(out))
+	copy(top, out)
+	sort.SliceStable(top, func(i, j int) bool { return len(top[i].IDs) > len(top[j].IDs) })
+	keep := make(map[*Bucket]bool, opts.Top)
+	for _, bucket := range top[:opts.Top] {
+		keep[bucket] = true
+	}
+	i := 0
+	for _, bucket := range out {
+		if keep[bucket] {
+			out[i] = bucket
+			i++
+		}
+	}
+	return out[:i]
+}
+
+// Ranker returns true if l is more relevant than r. It is used to sort
+// buckets with Buckets.Sort.
+type Ranker func(l, r *Bucket) bool
+
+// ByInterest ranks the buckets by likely relevance to debug a crash or a hang.
+//
+// It ranks first the bucket with the first goroutine printed, which is the
+// one that panicked in a crash dump, then the buckets not created by the
+// standard library, then the buckets with the most goroutines, then the ones
+// that have been waiting the longest.
+//
+// Call.IsStdlib is only set when the stack dump was parsed with guesspaths.
+func ByInterest(l, r *Bucket) bool {
+	if l.First != r.First {
+		return l.First
+	}
+	if l.CreatedBy.IsStdlib != r.CreatedBy.IsStdlib {
+		return !l.CreatedBy.IsStdlib
+	}
+	if len(l.IDs) != len(r.IDs) {
+		return len(l.IDs) > len(r.IDs)
+	}
+	return l.SleepMax > r.SleepMax
+}
+
+// Sort sorts the buckets in place with rank, the most relevant first.
+//
+// The sort is stable, so buckets ranked the same stay in library provided
+// order.
+func (b Buckets) Sort(rank Ranker) {
+	sort.SliceStable(b, func(i, j int) bool { return rank(b[i], b[j]) })
+}
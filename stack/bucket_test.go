@@ -49,6 +49,7 @@ func TestAggregateNotAggressive(t *testing.T) {
 			},
 			IDs:   []int{6},
 			First: true,
+			Stats: BucketStats{States: map[string]int{"chan receive": 1}, FirstID: 6},
 		},
 		{
 			Signature: Signature{
@@ -63,7 +64,8 @@ func TestAggregateNotAggressive(t *testing.T) {
 					},
 				},
 			},
-			IDs: []int{7},
+			IDs:   []int{7},
+			Stats: BucketStats{States: map[string]int{"chan receive": 1}, FirstID: 7},
 		},
 	}
 	compareBuckets(t, want, Aggregate(c.Goroutines, ExactLines))
@@ -113,6 +115,7 @@ func TestAggregateExactMatching(t *testing.T) {
 			},
 			IDs:   []int{6, 7},
 			First: true,
+			Stats: BucketStats{States: map[string]int{"chan receive": 2}, FirstID: 6},
 		},
 	}
 	compareBuckets(t, want, Aggregate(c.Goroutines, ExactLines))
@@ -159,11 +162,236 @@ func TestAggregateAggressive(t *testing.T) {
 			},
 			IDs:   []int{6, 7, 8},
 			First: true,
+			Stats: BucketStats{
+				States:      map[string]int{"chan receive": 3},
+				SleepMin:    10,
+				SleepMax:    100,
+				SleepMedian: 50,
+				FirstID:     6,
+			},
 		},
 	}
 	compareBuckets(t, want, Aggregate(c.Goroutines, AnyPointer))
 }
 
+func TestAggregateFunc(t *testing.T) {
+	t.Parallel()
+	// 2 goroutines with different values and a different number of arguments,
+	// which are only coalesced by ignoring arguments altogether.
+	data := []string{
+		"panic: runtime error: index out of range",
+		"",
+		"goroutine 6 [chan receive]:",
+		"main.func·001(0x11000000, 2)",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+		"goroutine 7 [chan receive]:",
+		"main.func·001(0x21000000)",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+		"goroutine 8 [chan receive]:",
+		"main.func·002(0x21000000)",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:80 +0x49",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noArgs := func(l, r *Call) bool {
+		return l.SrcPath == r.SrcPath && l.Line == r.Line && l.Func == r.Func
+	}
+	want := []*Bucket{
+		{
+			Signature: Signature{
+				State: "chan receive",
+				Stack: Stack{
+					Calls: []Call{
+						newCall(
+							"main.func·001",
+							Args{Values: []Arg{{Value: 0x11000000, Name: "*"}, {Value: 2, Name: "*"}}},
+							"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
+							72),
+					},
+				},
+			},
+			IDs:   []int{6, 7},
+			First: true,
+			Stats: BucketStats{States: map[string]int{"chan receive": 2}, FirstID: 6},
+		},
+		{
+			Signature: Signature{
+				State: "chan receive",
+				Stack: Stack{
+					Calls: []Call{
+						newCall(
+							"main.func·002",
+							Args{Values: []Arg{{Value: 0x21000000, Name: "#1"}}},
+							"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
+							80),
+					},
+				},
+			},
+			IDs:   []int{8},
+			Stats: BucketStats{States: map[string]int{"chan receive": 1}, FirstID: 8},
+		},
+	}
+	compareBuckets(t, want, AggregateFunc(c.Goroutines, noArgs))
+}
+
+func TestHideStdlib(t *testing.T) {
+	t.Parallel()
+	stdlib := func(f string) Call {
+		c := newCall(f, Args{}, "/goroot/src/runtime/proc.go", 300)
+		c.IsStdlib = true
+		return c
+	}
+	main := newCall("main.wait", Args{}, "/gopath/src/foo/main.go", 12)
+	goroutines := []*Goroutine{
+		{
+			Signature: Signature{State: "select", Stack: Stack{Calls: []Call{stdlib("runtime.park_m"), main}}},
+			ID:        1,
+		},
+		{
+			Signature: Signature{State: "select", Stack: Stack{Calls: []Call{stdlib("runtime.selectgo"), stdlib("runtime.gopark"), main}}},
+			ID:        2,
+		},
+		{
+			Signature: Signature{State: "running", Stack: Stack{Calls: []Call{stdlib("runtime.goexit")}}},
+			ID:        3,
+		},
+	}
+	if got := Aggregate(goroutines, AnyPointer); len(got) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(got))
+	}
+	hidden := HideStdlib(goroutines)
+	want := []*Bucket{
+		{
+			Signature: Signature{State: "select", Stack: Stack{Calls: []Call{main}}},
+			IDs:       []int{1, 2},
+			Stats:     BucketStats{States: map[string]int{"select": 2}, FirstID: 1},
+		},
+		{
+			Signature: Signature{State: "running", Stack: Stack{Calls: []Call{stdlib("runtime.goexit")}}},
+			IDs:       []int{3},
+			Stats:     BucketStats{States: map[string]int{"running": 1}, FirstID: 3},
+		},
+	}
+	compareBuckets(t, want, Aggregate(hidden, AnyPointer))
+	// The original goroutines are not modified.
+	if len(goroutines[1].Stack.Calls) != 3 {
+		t.Fatal("goroutine was modified")
+	}
+}
+
+func TestNewBucketStats(t *testing.T) {
+	t.Parallel()
+	goroutines := []*Goroutine{
+		{Signature: Signature{State: "chan receive", SleepMin: 5, SleepMax: 5}, ID: 9},
+		{Signature: Signature{State: "chan receive", SleepMin: 1, SleepMax: 1, Locked: true}, ID: 3},
+		{Signature: Signature{State: "select", SleepMin: 10, SleepMax: 10}, ID: 4},
+		{Signature: Signature{State: "select", SleepMin: 2, SleepMax: 2, Locked: true}, ID: 5},
+	}
+	want := BucketStats{
+		States:      map[string]int{"chan receive": 2, "select": 2},
+		SleepMin:    1,
+		SleepMax:    10,
+		SleepMedian: 3,
+		Locked:      2,
+		FirstID:     9,
+	}
+	if diff := cmp.Diff(want, newBucketStats(goroutines)); diff != "" {
+		t.Fatalf("BucketStats mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBucketsFilter(t *testing.T) {
+	t.Parallel()
+	b := Buckets{
+		{Signature: Signature{State: "running"}, IDs: []int{1}},
+		{Signature: Signature{State: "chan receive"}, IDs: []int{2, 3, 4}},
+		{Signature: Signature{State: "select"}, IDs: []int{5, 6}},
+		{Signature: Signature{State: "chan receive"}, IDs: []int{7, 8, 9, 10}},
+		{Signature: Signature{State: "select"}, IDs: []int{11, 12}},
+	}
+	data := []struct {
+		opts FilterOpts
+		want Buckets
+	}{
+		{FilterOpts{}, b},
+		{FilterOpts{MinCount: 2}, Buckets{b[1], b[2], b[3], b[4]}},
+		{FilterOpts{States: []string{"chan receive", "running"}}, Buckets{b[0], b[1], b[3]}},
+		{FilterOpts{Top: 2}, Buckets{b[1], b[3]}},
+		// Ties are broken by order.
+		{FilterOpts{Top: 3}, Buckets{b[1], b[2], b[3]}},
+		{FilterOpts{Top: 10}, b},
+		{FilterOpts{Top: 1, States: []string{"select"}}, Buckets{b[2]}},
+		{FilterOpts{MinCount: 5}, Buckets{}},
+	}
+	for i, line := range data {
+		if diff := cmp.Diff(line.want, b.Filter(line.opts)); diff != "" {
+			t.Fatalf("%d: Buckets mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestBucketsSortByInterest(t *testing.T) {
+	t.Parallel()
+	stdlib := Call{Func: Func{Raw: "net/http.(*Server).Serve"}, IsStdlib: true}
+	b := Buckets{
+		{Signature: Signature{State: "IO wait", CreatedBy: stdlib}, IDs: []int{1, 2, 3, 4, 5}},
+		{Signature: Signature{State: "select", SleepMax: 10}, IDs: []int{6, 7}},
+		{Signature: Signature{State: "chan receive", SleepMax: 30}, IDs: []int{8, 9}},
+		{Signature: Signature{State: "chan send"}, IDs: []int{10, 11, 12}},
+		{Signature: Signature{State: "running"}, IDs: []int{13}, First: true},
+		{Signature: Signature{State: "sleep"}, IDs: []int{14, 15}},
+	}
+	want := Buckets{b[4], b[3], b[2], b[1], b[5], b[0]}
+	b.Sort(ByInterest)
+	if diff := cmp.Diff(want, b); diff != "" {
+		t.Fatalf("Buckets mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBucketShortID(t *testing.T) {
+	t.Parallel()
+	b := &Bucket{
+		Signature: Signature{
+			State: "chan receive",
+			Stack: Stack{
+				Calls: []Call{
+					newCall(
+						"main.func·001",
+						Args{Values: []Arg{{Value: 0x11000000}, {Value: 2}}},
+						"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
+						72),
+				},
+			},
+		},
+		IDs: []int{6},
+	}
+	id := b.ShortID()
+	compareString(t, "12638691", id)
+	// It doesn't depend on arguments, goroutine IDs nor the source directory.
+	other := &Bucket{Signature: b.Signature, IDs: []int{1, 2}}
+	other.Stack.Calls = []Call{
+		newCall(
+			"main.func·001",
+			Args{Values: []Arg{{Value: 0x21000000}, {Value: 3}}},
+			"/home/user/go/src/github.com/maruel/panicparse/stack/stack.go",
+			72),
+	}
+	compareString(t, id, other.ShortID())
+	other.State = "chan send"
+	if other.ShortID() == id {
+		t.Fatal("expected different ID")
+	}
+	compareBool(t, true, b.MatchID(id[:4]))
+	compareBool(t, true, b.MatchID(strings.ToUpper(id)))
+	compareBool(t, false, b.MatchID(""))
+	compareBool(t, false, b.MatchID("zz"))
+}
+
 func BenchmarkAggregate(b *testing.B) {
 	b.ReportAllocs()
 	c, err := ParseDump(bytes.NewReader(internaltest.StaticPanicwebOutput()), ioutil.Discard, true)
@@ -182,6 +410,30 @@ func BenchmarkAggregate(b *testing.B) {
 	}
 }
 
+func BenchmarkAggregate_Large(b *testing.B) {
+	b.ReportAllocs()
+	// 100k goroutines in 1000 different stacks.
+	goroutines := make([]*Goroutine, 100000)
+	for i := range goroutines {
+		goroutines[i] = &Goroutine{
+			Signature: Signature{
+				State: "chan receive",
+				Stack: Stack{Calls: []Call{
+					newCall("main.worker", Args{Values: []Arg{{Value: uint64(0xc000010000 + i)}}}, "/gopath/src/foo/main.go", 20+i%1000),
+					newCall("main.main", Args{}, "/gopath/src/foo/main.go", 10),
+				}},
+			},
+			ID: i + 1,
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if buckets := Aggregate(goroutines, AnyPointer); len(buckets) != 1000 {
+			b.Fatalf("unexpected %d buckets", len(buckets))
+		}
+	}
+}
+
 func compareBuckets(t *testing.T, want, got []*Bucket) {
 	helper(t)()
 	if diff := cmp.Diff(want, got); diff != "" {
@@ -0,0 +1,89 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Snapshot is the state of the process captured by Capture.
+type Snapshot struct {
+	// Value is the value passed to panic(), as returned by recover(). It is nil
+	// if there was no panic.
+	Value interface{}
+	// Raw is the stack dump as printed by runtime.Stack(), before the calls
+	// are removed.
+	Raw []byte
+	// Context is the goroutines captured. The current goroutine is the first
+	// one.
+	//
+	// When Value is not nil, its calls start at the call that panicked, and
+	// Context.Panics describes the panic.
+	*Context
+}
+
+// Capture captures the current goroutine, or all of them if all is true, and
+// parses it in-process.
+//
+// Call it in a deferred function with the value returned by recover():
+//
+//	defer func() {
+//	  if v := recover(); v != nil {
+//	    s, err := stack.Capture(v, false)
+//	    ...
+//	  }
+//	}()
+//
+// The calls of the deferred function and of the runtime panic handling are
+// removed from the current goroutine.
+//
+// If the stack dump cannot be parsed, the Snapshot is still returned along
+// the error, with only Value and Raw set.
+func Capture(recovered interface{}, all bool) (*Snapshot, error) {
+	raw := currentStack(all)
+	c, err := ParseDump(bytes.NewReader(raw), ioutil.Discard, false)
+	s := &Snapshot{Value: recovered, Raw: raw}
+	if err != nil || c == nil {
+		return s, err
+	}
+	s.Context = c
+	if len(c.Goroutines) != 0 {
+		trimCapture(&c.Goroutines[0].Stack, recovered != nil)
+	}
+	if recovered != nil {
+		msg := fmt.Sprint(recovered)
+		c.Panics = []PanicDetail{{Kind: "panic", Message: msg, Value: msg}}
+	}
+	return s, nil
+}
+
+// Private stuff.
+
+// trimCapture removes the calls of Capture and, if panicked is true, the
+// calls up to the runtime panic handling included.
+func trimCapture(s *Stack, panicked bool) {
+	i := 0
+	for ; i < len(s.Calls); i++ {
+		r := s.Calls[i].Func.Raw
+		if !strings.HasSuffix(r, "stack.currentStack") && !strings.HasSuffix(r, "stack.Capture") {
+			break
+		}
+	}
+	if panicked {
+		for j := i; j < len(s.Calls); j++ {
+			if r := s.Calls[j].Func.Raw; r == "panic" || r == "runtime.gopanic" {
+				// Skip the runtime calls raising the panic, e.g.
+				// runtime.goPanicIndex or runtime.sigpanic.
+				for i = j + 1; i < len(s.Calls) && strings.HasPrefix(s.Calls[i].Func.Raw, "runtime."); i++ {
+				}
+				break
+			}
+		}
+	}
+	s.Calls = s.Calls[i:]
+}
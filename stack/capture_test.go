@@ -0,0 +1,74 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	t.Parallel()
+	s, err := capturePanic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Value != "boom" {
+		t.Fatalf("unexpected %v", s.Value)
+	}
+	want := []PanicDetail{{Kind: "panic", Message: "boom", Value: "boom"}}
+	if len(s.Panics) != 1 || s.Panics[0] != want[0] {
+		t.Fatalf("unexpected %v", s.Panics)
+	}
+	calls := s.Goroutines[0].Stack.Calls
+	if len(calls) < 2 || !strings.HasSuffix(calls[0].Func.Raw, "stack.panicking") || !strings.HasSuffix(calls[1].Func.Raw, "stack.capturePanic") {
+		t.Fatalf("unexpected %#v", calls)
+	}
+}
+
+func TestCapture_NoPanic(t *testing.T) {
+	t.Parallel()
+	s, err := Capture(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Value != nil || len(s.Panics) != 0 || len(s.Goroutines) != 1 {
+		t.Fatalf("unexpected %#v", s)
+	}
+	if c := s.Goroutines[0].Stack.Calls; !strings.HasSuffix(c[0].Func.Raw, "stack.TestCapture_NoPanic") {
+		t.Fatalf("unexpected %#v", c[0])
+	}
+}
+
+func TestTrimCapture(t *testing.T) {
+	t.Parallel()
+	s := Stack{Calls: []Call{
+		{Func: Func{Raw: "github.com/maruel/panicparse/stack.currentStack"}},
+		{Func: Func{Raw: "github.com/maruel/panicparse/stack.Capture"}},
+		{Func: Func{Raw: "main.main.func1"}},
+		{Func: Func{Raw: "panic"}},
+		{Func: Func{Raw: "runtime.panicmem"}},
+		{Func: Func{Raw: "runtime.sigpanic"}},
+		{Func: Func{Raw: "main.main"}},
+	}}
+	trimCapture(&s, true)
+	if len(s.Calls) != 1 || s.Calls[0].Func.Raw != "main.main" {
+		t.Fatalf("unexpected %#v", s.Calls)
+	}
+}
+
+func capturePanic() (s *Snapshot, err error) {
+	defer func() {
+		s, err = Capture(recover(), false)
+	}()
+	// Since Go 1.17, the string is printed as an aggregate.
+	panicking("boom")
+	return nil, nil
+}
+
+//go:noinline
+func panicking(msg string) {
+	panic(msg)
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "sort"
+
+// PackageCount is the goroutines whose top-most call outside the standard
+// library is in the same package.
+type PackageCount struct {
+	// ImportPath is the import path of the package. It is "main" for package
+	// main unless the stack dump was parsed with guesspaths. It is empty for
+	// the goroutines with only calls into the standard library.
+	ImportPath string
+	// IDs is the ID of each goroutine, sorted.
+	IDs []int
+	// States is the number of goroutines for each State.
+	States map[string]int
+}
+
+// CountByPackage returns a census of the goroutines per package, which is
+// much more compact than Aggregate() when only the number of goroutines per
+// subsystem is of interest.
+//
+// Each goroutine is counted in the package of its top-most call outside the
+// standard library. The packages with the most goroutines are first.
+func CountByPackage(goroutines []*Goroutine) []PackageCount {
+	var out []PackageCount
+	index := map[string]int{}
+	for _, g := range goroutines {
+		p := topPackage(g)
+		i, ok := index[p]
+		if !ok {
+			i = len(out)
+			index[p] = i
+			out = append(out, PackageCount{ImportPath: p, States: map[string]int{}})
+		}
+		out[i].IDs = append(out[i].IDs, g.ID)
+		out[i].States[g.State]++
+	}
+	for i := range out {
+		sort.Ints(out[i].IDs)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if len(out[i].IDs) != len(out[j].IDs) {
+			return len(out[i].IDs) > len(out[j].IDs)
+		}
+		return out[i].ImportPath < out[j].ImportPath
+	})
+	return out
+}
+
+// Private stuff.
+
+// topPackage returns the import path of the top-most call outside the
+// standard library.
+func topPackage(g *Goroutine) string {
+	for i := range g.Stack.Calls {
+		c := &g.Stack.Calls[i]
+		if isStdlibCall(c) {
+			continue
+		}
+		if p := c.ImportPath(); p != "" {
+			return p
+		}
+		return c.Func.PkgName()
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCountByPackage(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [chan receive]:",
+		"main.main()",
+		"	/gopath/src/foo/main.go:12 +0x49",
+		"",
+		"goroutine 5 [IO wait]:",
+		"internal/poll.runtime_pollWait(0x7f3c, 0x72)",
+		"	/goroot/src/runtime/netpoll.go:203 +0x55",
+		"github.com/foo/db.(*Conn).read(0xc000010000)",
+		"	/gopath/src/github.com/foo/db/conn.go:40 +0x49",
+		"github.com/foo/db.(*Pool).worker(0xc000010000)",
+		"	/gopath/src/github.com/foo/db/pool.go:80 +0x49",
+		"",
+		"goroutine 6 [select]:",
+		"github.com/foo/db.(*Pool).worker(0xc000010000)",
+		"	/gopath/src/github.com/foo/db/pool.go:82 +0x49",
+		"",
+		"goroutine 7 [IO wait]:",
+		"internal/poll.runtime_pollWait(0x7f3c, 0x72)",
+		"	/goroot/src/runtime/netpoll.go:203 +0x55",
+		"net/http.(*conn).serve(0xc000020000)",
+		"	/goroot/src/net/http/server.go:1890 +0x49",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PackageCount{
+		{ImportPath: "github.com/foo/db", IDs: []int{5, 6}, States: map[string]int{"IO wait": 1, "select": 1}},
+		{ImportPath: "", IDs: []int{7}, States: map[string]int{"IO wait": 1}},
+		{ImportPath: "main", IDs: []int{1}, States: map[string]int{"chan receive": 1}},
+	}
+	if diff := cmp.Diff(want, CountByPackage(c.Goroutines)); diff != "" {
+		t.Fatalf("PackageCount mismatch (-want +got):\n%s", diff)
+	}
+}
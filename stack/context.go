@@ -7,7 +7,6 @@
 package stack
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
@@ -20,6 +19,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Context is a parsing context.
@@ -48,10 +49,55 @@ type Context struct {
 	// Nil is guesspaths was false.
 	GOPATHs map[string]string
 
+	// Wrapped is the number of lines that were obviously wrapped, for example
+	// by a log shipper, and were joined back before being parsed.
+	//
+	// A non-zero value is a warning that the parsed goroutines may not be
+	// accurate.
+	Wrapped int
+
+	// Truncated is set when the input ended in the middle of a goroutine, for
+	// example when runtime.Stack() was called with a buffer too small or the
+	// log was cut. The last goroutine has Partial set and the goroutines after
+	// it are missing.
+	//
+	// The frames elided by the runtime in a deep stack are not a truncation,
+	// see Stack.Elided.
+	Truncated bool
+
+	// Panics is the "panic: " or "fatal error: " lines printed before the
+	// goroutines, in order. There is more than one when a panic was recovered
+	// then another panic happened, in which case all but the last have
+	// Recovered set.
+	//
+	// When the input contains multiple stack dumps, e.g. a log followed with
+	// IncrementalParser, a panic found after goroutines starts a new chain:
+	// Panics and Signal are the ones of the last stack dump.
+	Panics []PanicDetail
+
+	// Signal is the signal that caused the stack dump, if any.
+	Signal *SignalInfo
+
+	// Warnings is the problems found while parsing with Opts.Lenient or
+	// Opts.Resync.
+	Warnings []ParseWarning
+
 	// localgoroot is GOROOT with "/" as path separator. No trailing "/".
 	localgoroot string
 	// localgopaths is GOPATH with "/" as path separator. No trailing "/".
 	localgopaths []string
+	// env is the environment passed in Opts, never nil once parsed.
+	env *Env
+	// modCache is the local module cache used with env.Modules.
+	modCache string
+
+	// lines and strs are the reader of the lines and the lines interned by
+	// the joiner, kept across Parse calls.
+	lines *lineReader
+	strs  map[string]string
+	// files caches the files found while guessing the paths, kept across
+	// Parse calls.
+	files *fileCache
 }
 
 // ParseDump processes the output from runtime.Stack().
@@ -66,69 +112,613 @@ type Context struct {
 // entites do not have LocalSrcPath and IsStdlib filled in. If true, be warned
 // that file presence is done, which means some level of disk I/O.
 func ParseDump(r io.Reader, out io.Writer, guesspaths bool) (*Context, error) {
-	goroutines, err := parseDump(r, out)
-	if len(goroutines) == 0 {
+	return ParseDumpWithOpts(r, out, &Opts{GuessPaths: guesspaths})
+}
+
+// ParseBytes is like ParseDump for a stack dump already in memory.
+//
+// It returns the text that is not part of the stack dump, e.g. the log lines
+// printed before it, instead of writing it to an io.Writer.
+func ParseBytes(b []byte, guesspaths bool) (*Context, []byte, error) {
+	var extra bytes.Buffer
+	c, err := ParseDump(bytes.NewReader(b), &extra, guesspaths)
+	return c, extra.Bytes(), err
+}
+
+// ParseString is like ParseBytes for a string.
+func ParseString(s string, guesspaths bool) (*Context, string, error) {
+	var extra bytes.Buffer
+	c, err := ParseDump(strings.NewReader(s), &extra, guesspaths)
+	return c, extra.String(), err
+}
+
+// Opts are the options to parse a stack dump.
+type Opts struct {
+	// GuessPaths has the same meaning as guesspaths with ParseDump.
+	GuessPaths bool
+
+	// MaxGoroutines is the maximum number of goroutines to parse. 0 means no
+	// limit.
+	MaxGoroutines int
+	// MaxFramesPerGoroutine is the maximum number of calls to parse in the
+	// stack of a goroutine. 0 means no limit.
+	MaxFramesPerGoroutine int
+	// MaxLineLength is the maximum length of a line in bytes, including the
+	// line terminator. 0 means no limit.
+	//
+	// The lines are read whole whatever their length, so it also bounds the
+	// memory used to read a line, e.g. a huge log line before the stack dump.
+	MaxLineLength int
+
+	// Lenient skips the goroutines that cannot be parsed instead of returning
+	// an error. A ParseWarning is added to Context.Warnings for each.
+	Lenient bool
+	// Resync keeps what could be parsed of a broken goroutine, flagged as
+	// Partial, then skips everything up to the next goroutine header. This
+	// recovers dumps interleaved with garbage, for example when other
+	// goroutines were writing to stderr concurrently. A ParseWarning is added
+	// to Context.Warnings for each broken goroutine.
+	//
+	// It takes precedence over Lenient. The junk after the last goroutine is
+	// not written to out.
+	Resync bool
+
+	// JSONLogs extracts and parses the stack traces logged as a string field
+	// of a JSON log line, as written by structured loggers like zap or logrus.
+	// The JSON log line is written to out as is.
+	JSONLogs bool
+
+	// Env, if set, describes where the sources are, instead of guessing them
+	// from the GOROOT and GOPATH of the host. It is only used with GuessPaths.
+	Env *Env
+
+	// Resolvers are called in order on each call once parsed, after the paths
+	// were guessed. The first error is returned along the Context.
+	Resolvers []Resolver
+
+	// LazyPaths defers the resolution of the calls: with GuessPaths, the
+	// GOROOT and GOPATHs are still guessed but LocalSrcPath, RelSrcPath and
+	// IsStdlib are not set, and Resolvers are not called.
+	//
+	// Call Resolve() with the Context as the Resolver, then with each of
+	// Resolvers, on the goroutines kept after filtering them. This saves the
+	// resolution of the goroutines that are not rendered.
+	LazyPaths bool
+}
+
+// Env describes the environment used to resolve the source paths of a stack
+// dump, for example when it was produced on a Linux server and is read on a
+// macOS laptop.
+//
+// The paths use "/" as path separator, without a trailing "/". Anything left
+// empty is guessed like without Env.
+type Env struct {
+	// GOROOT is the GOROOT where the stack dump was produced, e.g.
+	// "/usr/local/go".
+	GOROOT string
+	// LocalGOROOT is the GOROOT on the host. Defaults to runtime.GOROOT().
+	LocalGOROOT string
+	// GOPATHs maps each GOPATH where the stack dump was produced to the
+	// corresponding path on the host, like Context.GOPATHs. It covers both
+	// "<GOPATH>/src" and the module cache in "<GOPATH>/pkg/mod".
+	GOPATHs map[string]string
+	// LocalGOPATHs is the GOPATHs on the host to search the sources into.
+	// Defaults to $GOPATH or its default.
+	LocalGOPATHs []string
+	// SourceRoots maps a directory where the stack dump was produced to the
+	// corresponding directory on the host, for example a checkout or a module
+	// cache outside of GOPATH. It takes precedence over the other paths.
+	SourceRoots map[string]string
+	// Remap, if set, is called with the source path of each call and returns
+	// the corresponding path on the host and the path relative to the
+	// directory it was mapped into, used as LocalSrcPath and RelSrcPath. It
+	// returns empty strings to keep the paths found otherwise. For example, it
+	// can translate the paths of a container build like "/go/src/app/..." into
+	// a local checkout. It takes precedence over SourceRoots.
+	//
+	// SrcPath is not modified.
+	Remap func(srcPath string) (localPath, relPath string)
+	// Modules is the modules checked out on the host, as loaded with
+	// LoadModule. The calls in these modules, in their replacements and
+	// vendor directories are resolved precisely instead of guessed.
+	Modules []*Module
+	// LocalModCache is the module cache on the host to resolve the calls in
+	// the module cache of the stack dump with Modules. Defaults to
+	// $GOMODCACHE or "<GOPATH>/pkg/mod".
+	LocalModCache string
+}
+
+// ParseWarning is a problem found while parsing a stack dump with
+// Opts.Lenient or Opts.Resync.
+type ParseWarning struct {
+	// Line is the line number where the problem was found, starting at 1.
+	Line int
+	// Reason describes the problem.
+	Reason string
+}
+
+// LimitError is returned by ParseDumpWithOpts when the stack dump exceeded
+// one of the limits in Opts.
+//
+// The Context returned with it contains what was parsed up to the limit.
+type LimitError struct {
+	// Limit is the name of the field in Opts that was exceeded, e.g.
+	// "MaxGoroutines".
+	Limit string
+	// Value is the value of the limit.
+	Value int
+}
+
+func (l *LimitError) Error() string {
+	return fmt.Sprintf("stack dump exceeds %s of %d", l.Limit, l.Value)
+}
+
+// ParseDumpWithOpts is like ParseDump with more options.
+//
+// Use the limits in opts when parsing untrusted stack dumps, so a
+// pathological input cannot exhaust the memory. When a limit is exceeded, it
+// stops parsing and returns what was parsed along a *LimitError.
+func ParseDumpWithOpts(r io.Reader, out io.Writer, opts *Opts) (*Context, error) {
+	c, err := parseDump(r, out, opts)
+	if len(c.Goroutines) == 0 {
 		return nil, err
 	}
-	c := &Context{
-		Goroutines:   goroutines,
-		localgoroot:  strings.Replace(runtime.GOROOT(), "\\", "/", -1),
-		localgopaths: getGOPATHs(),
+	if err2 := c.resolve(opts); err == nil {
+		err = err2
+	}
+	return c, err
+}
+
+// Parse resets c then parses the stack dump in r into it, like
+// ParseDumpWithOpts. opts can be nil.
+//
+// Reusing a Context to parse many stack dumps, e.g. in a long running
+// collector, reduces the allocations, see Reset(). Contrary to
+// ParseDumpWithOpts, Goroutines is empty when no stack trace was detected.
+func (c *Context) Parse(r io.Reader, out io.Writer, opts *Opts) error {
+	if opts == nil {
+		opts = &Opts{}
+	}
+	c.Reset()
+	err := c.parse(r, out, opts)
+	if len(c.Goroutines) == 0 {
+		return err
+	}
+	if err2 := c.resolve(opts); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Reset clears c so it can be reused with Parse.
+//
+// The internal buffers are kept: the buffer to read the lines, the lines
+// already seen, which are reused when they repeat across stack dumps, and the
+// files found or not while guessing the paths, so the file system is not
+// checked again. Use a new Context to notice the source files added since.
+//
+// The goroutines previously parsed in c must not be used anymore, since their
+// storage is reused.
+func (c *Context) Reset() {
+	for i := range c.Goroutines {
+		c.Goroutines[i] = nil
+	}
+	*c = Context{
+		Goroutines: c.Goroutines[:0],
+		lines:      c.lines,
+		strs:       c.strs,
+		files:      c.files,
 	}
-	nameArguments(goroutines)
+}
+
+// Crashed returns the goroutine that panicked and its first call outside the
+// standard library below the call to panic.
+//
+// The goroutine is the one in state "running" that called panic, the
+// goroutine printed first preferred. The call is nil if all the callers of
+// panic are in the standard library. Returns nil, nil if no goroutine
+// panicked, e.g. for a "fatal error: ".
+func (c *Context) Crashed() (*Goroutine, *Call) {
+	var found *Goroutine
+	var call *Call
+	for _, g := range c.Goroutines {
+		if g.State != "running" || (found != nil && !g.First) {
+			continue
+		}
+		for i := range g.Stack.Calls {
+			if f := g.Stack.Calls[i].Func.Raw; f != "panic" && f != "runtime.gopanic" {
+				continue
+			}
+			found = g
+			call = nil
+			for j := i + 1; j < len(g.Stack.Calls); j++ {
+				if !isStdlibCall(&g.Stack.Calls[j]) {
+					call = &g.Stack.Calls[j]
+					break
+				}
+			}
+			break
+		}
+		if found != nil && found.First {
+			break
+		}
+	}
+	return found, call
+}
+
+// Anonymize replaces the value of each pointer argument with a stable
+// pseudo value named "#1", "#2", etc.
+//
+// The numbering is in order of first appearance across all the goroutines
+// and is not based on the addresses, so two dumps of the same state produce
+// the same output even if the memory layout changed. This is useful to
+// produce golden files or to share a stack dump without leaking addresses.
+//
+// It overrides the names set by ParseDump. Call it before Augment(), which
+// may print the addresses in Args.Processed.
+func (c *Context) Anonymize() {
+	ids := map[uint64]int{}
+	for _, g := range c.Goroutines {
+		for i := range g.Stack.Calls {
+			anonymizeArgs(&g.Stack.Calls[i].Args, ids)
+		}
+		anonymizeArgs(&g.CreatedBy.Args, ids)
+	}
+}
+
+// Private stuff.
+
+// newContext returns a Context for the goroutines, naming their arguments and
+// guessing the paths if requested.
+func newContext(goroutines []*Goroutine, guesspaths bool) *Context {
+	c := &Context{Goroutines: goroutines}
+	c.init(guesspaths, nil)
+	if guesspaths {
+		_ = Resolve(c.Goroutines, c)
+	}
+	return c
+}
+
+// init names the arguments of the goroutines and guesses the GOROOT and
+// GOPATHs if requested, using what is known from env if not nil.
+//
+// The calls are not resolved.
+func (c *Context) init(guesspaths bool, env *Env) {
+	if c.files == nil {
+		c.files = &fileCache{files: map[string]bool{}}
+	}
+	c.localgoroot = strings.Replace(runtime.GOROOT(), "\\", "/", -1)
+	c.localgopaths = getGOPATHs()
+	if env == nil {
+		env = &Env{}
+	}
+	c.env = env
+	if env.LocalGOROOT != "" {
+		c.localgoroot = env.LocalGOROOT
+	}
+	if len(env.LocalGOPATHs) != 0 {
+		c.localgopaths = env.LocalGOPATHs
+	}
+	c.modCache = env.LocalModCache
+	if c.modCache == "" && len(env.Modules) != 0 {
+		c.modCache = getModCache(c.localgopaths)
+	}
+	nameArguments(c.Goroutines)
 	// Corresponding local values on the host for Context.
 	if guesspaths {
-		c.findRoots()
-		for _, r := range c.Goroutines {
-			// Note that this is important to call it even if
-			// c.GOROOT == c.localgoroot.
-			r.updateLocations(c.GOROOT, c.localgoroot, c.GOPATHs)
+		c.GOROOT = env.GOROOT
+		c.findRoots(env.GOPATHs)
+	}
+}
+
+// remapCall sets the local and relative paths of c with env.Remap,
+// env.SourceRoots and env.Modules.
+func remapCall(c *Call, env *Env, modCache string, files *fileCache) {
+	if env.Remap != nil {
+		if l, r := env.Remap(c.SrcPath); l != "" {
+			c.LocalSrcPath = l
+			c.RelSrcPath = r
+			return
 		}
 	}
-	return c, err
+	// Prefer the longest match, as roots may be nested.
+	best := ""
+	for remote := range env.SourceRoots {
+		if len(remote) > len(best) && strings.HasPrefix(c.SrcPath, remote+"/") {
+			best = remote
+		}
+	}
+	if best != "" {
+		c.RelSrcPath = c.SrcPath[len(best)+1:]
+		c.LocalSrcPath = pathJoin(env.SourceRoots[best], c.RelSrcPath)
+		return
+	}
+	resolveModule(c, env.Modules, modCache, files)
 }
 
-// Private stuff.
+// resolve names the arguments and resolves the calls of the goroutines
+// parsed, as requested in opts.
+func (c *Context) resolve(opts *Opts) error {
+	c.init(opts.GuessPaths, opts.Env)
+	if opts.LazyPaths {
+		return nil
+	}
+	if opts.GuessPaths {
+		// Note that this is important to resolve the calls even if
+		// c.GOROOT == c.localgoroot.
+		_ = Resolve(c.Goroutines, c)
+	}
+	var err error
+	for _, r := range opts.Resolvers {
+		if err2 := Resolve(c.Goroutines, r); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
 
-func parseDump(r io.Reader, out io.Writer) ([]*Goroutine, error) {
-	scanner := bufio.NewScanner(r)
-	scanner.Split(scanLines)
+// parseDump returns a Context with the goroutines found, the number of
+// wrapped lines that were joined and the header, panics and signal printed
+// before the goroutines.
+func parseDump(r io.Reader, out io.Writer, opts *Opts) (*Context, error) {
+	c := &Context{}
+	err := c.parse(r, out, opts)
+	// Only keep the buffers when the Context is reused.
+	c.lines = nil
+	c.strs = nil
+	return c, err
+}
+
+// parse parses the stack dump in r into c, which must be empty.
+func (c *Context) parse(r io.Reader, out io.Writer, opts *Opts) error {
+	if c.lines == nil {
+		c.lines = newLineReader(r, opts.MaxLineLength)
+	} else {
+		c.lines.reset(r, opts.MaxLineLength)
+	}
+	if c.strs == nil {
+		c.strs = map[string]string{}
+	}
 	// Do not enable race detection parsing yet, since it cannot be returned in
 	// Context at the moment.
-	s := scanningState{}
-	for scanner.Scan() {
-		line, err := s.scan(scanner.Text())
-		if line != "" {
-			_, _ = io.WriteString(out, line)
+	p := lineParser{c: c, s: scanningState{goroutines: c.Goroutines}, out: out, opts: opts}
+	j := joiner{lines: c.lines, s: &p.s, strs: c.strs, jsonLogs: opts.JSONLogs}
+	var err error
+	for j.Scan() {
+		if j.raw != "" {
+			_, _ = io.WriteString(out, j.raw)
 		}
-		if err != nil {
-			return s.goroutines, err
+		// The lines extracted from a JSON log line were written with it.
+		p.quiet = j.extracted
+		if err = p.parseLine(j.Text(), j.lineNo, j.lastNo, j.lineOff, j.end); err != nil {
+			break
 		}
 	}
-	return s.goroutines, scanner.Err()
+	if err == nil {
+		err = c.lines.Err()
+	}
+	if err == nil && p.s.cutShort() {
+		c.Truncated = true
+		p.s.goroutines[len(p.s.goroutines)-1].Partial = true
+	}
+	c.Goroutines = p.s.goroutines
+	c.Wrapped = j.wrapped
+	return err
+}
+
+// lineParser parses the lines of a stack dump into a Context.
+type lineParser struct {
+	c    *Context
+	s    scanningState
+	out  io.Writer
+	opts *Opts
+	// skipping is set after a parse error in lenient or resync mode, until
+	// the end of the broken goroutine.
+	skipping bool
+	// quiet is set to not write the lines that are not part of a stack
+	// trace to out.
+	quiet bool
+	// body is set once goroutines were found, until a panic starts the next
+	// stack dump.
+	body bool
+}
+
+// parseLine parses text, the line lineNo at offset off in the input. lastNo
+// and end are the line number of the last line and the offset right after
+// it, which differ when wrapped lines were joined.
+//
+// The goroutines are in p.s.goroutines. It returns an error when the parsing
+// must stop.
+func (p *lineParser) parseLine(text string, lineNo, lastNo int, off, end int64) error {
+	c, s, opts := p.c, &p.s, p.opts
+	// The lines read are capped by the lineReader but not the lines joined.
+	if opts.MaxLineLength != 0 && len(text) > opts.MaxLineLength {
+		return &LimitError{Limit: "MaxLineLength", Value: opts.MaxLineLength}
+	}
+	if p.skipping {
+		t := strings.TrimRight(text, "\r\n")
+		if t == "" && !opts.Resync {
+			p.skipping = false
+			return nil
+		}
+		if !isRoutineHeader(t) {
+			return nil
+		}
+		p.skipping = false
+	}
+	prev := s.state
+	n := len(s.goroutines)
+	line, err := s.scan(text)
+	if line != "" {
+		if !p.quiet {
+			_, _ = io.WriteString(p.out, line)
+		}
+		if p.body && isPanicStart(line) {
+			// The next stack dump, e.g. a process that crashed again in a log.
+			p.body = false
+			c.Signal = nil
+		}
+		if !p.body {
+			c.Panics = appendPanic(c.Panics, line, lineNo)
+			c.Signal = updateSignal(c.Signal, line)
+		}
+	}
+	if len(s.goroutines) > n {
+		p.body = true
+	}
+	if err != nil {
+		if !opts.Lenient && !opts.Resync {
+			return err
+		}
+		c.Warnings = append(c.Warnings, ParseWarning{Line: lineNo, Reason: err.Error()})
+		s.abort(prev, opts.Resync)
+		if isRoutineHeader(strings.TrimRight(text, "\r\n")) {
+			// The broken goroutine was cut short by the next one.
+			_, _ = s.scan(text)
+		} else {
+			p.skipping = true
+		}
+	}
+	if len(s.goroutines) != 0 {
+		g := s.goroutines[len(s.goroutines)-1]
+		if g.StartLine == 0 {
+			g.StartLine = lineNo
+			g.Start = off
+		}
+		if line == "" && s.state != normal && s.state != betweenRoutine {
+			g.EndLine = lastNo
+			g.End = end
+		}
+	}
+	return s.checkLimits(opts)
+}
+
+// joiner wraps a lineReader to join back the lines of a stack trace that
+// were obviously wrapped, for example by a log shipper.
+//
+// It looks ahead one line. The lines are only joined when the line is not
+// what the scanningState expects but the joined line is, e.g. a goroutine
+// header that doesn't end with "]:".
+type joiner struct {
+	lines   *lineReader
+	s       *scanningState
+	line    string
+	next    string
+	hasNext bool
+	// lineNo and nextNo are the line numbers of line and next, starting at 1.
+	// lastNo is the line number of the last line joined into line.
+	lineNo int
+	nextNo int
+	lastNo int
+	// lineOff and nextOff are the byte offsets of line and next in the input,
+	// end is the offset right after line and pos the offset of the line to
+	// read.
+	lineOff int64
+	nextOff int64
+	end     int64
+	pos     int64
+	// wrapped is the number of lines that were joined.
+	wrapped int
+	// jsonLogs enables the extraction of the stack dumps embedded in JSON log
+	// lines, see Opts.JSONLogs.
+	jsonLogs bool
+	// raw is the JSON log line line was extracted from, set only on its first
+	// line, and extracted is set on all of them. nextRaw and nextExtracted are
+	// the same for next.
+	raw           string
+	extracted     bool
+	nextRaw       string
+	nextExtracted bool
+	// pending is the lines left of a stack dump embedded in a JSON log line.
+	pending []string
+	// strs is the lines already seen, see intern().
+	strs map[string]string
+}
+
+// Scan advances to the next line, like bufio.Scanner.Scan().
+func (j *joiner) Scan() bool {
+	if !j.hasNext && !j.read() {
+		return false
+	}
+	j.line = j.next
+	j.lineNo = j.nextNo
+	j.lastNo = j.nextNo
+	j.lineOff = j.nextOff
+	j.end = j.pos
+	j.raw = j.nextRaw
+	j.extracted = j.nextExtracted
+	if j.hasNext = j.read(); !j.hasNext {
+		return true
+	}
+	if j.nextRaw != "" || j.nextExtracted != j.extracted {
+		// Never join a line with one extracted from a JSON log line.
+		return true
+	}
+	if l, ok := j.s.join(j.line, j.next); ok {
+		j.line = l
+		j.lastNo = j.nextNo
+		j.end = j.pos
+		j.wrapped++
+		j.hasNext = false
+	}
+	return true
 }
 
-// scanLines is similar to bufio.ScanLines except that it:
-//     - doesn't drop '\n'
-//     - doesn't strip '\r'
-//     - returns when the data is bufio.MaxScanTokenSize bytes
-func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 {
-		return 0, nil, nil
+// read sets next to the next line.
+//
+// With jsonLogs, a stack dump embedded in a JSON log line is expanded to its
+// lines, which all have the position of the JSON log line.
+func (j *joiner) read() bool {
+	j.nextRaw = ""
+	if len(j.pending) != 0 {
+		j.next = j.pending[0]
+		j.pending = j.pending[1:]
+		return true
+	}
+	j.nextExtracted = false
+	if !j.lines.Scan() {
+		return false
 	}
-	if i := bytes.IndexByte(data, '\n'); i >= 0 {
-		return i + 1, data[0 : i+1], nil
+	j.next = intern(j.strs, j.lines.Bytes())
+	j.nextNo++
+	j.nextOff = j.pos
+	j.pos += int64(len(j.next))
+	if !j.jsonLogs {
+		return true
 	}
-	if atEOF {
-		return len(data), data, nil
+	if l := jsonDump(j.next); len(l) != 0 {
+		j.nextRaw = j.next
+		j.nextExtracted = true
+		j.next = l[0]
+		j.pending = l[1:]
 	}
-	if len(data) >= bufio.MaxScanTokenSize {
-		// Returns the line even if it is not at EOF nor has a '\n', otherwise the
-		// scanner will return bufio.ErrTooLong which is definitely not what we
-		// want.
-		return len(data), data, nil
+	return true
+}
+
+// intern returns b as a string, reusing the string of an identical line seen
+// before and kept in strs.
+//
+// The stack dumps with a lot of goroutines repeat the same lines, so it saves
+// most of the allocations and the memory retained by the calls, which
+// reference substrings of the lines.
+func intern(strs map[string]string, b []byte) string {
+	if len(b) > maxInternLen {
+		return string(b)
+	}
+	// The conversion in the map lookup doesn't allocate.
+	if l, ok := strs[string(b)]; ok {
+		return l
 	}
-	return 0, nil, nil
+	l := string(b)
+	if len(strs) < maxInterned {
+		strs[l] = l
+	}
+	return l
+}
+
+// Text returns the current line, like bufio.Scanner.Text().
+func (j *joiner) Text() string {
+	return j.line
 }
 
 const (
@@ -136,35 +726,23 @@ const (
 	elided           = "...additional frames elided..."
 	raceHeaderFooter = "=================="
 	raceHeader       = "WARNING: DATA RACE"
+
+	// maxArgDepth is the maximum nesting of the aggregate arguments. The
+	// runtime prints at most 5 levels.
+	maxArgDepth = 10
+
+	// maxInternLen is the length of the longest line interned by the joiner.
+	// Longer lines are unlikely to repeat.
+	maxInternLen = 1024
+	// maxInterned is the maximum number of lines interned by the joiner, to
+	// bound its memory usage on large inputs that are not stack dumps.
+	maxInterned = 1 << 16
+	// maxCachedFiles is the maximum number of paths cached by fileCache.
+	maxCachedFiles = 1 << 16
 )
 
 // These are effectively constants.
 var (
-	reRoutineHeader = regexp.MustCompile("^([ \t]*)goroutine (\\d+) \\[([^\\]]+)\\]\\:$")
-	reMinutes       = regexp.MustCompile("^(\\d+) minutes$")
-	reUnavail       = regexp.MustCompile("^(?:\t| +)goroutine running on other thread; stack unavailable")
-	// See gentraceback() in src/runtime/traceback.go for more information.
-	// - Sometimes the source file comes up as "<autogenerated>". It is the
-	//   compiler than generated these, not the runtime.
-	// - The tab may be replaced with spaces when a user copy-paste it, handle
-	//   this transparently.
-	// - "runtime.gopanic" is explicitly replaced with "panic" by gentraceback().
-	// - The +0x123 byte offset is printed when frame.pc > _func.entry. _func is
-	//   generated by the linker.
-	// - The +0x123 byte offset is not included with generated code, e.g. unnamed
-	//   functions "func·006()" which is generally go func() { ... }()
-	//   statements. Since the _func is generated at runtime, it's probably why
-	//   _func.entry is not set.
-	// - C calls may have fp=0x123 sp=0x123 appended. I think it normally happens
-	//   when a signal is not correctly handled. It is printed with m.throwing>0.
-	//   These are discarded.
-	// - For cgo, the source file may be "??".
-	reFile = regexp.MustCompile("^(?:\t| +)(\\?\\?|\\<autogenerated\\>|.+\\.(?:c|go|s))\\:(\\d+)(?:| \\+0x[0-9a-f]+)(?:| fp=0x[0-9a-f]+ sp=0x[0-9a-f]+(?:| pc=0x[0-9a-f]+))$")
-	// Sadly, it doesn't note the goroutine number so we could cascade them per
-	// parenthood.
-	reCreated = regexp.MustCompile("^created by (.+)$")
-	reFunc    = regexp.MustCompile("^(.+)\\((.*)\\)$")
-
 	// See https://github.com/llvm/llvm-project/blob/master/compiler-rt/lib/tsan/rtl/tsan_report.cc
 	// for the code generating these messages. Please note only the block in
 	//   #else  // #if !SANITIZER_GO
@@ -279,6 +857,49 @@ type scanningState struct {
 	races  []raceOp
 }
 
+// checkLimits enforces the limits in opts, dropping the goroutine or the call
+// that exceeded it.
+func (s *scanningState) checkLimits(opts *Opts) error {
+	if opts.MaxGoroutines != 0 && len(s.goroutines) > opts.MaxGoroutines {
+		s.goroutines = s.goroutines[:opts.MaxGoroutines]
+		return &LimitError{Limit: "MaxGoroutines", Value: opts.MaxGoroutines}
+	}
+	if len(s.goroutines) != 0 && opts.MaxFramesPerGoroutine != 0 {
+		cur := s.goroutines[len(s.goroutines)-1]
+		if len(cur.Stack.Calls) > opts.MaxFramesPerGoroutine {
+			cur.Stack.Calls = cur.Stack.Calls[:opts.MaxFramesPerGoroutine]
+			cur.Stack.Elided = true
+			return &LimitError{Limit: "MaxFramesPerGoroutine", Value: opts.MaxFramesPerGoroutine}
+		}
+	}
+	return nil
+}
+
+// cutShort returns true if the scan is in the middle of a goroutine that is
+// not complete, e.g. a call without its file or a goroutine without a call.
+func (s *scanningState) cutShort() bool {
+	switch s.state {
+	case gotRoutineHeader, gotFunc, gotCreated:
+		return len(s.goroutines) != 0
+	default:
+		return false
+	}
+}
+
+// abort drops the goroutine being parsed when the scan failed in state prev,
+// or flags it as partial if keep is true, and resets the state.
+func (s *scanningState) abort(prev state, keep bool) {
+	if prev != normal && prev != betweenRoutine && len(s.goroutines) != 0 {
+		if keep {
+			s.goroutines[len(s.goroutines)-1].Partial = true
+		} else {
+			s.goroutines = s.goroutines[:len(s.goroutines)-1]
+		}
+	}
+	s.state = normal
+	s.prefix = ""
+}
+
 // scan scans one line, updates goroutines and move to the next state.
 //
 // TODO(maruel): Handle corrupted stack cases:
@@ -301,9 +922,7 @@ func (s *scanningState) scan(line string) (string, error) {
 	} else if strings.HasSuffix(line, "\n") {
 		trimmed = line[:len(line)-1]
 	} else {
-		// There's two cases:
-		// - It's the end of the stream and it's not terminating with EOL character.
-		// - The line is longer than bufio.MaxScanTokenSize
+		// It's the end of the stream and it's not terminating with EOL character.
 		if s.state == normal {
 			return line, nil
 		}
@@ -328,12 +947,13 @@ func (s *scanningState) scan(line string) (string, error) {
 		fallthrough
 	case betweenRoutine:
 		// Look for a goroutine header.
-		if match := reRoutineHeader.FindStringSubmatch(trimmed); match != nil {
-			if id, err := strconv.Atoi(match[2]); err == nil {
+		if prefix, num, header, ok := matchRoutineHeader(trimmed); ok {
+			if id, err := strconv.Atoi(num); err == nil {
 				// See runtime/traceback.go.
 				// "<state>, \d+ minutes, locked to thread"
-				items := strings.Split(match[3], ", ")
+				items := strings.Split(header, ", ")
 				sleep := 0
+				var wait time.Duration
 				locked := false
 				for i := 1; i < len(items); i++ {
 					if items[i] == lockedToThread {
@@ -341,8 +961,14 @@ func (s *scanningState) scan(line string) (string, error) {
 						continue
 					}
 					// Look for duration, if any.
-					if match2 := reMinutes.FindStringSubmatch(items[i]); match2 != nil {
-						sleep, _ = strconv.Atoi(match2[1])
+					if n, ok := matchDuration(items[i], "minutes"); ok {
+						sleep, _ = strconv.Atoi(n)
+					} else if n, ok := matchDuration(strings.TrimSuffix(items[i], "s"), "second"); ok {
+						// Not printed by the runtime but by tools that
+						// reformat the dump.
+						sec, _ := strconv.Atoi(n)
+						wait = time.Duration(sec) * time.Second
+						sleep = sec / 60
 					}
 				}
 				g := &Goroutine{
@@ -350,6 +976,8 @@ func (s *scanningState) scan(line string) (string, error) {
 						State:    items[0],
 						SleepMin: sleep,
 						SleepMax: sleep,
+						WaitMin:  wait,
+						WaitMax:  wait,
 						Locked:   locked,
 					},
 					ID:    id,
@@ -361,7 +989,7 @@ func (s *scanningState) scan(line string) (string, error) {
 				}
 				s.goroutines = append(s.goroutines, g)
 				s.state = gotRoutineHeader
-				s.prefix = match[1]
+				s.prefix = prefix
 				return "", nil
 			}
 		}
@@ -378,7 +1006,7 @@ func (s *scanningState) scan(line string) (string, error) {
 		return line, nil
 
 	case gotRoutineHeader:
-		if reUnavail.MatchString(trimmed) {
+		if isUnavail(trimmed) {
 			// Generate a fake stack entry.
 			cur.Stack.Calls = []Call{{SrcPath: "<unavailable>"}}
 			// Next line is expected to be an empty line.
@@ -417,8 +1045,9 @@ func (s *scanningState) scan(line string) (string, error) {
 		return "", nil
 
 	case gotFileFunc:
-		if match := reCreated.FindStringSubmatch(trimmed); match != nil {
-			cur.CreatedBy.Func.Raw = match[1]
+		if f, id, ok := matchCreated(trimmed); ok {
+			cur.CreatedBy.Func.Raw = f
+			cur.CreatedByID, _ = strconv.Atoi(id)
 			s.state = gotCreated
 			return "", nil
 		}
@@ -460,8 +1089,9 @@ func (s *scanningState) scan(line string) (string, error) {
 			s.state = betweenRoutine
 			return "", nil
 		}
-		if match := reCreated.FindStringSubmatch(trimmed); match != nil {
-			cur.CreatedBy.Func.Raw = match[1]
+		if f, id, ok := matchCreated(trimmed); ok {
+			cur.CreatedBy.Func.Raw = f
+			cur.CreatedByID, _ = strconv.Atoi(id)
 			s.state = gotCreated
 			return "", nil
 		}
@@ -615,43 +1245,163 @@ func (s *scanningState) scan(line string) (string, error) {
 	}
 }
 
+// join returns line and next joined together if line was obviously wrapped.
+//
+// Only the lines expected in the current state are considered: a goroutine
+// header outside of a goroutine, a function call after a header or a file,
+// and a file after a function call or a "created by" line.
+func (s *scanningState) join(line, next string) (string, bool) {
+	l := strings.TrimRight(line, "\r\n")
+	if l == "" || l == line || strings.TrimSpace(next) == "" {
+		return "", false
+	}
+	var match func(string) bool
+	switch s.state {
+	case normal, betweenRoutine:
+		if !strings.HasPrefix(strings.TrimLeft(l, " \t"), "goroutine ") {
+			return "", false
+		}
+		match = isRoutineHeader
+	case gotRoutineHeader, gotFileFunc:
+		// The arguments were cut.
+		if !strings.Contains(l, "(") || strings.HasSuffix(l, ")") {
+			return "", false
+		}
+		match = isFunc
+	case gotFunc, gotCreated:
+		if !strings.HasPrefix(l, "\t") && !strings.HasPrefix(l, " ") {
+			return "", false
+		}
+		match = isFileLine
+	default:
+		return "", false
+	}
+	if match(l) {
+		return "", false
+	}
+	joined := l + next
+	if !match(strings.TrimRight(joined, "\r\n")) {
+		return "", false
+	}
+	return joined, true
+}
+
+// anonymizeArgs replaces the pointers in args with the pseudo value of their
+// ID in ids, allocating new IDs as needed.
+func anonymizeArgs(args *Args, ids map[uint64]int) {
+	for i := range args.Values {
+		a := &args.Values[i]
+		if !a.IsPtr() {
+			continue
+		}
+		id, ok := ids[a.Value]
+		if !ok {
+			id = len(ids) + 1
+			ids[a.Value] = id
+		}
+		// Keep it a pointer so the aggregation is not affected.
+		a.Value = pointerFloor + uint64(id)
+		a.Name = fmt.Sprintf("#%d", id)
+	}
+}
+
 // parseFunc only return an error if also returning a Call.
 func parseFunc(c *Call, line string) (bool, error) {
-	if match := reFunc.FindStringSubmatch(line); match != nil {
-		c.Func.Raw = match[1]
-		for _, a := range strings.Split(match[2], ", ") {
-			if a == "..." {
-				c.Args.Elided = true
-				continue
+	if name, args, ok := matchFunc(line); ok {
+		c.Func.Raw = name
+		if _, err := parseArgs(&c.Args, args, 0); err != nil {
+			return true, fmt.Errorf("%s on line: %q", err, strings.TrimSpace(line))
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// parseArgs parses the arguments s of a call into args and returns what is
+// left of s after the closing brace when depth is not 0.
+//
+// Starting with Go 1.17, the runtime prints:
+//   - the structs, arrays, strings, slices and interfaces as "{...}" with
+//     their words, which can be nested
+//   - "..." for the words elided, including in an aggregate
+//   - "_" for the words too far in the frame to be printed
+//   - a "?" suffix for the values that may be inaccurate
+//
+// e.g. "{0xc000012018, 0x3}, {{0x1, 0x2}, ...}, _, 0x65?".
+func parseArgs(args *Args, s string, depth int) (string, error) {
+	for s != "" {
+		var a Arg
+		elided := false
+		switch {
+		case s[0] == '{':
+			if depth == maxArgDepth {
+				return "", errors.New("failed to parse args")
+			}
+			a.IsAggregate = true
+			var err error
+			if s, err = parseArgs(&a.Fields, s[1:], depth+1); err != nil {
+				return "", err
 			}
-			if a == "" {
+		case strings.HasPrefix(s, "..."):
+			args.Elided = true
+			elided = true
+			s = s[len("..."):]
+		case s[0] == '_':
+			a.IsOffsetTooLarge = true
+			s = s[1:]
+		default:
+			i := strings.IndexAny(s, ",}")
+			if i == -1 {
+				i = len(s)
+			}
+			v := s[:i]
+			if v == "" {
 				// Remaining values were dropped.
-				break
+				return "", nil
 			}
-			v, err := strconv.ParseUint(a, 0, 64)
-			if err != nil {
-				return true, fmt.Errorf("failed to parse int on line: %q", strings.TrimSpace(line))
+			// A "?" suffix flags a value that may be inaccurate.
+			a.Inexact = strings.HasSuffix(v, "?")
+			var err error
+			if a.Value, err = strconv.ParseUint(strings.TrimSuffix(v, "?"), 0, 64); err != nil {
+				return "", errors.New("failed to parse int")
 			}
+			s = s[i:]
+		}
+		if !elided {
 			// Increase performance by always allocating 4 values minimally.
-			if c.Args.Values == nil {
-				c.Args.Values = make([]Arg, 0, 4)
+			if args.Values == nil {
+				args.Values = make([]Arg, 0, 4)
 			}
-			c.Args.Values = append(c.Args.Values, Arg{Value: v})
+			args.Values = append(args.Values, a)
+		}
+		switch {
+		case strings.HasPrefix(s, ", "):
+			s = s[2:]
+		case s == "":
+		case s[0] == '}' && depth != 0:
+			return s[1:], nil
+		default:
+			return "", errors.New("failed to parse args")
 		}
-		return true, nil
 	}
-	return false, nil
+	if depth != 0 {
+		return "", errors.New("failed to parse args")
+	}
+	return "", nil
 }
 
 // parseFile only return an error if also processing a Call.
 func parseFile(c *Call, line string) (bool, error) {
-	if match := reFile.FindStringSubmatch(line); match != nil {
-		num, err := strconv.Atoi(match[2])
+	if path, n, offset, ok := matchFile(line); ok {
+		num, err := strconv.Atoi(n)
 		if err != nil {
 			return true, fmt.Errorf("failed to parse int on line: %q", strings.TrimSpace(line))
 		}
-		c.SrcPath = match[1]
+		c.SrcPath = path
 		c.Line = num
+		// The frames inlined in their caller have no PC offset and their
+		// arguments are printed as "(...)".
+		c.Inlined = offset == "" && c.Args.Elided && len(c.Args.Values) == 0
 		return true, nil
 	}
 	return false, nil
@@ -717,25 +1467,58 @@ func isFile(p string) bool {
 	return err == nil && !i.IsDir()
 }
 
+// fileCache caches the result of isFile, so guessing the paths of many stack
+// dumps with the same Context doesn't hammer the file system.
+//
+// A nil *fileCache doesn't cache. It is safe for concurrent use.
+type fileCache struct {
+	mu    sync.Mutex
+	files map[string]bool
+}
+
+// isFile returns true if the path is a valid file.
+func (f *fileCache) isFile(p string) bool {
+	if f == nil {
+		return isFile(p)
+	}
+	f.mu.Lock()
+	ok, found := f.files[p]
+	f.mu.Unlock()
+	if found {
+		return ok
+	}
+	ok = isFile(p)
+	f.mu.Lock()
+	if len(f.files) < maxCachedFiles {
+		f.files[p] = ok
+	}
+	f.mu.Unlock()
+	return ok
+}
+
 // rootedIn returns a root if the file split in parts is rooted in root.
 //
 // Uses "/" as path separator.
-func rootedIn(root string, parts []string) string {
+func rootedIn(files *fileCache, root string, parts []string) string {
 	//log.Printf("rootIn(%s, %v)", root, parts)
 	for i := 1; i < len(parts); i++ {
 		suffix := pathJoin(parts[i:]...)
-		if isFile(pathJoin(root, suffix)) {
+		if files.isFile(pathJoin(root, suffix)) {
 			return pathJoin(parts[:i]...)
 		}
 	}
 	return ""
 }
 
-// findRoots sets member GOROOT and GOPATHs.
+// findRoots sets member GOROOT and GOPATHs, starting with the GOPATHs already
+// known.
 //
 // This causes disk I/O as it checks for file presence.
-func (c *Context) findRoots() {
-	c.GOPATHs = map[string]string{}
+func (c *Context) findRoots(known map[string]string) {
+	c.GOPATHs = make(map[string]string, len(known))
+	for k, v := range known {
+		c.GOPATHs[k] = v
+	}
 	for _, f := range getFiles(c.Goroutines) {
 		// TODO(maruel): Could a stack dump have mixed cases? I think it's
 		// possible, need to confirm and handle.
@@ -748,7 +1531,7 @@ func (c *Context) findRoots() {
 		}
 		parts := splitPath(f)
 		if c.GOROOT == "" {
-			if r := rootedIn(c.localgoroot+"/src", parts); r != "" {
+			if r := rootedIn(c.files, c.localgoroot+"/src", parts); r != "" {
 				c.GOROOT = r[:len(r)-4]
 				//log.Printf("Found GOROOT=%s", c.GOROOT)
 				continue
@@ -756,13 +1539,13 @@ func (c *Context) findRoots() {
 		}
 		found := false
 		for _, l := range c.localgopaths {
-			if r := rootedIn(l+"/src", parts); r != "" {
+			if r := rootedIn(c.files, l+"/src", parts); r != "" {
 				//log.Printf("Found GOPATH=%s", r[:len(r)-4])
 				c.GOPATHs[r[:len(r)-4]] = l
 				found = true
 				break
 			}
-			if r := rootedIn(l+"/pkg/mod", parts); r != "" {
+			if r := rootedIn(c.files, l+"/pkg/mod", parts); r != "" {
 				//log.Printf("Found GOPATH=%s", r[:len(r)-8])
 				c.GOPATHs[r[:len(r)-8]] = l
 				found = true
@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -17,6 +18,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/maruel/panicparse/internal/internaltest"
@@ -34,6 +36,110 @@ func TestParseDumpNothing(t *testing.T) {
 	}
 }
 
+func TestParseBytes(t *testing.T) {
+	t.Parallel()
+	in := "junk\n" +
+		"goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n"
+	c, extra, err := ParseBytes([]byte(in), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || len(c.Goroutines) != 1 || c.Goroutines[0].Stack.Calls[0].Line != 10 {
+		t.Fatalf("unexpected %v", c)
+	}
+	if string(extra) != "junk\n" {
+		t.Fatalf("unexpected extra %q", extra)
+	}
+
+	c2, extra2, err := ParseString(in, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, c2) || extra2 != "junk\n" {
+		t.Fatalf("unexpected %v, %q", c2, extra2)
+	}
+
+	if c, extra2, err = ParseString("no dump\n", false); c != nil || extra2 != "no dump\n" || err != nil {
+		t.Fatalf("unexpected %v, %q, %v", c, extra2, err)
+	}
+}
+
+func TestContextParse(t *testing.T) {
+	t.Parallel()
+	dumps := []string{
+		"panic: boom\n\n" +
+			"goroutine 1 [running]:\n" +
+			"main.main(0xc000010000)\n" +
+			"\t/gopath/src/foo/main.go:10 +0x20\n" +
+			"\n" +
+			"goroutine 6 [chan receive]:\n" +
+			"main.worker(0xc000010000)\n" +
+			"\t/gopath/src/foo/main.go:20 +0x20\n",
+		"goroutine 2 [select]:\n" +
+			"main.loop()\n" +
+			"\t/gopath/src/foo/main.go:30 +0x20\n",
+	}
+	c := &Context{}
+	for i := 0; i < 2; i++ {
+		for _, d := range dumps {
+			want, err := ParseDump(strings.NewReader(d), ioutil.Discard, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Parse(strings.NewReader(d), ioutil.Discard, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(want.Goroutines, c.Goroutines) || !reflect.DeepEqual(want.Panics, c.Panics) {
+				t.Fatalf("unexpected %v, %v", c.Goroutines, c.Panics)
+			}
+		}
+	}
+	if err := c.Parse(strings.NewReader("no dump\n"), ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Goroutines) != 0 || len(c.Panics) != 0 {
+		t.Fatalf("unexpected %v, %v", c.Goroutines, c.Panics)
+	}
+}
+
+func TestParseDumpPositions(t *testing.T) {
+	t.Parallel()
+	g1 := "goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n"
+	g2 := "goroutine 6 [chan receive]:\n" +
+		"main.worker()\n" +
+		"\t/gopath/src/foo/ma\n" +
+		"in.go:20 +0x20\n"
+	in := "junk\n" + g1 + "\n" + g2 + "\n" + "exit status 2\n"
+	c, err := ParseDump(strings.NewReader(in), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Goroutines) != 2 || c.Wrapped != 1 {
+		t.Fatalf("unexpected %v", c)
+	}
+	start2 := int64(len("junk\n" + g1 + "\n"))
+	data := []struct {
+		startLine, endLine int
+		start, end         int64
+	}{
+		{2, 4, 5, int64(5 + len(g1))},
+		{6, 9, start2, start2 + int64(len(g2))},
+	}
+	for i, line := range data {
+		g := c.Goroutines[i]
+		if g.StartLine != line.startLine || g.EndLine != line.endLine || g.Start != line.start || g.End != line.end {
+			t.Fatalf("#%d: want %d-%d [%d:%d], got %d-%d [%d:%d]", i, line.startLine, line.endLine, line.start, line.end, g.StartLine, g.EndLine, g.Start, g.End)
+		}
+		if !strings.HasPrefix(in[g.Start:g.End], "goroutine ") {
+			t.Fatalf("#%d: unexpected %q", i, in[g.Start:g.End])
+		}
+	}
+}
+
 func TestParseDump1(t *testing.T) {
 	t.Parallel()
 	// One call from main, one from stdlib, one from third party.
@@ -414,6 +520,747 @@ func TestParseDumpOrderErr(t *testing.T) {
 	compareString(t, "panic: reflect.Set: value of type\n\n", extra.String())
 }
 
+func TestParseDumpWrapped(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: wrapped",
+		"(not a function",
+		"",
+		"goroutine 1 [chan receive,",
+		" 10 minutes]:",
+		"main.func·001(0x11000000,",
+		" 0x2)",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/sta",
+		"ck.go:72 +0x49",
+		"created by main.mainImpl",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:74 +0xeb",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), extra, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State:    "chan receive",
+				SleepMin: 10,
+				SleepMax: 10,
+				CreatedBy: newCall(
+					"main.mainImpl",
+					Args{},
+					"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
+					74),
+				Stack: Stack{
+					Calls: []Call{
+						newCall(
+							"main.func·001",
+							Args{Values: []Arg{{Value: 0x11000000}, {Value: 2}}},
+							"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
+							72),
+					},
+				},
+			},
+			ID:    1,
+			First: true,
+		},
+	}
+	compareGoroutines(t, want, c.Goroutines)
+	compareString(t, "panic: wrapped\n(not a function\n\n", extra.String())
+	if c.Wrapped != 3 {
+		t.Fatalf("expected 3 wrapped lines, got %d", c.Wrapped)
+	}
+}
+
+func TestParseDumpPanics(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: first [recovered]",
+		"\tpanic: main.S(\"second\")",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), extra, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PanicDetail{
+		{Kind: "panic", Message: "first", Recovered: true, Value: "first", Line: 1},
+		{Kind: "panic", Message: `main.S("second")`, Value: "second", Line: 2},
+	}
+	if diff := cmp.Diff(want, c.Panics); diff != "" {
+		t.Fatalf("Panics mismatch (-want +got):\n%s", diff)
+	}
+	compareString(t, "panic: first [recovered]\n\tpanic: main.S(\"second\")\n\n", extra.String())
+}
+
+func TestParseDumpPanicsRepanicked(t *testing.T) {
+	t.Parallel()
+	// As printed by Go 1.23 and later.
+	data := []string{
+		"panic: main.S(\"first\") [recovered, repanicked]",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PanicDetail{{Kind: "panic", Message: `main.S("first")`, Recovered: true, Repanicked: true, Value: "first", Line: 1}}
+	if diff := cmp.Diff(want, c.Panics); diff != "" {
+		t.Fatalf("Panics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseDumpPanicsNextDump(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: first",
+		"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x4a5b6c]",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+		"restarted",
+		"panic: second",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PanicDetail{{Kind: "panic", Message: "second", Value: "second", Line: 9}}
+	if diff := cmp.Diff(want, c.Panics); diff != "" {
+		t.Fatalf("Panics mismatch (-want +got):\n%s", diff)
+	}
+	if c.Signal != nil {
+		t.Fatalf("unexpected signal %v", c.Signal)
+	}
+}
+
+func TestContextCrashed(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: runtime error: invalid memory address or nil pointer dereference",
+		"",
+		"goroutine 5 [chan receive]:",
+		"main.wait()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:10 +0x49",
+		"",
+		"goroutine 1 [running]:",
+		"runtime.gopanic(0x4c5b20, 0x5a4f40)",
+		"\t/goroot/src/runtime/panic.go:679 +0x1b2",
+		"runtime.panicmem(...)",
+		"\t/goroot/src/runtime/panic.go:199",
+		"runtime.sigpanic()",
+		"\t/goroot/src/runtime/signal_unix.go:394 +0x3ec",
+		"main.crash()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:20 +0x1d",
+		"main.main()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:30 +0x20",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, call := c.Crashed()
+	if g == nil || g.ID != 1 {
+		t.Fatalf("unexpected goroutine %v", g)
+	}
+	if call == nil || call.Func.Raw != "main.crash" || call.Line != 20 {
+		t.Fatalf("unexpected call %v", call)
+	}
+
+	// No user call.
+	c.Goroutines[1].Stack.Calls = c.Goroutines[1].Stack.Calls[:3]
+	if g, call = c.Crashed(); g == nil || g.ID != 1 || call != nil {
+		t.Fatalf("unexpected %v, %v", g, call)
+	}
+
+	// No panic.
+	c.Goroutines = c.Goroutines[:1]
+	if g, call = c.Crashed(); g != nil || call != nil {
+		t.Fatalf("unexpected %v, %v", g, call)
+	}
+}
+
+func TestParseDumpInlined(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [running]:",
+		"sync.(*Mutex).Lock(...)",
+		"\t/goroot/src/sync/mutex.go:74",
+		"main.lock(0x1)",
+		"\t/gopath/src/foo/main.go:10",
+		"main.main(...)",
+		"\t/gopath/src/foo/main.go:20 +0x1d",
+		"created by main.init",
+		"\t/gopath/src/foo/main.go:5 +0x20",
+		"",
+	}
+	c, err := ParseDump(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := c.Goroutines[0]
+	for i, want := range []bool{true, false, false} {
+		if got := g.Stack.Calls[i].Inlined; got != want {
+			t.Fatalf("#%d: want Inlined %t", i, want)
+		}
+	}
+	if g.CreatedBy.Inlined {
+		t.Fatal("unexpected inlined creator")
+	}
+}
+
+func TestParseDumpInexact(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [IO wait]:",
+		"internal/poll.(*pollDesc).wait(0xc000100000?, 0x100?, 0x0)",
+		"\t/goroot/src/internal/poll/fd_poll_runtime.go:84 +0x32",
+		"",
+	}
+	c, err := ParseDump(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "IO wait",
+				Stack: Stack{
+					Calls: []Call{
+						newCall(
+							"internal/poll.(*pollDesc).wait",
+							Args{Values: []Arg{{Value: 0xc000100000, Inexact: true}, {Value: 0x100, Inexact: true}, {}}},
+							"/goroot/src/internal/poll/fd_poll_runtime.go",
+							84),
+					},
+				},
+			},
+			ID:    1,
+			First: true,
+		},
+	}
+	compareGoroutines(t, want, c.Goroutines)
+	compareString(t, "0xc000100000?, 0x100?, 0", c.Goroutines[0].Stack.Calls[0].Args.String())
+}
+
+func TestParseDumpAggregate(t *testing.T) {
+	t.Parallel()
+	// Starting with Go 1.17, the fields of the aggregates passed by value are
+	// printed within braces.
+	data := []string{
+		"panic: boom",
+		"",
+		"goroutine 5 [running]:",
+		"main.deep({{0x1, 0x2, {0x499000, 0x1}}, {0x1, 0x2}, 0x0}, {0x0, 0x0}, 0x3ff8000000000000, ...)",
+		"\t/gopath/src/example.com/agg/main.go:18 +0xcc",
+		"main.strs({0x0?, 0x70?}, {0x499000?, ...}, {{{{{...}}}}}, _)",
+		"\t/gopath/src/example.com/agg/main.go:23 +0x105",
+		"created by main.main in goroutine 1",
+		"\t/gopath/src/example.com/agg/main.go:27 +0x65",
+		"",
+	}
+	c, err := ParseDump(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				CreatedBy: newCall(
+					"main.main",
+					Args{},
+					"/gopath/src/example.com/agg/main.go",
+					27),
+				CreatedByID: 1,
+				Stack: Stack{
+					Calls: []Call{
+						newCall(
+							"main.deep",
+							Args{
+								Values: []Arg{
+									{IsAggregate: true, Fields: Args{Values: []Arg{
+										{IsAggregate: true, Fields: Args{Values: []Arg{
+											{Value: 1}, {Value: 2},
+											{IsAggregate: true, Fields: Args{Values: []Arg{{Value: 0x499000, Name: "#1"}, {Value: 1}}}},
+										}}},
+										{IsAggregate: true, Fields: Args{Values: []Arg{{Value: 1}, {Value: 2}}}},
+										{},
+									}}},
+									{IsAggregate: true, Fields: Args{Values: []Arg{{}, {}}}},
+									{Value: 0x3ff8000000000000},
+								},
+								Elided: true,
+							},
+							"/gopath/src/example.com/agg/main.go",
+							18),
+						newCall(
+							"main.strs",
+							Args{
+								Values: []Arg{
+									{IsAggregate: true, Fields: Args{Values: []Arg{{Inexact: true}, {Value: 0x70, Inexact: true}}}},
+									{IsAggregate: true, Fields: Args{Values: []Arg{{Value: 0x499000, Name: "#1", Inexact: true}}, Elided: true}},
+									{IsAggregate: true, Fields: Args{Values: []Arg{
+										{IsAggregate: true, Fields: Args{Values: []Arg{
+											{IsAggregate: true, Fields: Args{Values: []Arg{
+												{IsAggregate: true, Fields: Args{Values: []Arg{
+													{IsAggregate: true, Fields: Args{Elided: true}},
+												}}},
+											}}},
+										}}},
+									}}},
+									{IsOffsetTooLarge: true},
+								},
+							},
+							"/gopath/src/example.com/agg/main.go",
+							23),
+					},
+				},
+			},
+			ID:    5,
+			First: true,
+		},
+	}
+	compareGoroutines(t, want, c.Goroutines)
+	compareString(t, "{{1, 2, {#1, 1}}, {1, 2}, 0}, {0, 0}, 0x3ff8000000000000, ...", c.Goroutines[0].Stack.Calls[0].Args.String())
+	compareString(t, "{0?, 0x70?}, {#1, ...}, {{{{{...}}}}}, _", c.Goroutines[0].Stack.Calls[1].Args.String())
+}
+
+func TestParseDumpAggregateErr(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"{0x1",
+		"0x1}",
+		"{0x1}}",
+		"{0x1, {0x2}",
+		"{0x1 0x2}",
+		"{zz}",
+		strings.Repeat("{", maxArgDepth+1) + "0x1" + strings.Repeat("}", maxArgDepth+1),
+	}
+	for _, args := range data {
+		var a Args
+		if _, err := parseArgs(&a, args, 0); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
+
+func TestParseDumpTruncated(t *testing.T) {
+	t.Parallel()
+	// Captured with pprof.Lookup("goroutine").WriteTo(os.Stdout, 2).
+	dump := []string{
+		"goroutine 1 [running]:",
+		"runtime/pprof.writeGoroutineStacks({0x5e1750, 0x2298cc144038})",
+		"\t/usr/local/go/src/runtime/pprof/pprof.go:816 +0x69",
+		"runtime/pprof.writeGoroutine({0x5e1750?, 0x2298cc144038?}, 0x408975?)",
+		"\t/usr/local/go/src/runtime/pprof/pprof.go:779 +0x25",
+		"runtime/pprof.(*Profile).WriteTo(0x4df856?, {0x5e1750?, 0x2298cc144038?}, 0x5e3768?)",
+		"\t/usr/local/go/src/runtime/pprof/pprof.go:405 +0x149",
+		"main.main()",
+		"\t/tmp/cap/main.go:11 +0x9f",
+		"",
+		"goroutine 6 [runnable]:",
+		"main.main.func1()",
+		"\t/tmp/cap/main.go:10",
+		"created by main.main in goroutine 1",
+		"\t/tmp/cap/main.go:10 +0x76",
+		"",
+	}
+	data := []struct {
+		name      string
+		lines     int
+		truncated bool
+	}{
+		{"complete", len(dump), false},
+		{"no trailing empty line", len(dump) - 1, false},
+		{"between goroutines", 10, false},
+		{"header", 11, true},
+		{"call without file", 12, true},
+		{"created without file", 14, true},
+	}
+	for i, line := range data {
+		line := line
+		t.Run(fmt.Sprintf("%d-%s", i, line.name), func(t *testing.T) {
+			t.Parallel()
+			c, err := ParseDump(strings.NewReader(strings.Join(dump[:line.lines], "\n")), ioutil.Discard, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Truncated != line.truncated {
+				t.Fatalf("want Truncated %t, got %t", line.truncated, c.Truncated)
+			}
+			if g := c.Goroutines[len(c.Goroutines)-1]; g.Partial != line.truncated {
+				t.Fatalf("want Partial %t, got %t", line.truncated, g.Partial)
+			}
+		})
+	}
+}
+
+func TestParseDumpSeconds(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [chan receive, 90 seconds]:",
+		"main.wait()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:10 +0x49",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State:    "chan receive",
+				SleepMin: 1,
+				SleepMax: 1,
+				WaitMin:  90 * time.Second,
+				WaitMax:  90 * time.Second,
+				Stack: Stack{
+					Calls: []Call{
+						newCall(
+							"main.wait",
+							Args{},
+							"/gopath/src/github.com/maruel/panicparse/stack/stack.go",
+							10),
+					},
+				},
+			},
+			ID:    1,
+			First: true,
+		},
+	}
+	compareGoroutines(t, want, c.Goroutines)
+}
+
+func TestContextAnonymize(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [running]:",
+		"main.main(0xc000010000, 0x2, 0xc000020000)",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.wait(0xc000020000, 0xc000030000)",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:10 +0x49",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Anonymize()
+	want := [][]Arg{
+		{{Value: pointerFloor + 1, Name: "#1"}, {Value: 2}, {Value: pointerFloor + 2, Name: "#2"}},
+		{{Value: pointerFloor + 2, Name: "#2"}, {Value: pointerFloor + 3, Name: "#3"}},
+	}
+	for i, g := range c.Goroutines {
+		if diff := cmp.Diff(want[i], g.Stack.Calls[0].Args.Values); diff != "" {
+			t.Fatalf("#%d: (-want +got):\n%s", i, diff)
+		}
+		if !g.Stack.Calls[0].Args.Values[0].IsPtr() {
+			t.Fatalf("#%d: expected a pointer", i)
+		}
+	}
+}
+
+func TestParseDumpWithOptsLimits(t *testing.T) {
+	t.Parallel()
+	data := strings.Join([]string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.a()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:10 +0x49",
+		"main.main()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:20 +0x49",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.wait()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:30 +0x49",
+		"",
+	}, "\n")
+	data2 := []struct {
+		opts       Opts
+		want       *LimitError
+		goroutines int
+		calls      int
+	}{
+		{Opts{}, nil, 2, 2},
+		{Opts{MaxGoroutines: 2, MaxFramesPerGoroutine: 2, MaxLineLength: 80}, nil, 2, 2},
+		{Opts{MaxGoroutines: 1}, &LimitError{Limit: "MaxGoroutines", Value: 1}, 1, 2},
+		{Opts{MaxFramesPerGoroutine: 1}, &LimitError{Limit: "MaxFramesPerGoroutine", Value: 1}, 1, 1},
+		{Opts{MaxLineLength: 30}, &LimitError{Limit: "MaxLineLength", Value: 30}, 1, 1},
+	}
+	for i, line := range data2 {
+		c, err := ParseDumpWithOpts(strings.NewReader(data), ioutil.Discard, &line.opts)
+		if line.want == nil {
+			if err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+		} else {
+			l, ok := err.(*LimitError)
+			if !ok {
+				t.Fatalf("#%d: expected LimitError, got %v", i, err)
+			}
+			if diff := cmp.Diff(line.want, l); diff != "" {
+				t.Fatalf("#%d: (-want +got):\n%s", i, diff)
+			}
+		}
+		if len(c.Goroutines) != line.goroutines {
+			t.Fatalf("#%d: expected %d goroutines, got %d", i, line.goroutines, len(c.Goroutines))
+		}
+		if l := len(c.Goroutines[0].Stack.Calls); l != line.calls {
+			t.Fatalf("#%d: expected %d calls, got %d", i, line.calls, l)
+		}
+	}
+	compareString(t, "stack dump exceeds MaxGoroutines of 1", (&LimitError{Limit: "MaxGoroutines", Value: 1}).Error())
+}
+
+func TestParseDumpWithOptsLenient(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"panic: oh no",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:10 +0x49",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.broken()",
+		"garbage",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:20 +0x49",
+		"",
+		"goroutine 3 [chan receive]:",
+		"main.cut()",
+		"goroutine 4 [select]:",
+		"main.wait()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:30 +0x49",
+		"",
+	}
+	in := strings.Join(data, "\n")
+	if _, err := ParseDumpWithOpts(strings.NewReader(in), ioutil.Discard, &Opts{}); err == nil {
+		t.Fatal("expected error")
+	}
+	extra := &bytes.Buffer{}
+	c, err := ParseDumpWithOpts(strings.NewReader(in), extra, &Opts{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, g := range c.Goroutines {
+		ids = append(ids, g.ID)
+	}
+	if diff := cmp.Diff([]int{1, 4}, ids); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+	want := []ParseWarning{
+		{Line: 9, Reason: "expected a file after a function, got: \"garbage\""},
+		{Line: 14, Reason: "expected a file after a function, got: \"goroutine 4 [select]:\""},
+	}
+	if diff := cmp.Diff(want, c.Warnings); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+	compareString(t, "panic: oh no\n\n", extra.String())
+}
+
+func TestParseDumpWithOptsResync(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [running]:",
+		"main.a()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:10 +0x49",
+		"main.main()",
+		"log line from another goroutine",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:20 +0x49",
+		"",
+		"goroutine 2 [select]:",
+		"main.wait()",
+		"\t/gopath/src/github.com/maruel/panicparse/stack/stack.go:30 +0x49",
+		"",
+	}
+	c, err := ParseDumpWithOpts(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, &Opts{Resync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						newCall("main.a", Args{}, "/gopath/src/github.com/maruel/panicparse/stack/stack.go", 10),
+						newCall("main.main", Args{}, "", 0),
+					},
+				},
+			},
+			ID:      1,
+			First:   true,
+			Partial: true,
+		},
+		{
+			Signature: Signature{
+				State: "select",
+				Stack: Stack{
+					Calls: []Call{
+						newCall("main.wait", Args{}, "/gopath/src/github.com/maruel/panicparse/stack/stack.go", 30),
+					},
+				},
+			},
+			ID: 2,
+		},
+	}
+	compareGoroutines(t, want, c.Goroutines)
+	if len(c.Warnings) != 1 || c.Warnings[0].Line != 5 {
+		t.Fatalf("unexpected warnings %v", c.Warnings)
+	}
+}
+
+func TestParseDumpWithOptsEnv(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 2 [select]:",
+		"main.wait()",
+		"\t/build/app/main.go:30 +0x49",
+		"github.com/foo/bar.Wait()",
+		"\t/home/user/go/pkg/mod/github.com/foo/bar@v1.0.0/bar.go:20 +0x49",
+		"sync.(*Cond).Wait()",
+		"\t/usr/local/go/src/sync/cond.go:56 +0x49",
+		"created by main.main",
+		"\t/build/app/main.go:12 +0x49",
+		"",
+	}
+	env := &Env{
+		GOROOT:      "/usr/local/go",
+		LocalGOROOT: "/opt/go",
+		GOPATHs:     map[string]string{"/home/user/go": "/Users/me/go"},
+		SourceRoots: map[string]string{"/build": "/tmp", "/build/app": "/Users/me/app"},
+	}
+	c, err := ParseDumpWithOpts(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, &Opts{GuessPaths: true, Env: env})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GOROOT != "/usr/local/go" {
+		t.Fatalf("unexpected GOROOT %q", c.GOROOT)
+	}
+	g := c.Goroutines[0]
+	want := []struct {
+		local    string
+		isStdlib bool
+	}{
+		{"/Users/me/app/main.go", false},
+		{"/Users/me/go/pkg/mod/github.com/foo/bar@v1.0.0/bar.go", false},
+		{"/opt/go/src/sync/cond.go", true},
+	}
+	for i, w := range want {
+		if l := g.Stack.Calls[i].LocalSrcPath; l != w.local {
+			t.Fatalf("#%d: want %q, got %q", i, w.local, l)
+		}
+		if s := g.Stack.Calls[i].IsStdlib; s != w.isStdlib {
+			t.Fatalf("#%d: want IsStdlib %t", i, w.isStdlib)
+		}
+	}
+	if l := g.CreatedBy.LocalSrcPath; l != "/Users/me/app/main.go" {
+		t.Fatalf("unexpected %q", l)
+	}
+}
+
+func TestParseDumpWithOptsLazyPaths(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [running]:",
+		"sync.(*Cond).Wait()",
+		"\t/usr/local/go/src/sync/cond.go:56 +0x49",
+		"",
+		"goroutine 2 [select]:",
+		"github.com/foo/bar.Wait()",
+		"\t/home/user/go/src/github.com/foo/bar/bar.go:20 +0x49",
+		"",
+	}
+	env := &Env{
+		GOROOT:      "/usr/local/go",
+		LocalGOROOT: "/opt/go",
+		GOPATHs:     map[string]string{"/home/user/go": "/Users/me/go"},
+	}
+	calls := 0
+	r := ResolverFunc(func(c *Call) error {
+		calls++
+		return nil
+	})
+	c, err := ParseDumpWithOpts(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, &Opts{GuessPaths: true, Env: env, Resolvers: []Resolver{r}, LazyPaths: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GOROOT != "/usr/local/go" || c.GOPATHs["/home/user/go"] != "/Users/me/go" {
+		t.Fatalf("unexpected %q, %v", c.GOROOT, c.GOPATHs)
+	}
+	for _, g := range c.Goroutines {
+		if call := g.Stack.Calls[0]; call.LocalSrcPath != "" || call.IsStdlib || calls != 0 {
+			t.Fatalf("unexpected %#v", call)
+		}
+	}
+	// Only resolve the goroutines kept.
+	if err := Resolve(c.Goroutines[1:], c); err != nil {
+		t.Fatal(err)
+	}
+	if l := c.Goroutines[0].Stack.Calls[0].LocalSrcPath; l != "" {
+		t.Fatalf("unexpected %q", l)
+	}
+	if l := c.Goroutines[1].Stack.Calls[0].LocalSrcPath; l != "/Users/me/go/src/github.com/foo/bar/bar.go" {
+		t.Fatalf("unexpected %q", l)
+	}
+}
+
+func TestParseDumpWithOptsEnvRemap(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/go/src/app/main.go:30 +0x49",
+		"main.other()",
+		"\t/go/src/other/other.go:20 +0x49",
+		"",
+	}
+	env := &Env{
+		Remap: func(p string) (string, string) {
+			if strings.HasPrefix(p, "/go/src/app/") {
+				return "/home/me/app/" + p[len("/go/src/app/"):], p[len("/go/src/app/"):]
+			}
+			return "", ""
+		},
+		SourceRoots: map[string]string{"/go/src": "/src"},
+	}
+	c, err := ParseDumpWithOpts(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, &Opts{GuessPaths: true, Env: env})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := c.Goroutines[0].Stack.Calls
+	if calls[0].SrcPath != "/go/src/app/main.go" || calls[0].LocalSrcPath != "/home/me/app/main.go" || calls[0].RelSrcPath != "main.go" {
+		t.Fatalf("unexpected %#v", calls[0])
+	}
+	if calls[1].LocalSrcPath != "/src/other/other.go" || calls[1].RelSrcPath != "other/other.go" {
+		t.Fatalf("unexpected %#v", calls[1])
+	}
+}
+
 func TestParseDumpElided(t *testing.T) {
 	t.Parallel()
 	data := []string{
@@ -893,6 +1740,10 @@ func TestParseDumpCCode(t *testing.T) {
 		},
 	}
 	compareGoroutines(t, wantGR, c.Goroutines)
+	wantSig := &SignalInfo{Name: "SIGQUIT", Description: "quit", PC: 0x43f349}
+	if diff := cmp.Diff(wantSig, c.Signal); diff != "" {
+		t.Fatalf("Signal mismatch (-want +got):\n%s", diff)
+	}
 }
 
 func TestParseDumpWithCarriageReturn(t *testing.T) {
@@ -1119,8 +1970,7 @@ func TestRaceManual(t *testing.T) {
 			ID: 6,
 		},
 	}
-	scanner := bufio.NewScanner(bytes.NewBufferString(strings.Join(data, "\n")))
-	scanner.Split(scanLines)
+	scanner := newLineReader(bytes.NewBufferString(strings.Join(data, "\n")), 0)
 	s := scanningState{raceDetectionEnabled: true}
 	for scanner.Scan() {
 		line, err := s.scan(scanner.Text())
@@ -1138,6 +1988,34 @@ func TestRaceManual(t *testing.T) {
 	}
 }
 
+func TestFileCache(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(p, []byte("package main\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f := &fileCache{files: map[string]bool{}}
+	if !f.isFile(p) || f.isFile(dir) {
+		t.Fatal("unexpected")
+	}
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	// The result is cached.
+	if !f.isFile(p) {
+		t.Fatal("expected cached result")
+	}
+	var n *fileCache
+	if n.isFile(p) {
+		t.Fatal("expected no cache")
+	}
+}
+
 func TestSplitPath(t *testing.T) {
 	t.Parallel()
 	if p := splitPath(""); p != nil {
@@ -1449,6 +2327,42 @@ func BenchmarkParseDump_NoGuess(b *testing.B) {
 	}
 }
 
+func BenchmarkParseDump_Large(b *testing.B) {
+	b.ReportAllocs()
+	buf := bytes.Buffer{}
+	for i := 1; i <= 10000; i++ {
+		fmt.Fprintf(&buf, "goroutine %d [chan receive, 3 minutes]:\n", i)
+		buf.WriteString("main.worker(0xc000010000, 0x1)\n\t/gopath/src/foo/main.go:20 +0x20\n")
+		buf.WriteString("created by main.main\n\t/gopath/src/foo/main.go:8 +0x20\n\n")
+	}
+	data := buf.Bytes()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, err := ParseDump(bytes.NewReader(data), ioutil.Discard, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(c.Goroutines) != 10000 {
+			b.Fatal("missing goroutines")
+		}
+	}
+}
+
+func BenchmarkContextParse(b *testing.B) {
+	b.ReportAllocs()
+	data := internaltest.StaticPanicwebOutput()
+	c := &Context{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.Parse(bytes.NewReader(data), ioutil.Discard, nil); err != nil {
+			b.Fatal(err)
+		}
+		if len(c.Goroutines) == 0 {
+			b.Fatal("missing goroutines")
+		}
+	}
+}
+
 //
 
 type panicwebSignatureType int
@@ -0,0 +1,54 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "regexp"
+
+// Filter selects goroutines based on the calls in their stack.
+//
+// The regexps are matched against both the function name, e.g.
+// "net/http.(*conn).serve", and the source path of each call. This enables
+// silencing known noisy subsystems.
+//
+// The zero value keeps all the goroutines.
+type Filter struct {
+	// Include keeps only the goroutines with at least one call matching. Nil
+	// keeps all the goroutines.
+	Include *regexp.Regexp
+	// Exclude drops the goroutines with at least one call matching. It has
+	// precedence over Include. Nil drops none.
+	Exclude *regexp.Regexp
+}
+
+// Apply returns the goroutines selected by the filter, in the same order.
+func (f *Filter) Apply(goroutines []*Goroutine) []*Goroutine {
+	if f.Include == nil && f.Exclude == nil {
+		return goroutines
+	}
+	out := make([]*Goroutine, 0, len(goroutines))
+	for _, g := range goroutines {
+		if f.Exclude != nil && matchCalls(f.Exclude, g.Stack.Calls) {
+			continue
+		}
+		if f.Include != nil && !matchCalls(f.Include, g.Stack.Calls) {
+			continue
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// Private stuff.
+
+// matchCalls returns true if any call's function name or source path matches
+// r.
+func matchCalls(r *regexp.Regexp, calls []Call) bool {
+	for i := range calls {
+		if r.MatchString(calls[i].Func.Raw) || r.MatchString(calls[i].SrcPath) {
+			return true
+		}
+	}
+	return false
+}
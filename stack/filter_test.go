@@ -0,0 +1,71 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	goroutines := []*Goroutine{
+		{
+			Signature: Signature{
+				Stack: Stack{
+					Calls: []Call{
+						newCall("net/http.(*conn).serve", Args{}, "/goroot/src/net/http/server.go", 1890),
+					},
+				},
+			},
+			ID: 1,
+		},
+		{
+			Signature: Signature{
+				Stack: Stack{
+					Calls: []Call{
+						newCall("main.worker", Args{}, "/gopath/src/foo/worker.go", 12),
+						newCall("main.main", Args{}, "/gopath/src/foo/main.go", 20),
+					},
+				},
+			},
+			ID: 2,
+		},
+		{
+			Signature: Signature{
+				Stack: Stack{
+					Calls: []Call{
+						newCall("foo/metrics.loop", Args{}, "/gopath/src/foo/metrics/metrics.go", 5),
+					},
+				},
+			},
+			ID: 3,
+		},
+	}
+	data := []struct {
+		f    Filter
+		want []int
+	}{
+		{Filter{}, []int{1, 2, 3}},
+		{Filter{Exclude: regexp.MustCompile(`^net/http\.`)}, []int{2, 3}},
+		// Matches the source path.
+		{Filter{Exclude: regexp.MustCompile(`/metrics/`)}, []int{1, 2}},
+		// Matches any frame.
+		{Filter{Include: regexp.MustCompile(`^main\.main$`)}, []int{2}},
+		{Filter{Include: regexp.MustCompile(`foo`), Exclude: regexp.MustCompile(`metrics`)}, []int{2}},
+		{Filter{Include: regexp.MustCompile(`notpresent`)}, []int{}},
+	}
+	for i, line := range data {
+		got := []int{}
+		for _, g := range line.f.Apply(goroutines) {
+			got = append(got, g.ID)
+		}
+		if diff := cmp.Diff(line.want, got); diff != "" {
+			t.Fatalf("%d: IDs mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package httpmid provides a net/http middleware that recovers the panics of
+// the handlers and reports them as parsed stack dumps.
+//
+// It replaces the usual recovery code calling debug.PrintStack(), which
+// loses the other goroutines and produces a stack dump that is hard to
+// process.
+package httpmid
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+	"github.com/maruel/panicparse/stack/webstack"
+)
+
+// Report is a panic recovered while serving a request.
+type Report struct {
+	// Request is the request being served.
+	Request *http.Request
+	// Snapshot is the goroutines when the panic was recovered, the panicking
+	// one first. Snapshot.Context is nil if Err is set.
+	*stack.Snapshot
+	// Err is the error parsing the stack dump, if any.
+	Err error
+	// ID is the ID of the stack dump in Opts.Store, 0 if it wasn't stored.
+	ID int
+	// StoreErr is the error storing the stack dump in Opts.Store, if any.
+	StoreErr error
+}
+
+// Opts are the options of Handler.
+type Opts struct {
+	// OnPanic is called with each panic recovered, e.g. to log it.
+	OnPanic func(r *Report)
+	// Store, if set, stores the stack dump of each panic recovered. Use the
+	// same store with webstack.CollectorHandlerWithStore to browse them.
+	Store webstack.SnapshotStore
+	// Max is the maximum number of stack dumps kept in Store, the oldest ones
+	// are dropped first; 0 means no limit.
+	Max int
+}
+
+// Handler returns a http.Handler that serves the requests with h and
+// recovers its panics.
+//
+// On panic, all the goroutines are captured and parsed, reported to
+// opts.OnPanic and stored in opts.Store, then the request fails with 500
+// Internal Server Error.
+//
+// http.ErrAbortHandler is not recovered, so the request is aborted as
+// intended.
+func Handler(h http.Handler, opts *Opts) http.Handler {
+	if opts == nil {
+		opts = &Opts{}
+	}
+	return &handler{h: h, opts: *opts, now: time.Now}
+}
+
+// Private stuff.
+
+type handler struct {
+	h    http.Handler
+	opts Opts
+	now  func() time.Time
+}
+
+func (m *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		if v == http.ErrAbortHandler {
+			panic(v)
+		}
+		s, err := stack.Capture(v, true)
+		r := &Report{Request: req, Snapshot: s, Err: err}
+		if m.opts.Store != nil {
+			r.ID, r.StoreErr = m.store(r)
+		}
+		if m.opts.OnPanic != nil {
+			m.opts.OnPanic(r)
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}()
+	m.h.ServeHTTP(w, req)
+}
+
+// store stores the stack dump of the panic r and returns its ID.
+func (m *handler) store(r *Report) (int, error) {
+	msg := "panic: " + fmt.Sprint(r.Value)
+	src := r.Request.Method + " " + r.Request.URL.Path
+	var info *webstack.SnapshotInfo
+	if r.Context != nil {
+		info = webstack.NewSnapshotInfo(r.Context, src, m.now())
+	} else {
+		info = &webstack.SnapshotInfo{Received: m.now(), Source: src, Panic: msg}
+	}
+	// Prepend the panic as printed by the runtime, so it is found when the
+	// stack dump is parsed back.
+	raw := append([]byte(msg+"\n\n"), r.Raw...)
+	if err := m.opts.Store.Put(info, raw); err != nil {
+		return 0, err
+	}
+	if m.opts.Max > 0 {
+		// The dump is stored, don't fail.
+		_ = m.opts.Store.Prune(m.opts.Max)
+	}
+	return info.ID, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package httpmid
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack/webstack"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	var got *Report
+	store := webstack.NewMemoryStore()
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	}), &Opts{OnPanic: func(r *Report) { got = r }, Store: store, Max: 1})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if got == nil {
+		t.Fatal("OnPanic wasn't called")
+	}
+	if got.Value != "boom" || got.Request.URL.Path != "/foo" || len(got.Raw) == 0 {
+		t.Fatalf("unexpected %#v", got)
+	}
+	if got.Err != nil {
+		t.Fatal(got.Err)
+	}
+	if len(got.Panics) != 1 || got.Panics[0].Message != "boom" {
+		t.Fatalf("unexpected %#v", got.Panics)
+	}
+	if len(got.Goroutines) == 0 || len(got.Goroutines[0].Stack.Calls) == 0 {
+		t.Fatalf("unexpected %#v", got.Goroutines)
+	}
+	if f := got.Goroutines[0].Stack.Calls[0].Func.Raw; !strings.HasSuffix(f, "httpmid.TestHandler.func1") {
+		t.Fatalf("unexpected %q", f)
+	}
+	if got.ID != 1 || got.StoreErr != nil {
+		t.Fatalf("unexpected %d, %v", got.ID, got.StoreErr)
+	}
+	dumps, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dumps) != 1 || dumps[0].Source != "GET /foo" || dumps[0].Panic != "panic: boom" {
+		t.Fatalf("unexpected %#v", dumps)
+	}
+	raw, err := store.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, []byte("panic: boom\n\ngoroutine ")) {
+		t.Fatalf("unexpected %q", raw)
+	}
+}
+
+func TestHandler_NoPanic(t *testing.T) {
+	t.Parallel()
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}), &Opts{OnPanic: func(r *Report) { t.Error("unexpected panic") }})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("unexpected %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestHandler_Abort(t *testing.T) {
+	t.Parallel()
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic(http.ErrAbortHandler)
+	}), &Opts{OnPanic: func(r *Report) { t.Error("unexpected report") }})
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Fatalf("unexpected %v", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// This file contains readers for stack traces stored by crash trackers.
+
+package stack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// ParseSentry processes a Sentry event encoded as JSON.
+//
+// Each exception and each thread with a stack trace in the event is converted
+// to a Goroutine, exceptions first. Sentry doesn't store the arguments so the
+// calls have none. The goroutine ID is the thread ID when it is a number,
+// otherwise the goroutines are numbered sequentially starting at 1.
+//
+// Returns nil *Context if no stack trace was found.
+//
+// guesspaths has the same meaning as with ParseDump.
+func ParseSentry(r io.Reader, guesspaths bool) (*Context, error) {
+	var e sentryEvent
+	if err := json.NewDecoder(r).Decode(&e); err != nil {
+		return nil, fmt.Errorf("failed to decode sentry event: %v", err)
+	}
+	var goroutines []*Goroutine
+	add := func(id interface{}, st *sentryStacktrace) {
+		if st == nil || len(st.Frames) == 0 {
+			return
+		}
+		g := &Goroutine{
+			Signature: Signature{State: "running"},
+			ID:        len(goroutines) + 1,
+			First:     len(goroutines) == 0,
+		}
+		if i, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(id))); err == nil {
+			g.ID = i
+		}
+		// Sentry lists the frames from the outermost to the innermost call.
+		for i := len(st.Frames) - 1; i >= 0; i-- {
+			g.Stack.Calls = append(g.Stack.Calls, st.Frames[i].call())
+		}
+		goroutines = append(goroutines, g)
+	}
+	for i := range e.Exception.Values {
+		add(e.Exception.Values[i].ThreadID, e.Exception.Values[i].Stacktrace)
+	}
+	for i := range e.Threads.Values {
+		add(e.Threads.Values[i].ID, e.Threads.Values[i].Stacktrace)
+	}
+	if len(goroutines) == 0 {
+		return nil, nil
+	}
+	return newContext(goroutines, guesspaths), nil
+}
+
+// ParseErrorReporting processes Google Cloud Error Reporting events encoded as
+// JSON.
+//
+// It accepts a single event, a list of events or the response of the
+// projects.events.list API. The message of each event is parsed like
+// ParseDump does, and anything that is not a stack trace is piped into out.
+//
+// Returns nil *Context if no stack trace was found.
+func ParseErrorReporting(r io.Reader, out io.Writer, guesspaths bool) (*Context, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []errorReportingEvent
+	if b = bytes.TrimSpace(b); len(b) != 0 && b[0] == '[' {
+		err = json.Unmarshal(b, &events)
+	} else {
+		var l struct {
+			errorReportingEvent
+			ErrorEvents []errorReportingEvent `json:"errorEvents"`
+		}
+		if err = json.Unmarshal(b, &l); err == nil {
+			events = l.ErrorEvents
+			if l.Message != "" {
+				events = append([]errorReportingEvent{l.errorReportingEvent}, events...)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode error reporting events: %v", err)
+	}
+	if len(events) == 0 {
+		return nil, errors.New("no error reporting event found")
+	}
+	var goroutines []*Goroutine
+	for _, e := range events {
+		c, err := parseDump(strings.NewReader(e.Message), out, &Opts{})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range c.Goroutines {
+			r.First = len(goroutines) == 0
+			goroutines = append(goroutines, r)
+		}
+	}
+	if len(goroutines) == 0 {
+		return nil, nil
+	}
+	return newContext(goroutines, guesspaths), nil
+}
+
+// Private stuff.
+
+// sentryEvent is the subset of a Sentry event that is used.
+//
+// See https://develop.sentry.dev/sdk/event-payloads/
+type sentryEvent struct {
+	Exception struct {
+		Values []struct {
+			ThreadID   interface{}       `json:"thread_id"`
+			Stacktrace *sentryStacktrace `json:"stacktrace"`
+		} `json:"values"`
+	} `json:"exception"`
+	Threads struct {
+		Values []struct {
+			ID         interface{}       `json:"id"`
+			Stacktrace *sentryStacktrace `json:"stacktrace"`
+		} `json:"values"`
+	} `json:"threads"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+}
+
+// call converts the frame to a Call.
+func (f *sentryFrame) call() Call {
+	c := Call{SrcPath: f.AbsPath, Line: f.Lineno, Func: Func{Raw: f.Function}}
+	if c.SrcPath == "" {
+		c.SrcPath = f.Filename
+	}
+	// The Go SDK splits the package path out of the function name.
+	if f.Module != "" && !strings.HasPrefix(f.Function, f.Module+".") {
+		c.Func.Raw = f.Module + "." + f.Function
+	}
+	return c
+}
+
+// errorReportingEvent is the subset of an Error Reporting event that is used.
+//
+// See https://cloud.google.com/error-reporting/reference/rest/v1beta1/ErrorEvent
+type errorReportingEvent struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseSentry(t *testing.T) {
+	t.Parallel()
+	data := `{
+  "event_id": "fc6d8c0c43fc4630ad850ee518f1b9d0",
+  "exception": {
+    "values": [
+      {
+        "type": "*errors.errorString",
+        "value": "boom",
+        "thread_id": 7,
+        "stacktrace": {
+          "frames": [
+            {"function": "main", "module": "main", "abs_path": "/gopath/src/foo/main.go", "lineno": 20},
+            {"function": "(*T).Run", "module": "foo/bar", "abs_path": "/gopath/src/foo/bar/bar.go", "lineno": 12}
+          ]
+        }
+      }
+    ]
+  },
+  "threads": {
+    "values": [
+      {"id": "worker", "stacktrace": {"frames": [{"function": "main.work", "filename": "main.go", "lineno": 5}]}},
+      {"id": 3}
+    ]
+  }
+}`
+	c, err := ParseSentry(bytes.NewBufferString(data), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Goroutine{
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						{SrcPath: "/gopath/src/foo/bar/bar.go", Line: 12, Func: Func{Raw: "foo/bar.(*T).Run"}},
+						{SrcPath: "/gopath/src/foo/main.go", Line: 20, Func: Func{Raw: "main.main"}},
+					},
+				},
+			},
+			ID:    7,
+			First: true,
+		},
+		{
+			Signature: Signature{
+				State: "running",
+				Stack: Stack{
+					Calls: []Call{
+						{SrcPath: "main.go", Line: 5, Func: Func{Raw: "main.work"}},
+					},
+				},
+			},
+			ID: 2,
+		},
+	}
+	compareGoroutines(t, want, c.Goroutines)
+}
+
+func TestParseSentryEmpty(t *testing.T) {
+	t.Parallel()
+	c, err := ParseSentry(bytes.NewBufferString(`{"message": "hi"}`), false)
+	if c != nil || err != nil {
+		t.Fatal(c, err)
+	}
+	if _, err := ParseSentry(bytes.NewBufferString(`{`), false); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseErrorReporting(t *testing.T) {
+	t.Parallel()
+	msg := strings.Join([]string{
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/foo/main.go:20 +0x49",
+		"",
+	}, "\n")
+	event := `{"eventTime": "2020-01-01T00:00:00Z", "message": ` + strconv.Quote(msg) + `}`
+	data := []string{
+		event,
+		`[` + event + `,` + event + `]`,
+		`{"errorEvents": [` + event + `,` + event + `]}`,
+	}
+	for i, d := range data {
+		extra := &bytes.Buffer{}
+		c, err := ParseErrorReporting(bytes.NewBufferString(d), extra, false)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		want := 1
+		if i != 0 {
+			want = 2
+		}
+		if len(c.Goroutines) != want {
+			t.Fatalf("%d: got %d goroutines", i, len(c.Goroutines))
+		}
+		for j, g := range c.Goroutines {
+			if g.First != (j == 0) {
+				t.Fatalf("%d: goroutine %d: First %t", i, j, g.First)
+			}
+			compareString(t, "main.main", g.Stack.Calls[0].Func.Raw)
+		}
+		compareString(t, strings.Repeat("panic: boom\n\n", want), extra.String())
+	}
+}
+
+func TestParseErrorReportingErr(t *testing.T) {
+	t.Parallel()
+	for _, d := range []string{"", "{", `{"errorEvents": []}`} {
+		if _, err := ParseErrorReporting(bytes.NewBufferString(d), ioutil.Discard, false); err == nil {
+			t.Fatalf("%q: expected error", d)
+		}
+	}
+}
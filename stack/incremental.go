@@ -0,0 +1,280 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// IncrementalParser parses a stack dump as it is written, e.g. a log file
+// being appended to. Only the new data is parsed each time, instead of
+// parsing the whole input again.
+//
+// It keeps the state of the parsing between the calls to Write: the
+// goroutine being parsed and the line not terminated yet.
+//
+// Contrary to ParseDump, the lines wrapped by a log shipper are not joined.
+// The paths are not guessed and Opts.Resolvers are not called, since the
+// goroutines are not complete yet; use Opts.Resync to not stop on a stack
+// trace that is cut short.
+type IncrementalParser struct {
+	p    lineParser
+	c    Context
+	opts Opts
+	// strs is the lines already seen, see intern().
+	strs map[string]string
+	// partial is the start of the line not terminated yet.
+	partial []byte
+	// offset is the offset right after the last line parsed.
+	offset int64
+	// names is the state to name the arguments of the calls parsed since the
+	// last call to Context().
+	names  argNamer
+	lineNo int
+	err    error
+}
+
+// NewIncrementalParser returns an IncrementalParser. Anything not detected
+// as a stack trace is written to out. opts can be nil.
+func NewIncrementalParser(out io.Writer, opts *Opts) *IncrementalParser {
+	i := &IncrementalParser{strs: map[string]string{}}
+	if opts != nil {
+		i.opts = *opts
+	}
+	i.p = lineParser{c: &i.c, out: out, opts: &i.opts}
+	return i
+}
+
+// Write parses the lines terminated in b. The last line of b, if not
+// terminated, is kept until the rest of it is written.
+//
+// Once an error is returned, the following calls return it too.
+func (i *IncrementalParser) Write(b []byte) (int, error) {
+	if i.err != nil {
+		return 0, i.err
+	}
+	n := len(b)
+	for len(b) != 0 {
+		e := bytes.IndexByte(b, '\n')
+		if e == -1 {
+			i.partial = append(i.partial, b...)
+			if i.opts.MaxLineLength != 0 && len(i.partial) > i.opts.MaxLineLength {
+				i.err = &LimitError{Limit: "MaxLineLength", Value: i.opts.MaxLineLength}
+			}
+			break
+		}
+		var line string
+		if len(i.partial) != 0 {
+			i.partial = append(i.partial, b[:e+1]...)
+			line = intern(i.strs, i.partial)
+			i.partial = i.partial[:0]
+		} else {
+			line = intern(i.strs, b[:e+1])
+		}
+		b = b[e+1:]
+		if i.err = i.parseLine(line); i.err != nil {
+			break
+		}
+	}
+	i.c.Goroutines = i.p.s.goroutines
+	return n, i.err
+}
+
+// Offset returns the offset in the input right after the last line parsed.
+// The data written after it is an incomplete line.
+func (i *IncrementalParser) Offset() int64 {
+	return i.offset
+}
+
+// Context returns the goroutines and the panics parsed so far. The last
+// goroutine may be incomplete.
+//
+// The pointer arguments are named as with ParseDump, except that they are
+// numbered in the order they are found: only the calls parsed since the last
+// call are named, and the names already set are kept. The Context is updated
+// by the following calls to Write.
+func (i *IncrementalParser) Context() *Context {
+	i.names.nameNew(i.c.Goroutines)
+	return &i.c
+}
+
+// Keep drops the oldest goroutines to keep at most n of them, to bound the
+// memory used when following a log for a long time. n must be positive.
+//
+// It returns the number of goroutines dropped.
+func (i *IncrementalParser) Keep(n int) int {
+	g := i.p.s.goroutines
+	if n < 1 || len(g) <= n {
+		return 0
+	}
+	// Copy so the dropped goroutines can be reclaimed.
+	i.p.s.goroutines = append([]*Goroutine(nil), g[len(g)-n:]...)
+	i.c.Goroutines = i.p.s.goroutines
+	i.names.drop(i.c.Goroutines, len(g)-n)
+	return len(g) - n
+}
+
+// parseLine parses a line of the input. With Opts.JSONLogs, a stack dump
+// embedded in a JSON log line is expanded to its lines, which all have the
+// position of the JSON log line.
+func (i *IncrementalParser) parseLine(line string) error {
+	i.lineNo++
+	off := i.offset
+	i.offset += int64(len(line))
+	var lines []string
+	if i.opts.JSONLogs {
+		lines = jsonDump(line)
+	}
+	if len(lines) == 0 {
+		return i.p.parseLine(line, i.lineNo, i.lineNo, off, i.offset)
+	}
+	_, _ = io.WriteString(i.p.out, line)
+	// The lines extracted were written with the JSON log line.
+	i.p.quiet = true
+	defer func() { i.p.quiet = false }()
+	for _, l := range lines {
+		if err := i.p.parseLine(l, i.lineNo, i.lineNo, off, i.offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// argNamer names the pointer arguments of the goroutines incrementally, as
+// they are parsed.
+//
+// Like nameArguments(), a pointer is named when it occurs more than once
+// including in the primary goroutine, i.e. the first one, and always
+// otherwise.
+type argNamer struct {
+	// names is the name of each pointer already named.
+	names map[uint64]string
+	// unnamed is the pointers found only once so far, in the primary
+	// goroutine.
+	unnamed map[uint64]bool
+	primary *Goroutine
+	// started is set once the primary goroutine was found.
+	started bool
+	nextID  int
+	// done is the number of goroutines that are completely named. The calls
+	// of the goroutine last are named up to lastCalls, since the last
+	// goroutine may be incomplete.
+	done      int
+	last      *Goroutine
+	lastCalls int
+}
+
+// nameNew names the arguments of the calls not named yet.
+func (n *argNamer) nameNew(goroutines []*Goroutine) {
+	if n.names == nil {
+		n.names = map[uint64]string{}
+		n.unnamed = map[uint64]bool{}
+		n.nextID = 1
+	}
+	if n.done > len(goroutines) {
+		// The last goroutine was dropped, see scanningState.abort().
+		n.done = len(goroutines)
+	}
+	for _, g := range goroutines[n.done:] {
+		if !n.started {
+			n.primary = g
+			n.started = true
+		}
+		j := 0
+		if g == n.last {
+			j = n.lastCalls
+		}
+		for ; j < len(g.Stack.Calls); j++ {
+			n.nameArgs(&g.Stack.Calls[j].Args, g == n.primary)
+		}
+		n.last = g
+		n.lastCalls = j
+	}
+	if len(goroutines) != 0 {
+		n.done = len(goroutines) - 1
+	}
+}
+
+// nameArgs names the pointers in args, including the ones in the aggregates.
+func (n *argNamer) nameArgs(args *Args, primary bool) {
+	for i := range args.Values {
+		a := &args.Values[i]
+		if a.IsAggregate {
+			n.nameArgs(&a.Fields, primary)
+			continue
+		}
+		if !a.IsPtr() {
+			continue
+		}
+		if name, ok := n.names[a.Value]; ok {
+			a.Name = name
+			continue
+		}
+		if primary && !n.unnamed[a.Value] {
+			n.unnamed[a.Value] = true
+			continue
+		}
+		a.Name = "#" + strconv.Itoa(n.nextID)
+		n.nextID++
+		n.names[a.Value] = a.Name
+		if n.unnamed[a.Value] {
+			// Name the previous occurrence in the primary goroutine.
+			delete(n.unnamed, a.Value)
+			if n.primary != nil {
+				for j := range n.primary.Stack.Calls {
+					setArgName(&n.primary.Stack.Calls[j].Args, a.Value, a.Name)
+				}
+			}
+		}
+	}
+}
+
+// drop forgets the goroutines dropped from the start of goroutines, so the
+// names of their pointers can be reclaimed.
+func (n *argNamer) drop(goroutines []*Goroutine, dropped int) {
+	if n.done -= dropped; n.done < 0 {
+		n.done = 0
+	}
+	if n.names == nil {
+		return
+	}
+	primary := false
+	names := map[uint64]string{}
+	for _, g := range goroutines {
+		primary = primary || g == n.primary
+		for j := range g.Stack.Calls {
+			keepArgNames(names, &g.Stack.Calls[j].Args)
+		}
+	}
+	n.names = names
+	if !primary {
+		n.primary = nil
+		n.unnamed = map[uint64]bool{}
+	}
+}
+
+// setArgName names the pointers in args with the value v.
+func setArgName(args *Args, v uint64, name string) {
+	for i := range args.Values {
+		if a := &args.Values[i]; a.IsAggregate {
+			setArgName(&a.Fields, v, name)
+		} else if a.Value == v && a.IsPtr() {
+			a.Name = name
+		}
+	}
+}
+
+// keepArgNames adds the names of the pointers in args to names.
+func keepArgNames(names map[uint64]string, args *Args) {
+	for i := range args.Values {
+		if a := &args.Values[i]; a.IsAggregate {
+			keepArgNames(names, &a.Fields)
+		} else if a.Name != "" {
+			names[a.Value] = a.Name
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIncrementalParser(t *testing.T) {
+	t.Parallel()
+	data := strings.Join([]string{
+		"junk",
+		"panic: reflect.Set: value of type",
+		"",
+		"goroutine 1 [running]:",
+		"gopkg.in/yaml%2ev2.handleErr(0x433b20)",
+		"	/gopath/src/gopkg.in/yaml.v2/yaml.go:153 +0xc6",
+		"main.main()",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:428 +0x27",
+		"",
+		"goroutine 6 [chan receive, 3 minutes]:",
+		"main.worker(0xc208012000)",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:20 +0x27",
+		"created by main.main",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:8 +0x27",
+		"",
+	}, "\n")
+	wantOut := &bytes.Buffer{}
+	want, err := ParseDump(strings.NewReader(data), wantOut, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{1, 7, 64, len(data)} {
+		out := &bytes.Buffer{}
+		i := NewIncrementalParser(out, nil)
+		for b := []byte(data); len(b) != 0; {
+			n := size
+			if n > len(b) {
+				n = len(b)
+			}
+			if _, err := i.Write(b[:n]); err != nil {
+				t.Fatal(err)
+			}
+			b = b[n:]
+		}
+		c := i.Context()
+		if diff := cmp.Diff(want.Goroutines, c.Goroutines); diff != "" {
+			t.Fatalf("%d: Goroutines mismatch (-want +got):\n%s", size, diff)
+		}
+		if diff := cmp.Diff(want.Panics, c.Panics); diff != "" {
+			t.Fatalf("%d: Panics mismatch (-want +got):\n%s", size, diff)
+		}
+		compareString(t, wantOut.String(), out.String())
+		if o := i.Offset(); o != int64(len(data)) {
+			t.Fatalf("%d: want offset %d, got %d", size, len(data), o)
+		}
+	}
+}
+
+func TestIncrementalParser_partial(t *testing.T) {
+	t.Parallel()
+	i := NewIncrementalParser(ioutil.Discard, &Opts{Resync: true})
+	if _, err := i.Write([]byte("goroutine 1 [running]:\nmain.ma")); err != nil {
+		t.Fatal(err)
+	}
+	if o := i.Offset(); o != int64(len("goroutine 1 [running]:\n")) {
+		t.Fatalf("unexpected offset %d", o)
+	}
+	if g := i.Context().Goroutines; len(g) != 1 || len(g[0].Stack.Calls) != 0 {
+		t.Fatalf("unexpected goroutines: %v", g)
+	}
+	if _, err := i.Write([]byte("in()\n\t/gopath/src/foo/main.go:12 +0x27\n\n")); err != nil {
+		t.Fatal(err)
+	}
+	g := i.Context().Goroutines
+	if len(g) != 1 || len(g[0].Stack.Calls) != 1 || g[0].Stack.Calls[0].Func.Raw != "main.main" {
+		t.Fatalf("unexpected goroutines: %v", g)
+	}
+
+	// A stack trace cut short doesn't stop the parsing with Resync.
+	if _, err := i.Write([]byte("goroutine 2 [running]:\nmain.main(\ngoroutine 3 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:13 +0x27\n")); err != nil {
+		t.Fatal(err)
+	}
+	c := i.Context()
+	if len(c.Goroutines) != 3 || !c.Goroutines[1].Partial || len(c.Warnings) != 1 {
+		t.Fatalf("unexpected goroutines: %v; %v", c.Goroutines, c.Warnings)
+	}
+
+	if n := i.Keep(1); n != 2 {
+		t.Fatalf("unexpected %d goroutines dropped", n)
+	}
+	if g := i.Context().Goroutines; len(g) != 1 || g[0].ID != 3 {
+		t.Fatalf("unexpected goroutines: %v", g)
+	}
+}
+
+func TestIncrementalParser_names(t *testing.T) {
+	t.Parallel()
+	i := NewIncrementalParser(ioutil.Discard, nil)
+	write := func(s string) {
+		if _, err := i.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func() []string {
+		var out []string
+		for _, g := range i.Context().Goroutines {
+			for _, c := range g.Stack.Calls {
+				out = append(out, c.Args.String())
+			}
+		}
+		return out
+	}
+	write("goroutine 1 [running]:\nmain.main(0xc000010000)\n\t/gopath/src/foo/main.go:12 +0x27\n\n")
+	write("goroutine 2 [running]:\nmain.a({0xc000020000, 0x1})\n\t/gopath/src/foo/main.go:13 +0x27\n")
+	if diff := cmp.Diff([]string{"0xc000010000", "{#1, 1}"}, names()); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+	// Only the calls parsed since the last call are named.
+	i.Context().Goroutines[1].Stack.Calls[0].Args.Values[0].Fields.Values[0].Name = "#x"
+	write("main.b(0xc000010000)\n\t/gopath/src/foo/main.go:14 +0x27\n\n")
+	write("goroutine 3 [running]:\nmain.c(0xc000020000)\n\t/gopath/src/foo/main.go:15 +0x27\n\n")
+	if diff := cmp.Diff([]string{"#2", "{#x, 1}", "#2", "#1"}, names()); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// The names are kept when goroutines are dropped.
+	if n := i.Keep(1); n != 2 {
+		t.Fatalf("unexpected %d goroutines dropped", n)
+	}
+	write("goroutine 4 [running]:\nmain.d(0xc000020000, 0xc000030000)\n\t/gopath/src/foo/main.go:16 +0x27\n\n")
+	if diff := cmp.Diff([]string{"#1", "#1, #3"}, names()); diff != "" {
+		t.Fatalf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestIncrementalParser_err(t *testing.T) {
+	t.Parallel()
+	i := NewIncrementalParser(ioutil.Discard, &Opts{MaxLineLength: 8})
+	want := &LimitError{Limit: "MaxLineLength", Value: 8}
+	if _, err := i.Write([]byte("a\nbcdefghij")); !cmp.Equal(want, err) {
+		t.Fatalf("want %v, got %v", want, err)
+	}
+	if _, err := i.Write([]byte("\n")); !cmp.Equal(want, err) {
+		t.Fatalf("want %v, got %v", want, err)
+	}
+
+	i = NewIncrementalParser(ioutil.Discard, nil)
+	if _, err := i.Write([]byte("goroutine 1 [running]:\njunk\n")); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// jsonDump returns the lines of the stack dumps embedded in the string fields
+// of line, if it is a JSON log line as written by structured loggers like zap
+// or logrus. Returns nil otherwise.
+//
+// Each stack dump is followed by an empty line, so the last goroutine ends
+// with the log line.
+func jsonDump(line string) []string {
+	t := strings.TrimSpace(line)
+	// Fast path: the header and the escaped new lines must be there.
+	if !strings.HasPrefix(t, "{") || !strings.HasSuffix(t, "}") || !strings.Contains(t, "goroutine ") || !strings.Contains(t, `\n`) {
+		return nil
+	}
+	var v interface{}
+	if json.Unmarshal([]byte(t), &v) != nil {
+		return nil
+	}
+	var out []string
+	for _, d := range findDumps(v, nil) {
+		for _, l := range strings.SplitAfter(d, "\n") {
+			if l != "" {
+				if !strings.HasSuffix(l, "\n") {
+					l += "\n"
+				}
+				out = append(out, l)
+			}
+		}
+		out = append(out, "\n")
+	}
+	return out
+}
+
+// findDumps appends the strings in v that contain a goroutine header, in a
+// stable order.
+func findDumps(v interface{}, out []string) []string {
+	switch t := v.(type) {
+	case string:
+		if isDump(t) {
+			out = append(out, t)
+		}
+	case []interface{}:
+		for _, i := range t {
+			out = findDumps(i, out)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			out = findDumps(t[k], out)
+		}
+	}
+	return out
+}
+
+// isDump returns true if s has a line that is a goroutine header.
+func isDump(s string) bool {
+	if !strings.Contains(s, "goroutine ") {
+		return false
+	}
+	for _, l := range strings.Split(s, "\n") {
+		if isRoutineHeader(strings.TrimRight(l, "\r")) {
+			return true
+		}
+	}
+	return false
+}
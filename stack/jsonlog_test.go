@@ -0,0 +1,91 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseDumpJSONLog(t *testing.T) {
+	t.Parallel()
+	dump := "panic: oh no\n\n" +
+		"goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n"
+	b, err := json.Marshal(map[string]interface{}{
+		"level": "fatal",
+		"msg":   "crashed",
+		"fields": map[string]interface{}{
+			"stack": dump,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := `{"level":"info","msg":"starting","count":1}` + "\n"
+	in := first + string(b) + "\n" + "exit status 2\n"
+	extra := &bytes.Buffer{}
+	c, err := ParseDumpWithOpts(strings.NewReader(in), extra, &Opts{JSONLogs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || len(c.Goroutines) != 1 {
+		t.Fatalf("unexpected %v", c)
+	}
+	g := c.Goroutines[0]
+	if g.ID != 1 || g.Stack.Calls[0].Line != 10 {
+		t.Fatalf("unexpected %#v", g)
+	}
+	if len(c.Panics) != 1 || c.Panics[0].Message != "oh no" {
+		t.Fatalf("unexpected %#v", c.Panics)
+	}
+	// The position is the JSON log line.
+	if g.StartLine != 2 || g.EndLine != 2 || in[g.Start:g.End] != string(b)+"\n" {
+		t.Fatalf("unexpected %d-%d [%d:%d]", g.StartLine, g.EndLine, g.Start, g.End)
+	}
+	// The JSON log line is written as is.
+	if extra.String() != in {
+		t.Fatalf("want %q, got %q", in, extra.String())
+	}
+
+	// It is disabled by default.
+	extra.Reset()
+	if c, err = ParseDump(strings.NewReader(in), extra, false); c != nil || err != nil {
+		t.Fatalf("unexpected %v, %v", c, err)
+	}
+	if extra.String() != in {
+		t.Fatalf("want %q, got %q", in, extra.String())
+	}
+
+	extra.Reset()
+	i := NewIncrementalParser(extra, &Opts{JSONLogs: true})
+	if _, err := i.Write([]byte(in)); err != nil {
+		t.Fatal(err)
+	}
+	if g := i.Context().Goroutines; len(g) != 1 || g[0].ID != 1 {
+		t.Fatalf("unexpected %v", g)
+	}
+	if extra.String() != in {
+		t.Fatalf("want %q, got %q", in, extra.String())
+	}
+}
+
+func TestJSONDump(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [running]:",
+		`{"msg": "goroutine 1 [running]:"}`,
+		`{"msg": "not a goroutine 1\nheader"}`,
+		`{"msg": "goroutine 1 [running]:\nmain.main()\n"`,
+	}
+	for i, line := range data {
+		if l := jsonDump(line); l != nil {
+			t.Fatalf("#%d: unexpected %q", i, l)
+		}
+	}
+}
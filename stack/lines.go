@@ -0,0 +1,109 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	// lineBufSize is the size of the buffer of the lineReader. Longer lines
+	// are read in chunks of this size and joined back.
+	lineBufSize = bufio.MaxScanTokenSize
+	// maxKeptLine is the size of the largest buffer used to join a long line
+	// that is kept by reset(), so a single huge line doesn't stay in memory.
+	maxKeptLine = 16 * lineBufSize
+)
+
+// lineReader reads the lines of a stack dump, like a bufio.Scanner with
+// bufio.ScanLines except that it:
+//   - doesn't drop '\n'
+//   - doesn't strip '\r'
+//   - returns the lines whole, whatever their length
+//
+// A bufio.Scanner fails with bufio.ErrTooLong on a line longer than its
+// buffer, see https://github.com/maruel/panicparse/issues/17. Instead, the
+// line is read in chunks and joined back. max caps the memory used this way;
+// a longer line stops the reading with a LimitError.
+type lineReader struct {
+	rd  *bufio.Reader
+	max int
+	// line is the current line. It is only valid until the next call to Scan.
+	line []byte
+	// long is the buffer to join the chunks of a line longer than rd's
+	// buffer.
+	long []byte
+	err  error
+}
+
+// newLineReader returns a lineReader reading from r. max is the maximum
+// length of a line in bytes, including the line terminator. 0 means no limit.
+func newLineReader(r io.Reader, max int) *lineReader {
+	return &lineReader{rd: bufio.NewReaderSize(r, lineBufSize), max: max}
+}
+
+// reset makes l read from r, reusing its buffers.
+func (l *lineReader) reset(r io.Reader, max int) {
+	l.rd.Reset(r)
+	l.max = max
+	l.line = nil
+	if cap(l.long) > maxKeptLine {
+		l.long = nil
+	}
+	l.err = nil
+}
+
+// Scan advances to the next line, like bufio.Scanner.Scan(). It returns false
+// at the end of the input or on error.
+func (l *lineReader) Scan() bool {
+	if l.err != nil {
+		return false
+	}
+	l.long = l.long[:0]
+	for {
+		b, err := l.rd.ReadSlice('\n')
+		if l.max != 0 && len(l.long)+len(b) > l.max {
+			l.line = nil
+			l.err = &LimitError{Limit: "MaxLineLength", Value: l.max}
+			return false
+		}
+		if err == bufio.ErrBufferFull {
+			// b is overwritten by the next read.
+			l.long = append(l.long, b...)
+			continue
+		}
+		l.line = b
+		if len(l.long) != 0 {
+			l.long = append(l.long, b...)
+			l.line = l.long
+		}
+		if err != nil {
+			// The last line may not have a line terminator.
+			l.err = err
+			return len(l.line) != 0
+		}
+		return true
+	}
+}
+
+// Bytes returns the current line, like bufio.Scanner.Bytes().
+func (l *lineReader) Bytes() []byte {
+	return l.line
+}
+
+// Text returns the current line, like bufio.Scanner.Text().
+func (l *lineReader) Text() string {
+	return string(l.line)
+}
+
+// Err returns the first error that was encountered, like
+// bufio.Scanner.Err().
+func (l *lineReader) Err() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
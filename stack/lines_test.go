@@ -0,0 +1,118 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLineReader(t *testing.T) {
+	t.Parallel()
+	long := strings.Repeat("a", 3*lineBufSize+7)
+	data := []struct {
+		name string
+		in   string
+		max  int
+		want []string
+		err  error
+	}{
+		{"empty", "", 0, nil, nil},
+		{"lines", "a\nb\r\n\nc", 0, []string{"a\n", "b\r\n", "\n", "c"}, nil},
+		{"long", "a\n" + long + "\nb\n", 0, []string{"a\n", long + "\n", "b\n"}, nil},
+		{"longLast", long, 0, []string{long}, nil},
+		{"max", "ab\nabc\nabcd\n", 4, []string{"ab\n", "abc\n"}, &LimitError{Limit: "MaxLineLength", Value: 4}},
+		{"maxLong", "a\n" + long + "\n", lineBufSize, []string{"a\n"}, &LimitError{Limit: "MaxLineLength", Value: lineBufSize}},
+	}
+	for _, line := range data {
+		line := line
+		t.Run(line.name, func(t *testing.T) {
+			t.Parallel()
+			l := newLineReader(strings.NewReader(line.in), line.max)
+			var got []string
+			for l.Scan() {
+				got = append(got, l.Text())
+			}
+			if diff := cmp.Diff(line.want, got); diff != "" {
+				t.Fatalf("Scan() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(line.err, l.Err()); diff != "" {
+				t.Fatalf("Err() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLineReader_Err(t *testing.T) {
+	t.Parallel()
+	want := errors.New("boom")
+	l := newLineReader(io.MultiReader(strings.NewReader("a\nb"), &errReader{want}), 0)
+	var got []string
+	for l.Scan() {
+		got = append(got, l.Text())
+	}
+	if diff := cmp.Diff([]string{"a\n", "b"}, got); diff != "" {
+		t.Fatalf("Scan() mismatch (-want +got):\n%s", diff)
+	}
+	if err := l.Err(); err != want {
+		t.Fatalf("want %v, got %v", want, err)
+	}
+}
+
+func TestLineReader_reset(t *testing.T) {
+	t.Parallel()
+	l := newLineReader(strings.NewReader("a\nb\n"), 1)
+	if l.Scan() {
+		t.Fatal("expected the line to be too long")
+	}
+	l.reset(strings.NewReader("c\n"+strings.Repeat("d", 2*lineBufSize)), 0)
+	var got []string
+	for l.Scan() {
+		got = append(got, l.Text())
+	}
+	if diff := cmp.Diff([]string{"c\n", strings.Repeat("d", 2*lineBufSize)}, got); diff != "" {
+		t.Fatalf("Scan() mismatch (-want +got):\n%s", diff)
+	}
+	if err := l.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseDumpLongFunc(t *testing.T) {
+	t.Parallel()
+	// A function line longer than the buffer of the reader is parsed whole.
+	name := "main." + strings.Repeat("a", 2*lineBufSize)
+	data := []string{
+		"goroutine 1 [running]:",
+		name + "()",
+		"	/gopath/src/github.com/maruel/panicparse/cmd/pp/main.go:12 +0x27",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	c, err := ParseDump(strings.NewReader(strings.Join(data, "\n")), extra, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Goroutines) != 1 || len(c.Goroutines[0].Stack.Calls) != 1 {
+		t.Fatalf("unexpected goroutines: %v", c.Goroutines)
+	}
+	if got := c.Goroutines[0].Stack.Calls[0].Func.Raw; got != name {
+		t.Fatalf("unexpected function of %d bytes", len(got))
+	}
+	compareString(t, "", extra.String())
+}
+
+type errReader struct {
+	err error
+}
+
+func (e *errReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
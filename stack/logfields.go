@@ -0,0 +1,69 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "fmt"
+
+// LogFields returns the Snapshot as structured logging fields, as alternating
+// keys and values.
+//
+// They can be passed as is to log/slog, e.g.
+// slog.Error("panic", s.LogFields()...), to the "w" functions of zap's
+// SugaredLogger, e.g. Errorw(), or to go-kit's log.Logger. Use LogFieldsMap
+// for logrus.
+//
+// The fields are:
+//   - "panic": the panic value, if any.
+//   - "fingerprint": the Signature.Fingerprint() of the first goroutine, to
+//     group the reports of the same panic.
+//   - "culprit": the innermost call outside the standard library of the
+//     first goroutine, as "pkg.Func path/file.go:line", see Stack.AppCall().
+//   - "goroutines": the number of goroutines.
+//   - "buckets": the number of goroutines buckets, as aggregated with
+//     AnyPointer.
+//   - "stack": the calls of the first goroutine, as "pkg.Func file.go:line".
+//
+// To log a Context parsed otherwise, e.g. by Writer, wrap it in a Snapshot.
+// If Context is nil, "stack" is the raw stack dump instead.
+func (s *Snapshot) LogFields() []interface{} {
+	var out []interface{}
+	if s.Value != nil {
+		out = append(out, "panic", fmt.Sprint(s.Value))
+	}
+	if s.Context == nil {
+		if len(s.Raw) != 0 {
+			out = append(out, "stack", string(s.Raw))
+		}
+		return out
+	}
+	if len(s.Goroutines) != 0 {
+		g := s.Goroutines[0]
+		out = append(out, "fingerprint", g.Fingerprint())
+		if c := g.Stack.AppCall(); c != nil {
+			out = append(out, "culprit", c.Func.PkgDotName()+" "+c.FullSrcLine())
+		}
+	}
+	out = append(out, "goroutines", len(s.Goroutines), "buckets", len(Aggregate(s.Goroutines, AnyPointer)))
+	if len(s.Goroutines) != 0 {
+		calls := s.Goroutines[0].Stack.Calls
+		lines := make([]string, 0, len(calls))
+		for i := range calls {
+			lines = append(lines, calls[i].Func.PkgDotName()+" "+calls[i].SrcLine())
+		}
+		out = append(out, "stack", lines)
+	}
+	return out
+}
+
+// LogFieldsMap returns the fields of LogFields() as a map, e.g. to be
+// converted to logrus.Fields.
+func (s *Snapshot) LogFieldsMap() map[string]interface{} {
+	f := s.LogFields()
+	out := make(map[string]interface{}, len(f)/2)
+	for i := 0; i < len(f); i += 2 {
+		out[f[i].(string)] = f[i+1]
+	}
+	return out
+}
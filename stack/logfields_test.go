@@ -0,0 +1,62 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSnapshotLogFields(t *testing.T) {
+	t.Parallel()
+	data := "panic: boom\n\n" +
+		"goroutine 1 [running]:\n" +
+		"strings.Repeat(0x0, 0x0)\n" +
+		"\t/goroot/src/strings/strings.go:500 +0x20\n" +
+		"github.com/foo/bar.Do()\n" +
+		"\t/gopath/src/github.com/foo/bar/bar.go:12 +0x20\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n" +
+		"\n" +
+		"goroutine 6 [chan receive]:\n" +
+		"main.worker()\n" +
+		"\t/gopath/src/foo/main.go:20 +0x20\n" +
+		"\n" +
+		"goroutine 7 [chan receive]:\n" +
+		"main.worker()\n" +
+		"\t/gopath/src/foo/main.go:20 +0x20\n"
+	c, err := ParseDump(strings.NewReader(data), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Snapshot{Value: "boom", Context: c}
+	want := []interface{}{
+		"panic", "boom",
+		"fingerprint", c.Goroutines[0].Fingerprint(),
+		"culprit", "bar.Do /gopath/src/github.com/foo/bar/bar.go:12",
+		"goroutines", 3,
+		"buckets", 2,
+		"stack", []string{"strings.Repeat strings.go:500", "bar.Do bar.go:12", "main.main main.go:10"},
+	}
+	if diff := cmp.Diff(want, s.LogFields()); diff != "" {
+		t.Fatalf("LogFields mismatch (-want +got):\n%s", diff)
+	}
+	m := s.LogFieldsMap()
+	if len(m) != 6 || m["goroutines"] != 3 || m["panic"] != "boom" {
+		t.Fatalf("unexpected %v", m)
+	}
+}
+
+func TestSnapshotLogFields_Raw(t *testing.T) {
+	t.Parallel()
+	s := &Snapshot{Value: 42, Raw: []byte("goroutine 1 [running]:\n")}
+	want := []interface{}{"panic", "42", "stack", "goroutine 1 [running]:\n"}
+	if diff := cmp.Diff(want, s.LogFields()); diff != "" {
+		t.Fatalf("LogFields mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// This file contains the hand written matchers of the lines of a stack dump.
+// They are called on every line so they are significantly faster than the
+// equivalent regexps, which are noted in the comment of each function.
+
+package stack
+
+import "strings"
+
+// matchRoutineHeader matches a goroutine header, e.g.
+// "goroutine 1 [running]:".
+//
+// Equivalent to "^([ \t]*)goroutine (\d+) \[([^\]]+)\]:$".
+func matchRoutineHeader(line string) (prefix, id, state string, ok bool) {
+	i := 0
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	prefix = line[:i]
+	rest := line[i:]
+	if !strings.HasPrefix(rest, "goroutine ") {
+		return "", "", "", false
+	}
+	rest = rest[len("goroutine "):]
+	n := digits(rest)
+	if n == 0 || !strings.HasPrefix(rest[n:], " [") || !strings.HasSuffix(rest, "]:") {
+		return "", "", "", false
+	}
+	id = rest[:n]
+	state = rest[n+2 : len(rest)-2]
+	if state == "" || strings.IndexByte(state, ']') != -1 {
+		return "", "", "", false
+	}
+	return prefix, id, state, true
+}
+
+// isRoutineHeader returns true if line is a goroutine header.
+func isRoutineHeader(line string) bool {
+	_, _, _, ok := matchRoutineHeader(line)
+	return ok
+}
+
+// matchDuration matches the wait duration in a goroutine header, e.g.
+// "3 minutes".
+//
+// Equivalent to "^(\d+) <unit>$".
+func matchDuration(s, unit string) (string, bool) {
+	if !strings.HasSuffix(s, " "+unit) {
+		return "", false
+	}
+	s = s[:len(s)-len(unit)-1]
+	return s, isDigits(s)
+}
+
+// isUnavail returns true if line is the stack of a goroutine running on
+// another thread.
+//
+// Equivalent to "^(?:\t| +)goroutine running on other thread; stack
+// unavailable".
+func isUnavail(line string) bool {
+	rest, ok := trimIndent(line)
+	return ok && strings.HasPrefix(rest, "goroutine running on other thread; stack unavailable")
+}
+
+// matchCreated matches the line describing the call that created the
+// goroutine.
+//
+// Starting with Go 1.21, it is suffixed with the ID of the goroutine that
+// created it, e.g. "created by main.main in goroutine 1", which is returned as
+// id; it is empty otherwise.
+//
+// Equivalent to "^created by (.+?)(?: in goroutine (\d+))?$".
+func matchCreated(line string) (f, id string, ok bool) {
+	if !strings.HasPrefix(line, "created by ") {
+		return "", "", false
+	}
+	f = line[len("created by "):]
+	if i := strings.LastIndex(f, " in goroutine "); i > 0 && isDigits(f[i+len(" in goroutine "):]) {
+		f, id = f[:i], f[i+len(" in goroutine "):]
+	}
+	return f, id, f != "" && strings.IndexByte(f, '\n') == -1
+}
+
+// matchFunc matches a function call line, e.g. "main.main(0x1, 0x2)".
+//
+// Equivalent to "^(.+)\((.*)\)$".
+func matchFunc(line string) (name, args string, ok bool) {
+	if !strings.HasSuffix(line, ")") || strings.IndexByte(line, '\n') != -1 {
+		return "", "", false
+	}
+	i := strings.LastIndexByte(line, '(')
+	if i < 1 {
+		return "", "", false
+	}
+	return line[:i], line[i+1 : len(line)-1], true
+}
+
+// isFunc returns true if line is a function call line.
+func isFunc(line string) bool {
+	_, _, ok := matchFunc(line)
+	return ok
+}
+
+// matchFile matches a source file line, e.g. "\t/src/main.go:12 +0x20".
+//
+// See gentraceback() in src/runtime/traceback.go for more information.
+//   - Sometimes the source file comes up as "<autogenerated>". It is the
+//     compiler than generated these, not the runtime.
+//   - The tab may be replaced with spaces when a user copy-paste it, handle
+//     this transparently.
+//   - "runtime.gopanic" is explicitly replaced with "panic" by
+//     gentraceback().
+//   - The +0x123 byte offset is printed when frame.pc > _func.entry. _func is
+//     generated by the linker.
+//   - The +0x123 byte offset is not included with generated code, e.g.
+//     unnamed functions "func·006()" which is generally go func() { ... }()
+//     statements. Since the _func is generated at runtime, it's probably why
+//     _func.entry is not set.
+//   - C calls may have fp=0x123 sp=0x123 appended. I think it normally
+//     happens when a signal is not correctly handled. It is printed with
+//     m.throwing>0. These are discarded.
+//   - For cgo, the source file may be "??".
+//
+// Equivalent to
+// "^(?:\t| +)(\?\?|<autogenerated>|.+\.(?:c|go|s)):(\d+)(| \+0x[0-9a-f]+)(?:| fp=0x[0-9a-f]+ sp=0x[0-9a-f]+(?:| pc=0x[0-9a-f]+))$".
+func matchFile(line string) (path, num, offset string, ok bool) {
+	rest, ok := trimIndent(line)
+	if !ok {
+		return "", "", "", false
+	}
+	// The suffix has a single colon, so the path ends at the last one.
+	i := strings.LastIndexByte(rest, ':')
+	if i == -1 {
+		return "", "", "", false
+	}
+	path = rest[:i]
+	if !isSrcPath(path) {
+		return "", "", "", false
+	}
+	tail := rest[i+1:]
+	n := digits(tail)
+	if n == 0 {
+		return "", "", "", false
+	}
+	num = tail[:n]
+	tail = tail[n:]
+	if l := hexValue(tail, " +0x"); l != 0 {
+		offset = tail[:l]
+		tail = tail[l:]
+	}
+	if tail != "" {
+		l := hexValue(tail, " fp=0x")
+		if l == 0 {
+			return "", "", "", false
+		}
+		tail = tail[l:]
+		if l = hexValue(tail, " sp=0x"); l == 0 {
+			return "", "", "", false
+		}
+		tail = tail[l:]
+		if tail != "" && hexValue(tail, " pc=0x") != len(tail) {
+			return "", "", "", false
+		}
+	}
+	return path, num, offset, true
+}
+
+// isFileLine returns true if line is a source file line.
+func isFileLine(line string) bool {
+	_, _, _, ok := matchFile(line)
+	return ok
+}
+
+// trimIndent removes the indentation of a line in a stack, either a tab or
+// spaces. Returns false if the line is not indented.
+func trimIndent(line string) (string, bool) {
+	if strings.HasPrefix(line, "\t") {
+		return line[1:], true
+	}
+	i := 0
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return line[i:], i != 0
+}
+
+// isSrcPath returns true if p is a source path as printed in a stack.
+func isSrcPath(p string) bool {
+	if p == "??" || p == "<autogenerated>" {
+		return true
+	}
+	if strings.IndexByte(p, '\n') != -1 {
+		return false
+	}
+	return (len(p) > len(".go") && strings.HasSuffix(p, ".go")) ||
+		(len(p) > len(".c") && (strings.HasSuffix(p, ".c") || strings.HasSuffix(p, ".s")))
+}
+
+// digits returns the number of leading decimal digits in s.
+func digits(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// hexValue returns the length of prefix followed by lower case hexadecimal
+// digits at the start of s, or 0 if there's none.
+func hexValue(s, prefix string) int {
+	if !strings.HasPrefix(s, prefix) {
+		return 0
+	}
+	i := len(prefix)
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'f') {
+		i++
+	}
+	if i == len(prefix) {
+		return 0
+	}
+	return i
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// The regexps the matchers replaced, to confirm they are equivalent.
+var (
+	reRoutineHeader = regexp.MustCompile("^([ \t]*)goroutine (\\d+) \\[([^\\]]+)\\]\\:$")
+	reMinutes       = regexp.MustCompile("^(\\d+) minutes$")
+	reSeconds       = regexp.MustCompile("^(\\d+) seconds?$")
+	reUnavail       = regexp.MustCompile("^(?:\t| +)goroutine running on other thread; stack unavailable")
+	reFile          = regexp.MustCompile("^(?:\t| +)(\\?\\?|\\<autogenerated\\>|.+\\.(?:c|go|s))\\:(\\d+)(| \\+0x[0-9a-f]+)(?:| fp=0x[0-9a-f]+ sp=0x[0-9a-f]+(?:| pc=0x[0-9a-f]+))$")
+	reCreated       = regexp.MustCompile("^created by (.+?)(?: in goroutine (\\d+))?$")
+	reFunc          = regexp.MustCompile("^(.+)\\((.*)\\)$")
+)
+
+var matchLines = []string{
+	"",
+	"goroutine 1 [running]:",
+	"\t goroutine 12 [chan receive, 3 minutes, locked to thread]:",
+	"goroutine 1 [running]",
+	"goroutine 1 []:",
+	"goroutine 1 [a]b]:",
+	"goroutine x [running]:",
+	"goroutine 1 [running]: ",
+	"goroutine profile: total 4",
+	"goroutine profile: total ",
+	"goroutine profile: total 4a",
+	"3 minutes",
+	"minutes",
+	"1 second",
+	"2 seconds",
+	"2 secondss",
+	"\tgoroutine running on other thread; stack unavailable",
+	"  goroutine running on other thread; stack unavailable",
+	"goroutine running on other thread; stack unavailable",
+	"created by main.main",
+	"created by ",
+	"created by main.main in goroutine 1",
+	"main.main()",
+	"main.(*T).F(0x1, 0x2, ...)",
+	"main.F({0x1, 0x2}, 0x3?)",
+	"(x)",
+	"a()b",
+	"panic(0x123, 0x456)",
+	"\t/gopath/src/foo/main.go:10 +0x20",
+	"    /gopath/src/foo/main.go:10",
+	"\t\t/gopath/src/foo/main.go:10",
+	"\t/gopath/src/foo/main.go:10 +0x",
+	"\t/gopath/src/foo/main.go:10 +0x20 fp=0xc sp=0xd",
+	"\t/gopath/src/foo/main.go:10 +0x20 fp=0xc sp=0xd pc=0xe",
+	"\t/gopath/src/foo/main.go:10 fp=0xc sp=0xd pc=0xe",
+	"\t/gopath/src/foo/main.go:10 fp=0xc",
+	"\t/gopath/src/foo/main.go:10 +0x20 pc=0xe",
+	"\t/gopath/src/foo/main.go:10 +0xABC",
+	"\t/gopath/src/foo/main.go:",
+	"\t/gopath/src/foo/main.go",
+	"\t/c:/foo bar/main.go:10 +0x20",
+	"\t.go:10",
+	"\ta.c:10",
+	"\tfoo.s:1 +0x1",
+	"\tfoo.h:1",
+	"\t??:0",
+	"\t<autogenerated>:1",
+	"/gopath/src/foo/main.go:10",
+}
+
+func TestMatchers(t *testing.T) {
+	t.Parallel()
+	for _, l := range matchLines {
+		var want, got []string
+		if m := reRoutineHeader.FindStringSubmatch(l); m != nil {
+			want = m[1:]
+		}
+		if p, id, s, ok := matchRoutineHeader(l); ok {
+			got = []string{p, id, s}
+		}
+		compareMatch(t, "header", l, want, got)
+
+		want, got = submatch(reMinutes, l), nil
+		if n, ok := matchDuration(l, "minutes"); ok {
+			got = []string{n}
+		}
+		compareMatch(t, "minutes", l, want, got)
+
+		want, got = submatch(reSeconds, l), nil
+		if n, ok := matchDuration(trimS(l), "second"); ok {
+			got = []string{n}
+		}
+		compareMatch(t, "seconds", l, want, got)
+
+		if w, g := reUnavail.MatchString(l), isUnavail(l); w != g {
+			t.Errorf("unavail(%q): want %t, got %t", l, w, g)
+		}
+
+		want, got = submatch(reCreated, l), nil
+		if f, id, ok := matchCreated(l); ok {
+			got = []string{f, id}
+		}
+		compareMatch(t, "created", l, want, got)
+
+		want, got = submatch(reFunc, l), nil
+		if n, a, ok := matchFunc(l); ok {
+			got = []string{n, a}
+		}
+		compareMatch(t, "func", l, want, got)
+
+		want, got = submatch(reFile, l), nil
+		if p, n, o, ok := matchFile(l); ok {
+			got = []string{p, n, o}
+		}
+		compareMatch(t, "file", l, want, got)
+	}
+}
+
+func BenchmarkMatchFile(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !isFileLine("\t/gopath/src/github.com/foo/bar/main.go:10 +0x20") {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func BenchmarkMatchFile_Regexp(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !reFile.MatchString("\t/gopath/src/github.com/foo/bar/main.go:10 +0x20") {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func submatch(re *regexp.Regexp, l string) []string {
+	if m := re.FindStringSubmatch(l); m != nil {
+		return m[1:]
+	}
+	return nil
+}
+
+func trimS(s string) string {
+	if len(s) != 0 && s[len(s)-1] == 's' {
+		return s[:len(s)-1]
+	}
+	return s
+}
+
+func compareMatch(t *testing.T, name, l string, want, got []string) {
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("%s(%q) mismatch (-want +got):\n%s", name, l, diff)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Module is a Go module checked out on the host, as described by its go.mod.
+//
+// It is used via Env.Modules to resolve the source paths precisely instead of
+// guessing them.
+type Module struct {
+	// Path is the module path, e.g. "github.com/maruel/panicparse".
+	Path string
+	// Dir is the directory containing go.mod, with "/" as path separator.
+	Dir string
+	// Replace maps the modules replaced by a local directory in go.mod to the
+	// directory, with "/" as path separator.
+	Replace map[string]string
+}
+
+// LoadModule reads the go.mod in dir.
+//
+// Only the module path and the replace directives pointing to a local
+// directory are used.
+func LoadModule(dir string) (*Module, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, err
+	}
+	m := &Module{Dir: strings.Replace(dir, "\\", "/", -1), Replace: map[string]string{}}
+	block := ""
+	for _, l := range strings.Split(string(b), "\n") {
+		if i := strings.Index(l, "//"); i != -1 {
+			l = l[:i]
+		}
+		f := strings.Fields(l)
+		if len(f) == 0 {
+			continue
+		}
+		if block != "" {
+			if f[0] == ")" {
+				block = ""
+				continue
+			}
+			f = append([]string{block}, f...)
+		} else if len(f) == 2 && f[1] == "(" {
+			block = f[0]
+			continue
+		}
+		switch f[0] {
+		case "module":
+			if len(f) == 2 {
+				m.Path = unquote(f[1])
+			}
+		case "replace":
+			// "replace old [version] => new [version]"
+			for i := range f {
+				if f[i] != "=>" || i+1 >= len(f) || i < 2 {
+					continue
+				}
+				if n := unquote(f[i+1]); isLocalPath(n) {
+					if !filepath.IsAbs(n) {
+						n = filepath.Join(dir, n)
+					}
+					m.Replace[unquote(f[1])] = strings.Replace(filepath.Clean(n), "\\", "/", -1)
+				}
+				break
+			}
+		}
+	}
+	if m.Path == "" {
+		return nil, errors.New("no module directive in " + filepath.Join(dir, "go.mod"))
+	}
+	return m, nil
+}
+
+// Private stuff.
+
+// resolveModule sets the local path of c from the modules, the vendor
+// directories and the local module cache. Returns false if none matched.
+func resolveModule(c *Call, modules []*Module, modCache string, files *fileCache) bool {
+	// In the module cache, e.g. "/root/go/pkg/mod/github.com/!foo/bar@v1.0.0/bar.go".
+	if i := strings.LastIndex(c.SrcPath, "/pkg/mod/"); i != -1 {
+		rel := c.SrcPath[i+len("/pkg/mod/"):]
+		if j := strings.IndexByte(rel, '@'); j != -1 {
+			if k := strings.IndexByte(rel[j:], '/'); k != -1 {
+				mod := unescapeModPath(rel[:j])
+				rest := rel[j+k+1:]
+				for _, m := range modules {
+					if d, ok := m.Replace[mod]; ok {
+						c.RelSrcPath = pathJoin(mod, rest)
+						c.LocalSrcPath = pathJoin(d, rest)
+						return true
+					}
+				}
+				for _, m := range modules {
+					if p := pathJoin(m.Dir, "vendor", mod, rest); files.isFile(p) {
+						c.RelSrcPath = pathJoin(mod, rest)
+						c.LocalSrcPath = p
+						return true
+					}
+				}
+				if modCache != "" {
+					c.RelSrcPath = rel
+					c.LocalSrcPath = pathJoin(modCache, rel)
+					return true
+				}
+			}
+		}
+		return false
+	}
+	// Vendored in the module that was built.
+	if i := strings.LastIndex(c.SrcPath, "/vendor/"); i != -1 {
+		rel := c.SrcPath[i+len("/vendor/"):]
+		for _, m := range modules {
+			if p := pathJoin(m.Dir, "vendor", rel); files.isFile(p) {
+				c.RelSrcPath = rel
+				c.LocalSrcPath = p
+				return true
+			}
+		}
+	}
+	// In one of the modules, which was built from a different directory.
+	if c.IsPkgMain() {
+		// The import path is not known, look for the file instead.
+		parts := splitPath(c.SrcPath)
+		for _, m := range modules {
+			if r := rootedIn(files, m.Dir, parts); r != "" {
+				rel := c.SrcPath[len(r)+1:]
+				c.RelSrcPath = pathJoin(m.Path, rel)
+				c.LocalSrcPath = pathJoin(m.Dir, rel)
+				return true
+			}
+		}
+		return false
+	}
+	p := c.Func.importPath()
+	for _, m := range modules {
+		if p == m.Path || strings.HasPrefix(p, m.Path+"/") {
+			c.RelSrcPath = pathJoin(p, c.SrcName())
+			c.LocalSrcPath = m.Dir + pathJoin(p[len(m.Path):], c.SrcName())
+			return true
+		}
+	}
+	return false
+}
+
+// getModCache returns the local module cache, using "/" as path separator.
+func getModCache(gopaths []string) string {
+	if d := os.Getenv("GOMODCACHE"); d != "" {
+		return strings.TrimRight(strings.Replace(d, "\\", "/", -1), "/")
+	}
+	if len(gopaths) != 0 {
+		return gopaths[0] + "/pkg/mod"
+	}
+	return ""
+}
+
+// unescapeModPath reverts the escaping of the upper case letters done in the
+// module cache, e.g. "github.com/!azure" is "github.com/Azure".
+func unescapeModPath(p string) string {
+	if !strings.Contains(p, "!") {
+		return p
+	}
+	out := make([]byte, 0, len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == '!' && i+1 < len(p) {
+			i++
+			out = append(out, p[i]-'a'+'A')
+			continue
+		}
+		out = append(out, p[i])
+	}
+	return string(out)
+}
+
+// isLocalPath returns true if the replacement in a replace directive is a
+// directory instead of a module.
+func isLocalPath(p string) bool {
+	return strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") || p == "." || p == ".." || filepath.IsAbs(p)
+}
+
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
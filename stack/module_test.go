@@ -0,0 +1,124 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadModule(t *testing.T) {
+	t.Parallel()
+	dir := setupModule(t)
+	defer os.RemoveAll(dir)
+	m, err := LoadModule(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := strings.Replace(dir, "\\", "/", -1)
+	want := &Module{
+		Path: "example.com/app",
+		Dir:  d,
+		Replace: map[string]string{
+			"github.com/foo/fork": d + "/fork",
+			"github.com/foo/abs":  "/src/abs",
+		},
+	}
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Fatalf("Module mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := LoadModule(filepath.Join(dir, "vendor")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseDumpWithOptsModules(t *testing.T) {
+	t.Parallel()
+	dir := setupModule(t)
+	defer os.RemoveAll(dir)
+	m, err := LoadModule(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := m.Dir
+	data := []string{
+		"goroutine 1 [running]:",
+		"example.com/app/server.Serve()",
+		"\t/build/server/server.go:30 +0x49",
+		"github.com/foo/fork.Do()",
+		"\t/root/go/pkg/mod/github.com/foo/fork@v1.0.0/fork.go:20 +0x49",
+		"github.com/foo/vendored.Do()",
+		"\t/build/vendor/github.com/foo/vendored/v.go:12 +0x49",
+		"github.com/!bar/baz.Do()",
+		"\t/root/go/pkg/mod/github.com/!bar/baz@v1.2.0/baz.go:10 +0x49",
+		"main.main()",
+		"\t/build/cmd/app/main.go:5 +0x49",
+		"",
+	}
+	env := &Env{Modules: []*Module{m}, LocalModCache: "/cache"}
+	c, err := ParseDumpWithOpts(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, &Opts{GuessPaths: true, Env: env})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		d + "/server/server.go",
+		d + "/fork/fork.go",
+		d + "/vendor/github.com/foo/vendored/v.go",
+		"/cache/github.com/!bar/baz@v1.2.0/baz.go",
+		d + "/cmd/app/main.go",
+	}
+	calls := c.Goroutines[0].Stack.Calls
+	for i, w := range want {
+		if l := calls[i].LocalSrcPath; l != w {
+			t.Fatalf("#%d: want %q, got %q", i, w, l)
+		}
+	}
+	if p := calls[4].ImportPath(); p != "example.com/app/cmd/app" {
+		t.Fatalf("unexpected %q", p)
+	}
+}
+
+func TestUnescapeModPath(t *testing.T) {
+	t.Parallel()
+	if s := unescapeModPath("github.com/!azure/!a!p!i"); s != "github.com/Azure/API" {
+		t.Fatal(s)
+	}
+}
+
+func setupModule(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod": "module \"example.com/app\" // The app.\n\n" +
+			"require github.com/foo/fork v1.0.0\n\n" +
+			"replace (\n" +
+			"\tgithub.com/foo/fork => ./fork\n" +
+			"\tgithub.com/foo/other v1.0.0 => github.com/bar/other v1.1.0\n" +
+			")\n\n" +
+			"replace github.com/foo/abs v1.0.0 => /src/abs\n",
+		"server/server.go":                    "package server\n",
+		"cmd/app/main.go":                     "package main\n",
+		"fork/fork.go":                        "package fork\n",
+		"vendor/github.com/foo/vendored/v.go": "package vendored\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
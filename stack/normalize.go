@@ -0,0 +1,109 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import "strings"
+
+// Normalize returns copies of the goroutines with the differences in the
+// calls into the runtime and the standard library that are specific to a Go
+// version removed.
+//
+// Use it before Aggregate() or Signature.Fingerprint() when merging stack
+// dumps of executables built with different Go versions, so the same logical
+// signature doesn't fragment by toolchain. For calls into the standard
+// library, it:
+//   - renames the functions that were renamed or moved across versions to
+//     their newest name,
+//   - collapses consecutive calls to the same function, which happens when a
+//     function was split in two,
+//   - drops the "runtime.goexit" call that older versions print at the bottom
+//     of the stack,
+//   - trims the source path to be relative to GOROOT/src, which was
+//     GOROOT/src/pkg before go1.4,
+//   - clears the line number and the arguments, which change across versions.
+//
+// The standard library is detected with Call.IsStdlib when the stack dump was
+// parsed with guesspaths, and otherwise by assuming that only the packages of
+// the standard library have no dot in the first element of their import path.
+// The goroutines passed in are not modified.
+func Normalize(goroutines []*Goroutine) []*Goroutine {
+	out := make([]*Goroutine, len(goroutines))
+	for i, g := range goroutines {
+		n := *g
+		n.CreatedBy = normalizeCall(g.CreatedBy)
+		n.Stack.Calls = make([]Call, 0, len(g.Stack.Calls))
+		for j, c := range g.Stack.Calls {
+			if j == len(g.Stack.Calls)-1 && j != 0 && c.Func.Raw == "runtime.goexit" {
+				break
+			}
+			c = normalizeCall(c)
+			if l := len(n.Stack.Calls); l != 0 && isStdlibCall(&c) && n.Stack.Calls[l-1].Func.Raw == c.Func.Raw {
+				continue
+			}
+			n.Stack.Calls = append(n.Stack.Calls, c)
+		}
+		out[i] = &n
+	}
+	return out
+}
+
+// Private stuff.
+
+// normalizedFuncs maps the functions of the runtime and the standard library
+// that were renamed or split across Go versions to their newest name.
+//
+// Keep it sorted.
+var normalizedFuncs = map[string]string{
+	// go1.9 moved the poller to internal/poll.
+	"net.(*pollDesc).wait":     "internal/poll.(*pollDesc).wait",
+	"net.(*pollDesc).waitRead": "internal/poll.(*pollDesc).waitRead",
+	"net.runtime_pollWait":     "internal/poll.runtime_pollWait",
+	// go1.4 renamed park to gopark, goparkunlock is a thin wrapper.
+	"runtime.goparkunlock": "runtime.gopark",
+	"runtime.park":         "runtime.gopark",
+	// go1.8 merged selectgoImpl into selectgo.
+	"runtime.selectgoImpl": "runtime.selectgo",
+	// go1.14 split the slow path out of Lock.
+	"sync.(*Mutex).lockSlow": "sync.(*Mutex).Lock",
+	// go1.9 added a separate semaphore for mutexes.
+	"sync.runtime_SemacquireMutex": "sync.runtime_Semacquire",
+}
+
+// normalizeCall returns the call normalized if it is into the standard
+// library.
+func normalizeCall(c Call) Call {
+	if c.Func.Raw == "" || !isStdlibCall(&c) {
+		return c
+	}
+	if n, ok := normalizedFuncs[c.Func.Raw]; ok {
+		c.Func.Raw = n
+	}
+	if c.RelSrcPath != "" {
+		c.SrcPath = c.RelSrcPath
+	} else if i := strings.LastIndex(c.SrcPath, "/src/pkg/"); i != -1 {
+		c.SrcPath = c.SrcPath[i+len("/src/pkg/"):]
+	} else if i := strings.LastIndex(c.SrcPath, "/src/"); i != -1 {
+		c.SrcPath = c.SrcPath[i+len("/src/"):]
+	}
+	c.Line = 0
+	c.Args = Args{}
+	return c
+}
+
+// isStdlibCall returns true if the call is into the standard library.
+func isStdlibCall(c *Call) bool {
+	if c.IsStdlib {
+		return true
+	}
+	// Packages outside the standard library have a dot in the first path
+	// element of their import path, e.g. "github.com/".
+	p := c.Func.Raw
+	if i := strings.IndexByte(p, '/'); i != -1 {
+		p = p[:i]
+	} else if i := strings.IndexByte(p, '.'); i != -1 {
+		p = p[:i]
+	}
+	return p != "" && p != "main" && !strings.Contains(p, ".")
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+	// The same goroutine as printed by go1.3 and go1.14, with different
+	// GOROOT.
+	data := []string{
+		"goroutine 5 [semacquire]:",
+		"sync.runtime_Semacquire(0xc208000038)",
+		"	/goroot/src/pkg/runtime/sema.go:199 +0x30",
+		"sync.(*Mutex).Lock(0xc208000030)",
+		"	/goroot/src/pkg/sync/mutex.go:66 +0xd6",
+		"github.com/foo/bar.(*T).Do(0xc208000030)",
+		"	/gopath/src/github.com/foo/bar/bar.go:12 +0x49",
+		"created by main.main",
+		"	/gopath/src/github.com/foo/bar/cmd/main.go:20 +0x49",
+		"",
+		"goroutine 9 [semacquire]:",
+		"sync.runtime_SemacquireMutex(0xc000010004, 0x0, 0x1)",
+		"	/usr/local/go/src/runtime/sema.go:71 +0x47",
+		"sync.(*Mutex).lockSlow(0xc000010000)",
+		"	/usr/local/go/src/sync/mutex.go:138 +0xfc",
+		"sync.(*Mutex).Lock(...)",
+		"	/usr/local/go/src/sync/mutex.go:81",
+		"github.com/foo/bar.(*T).Do(0xc000010000)",
+		"	/gopath/src/github.com/foo/bar/bar.go:12 +0x5b",
+		"created by main.main",
+		"	/gopath/src/github.com/foo/bar/cmd/main.go:20 +0x49",
+		"",
+	}
+	c, err := ParseDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Goroutines[0].Fingerprint() == c.Goroutines[1].Fingerprint() {
+		t.Fatal("expected different fingerprints before normalization")
+	}
+	n := Normalize(c.Goroutines)
+	compareString(t, n[0].Fingerprint(), n[1].Fingerprint())
+	if b := Aggregate(n, AnyPointer); len(b) != 1 {
+		t.Fatalf("expected 1 bucket, got %d", len(b))
+	}
+	want := &Signature{
+		State:     "semacquire",
+		CreatedBy: newCall("main.main", Args{}, "/gopath/src/github.com/foo/bar/cmd/main.go", 20),
+		Stack: Stack{
+			Calls: []Call{
+				newCall("sync.runtime_Semacquire", Args{}, "runtime/sema.go", 0),
+				newCall("sync.(*Mutex).Lock", Args{}, "sync/mutex.go", 0),
+				newCall("github.com/foo/bar.(*T).Do", Args{Values: []Arg{{Value: 0xc208000030, Name: "#1"}}}, "/gopath/src/github.com/foo/bar/bar.go", 12),
+			},
+		},
+	}
+	compareSignatures(t, want, &n[0].Signature)
+	// The original goroutines are not modified.
+	if len(c.Goroutines[1].Stack.Calls) != 4 {
+		t.Fatal("goroutine was modified")
+	}
+}
+
+func TestNormalizeGoexit(t *testing.T) {
+	t.Parallel()
+	g := &Goroutine{
+		Signature: Signature{
+			Stack: Stack{
+				Calls: []Call{
+					newCall("main.worker", Args{}, "/gopath/src/foo/main.go", 12),
+					newCall("runtime.goexit", Args{}, "/goroot/src/runtime/asm_amd64.s", 2232),
+				},
+			},
+		},
+	}
+	n := Normalize([]*Goroutine{g})
+	want := []Call{newCall("main.worker", Args{}, "/gopath/src/foo/main.go", 12)}
+	if len(n[0].Stack.Calls) != 1 {
+		t.Fatalf("unexpected %#v", n[0].Stack.Calls)
+	}
+	compareCalls(t, &want[0], &n[0].Stack.Calls[0])
+}
+
+func TestIsStdlibCall(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		f    string
+		want bool
+	}{
+		{"runtime.gopark", true},
+		{"net/http.(*conn).serve", true},
+		{"main.main", false},
+		{"github.com/foo/bar.Baz", false},
+		{"gopkg.in/yaml%2ev2.Unmarshal", false},
+		{"", false},
+	}
+	for _, line := range data {
+		c := Call{Func: Func{Raw: line.f}}
+		if got := isStdlibCall(&c); got != line.want {
+			t.Fatalf("%q: %t", line.f, got)
+		}
+	}
+}
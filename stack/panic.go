@@ -0,0 +1,109 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PanicDetail is a "panic: " or "fatal error: " line printed by the runtime
+// before the goroutines.
+type PanicDetail struct {
+	// Kind is either "panic" or "fatal error".
+	Kind string
+	// Message is the text after the kind, without the " [recovered]" or
+	// " [recovered, repanicked]" suffix.
+	Message string
+	// Recovered is true if the panic was recovered and another panic happened
+	// afterward.
+	Recovered bool
+	// Repanicked is true if the panic was recovered then panicked again with
+	// the same value. Starting with Go 1.23, the runtime then prints a single
+	// "[recovered, repanicked]" line instead of two panics. Recovered is also
+	// true.
+	Repanicked bool
+	// Value is the panic value without the type decoration the runtime adds to
+	// values of named types, e.g. "boom" for `main.S("boom")`. It is the same
+	// as Message otherwise.
+	Value string
+	// Line is the line of the panic in the input, starting at 1. It is 0 when
+	// the panic was not parsed, e.g. with Capture.
+	Line int
+}
+
+// Private stuff.
+
+var (
+	// reTypedString matches a value of a named string type, e.g.
+	// `main.S("boom")`.
+	reTypedString = regexp.MustCompile(`^(?:[\w.-]+/)*\w+\.\w+\("(.*)"\)$`)
+	// reTypedScalar matches a value of a named numeric or boolean type, e.g.
+	// "main.I(5)".
+	reTypedScalar = regexp.MustCompile(`^(?:[\w.-]+/)*\w+\.\w+\(([^()]*)\)$`)
+	// reTypedOther matches a value of any other type, where the runtime prints
+	// the address, e.g. "(main.T) 0xc000012345".
+	reTypedOther = regexp.MustCompile(`^\(([^()]+)\) (.*)$`)
+)
+
+// appendPanic appends the panic found in line, if any.
+//
+// An unindented line starts a new chain, as printed by the runtime; an
+// indented one is a subsequent panic in the current chain.
+func appendPanic(panics []PanicDetail, line string, lineNo int) []PanicDetail {
+	indented := strings.HasPrefix(line, "\t")
+	p, ok := parsePanic(strings.TrimSpace(line))
+	if !ok {
+		return panics
+	}
+	p.Line = lineNo
+	if !indented {
+		panics = panics[:0]
+	} else if len(panics) == 0 {
+		return panics
+	}
+	return append(panics, p)
+}
+
+// isPanicStart returns true if line starts a new chain of panics, see
+// appendPanic.
+func isPanicStart(line string) bool {
+	if strings.HasPrefix(line, "\t") {
+		return false
+	}
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ")
+}
+
+// parsePanic parses a single "panic: " or "fatal error: " line.
+func parsePanic(line string) (PanicDetail, bool) {
+	p := PanicDetail{}
+	switch {
+	case strings.HasPrefix(line, "panic: "):
+		p.Kind = "panic"
+	case strings.HasPrefix(line, "fatal error: "):
+		p.Kind = "fatal error"
+	default:
+		return p, false
+	}
+	p.Message = line[len(p.Kind)+2:]
+	if strings.HasSuffix(p.Message, " [recovered]") {
+		p.Message = p.Message[:len(p.Message)-len(" [recovered]")]
+		p.Recovered = true
+	} else if strings.HasSuffix(p.Message, " [recovered, repanicked]") {
+		p.Message = p.Message[:len(p.Message)-len(" [recovered, repanicked]")]
+		p.Recovered = true
+		p.Repanicked = true
+	}
+	p.Value = p.Message
+	if m := reTypedString.FindStringSubmatch(p.Message); m != nil {
+		p.Value = m[1]
+	} else if m := reTypedScalar.FindStringSubmatch(p.Message); m != nil {
+		p.Value = m[1]
+	} else if m := reTypedOther.FindStringSubmatch(p.Message); m != nil {
+		p.Value = m[2]
+	}
+	return p, true
+}
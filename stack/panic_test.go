@@ -0,0 +1,57 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePanic(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		line string
+		want PanicDetail
+		ok   bool
+	}{
+		{"panic: boom", PanicDetail{Kind: "panic", Message: "boom", Value: "boom"}, true},
+		{"panic: boom [recovered]", PanicDetail{Kind: "panic", Message: "boom", Recovered: true, Value: "boom"}, true},
+		{"panic: boom [recovered, repanicked]", PanicDetail{Kind: "panic", Message: "boom", Recovered: true, Repanicked: true, Value: "boom"}, true},
+		{`panic: main.S("boom") [recovered, repanicked]`, PanicDetail{Kind: "panic", Message: `main.S("boom")`, Recovered: true, Repanicked: true, Value: "boom"}, true},
+		{`panic: main.S("boom")`, PanicDetail{Kind: "panic", Message: `main.S("boom")`, Value: "boom"}, true},
+		{"panic: example.com/foo.I(5)", PanicDetail{Kind: "panic", Message: "example.com/foo.I(5)", Value: "5"}, true},
+		{"panic: (main.T) 0xc000012345", PanicDetail{Kind: "panic", Message: "(main.T) 0xc000012345", Value: "0xc000012345"}, true},
+		{"panic: assert(x)", PanicDetail{Kind: "panic", Message: "assert(x)", Value: "assert(x)"}, true},
+		{
+			"panic: runtime error: invalid memory address or nil pointer dereference",
+			PanicDetail{Kind: "panic", Message: "runtime error: invalid memory address or nil pointer dereference", Value: "runtime error: invalid memory address or nil pointer dereference"},
+			true,
+		},
+		{"fatal error: all goroutines are asleep - deadlock!", PanicDetail{Kind: "fatal error", Message: "all goroutines are asleep - deadlock!", Value: "all goroutines are asleep - deadlock!"}, true},
+		{"not a panic", PanicDetail{}, false},
+	}
+	for i, line := range data {
+		got, ok := parsePanic(line.line)
+		if ok != line.ok {
+			t.Fatalf("#%d: got %t", i, ok)
+		}
+		if diff := cmp.Diff(line.want, got); diff != "" {
+			t.Fatalf("#%d: (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestAppendPanic(t *testing.T) {
+	t.Parallel()
+	var got []PanicDetail
+	for i, l := range []string{"\tpanic: orphan\n", "panic: a [recovered]\n", "\tpanic: b\n", "other\n", "panic: c\n"} {
+		got = appendPanic(got, l, i+1)
+	}
+	want := []PanicDetail{{Kind: "panic", Message: "c", Value: "c", Line: 5}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("(-want +got):\n%s", diff)
+	}
+}
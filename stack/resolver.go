@@ -0,0 +1,83 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+// Resolver resolves a call, e.g. finds its source file on the host or
+// describes its arguments.
+//
+// Context implements it to guess the paths and SourceResolver implements it
+// for Augment. Implement it to plug in another resolution, e.g. to fetch the
+// sources from a symbol server or a source archive, and pass it in
+// Opts.Resolvers or to Resolve.
+type Resolver interface {
+	// ResolveCall updates c in place.
+	ResolveCall(c *Call) error
+}
+
+// ResolverFunc is a function implementing Resolver.
+type ResolverFunc func(c *Call) error
+
+// ResolveCall implements Resolver.
+func (r ResolverFunc) ResolveCall(c *Call) error {
+	return r(c)
+}
+
+// Resolve calls r on each call of the goroutines, including the calls that
+// created them.
+//
+// It stops at the first error.
+func Resolve(goroutines []*Goroutine, r Resolver) error {
+	for _, g := range goroutines {
+		for i := range g.Stack.Calls {
+			if err := r.ResolveCall(&g.Stack.Calls[i]); err != nil {
+				return err
+			}
+		}
+		if g.CreatedBy.SrcPath != "" {
+			if err := r.ResolveCall(&g.CreatedBy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveCall implements Resolver.
+//
+// It sets LocalSrcPath, RelSrcPath and IsStdlib from the GOROOT and GOPATHs
+// found while parsing with Opts.GuessPaths, and the Opts.Env passed, if any.
+func (c *Context) ResolveCall(call *Call) error {
+	call.updateLocations(c.GOROOT, c.localgoroot, c.GOPATHs)
+	if e := c.env; e != nil && (len(e.SourceRoots) != 0 || e.Remap != nil || len(e.Modules) != 0 || c.modCache != "") {
+		remapCall(call, e, c.modCache, c.files)
+	}
+	return nil
+}
+
+// SourceResolver is a Resolver that parses the source files found locally to
+// describe the arguments of the calls, see Augment.
+//
+// It caches the files, so reuse it across goroutines. It is not safe for
+// concurrent use.
+type SourceResolver struct {
+	c cache
+}
+
+// NewSourceResolver returns a SourceResolver with an empty cache.
+func NewSourceResolver() *SourceResolver {
+	return &SourceResolver{c: cache{files: map[string][]byte{}, parsed: map[string]*parsedFile{}}}
+}
+
+// ResolveCall implements Resolver.
+//
+// It requires LocalSrcPath to be set, e.g. by calling ParseDump() with
+// guesspaths set to true. The files that cannot be loaded are ignored.
+func (s *SourceResolver) ResolveCall(c *Call) error {
+	s.c.load(c.LocalSrcPath)
+	if f := s.c.getFuncAST(c); f != nil {
+		processCall(c, f)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolvers(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [running]:",
+		"main.f(0x1, 0x2)",
+		"\t/build/main.go:4 +0x49",
+		"main.main()",
+		"\t/build/main.go:8 +0x20",
+		"created by main.init",
+		"\t/build/init.go:5 +0x20",
+		"",
+	}
+	var seen []string
+	r := ResolverFunc(func(c *Call) error {
+		seen = append(seen, c.SrcLine())
+		c.LocalSrcPath = "/archive" + c.SrcPath
+		return nil
+	})
+	c, err := ParseDumpWithOpts(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, &Opts{Resolvers: []Resolver{r}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.Join(seen, " "); s != "main.go:4 main.go:8 init.go:5" {
+		t.Fatalf("unexpected calls %q", s)
+	}
+	if l := c.Goroutines[0].CreatedBy.LocalSrcPath; l != "/archive/build/init.go" {
+		t.Fatalf("unexpected %q", l)
+	}
+
+	errFail := errors.New("fail")
+	r = func(c *Call) error { return errFail }
+	if c, err = ParseDumpWithOpts(strings.NewReader(strings.Join(data, "\n")), ioutil.Discard, &Opts{Resolvers: []Resolver{r}}); err != errFail || c == nil {
+		t.Fatalf("unexpected %v, %v", c, err)
+	}
+}
+
+func TestSourceResolver(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := "package main\n\nfunc f(s string, i int) {\n\tpanic(s)\n}\n\nfunc main() {\n\tf(\"a\", 2)\n}\n"
+	p := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(p, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := newCall("main.f", Args{Values: []Arg{{Value: 0x4b1000}, {Value: 1}, {Value: 2}}}, "/build/main.go", 4)
+	c.LocalSrcPath = p
+	if err := NewSourceResolver().ResolveCall(&c); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Args.String(); s != "string(0x4b1000, len=1), 2" {
+		t.Fatalf("unexpected %q", s)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// This file contains the adapters to the stack traces of the current process
+// and to the frames used by error packages.
+
+package stack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"runtime"
+)
+
+// ParseCurrent returns the goroutines of the current process, as printed by
+// runtime.Stack().
+//
+// If all is false, only the calling goroutine is returned. guesspaths has the
+// same meaning as with ParseDump.
+func ParseCurrent(all, guesspaths bool) (*Context, error) {
+	return ParseDump(bytes.NewReader(currentStack(all)), ioutil.Discard, guesspaths)
+}
+
+// FromCallers returns the Stack of the program counters returned by
+// runtime.Callers().
+//
+// This is also the format of the stack traces of github.com/pkg/errors, once
+// its StackTrace is converted to []uintptr, and of the Callers() of
+// github.com/go-errors/errors. The calls have no argument.
+func FromCallers(pcs []uintptr) Stack {
+	var s Stack
+	if len(pcs) == 0 {
+		return s
+	}
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" || f.File != "" {
+			s.Calls = append(s.Calls, Call{SrcPath: f.File, Line: f.Line, Func: Func{Raw: f.Function}})
+		}
+		if !more {
+			break
+		}
+	}
+	return s
+}
+
+// Frames returns the calls as runtime.Frame, the innermost first, for code
+// consuming them, e.g. an error reporting library.
+//
+// Only Function, File and Line are set, as a stack dump doesn't have the
+// program counters. For the same reason, the calls cannot be converted to the
+// frames of github.com/pkg/errors.
+func (s *Stack) Frames() []runtime.Frame {
+	out := make([]runtime.Frame, 0, len(s.Calls))
+	for i := range s.Calls {
+		c := &s.Calls[i]
+		out = append(out, runtime.Frame{Function: c.Func.String(), File: c.SrcPath, Line: c.Line})
+	}
+	return out
+}
+
+// ErrorFrame is a call in the format of the StackFrame of
+// github.com/go-errors/errors, so it can be converted to it.
+type ErrorFrame struct {
+	// File is the path of the source file.
+	File string
+	// LineNumber is the line number in File.
+	LineNumber int
+	// Name is the function name without the package, e.g. "(*Server).Serve".
+	Name string
+	// Package is the package import path, e.g. "net/http".
+	Package string
+	// ProgramCounter is always 0 for a parsed stack dump.
+	ProgramCounter uintptr
+}
+
+// ErrorFrames returns the calls as ErrorFrame, the innermost first.
+func (s *Stack) ErrorFrames() []ErrorFrame {
+	out := make([]ErrorFrame, 0, len(s.Calls))
+	for i := range s.Calls {
+		c := &s.Calls[i]
+		name := c.Func.symbol()
+		pkg := ""
+		if len(name) < len(c.Func.Raw) {
+			pkg, _ = url.QueryUnescape(c.Func.Raw[:len(c.Func.Raw)-len(name)-1])
+		}
+		out = append(out, ErrorFrame{File: c.SrcPath, LineNumber: c.Line, Name: name, Package: pkg})
+	}
+	return out
+}
+
+// Private stuff.
+
+// currentStack returns the stack dump of the current process, as printed by
+// runtime.Stack().
+func currentStack(all bool) []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, all)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFromCallers(t *testing.T) {
+	t.Parallel()
+	pcs := make([]uintptr, 32)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+	s := FromCallers(pcs)
+	if len(s.Calls) == 0 {
+		t.Fatal("expected calls")
+	}
+	c := s.Calls[0]
+	if c.Func.Raw != "github.com/maruel/panicparse/stack.TestFromCallers" || !strings.HasSuffix(c.SrcPath, "/runtime_test.go") || c.Line == 0 {
+		t.Fatalf("unexpected %#v", c)
+	}
+	if s = FromCallers(nil); len(s.Calls) != 0 {
+		t.Fatalf("unexpected %#v", s)
+	}
+}
+
+func TestStackFrames(t *testing.T) {
+	t.Parallel()
+	s := Stack{
+		Calls: []Call{
+			newCall("gopkg.in/yaml%2ev2.Marshal", Args{}, "/gopath/src/gopkg.in/yaml.v2/yaml.go", 10),
+			newCall("net/http.(*Server).Serve", Args{}, "/goroot/src/net/http/server.go", 20),
+			newCall("main.main", Args{}, "/gopath/src/foo/main.go", 30),
+		},
+	}
+	// runtime.Frame has unexported fields that cmp cannot compare; only
+	// Function, File and Line are set anyway.
+	type frame struct {
+		Function string
+		File     string
+		Line     int
+	}
+	want := []frame{
+		{Function: "gopkg.in/yaml.v2.Marshal", File: "/gopath/src/gopkg.in/yaml.v2/yaml.go", Line: 10},
+		{Function: "net/http.(*Server).Serve", File: "/goroot/src/net/http/server.go", Line: 20},
+		{Function: "main.main", File: "/gopath/src/foo/main.go", Line: 30},
+	}
+	var got []frame
+	for _, f := range s.Frames() {
+		got = append(got, frame{Function: f.Function, File: f.File, Line: f.Line})
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Frames mismatch (-want +got):\n%s", diff)
+	}
+	wantErr := []ErrorFrame{
+		{File: "/gopath/src/gopkg.in/yaml.v2/yaml.go", LineNumber: 10, Name: "Marshal", Package: "gopkg.in/yaml.v2"},
+		{File: "/goroot/src/net/http/server.go", LineNumber: 20, Name: "(*Server).Serve", Package: "net/http"},
+		{File: "/gopath/src/foo/main.go", LineNumber: 30, Name: "main", Package: "main"},
+	}
+	if diff := cmp.Diff(wantErr, s.ErrorFrames()); diff != "" {
+		t.Fatalf("ErrorFrames mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseCurrent(t *testing.T) {
+	t.Parallel()
+	c, err := ParseCurrent(false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || len(c.Goroutines) != 1 || c.Goroutines[0].State != "running" {
+		t.Fatalf("unexpected %v", c)
+	}
+}
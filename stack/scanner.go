@@ -0,0 +1,145 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"io"
+)
+
+// RecordKind is the kind of line of a Record.
+type RecordKind int
+
+const (
+	// RecordJunk is a line that is not part of a goroutine, e.g. a log line
+	// or the "panic: " line.
+	RecordJunk RecordKind = iota
+	// RecordGoroutine is a goroutine header, e.g. "goroutine 1 [running]:".
+	RecordGoroutine
+	// RecordFunc is a function call, e.g. "main.main()".
+	RecordFunc
+	// RecordFile is the source of the function call or of the call that
+	// created the goroutine, e.g. "\t/foo/bar/baz.go:116 +0x35".
+	RecordFile
+	// RecordCreatedBy is the call that created the goroutine, e.g.
+	// "created by main.main".
+	RecordCreatedBy
+	// RecordOther is another line of a goroutine, e.g. the empty line after
+	// it or "...additional frames elided...".
+	RecordOther
+)
+
+// Record is a line of a stack dump as parsed by Scanner.
+type Record struct {
+	Kind RecordKind
+	// Text is the line as read, including the line terminator.
+	Text string
+	// Line is the line number, starting at 1.
+	Line int
+	// Offset is the position of the line in bytes from the start of the
+	// input.
+	Offset int64
+	// Goroutine is the goroutine the line is part of, or nil for RecordJunk.
+	// It is not fully parsed yet, the next lines add to it.
+	Goroutine *Goroutine
+	// Call is the call as parsed so far for RecordFunc, RecordFile and
+	// RecordCreatedBy, nil otherwise. It is a copy.
+	Call *Call
+}
+
+// Scanner parses a stack dump one line at a time, for tools that need to
+// annotate or rewrite the original text while parsing, e.g. a log enricher.
+//
+// Contrary to ParseDump, the lines wrapped by a log shipper are not joined
+// and the paths are not guessed. It stops at the first line that cannot be
+// parsed.
+type Scanner struct {
+	scanner *lineReader
+	s       scanningState
+	rec     Record
+	err     error
+	line    int
+	offset  int64
+}
+
+// NewScanner returns a Scanner reading from r.
+func NewScanner(r io.Reader) *Scanner {
+	s := &Scanner{scanner: newLineReader(r, 0)}
+	return s
+}
+
+// Scan advances to the next line, like bufio.Scanner.Scan(). It returns false
+// at the end of the input or on error.
+func (s *Scanner) Scan() bool {
+	if s.err != nil || !s.scanner.Scan() {
+		return false
+	}
+	text := s.scanner.Text()
+	s.line++
+	s.rec = Record{Text: text, Line: s.line, Offset: s.offset}
+	s.offset += int64(len(text))
+	prev := s.s.state
+	junk, err := s.s.scan(text)
+	if err != nil {
+		s.err = err
+		return false
+	}
+	if junk != "" || len(s.s.goroutines) == 0 {
+		return true
+	}
+	g := s.s.goroutines[len(s.s.goroutines)-1]
+	s.rec.Goroutine = g
+	switch st := s.s.state; {
+	case st == prev:
+		// e.g. "...additional frames elided...".
+		s.rec.Kind = RecordOther
+	case st == gotRoutineHeader:
+		s.rec.Kind = RecordGoroutine
+	case st == gotFunc:
+		s.rec.Kind = RecordFunc
+		s.rec.Call = lastCall(g)
+	case st == gotFileFunc:
+		s.rec.Kind = RecordFile
+		s.rec.Call = lastCall(g)
+	case st == gotCreated:
+		s.rec.Kind = RecordCreatedBy
+		s.rec.Call = createdBy(g)
+	case st == gotFileCreated:
+		s.rec.Kind = RecordFile
+		s.rec.Call = createdBy(g)
+	default:
+		s.rec.Kind = RecordOther
+	}
+	return true
+}
+
+// Record returns the line read by the last call to Scan.
+func (s *Scanner) Record() *Record {
+	return &s.rec
+}
+
+// Err returns the error that stopped Scan, if any.
+func (s *Scanner) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.scanner.Err()
+}
+
+// Goroutines returns the goroutines parsed so far.
+func (s *Scanner) Goroutines() []*Goroutine {
+	return s.s.goroutines
+}
+
+// Private stuff.
+
+func lastCall(g *Goroutine) *Call {
+	c := g.Stack.Calls[len(g.Stack.Calls)-1]
+	return &c
+}
+
+func createdBy(g *Goroutine) *Call {
+	c := g.CreatedBy
+	return &c
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	t.Parallel()
+	in := "panic: boom\n" +
+		"\n" +
+		"goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n" +
+		"\n" +
+		"goroutine 6 [chan receive]:\n" +
+		"main.worker(0x1)\n" +
+		"\t/gopath/src/foo/main.go:20 +0x20\n" +
+		"...additional frames elided...\n" +
+		"created by main.main\n" +
+		"\t/gopath/src/foo/main.go:5 +0x30\n" +
+		"exit status 2\n"
+	type rec struct {
+		kind   RecordKind
+		offset int64
+		id     int
+		call   string
+	}
+	want := []rec{
+		{RecordJunk, 0, 0, ""},
+		{RecordJunk, 12, 0, ""},
+		{RecordGoroutine, 13, 1, ""},
+		{RecordFunc, 36, 1, "main.main:0"},
+		{RecordFile, 48, 1, "main.main:10"},
+		{RecordOther, 82, 1, ""},
+		{RecordGoroutine, 83, 6, ""},
+		{RecordFunc, 111, 6, "main.worker:0"},
+		{RecordFile, 128, 6, "main.worker:20"},
+		{RecordOther, 162, 6, ""},
+		{RecordCreatedBy, 193, 6, "main.main:0"},
+		{RecordFile, 214, 6, "main.main:5"},
+		{RecordJunk, 247, 0, ""},
+	}
+	s := NewScanner(strings.NewReader(in))
+	var got []rec
+	var text string
+	for s.Scan() {
+		r := s.Record()
+		if r.Line != len(got)+1 {
+			t.Fatalf("unexpected line %d", r.Line)
+		}
+		if in[r.Offset:r.Offset+int64(len(r.Text))] != r.Text {
+			t.Fatalf("unexpected offset %d for %q", r.Offset, r.Text)
+		}
+		text += r.Text
+		g := rec{kind: r.Kind, offset: r.Offset}
+		if r.Goroutine != nil {
+			g.id = r.Goroutine.ID
+		}
+		if r.Call != nil {
+			g.call = r.Call.Func.Raw + ":" + strconv.Itoa(r.Call.Line)
+		}
+		got = append(got, g)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v\ngot  %v", want, got)
+	}
+	if text != in {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if g := s.Goroutines(); len(g) != 2 || len(g[1].Stack.Calls) != 1 || !g[1].Stack.Elided {
+		t.Fatalf("unexpected goroutines %v", g)
+	}
+}
+
+func TestScannerErr(t *testing.T) {
+	t.Parallel()
+	s := NewScanner(strings.NewReader("goroutine 1 [running]:\nnot a function\n"))
+	n := 0
+	for s.Scan() {
+		n++
+	}
+	if n != 1 || s.Err() == nil {
+		t.Fatalf("unexpected %d, %v", n, s.Err())
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SignalInfo is the signal that caused the stack dump, as printed by the
+// runtime before the goroutines.
+type SignalInfo struct {
+	// Name is the signal name, e.g. "SIGSEGV".
+	Name string
+	// Description is the signal description, e.g. "segmentation violation".
+	Description string
+	// Code is the signal code, e.g. 1 for SEGV_MAPERR.
+	Code uint64
+	// Addr is the faulting address.
+	Addr uint64
+	// PC is the program counter when the signal was received.
+	PC uint64
+	// Cgo is true if the signal arrived during cgo execution.
+	Cgo bool
+}
+
+// Private stuff.
+
+var (
+	// reSignal matches "SIGSEGV: segmentation violation".
+	reSignal = regexp.MustCompile(`^(SIG[A-Z0-9]+): (.+)$`)
+	// reSignalPanic matches the line printed after a panic caused by a signal,
+	// e.g. "[signal SIGSEGV: segmentation violation code=0x1 addr=0x0
+	// pc=0x4a5b6c]".
+	reSignalPanic = regexp.MustCompile(`^\[signal (SIG[A-Z0-9]+): (.+?)((?: \w+=0x[0-9a-f]+)*)\]$`)
+)
+
+// updateSignal updates the signal information with line, if relevant.
+func updateSignal(s *SignalInfo, line string) *SignalInfo {
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "signal arrived during cgo execution":
+		if s == nil {
+			s = &SignalInfo{}
+		}
+		s.Cgo = true
+	case strings.HasPrefix(line, "PC="):
+		// "PC=0x4a5b6c m=0 sigcode=1 addr=0x0"
+		if s == nil {
+			s = &SignalInfo{}
+		}
+		parseSignalFields(s, line)
+	default:
+		m := reSignalPanic.FindStringSubmatch(line)
+		if m == nil {
+			m = reSignal.FindStringSubmatch(line)
+		}
+		if m == nil {
+			return s
+		}
+		if s == nil {
+			s = &SignalInfo{}
+		}
+		s.Name = m[1]
+		s.Description = m[2]
+		if len(m) == 4 {
+			parseSignalFields(s, m[3])
+		}
+	}
+	return s
+}
+
+// parseSignalFields parses the space separated "key=value" fields.
+func parseSignalFields(s *SignalInfo, line string) {
+	for _, f := range strings.Fields(line) {
+		i := strings.IndexByte(f, '=')
+		if i == -1 {
+			continue
+		}
+		v, err := strconv.ParseUint(f[i+1:], 0, 64)
+		if err != nil {
+			continue
+		}
+		switch f[:i] {
+		case "PC", "pc":
+			s.PC = v
+		case "addr":
+			s.Addr = v
+		case "code", "sigcode":
+			s.Code = v
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUpdateSignal(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		lines []string
+		want  *SignalInfo
+	}{
+		{[]string{"panic: boom"}, nil},
+		{
+			[]string{"SIGSEGV: segmentation violation", "PC=0x4a5b6c m=0 sigcode=1 addr=0xdead", "", "signal arrived during cgo execution"},
+			&SignalInfo{Name: "SIGSEGV", Description: "segmentation violation", Code: 1, Addr: 0xdead, PC: 0x4a5b6c, Cgo: true},
+		},
+		{
+			[]string{"panic: runtime error: invalid memory address or nil pointer dereference", "[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x4a5b6c]"},
+			&SignalInfo{Name: "SIGSEGV", Description: "segmentation violation", Code: 1, PC: 0x4a5b6c},
+		},
+		{
+			[]string{"SIGQUIT: quit", "PC=0x43f349"},
+			&SignalInfo{Name: "SIGQUIT", Description: "quit", PC: 0x43f349},
+		},
+	}
+	for i, line := range data {
+		var got *SignalInfo
+		for _, l := range line.lines {
+			got = updateSignal(got, l+"\n")
+		}
+		if diff := cmp.Diff(line.want, got); diff != "" {
+			t.Fatalf("#%d: (-want +got):\n%s", i, diff)
+		}
+	}
+}
@@ -29,6 +29,8 @@ type cache struct {
 //
 // It modifies goroutines in place. It requires calling ParseDump() with
 // guesspaths set to true to work properly.
+//
+// Use SourceResolver to do the same as a Resolver.
 func Augment(goroutines []*Goroutine) {
 	c := &cache{}
 	for _, g := range goroutines {
@@ -0,0 +1,222 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Section is a stack trace as found in a stream, kept as raw text.
+type Section struct {
+	// Raw is the unprocessed text of the stack trace. It includes the preceding
+	// "panic:" or "fatal error:" message when one was found.
+	Raw []byte
+	// Line is the line number in the stream where Raw starts, starting at 1.
+	Line int
+}
+
+// maxLeadLines is the maximum number of lines kept between a "panic:" line and
+// the first goroutine header to be considered part of the same section.
+const maxLeadLines = 32
+
+// SplitDump splits the stack traces found in r into sections, without parsing
+// them further.
+//
+// fn is called for each stack trace section found. Processing stops if fn
+// returns an error. Anything not detected as a stack trace is streamed to out,
+// including the "panic:" message that is also kept in the Section.
+//
+// Contrary to ParseDump(), a malformed stack trace does not stop the
+// processing; the section is cut short and the scan resumes on the next line.
+func SplitDump(r io.Reader, out io.Writer, fn func(s *Section) error) error {
+	scanner := newLineReader(r, 0)
+	s := scanningState{}
+	var lead []string
+	leadLine := 0
+	var cur *Section
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		c := cur
+		cur = nil
+		lead = nil
+		s = scanningState{}
+		return fn(c)
+	}
+	for l := 1; scanner.Scan(); l++ {
+		text := scanner.Text()
+		line, err := s.scan(text)
+		if line == "" && err == nil {
+			// The line is part of a stack trace.
+			if cur == nil {
+				cur = &Section{Line: l}
+				if len(lead) != 0 {
+					cur.Line = leadLine
+					cur.Raw = []byte(strings.Join(lead, ""))
+				}
+			}
+			cur.Raw = append(cur.Raw, text...)
+			continue
+		}
+		if err2 := flush(); err2 != nil {
+			return err2
+		}
+		if err != nil {
+			// Resync on the next line and do not lose the offending line.
+			s = scanningState{}
+			line = text
+		}
+		_, _ = io.WriteString(out, line)
+		if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") {
+			lead = []string{line}
+			leadLine = l
+		} else if lead != nil {
+			if len(lead) < maxLeadLines {
+				lead = append(lead, line)
+			} else {
+				lead = nil
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+// LastDump returns the offset of the last stack dump in r, which is size
+// bytes long, including the preceding "panic:" or "fatal error:" message when
+// one is found. It returns size if no goroutine header was found.
+//
+// r is read backward from its end, in chunks, so only the end of a huge log
+// file is read to find the crash that terminated the process. Parse the
+// stack dump with io.NewSectionReader(r, off, size-off).
+func LastDump(r io.ReaderAt, size int64) (int64, error) {
+	b := backwardLines{r: r, pos: size}
+	off := size
+	// later is the kind of the line after the current one.
+	later := dumpJunk
+	for b.prev() {
+		t := strings.TrimRight(string(b.line), "\r\n")
+		k := dumpLineKind(t, later)
+		if k == dumpHeader {
+			off = b.off
+		} else if k == dumpJunk && off != size {
+			// The goroutines are contiguous; look for their message.
+			for i := 0; i < maxLeadLines; i++ {
+				if strings.HasPrefix(t, "panic: ") || strings.HasPrefix(t, "fatal error: ") || strings.HasPrefix(t, "goroutine profile: ") {
+					off = b.off
+					break
+				}
+				if isRoutineHeader(t) || isFileLine(t) || !b.prev() {
+					break
+				}
+				t = strings.TrimRight(string(b.line), "\r\n")
+			}
+			break
+		}
+		later = k
+	}
+	return off, b.err
+}
+
+// Private stuff.
+
+// dumpKind is the kind of a line of a stack dump, as determined by
+// dumpLineKind.
+type dumpKind int
+
+const (
+	dumpJunk dumpKind = iota
+	dumpHeader
+	dumpFunc
+	dumpFile
+	dumpOther
+)
+
+// dumpLineKind returns the kind of the line t, knowing the kind of the line
+// after it.
+//
+// A function call must be followed by its source file, since a lot of junk
+// ends with a parenthesis.
+func dumpLineKind(t string, later dumpKind) dumpKind {
+	switch {
+	case t == "":
+		return dumpOther
+	case isRoutineHeader(t):
+		return dumpHeader
+	case isFileLine(t):
+		return dumpFile
+	case isFunc(t):
+		if later == dumpFile {
+			return dumpFunc
+		}
+	case strings.HasPrefix(strings.TrimSpace(t), "created by "):
+		if later == dumpFile {
+			return dumpFunc
+		}
+	case strings.TrimSpace(t) == elided, isUnavail(t):
+		return dumpOther
+	}
+	return dumpJunk
+}
+
+// backwardLines reads the lines of r backward, from pos.
+type backwardLines struct {
+	r   io.ReaderAt
+	pos int64
+	// buf is the data read before pos that was not returned yet; it starts at
+	// offset pos.
+	buf []byte
+	// line is the current line and off its offset in r.
+	line []byte
+	off  int64
+	err  error
+}
+
+// prev moves to the previous line. It returns false at the start of r or on
+// error.
+//
+// A line longer than maxKeptLine is returned in parts, since it cannot be a
+// line of a stack dump.
+func (b *backwardLines) prev() bool {
+	for b.err == nil {
+		end := len(b.buf)
+		if end == 0 && b.pos == 0 {
+			return false
+		}
+		// Skip the line terminator of the line.
+		s := b.buf
+		if end != 0 && s[end-1] == '\n' {
+			s = s[:end-1]
+		}
+		i := bytes.LastIndexByte(s, '\n')
+		if i != -1 || b.pos == 0 || end >= maxKeptLine {
+			b.line = b.buf[i+1:]
+			b.off = b.pos + int64(i+1)
+			b.buf = b.buf[:i+1]
+			return true
+		}
+		n := int64(lineBufSize)
+		if n > b.pos {
+			n = b.pos
+		}
+		buf := make([]byte, int(n)+end)
+		if m, err := b.r.ReadAt(buf[:n], b.pos-n); err != nil && (err != io.EOF || int64(m) != n) {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			b.err = err
+			return false
+		}
+		copy(buf[n:], b.buf)
+		b.buf = buf
+		b.pos -= n
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitDump(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"junk",
+		"panic: first",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+		"more junk",
+		"goroutine 2 [chan receive]:",
+		"main.func·001()",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:74 +0x49",
+		"",
+		"goroutine 3 [chan receive]:",
+		"main.func·001(",
+		"trailing junk",
+		"",
+	}
+	extra := &bytes.Buffer{}
+	var got []Section
+	err := SplitDump(bytes.NewBufferString(strings.Join(data, "\n")), extra, func(s *Section) error {
+		got = append(got, *s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Section{
+		{
+			Raw:  []byte(strings.Join(data[1:7], "\n") + "\n"),
+			Line: 2,
+		},
+		{
+			// The malformed goroutine is cut short.
+			Raw:  []byte(strings.Join(data[8:13], "\n") + "\n"),
+			Line: 9,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Section mismatch (-want +got):\n%s", diff)
+	}
+	compareString(t, "junk\npanic: first\n\nmore junk\nmain.func·001(\ntrailing junk\n", extra.String())
+}
+
+func TestSplitDumpErr(t *testing.T) {
+	t.Parallel()
+	data := []string{
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+	}
+	want := errors.New("stop")
+	err := SplitDump(bytes.NewBufferString(strings.Join(data, "\n")), ioutil.Discard, func(s *Section) error {
+		return want
+	})
+	compareErr(t, want, err)
+}
+
+func TestLastDump(t *testing.T) {
+	t.Parallel()
+	dump := strings.Join([]string{
+		"panic: second",
+		"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x1]",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.func·001()",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:74 +0x49",
+		"created by main.main",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:73 +0x49",
+		"",
+	}, "\n")
+	first := strings.Join([]string{
+		"panic: first",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"	/gopath/src/github.com/maruel/panicparse/stack/stack.go:72 +0x49",
+		"",
+	}, "\n")
+	// The junk is longer than the chunks read.
+	junk := strings.Repeat("log line (with a parenthesis)\n", 2*lineBufSize/30)
+	data := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"empty", "", 0},
+		{"none", junk, len(junk)},
+		{"only", dump, 0},
+		{"last", first + junk + dump + "exit status 2\n", len(first + junk)},
+		{"noMessage", first + junk + dump[len("panic: second\n"):], len(first + junk + "[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x1]\n\n")},
+		{"longLine", strings.Repeat("a", 2*maxKeptLine) + "\n" + dump, 2*maxKeptLine + 1},
+	}
+	for _, line := range data {
+		line := line
+		t.Run(line.name, func(t *testing.T) {
+			t.Parallel()
+			r := strings.NewReader(line.in)
+			off, err := LastDump(r, r.Size())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if off != int64(line.want) {
+				t.Fatalf("want %d, got %d: %q", line.want, off, line.in[off:])
+			}
+		})
+	}
+}
+
+func TestLastDumpParse(t *testing.T) {
+	t.Parallel()
+	data := "panic: first\n\ngoroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:1 +0x1\n\njunk\n" +
+		"panic: second\n\ngoroutine 3 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:2 +0x1\n"
+	r := strings.NewReader(data)
+	off, err := LastDump(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := &bytes.Buffer{}
+	c, err := ParseDump(io.NewSectionReader(r, off, r.Size()-off), extra, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Goroutines) != 1 || c.Goroutines[0].ID != 3 {
+		t.Fatalf("unexpected goroutines: %v", c.Goroutines)
+	}
+	compareString(t, "panic: second\n\n", extra.String())
+}
+
+func TestLastDumpErr(t *testing.T) {
+	t.Parallel()
+	// The reader is shorter than the size passed.
+	r := strings.NewReader("goroutine 1 [running]:\n")
+	_, err := LastDump(r, r.Size()+1)
+	compareErr(t, io.ErrUnexpectedEOF, err)
+}
@@ -9,12 +9,16 @@
 package stack
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -115,10 +119,63 @@ func (f *Func) IsExported() bool {
 	return f.PkgName() == "main" && name == "main"
 }
 
+// Receiver returns the type of the receiver of a method without its type
+// parameters, e.g. "*Server" for "net/http.(*Server).Serve" or "List" for
+// "pkg.List[...].Len". Returns "" for a function.
+func (f *Func) Receiver() string {
+	recv, _ := splitMethod(stripTypeParams(f.symbol()))
+	return recv
+}
+
+// TypeParams returns the type parameters of a generic function or of the
+// receiver of a generic method as printed, e.g. "go.shape.int" for
+// "pkg.Fn[go.shape.int]". Go 1.21 and later print "..." instead of the
+// types. Returns "" if there is none.
+func (f *Func) TypeParams() string {
+	s := f.symbol()
+	i := strings.IndexByte(s, '[')
+	if i == -1 {
+		return ""
+	}
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				return s[i+1 : j]
+			}
+		}
+	}
+	return s[i+1:]
+}
+
+// BareName returns the name of the function or method without the receiver
+// and the type parameters, e.g. "Serve" for "net/http.(*Server).Serve".
+//
+// The closures keep their suffix, e.g. "Serve.func1".
+func (f *Func) BareName() string {
+	_, name := splitMethod(stripTypeParams(f.symbol()))
+	return name
+}
+
 // Arg is an argument on a Call.
 type Arg struct {
 	Value uint64 // Value is the raw value as found in the stack trace
 	Name  string // Name is a pseudo name given to the argument
+	// Inexact is set when the runtime flagged the value with a "?" as possibly
+	// inaccurate, which happens starting with Go 1.17 when the argument was
+	// passed in a register.
+	Inexact bool
+	// IsOffsetTooLarge is set when the runtime printed "_" instead of the
+	// value, because it is too far in the frame, starting with Go 1.17.
+	IsOffsetTooLarge bool
+	// IsAggregate is set when the argument is a struct, an array, a string, a
+	// slice or an interface, which the runtime prints as "{...}" starting with
+	// Go 1.17. Value is then 0 and Fields are the words of the aggregate.
+	IsAggregate bool
+	Fields      Args
 }
 
 const (
@@ -142,21 +199,42 @@ func (a *Arg) IsPtr() bool {
 const zeroToNine = "0123456789"
 
 // String prints the argument as the name if present, otherwise as the value.
+//
+// An inexact value is suffixed with "?" and an aggregate is printed as
+// "{...}", like in the stack trace.
 func (a *Arg) String() string {
+	if a.IsAggregate {
+		return "{" + a.Fields.String() + "}"
+	}
 	if a.Name != "" {
 		return a.Name
 	}
+	if a.IsOffsetTooLarge {
+		return "_"
+	}
+	s := ""
 	if a.Value < uint64(len(zeroToNine)) {
-		return zeroToNine[a.Value : a.Value+1]
+		s = zeroToNine[a.Value : a.Value+1]
+	} else {
+		s = fmt.Sprintf("0x%x", a.Value)
 	}
-	return fmt.Sprintf("0x%x", a.Value)
+	if a.Inexact {
+		s += "?"
+	}
+	return s
 }
 
 // similar returns true if the two Arg are equal or almost but not quite equal.
 func (a *Arg) similar(r *Arg, similar Similarity) bool {
+	if a.IsAggregate != r.IsAggregate {
+		return false
+	}
+	if a.IsAggregate {
+		return a.Fields.similar(&r.Fields, similar)
+	}
 	switch similar {
 	case ExactFlags, ExactLines:
-		return *a == *r
+		return a.equal(r)
 	case AnyValue:
 		return true
 	case AnyPointer:
@@ -169,6 +247,14 @@ func (a *Arg) similar(r *Arg, similar Similarity) bool {
 	}
 }
 
+// equal returns true only if both arguments are exactly equal.
+func (a *Arg) equal(r *Arg) bool {
+	if a.Value != r.Value || a.Name != r.Name || a.Inexact != r.Inexact || a.IsOffsetTooLarge != r.IsOffsetTooLarge || a.IsAggregate != r.IsAggregate {
+		return false
+	}
+	return !a.IsAggregate || a.Fields.equal(&r.Fields)
+}
+
 // Args is a series of function call arguments.
 type Args struct {
 	// Values is the arguments as shown on the stack trace. They are mangled via
@@ -197,13 +283,83 @@ func (a *Args) String() string {
 	return strings.Join(v, ", ")
 }
 
+// ArgsFormat controls how Args.Format renders the arguments.
+//
+// The zero value renders the same as Args.String().
+type ArgsFormat struct {
+	// Off renders no argument, only "..." if there were any.
+	Off bool
+	// Decimal renders the values in decimal instead of hexadecimal.
+	Decimal bool
+	// ElideZero renders the zero values as "_".
+	ElideZero bool
+	// CollapseRepeated renders consecutive identical arguments once with their
+	// count, e.g. "0xc000010000 (x3)" for the same pointer passed three times.
+	CollapseRepeated bool
+}
+
+// Format renders the arguments as specified by f.
+//
+// Decimal and ElideZero only apply to Values, not to Processed.
+func (a *Args) Format(f *ArgsFormat) string {
+	if f.Off {
+		if len(a.Values) != 0 || len(a.Processed) != 0 || a.Elided {
+			return "..."
+		}
+		return ""
+	}
+	var v []string
+	if len(a.Processed) != 0 {
+		v = a.Processed
+	} else {
+		v = make([]string, 0, len(a.Values))
+		for i := range a.Values {
+			item := &a.Values[i]
+			switch {
+			case item.IsAggregate:
+				v = append(v, "{"+item.Fields.Format(f)+"}")
+			case item.Name != "":
+				v = append(v, item.Name)
+			case item.IsOffsetTooLarge, f.ElideZero && item.Value == 0:
+				v = append(v, "_")
+			case f.Decimal && item.Inexact:
+				v = append(v, strconv.FormatUint(item.Value, 10)+"?")
+			case f.Decimal:
+				v = append(v, strconv.FormatUint(item.Value, 10))
+			default:
+				v = append(v, item.String())
+			}
+		}
+	}
+	if f.CollapseRepeated {
+		out := make([]string, 0, len(v))
+		for i := 0; i < len(v); {
+			j := i + 1
+			for j < len(v) && v[j] == v[i] {
+				j++
+			}
+			if j-i > 1 {
+				out = append(out, fmt.Sprintf("%s (x%d)", v[i], j-i))
+			} else {
+				out = append(out, v[i])
+			}
+			i = j
+		}
+		v = out
+	}
+	if a.Elided {
+		v = append(v, "...")
+	}
+	return strings.Join(v, ", ")
+}
+
 // equal returns true only if both arguments are exactly equal.
 func (a *Args) equal(r *Args) bool {
 	if a.Elided != r.Elided || len(a.Values) != len(r.Values) {
 		return false
 	}
-	for i, l := range a.Values {
-		if l != r.Values[i] {
+	for i := range a.Values {
+		if !a.Values[i].equal(&r.Values[i]) {
 			return false
 		}
 	}
@@ -225,17 +381,26 @@ func (a *Args) similar(r *Args, similar Similarity) bool {
 }
 
 // merge merges two similar Args, zapping out differences.
+//
+// The values are normally of the same length, but it is not guaranteed when
+// the calls were deemed similar by a user provided function. Missing values
+// are zapped out.
 func (a *Args) merge(r *Args) Args {
 	out := Args{
 		Values: make([]Arg, len(a.Values)),
 		Elided: a.Elided,
 	}
-	for i, l := range a.Values {
-		if l != r.Values[i] {
+	for i := range a.Values {
+		l := &a.Values[i]
+		switch {
+		case i < len(r.Values) && l.IsAggregate && r.Values[i].IsAggregate:
+			out.Values[i] = Arg{IsAggregate: true, Fields: l.Fields.merge(&r.Values[i].Fields)}
+		case i >= len(r.Values) || !l.equal(&r.Values[i]):
 			out.Values[i].Name = "*"
 			out.Values[i].Value = l.Value
-		} else {
-			out.Values[i] = l
+			out.Values[i].Inexact = l.Inexact || (i < len(r.Values) && r.Values[i].Inexact)
+		default:
+			out.Values[i] = *l
 		}
 	}
 	return out
@@ -254,6 +419,10 @@ type Call struct {
 	Func Func
 	// Args is the call arguments.
 	Args Args
+	// Inlined is true if the call was inlined in its caller, the next Call in
+	// the Stack. The line is then in the inlined function and the caller's
+	// line is the one where it was inlined.
+	Inlined bool
 
 	// The following are only set if guesspaths is set to true in ParseDump().
 	// IsStdlib is true if it is a Go standard library function. This includes
@@ -283,6 +452,7 @@ func (c *Call) merge(r *Call) Call {
 		Line:         c.Line,
 		Func:         c.Func,
 		Args:         c.Args.merge(&r.Args),
+		Inlined:      c.Inlined,
 		IsStdlib:     c.IsStdlib,
 		RelSrcPath:   c.RelSrcPath,
 	}
@@ -394,6 +564,29 @@ type Stack struct {
 	Elided bool
 }
 
+// AppCall returns the innermost call outside the standard library, e.g. the
+// likely culprit of a panic, or nil.
+//
+// IsStdlib is only set when the paths were guessed, so fallback on the
+// import path: packages outside the standard library have a dot in its first
+// element, e.g. "github.com/".
+func (s *Stack) AppCall() *Call {
+	for i := range s.Calls {
+		c := &s.Calls[i]
+		if c.IsStdlib {
+			continue
+		}
+		p := c.ImportPath()
+		if i := strings.IndexByte(p, '/'); i != -1 {
+			p = p[:i]
+		}
+		if c.IsPkgMain() || strings.Contains(p, ".") {
+			return c
+		}
+	}
+	return nil
+}
+
 // equal returns true on if both call stacks are exactly equal.
 func (s *Stack) equal(r *Stack) bool {
 	if len(s.Calls) != len(r.Calls) || s.Elided != r.Elided {
@@ -421,6 +614,20 @@ func (s *Stack) similar(r *Stack, similar Similarity) bool {
 	return true
 }
 
+// similarFunc returns true if the two Stack are similar according to the
+// user provided function.
+func (s *Stack) similarFunc(r *Stack, similar func(l, r *Call) bool) bool {
+	if len(s.Calls) != len(r.Calls) || s.Elided != r.Elided {
+		return false
+	}
+	for i := range s.Calls {
+		if !similar(&s.Calls[i], &r.Calls[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // merge merges two similar Stack, zapping out differences.
 func (s *Stack) merge(r *Stack) *Stack {
 	// Assumes similar stacks have the same length.
@@ -529,10 +736,21 @@ type Signature struct {
 	State string
 	// Createdby is the goroutine which created this one, if applicable.
 	CreatedBy Call
+	// CreatedByID is the ID of the goroutine which created this one, as
+	// printed starting with Go 1.21, or 0. It is ignored when comparing
+	// signatures.
+	CreatedByID int
 	// SleepMin is the wait time in minutes, if applicable.
 	SleepMin int
 	// SleepMax is the wait time in minutes, if applicable.
 	SleepMax int
+	// WaitMin and WaitMax are the wait time when it was printed with a finer
+	// granularity than minutes, e.g. "45 seconds". SleepMin and SleepMax are
+	// then the number of whole minutes.
+	//
+	// Use WaitRange() to get the wait time independently of the granularity.
+	WaitMin time.Duration
+	WaitMax time.Duration
 	// Stack is the call stack.
 	Stack Stack
 	// Locked is set if the goroutine was locked to an OS thread.
@@ -541,7 +759,7 @@ type Signature struct {
 
 // equal returns true only if both signatures are exactly equal.
 func (s *Signature) equal(r *Signature) bool {
-	if s.State != r.State || !s.CreatedBy.equal(&r.CreatedBy) || s.Locked != r.Locked || s.SleepMin != r.SleepMin || s.SleepMax != r.SleepMax {
+	if s.State != r.State || !s.CreatedBy.equal(&r.CreatedBy) || s.Locked != r.Locked || s.SleepMin != r.SleepMin || s.SleepMax != r.SleepMax || s.WaitMin != r.WaitMin || s.WaitMax != r.WaitMax {
 		return false
 	}
 	return s.Stack.equal(&r.Stack)
@@ -559,6 +777,15 @@ func (s *Signature) similar(r *Signature, similar Similarity) bool {
 	return s.Stack.similar(&r.Stack, similar)
 }
 
+// similarFunc returns true if the two Signature are similar according to the
+// user provided function.
+func (s *Signature) similarFunc(r *Signature, similar func(l, r *Call) bool) bool {
+	if s.State != r.State || !similar(&s.CreatedBy, &r.CreatedBy) {
+		return false
+	}
+	return s.Stack.similarFunc(&r.Stack, similar)
+}
+
 // merge merges two similar Signature, zapping out differences.
 func (s *Signature) merge(r *Signature) *Signature {
 	min := s.SleepMin
@@ -569,7 +796,7 @@ func (s *Signature) merge(r *Signature) *Signature {
 	if r.SleepMax > max {
 		max = r.SleepMax
 	}
-	return &Signature{
+	out := &Signature{
 		State:     s.State,     // Drop right side.
 		CreatedBy: s.CreatedBy, // Drop right side.
 		SleepMin:  min,
@@ -577,6 +804,22 @@ func (s *Signature) merge(r *Signature) *Signature {
 		Stack:     *s.Stack.merge(&r.Stack),
 		Locked:    s.Locked || r.Locked, // TODO(maruel): This is weirdo.
 	}
+	if s.CreatedByID == r.CreatedByID {
+		out.CreatedByID = s.CreatedByID
+	}
+	if s.WaitMax != 0 || r.WaitMax != 0 {
+		sMin, sMax := s.WaitRange()
+		rMin, rMax := r.WaitRange()
+		out.WaitMin = sMin
+		if rMin < sMin {
+			out.WaitMin = rMin
+		}
+		out.WaitMax = sMax
+		if rMax > sMax {
+			out.WaitMax = rMax
+		}
+	}
+	return out
 }
 
 // less compares two Signature, where the ones that are less are more
@@ -605,6 +848,44 @@ func (s *Signature) less(r *Signature) bool {
 	return false
 }
 
+// Fingerprint returns a hash of the Signature as an hexadecimal string.
+//
+// It only depends on the state, the functions, the source file base names and
+// line numbers of the calls and of the creator. It doesn't depend on argument
+// values, goroutine IDs nor on where the sources were located, so it is stable
+// across stack dumps of the same executable, even on different hosts. Use
+// Normalize() first to compare executables built with different Go versions.
+func (s *Signature) Fingerprint() string {
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "%s\n%t\n", s.State, s.Stack.Elided)
+	_, _ = fmt.Fprintf(h, "%s %s:%d\n", s.CreatedBy.Func.Raw, s.CreatedBy.SrcName(), s.CreatedBy.Line)
+	for i := range s.Stack.Calls {
+		c := &s.Stack.Calls[i]
+		_, _ = fmt.Fprintf(h, "%s %s:%d\n", c.Func.Raw, c.SrcName(), c.Line)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Hash returns a hash of the fields of the Signature that must be equal for
+// two signatures to be similar at any Similarity level: the state, the
+// functions, source paths, line numbers and number of arguments of the calls
+// and of the creator.
+//
+// Two similar signatures have the same hash. It is cheaper to compute than
+// Fingerprint() but it is not stable across stack dumps.
+func (s *Signature) Hash() uint64 {
+	h := hashString(fnvOffset, s.State)
+	h = hashCall(h, &s.CreatedBy)
+	h = hashInt(h, len(s.Stack.Calls))
+	if s.Stack.Elided {
+		h = hashInt(h, 1)
+	}
+	for i := range s.Stack.Calls {
+		h = hashCall(h, &s.Stack.Calls[i])
+	}
+	return h
+}
+
 // SleepString returns a string "N-M minutes" if the goroutine(s) slept for a
 // long time.
 //
@@ -619,6 +900,44 @@ func (s *Signature) SleepString() string {
 	return fmt.Sprintf("%d minutes", s.SleepMax)
 }
 
+// WaitRange returns the wait time bounds of the goroutine(s).
+//
+// It is WaitMin and WaitMax when the wait time was printed with a granularity
+// finer than minutes, SleepMin and SleepMax otherwise. Returns 0, 0 if the
+// goroutine(s) didn't wait for long.
+func (s *Signature) WaitRange() (time.Duration, time.Duration) {
+	if s.WaitMax != 0 {
+		return s.WaitMin, s.WaitMax
+	}
+	return time.Duration(s.SleepMin) * time.Minute, time.Duration(s.SleepMax) * time.Minute
+}
+
+// TestName returns the name of the test, benchmark, fuzz test or example run
+// by "go test" that the goroutine(s) belong to, e.g. "TestFoo", so the right
+// test can be blamed for a leak or a panic.
+//
+// It is the function called by the testing package, or the function of a test
+// that created the goroutine. Returns an empty string otherwise.
+func (s *Signature) TestName() string {
+	// The stack may be elided before the testing package's frames, in which
+	// case the goroutine created by it starts with the test.
+	inTest := testRunners[s.CreatedBy.Func.Raw]
+	for i := len(s.Stack.Calls) - 1; i >= 0; i-- {
+		f := &s.Stack.Calls[i].Func
+		if testRunners[f.Raw] {
+			inTest = true
+			continue
+		}
+		if inTest {
+			if n := testFunc(f); n != "" {
+				return n
+			}
+			inTest = false
+		}
+	}
+	return testFunc(&s.CreatedBy.Func)
+}
+
 // CreatedByString return a short context about the origin of this goroutine
 // signature.
 //
@@ -651,74 +970,243 @@ type Goroutine struct {
 	ID int
 	// First is the goroutine first printed, normally the one that crashed.
 	First bool
+	// Partial is set when the goroutine could not be parsed completely, which
+	// happens with Opts.Resync or when the input ended in its middle, see
+	// Context.Truncated.
+	Partial bool
+	// StartLine and EndLine are the first and last lines of the goroutine in
+	// the input, starting at 1. Start and End are the matching byte offsets,
+	// End being exclusive. They are set by ParseDump, so the goroutine can be
+	// linked back to the raw input.
+	StartLine, EndLine int
+	Start, End         int64
 }
 
 // Private stuff.
 
-// nameArguments is a post-processing step where Args are 'named' with numbers.
-func nameArguments(goroutines []*Goroutine) {
-	// Set a name for any pointer occurring more than once.
-	type object struct {
-		args      []*Arg
-		inPrimary bool
-		id        int
-	}
-	objects := map[uint64]object{}
-	// Enumerate all the arguments.
-	for i := range goroutines {
-		for j := range goroutines[i].Stack.Calls {
-			for k := range goroutines[i].Stack.Calls[j].Args.Values {
-				arg := goroutines[i].Stack.Calls[j].Args.Values[k]
-				if arg.IsPtr() {
-					objects[arg.Value] = object{
-						args:      append(objects[arg.Value].args, &goroutines[i].Stack.Calls[j].Args.Values[k]),
-						inPrimary: objects[arg.Value].inPrimary || i == 0,
-					}
-				}
+// symbol returns the part of Func.Raw after the package name.
+//
+// The type parameters may contain "/", e.g. "go.shape.*example.com/x.T".
+func (f *Func) symbol() string {
+	start := 0
+	depth := 0
+	for i := 0; i < len(f.Raw); i++ {
+		switch f.Raw[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '/':
+			if depth == 0 {
+				start = i + 1
 			}
 		}
-		// CreatedBy.Args is never set.
 	}
-	order := make(uint64Slice, 0, len(objects)/2)
-	for k, obj := range objects {
-		if len(obj.args) > 1 && obj.inPrimary {
-			order = append(order, k)
+	s := f.Raw[start:]
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		return s[i+1:]
+	}
+	return s
+}
+
+// stripTypeParams removes the type parameters in brackets.
+func stripTypeParams(s string) string {
+	if strings.IndexByte(s, '[') == -1 {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '[':
+			depth++
+		case s[i] == ']':
+			depth--
+		case depth == 0:
+			out = append(out, s[i])
 		}
 	}
-	sort.Sort(order)
-	nextID := 1
-	for _, k := range order {
-		for _, arg := range objects[k].args {
-			arg.Name = fmt.Sprintf("#%d", nextID)
+	return string(out)
+}
+
+// splitMethod splits a symbol without its package into the receiver and the
+// name.
+func splitMethod(s string) (string, string) {
+	if strings.HasPrefix(s, "(") {
+		// Pointer receiver, e.g. "(*Server).Serve".
+		if i := strings.Index(s, ")."); i != -1 {
+			return s[1:i], s[i+2:]
+		}
+		return "", s
+	}
+	// Value receiver, e.g. "Server.Serve", as opposed to a closure, e.g.
+	// "Serve.func1", "Serve.func1.2" or "glob..func1".
+	i := strings.IndexByte(s, '.')
+	if i == -1 {
+		return "", s
+	}
+	next := s[i+1:]
+	if j := strings.IndexByte(next, '.'); j != -1 {
+		next = next[:j]
+	}
+	if next == "" || isDigits(next) || (strings.HasPrefix(next, "func") && isDigits(next[4:])) {
+		return "", s
+	}
+	return s[:i], s[i+1:]
+}
+
+// isDigits returns true if s is a non-empty string of decimal digits.
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
 		}
-		nextID++
 	}
+	return s != ""
+}
 
-	// Now do the rest. This is done so the output is deterministic.
-	order = make(uint64Slice, 0, len(objects))
-	for k := range objects {
-		order = append(order, k)
+// testRunners is the functions of the testing package that call the tests,
+// benchmarks and examples.
+var testRunners = map[string]bool{
+	"testing.tRunner":         true,
+	"testing.(*T).Run":        true,
+	"testing.(*B).runN":       true,
+	"testing.(*B).run1":       true,
+	"testing.(*B).launch":     true,
+	"testing.runExample":      true,
+	"testing.(*F).Fuzz.func1": true,
+}
+
+// testFunc returns the name of the test if f is a test, benchmark, fuzz test
+// or example function, or one of its closures.
+func testFunc(f *Func) string {
+	if f.Receiver() != "" {
+		return ""
 	}
-	sort.Sort(order)
-	for _, k := range order {
-		// Process the remaining pointers, they were not referenced by primary
-		// thread so will have higher IDs.
-		if objects[k].inPrimary {
+	name := f.BareName()
+	if i := strings.IndexByte(name, '.'); i != -1 {
+		name = name[:i]
+	}
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		if !strings.HasPrefix(name, prefix) {
 			continue
 		}
-		for _, arg := range objects[k].args {
-			arg.Name = fmt.Sprintf("#%d", nextID)
+		// Like "go test", "Testing" is not a test but "Test_foo" is.
+		if r, _ := utf8.DecodeRuneInString(name[len(prefix):]); r == utf8.RuneError || !unicode.IsLower(r) {
+			return name
 		}
-		nextID++
 	}
+	return ""
+}
+
+// nameArguments is a post-processing step where Args are 'named' with numbers.
+func nameArguments(goroutines []*Goroutine) {
+	// Set a name for any pointer occurring more than once.
+	//
+	// Enumerate all the arguments in a single slice sorted by value instead
+	// of a map of slices, which is significantly cheaper with a lot of
+	// goroutines.
+	n := 0
+	for _, g := range goroutines {
+		for j := range g.Stack.Calls {
+			n += len(g.Stack.Calls[j].Args.Values)
+		}
+	}
+	refs := make(argRefs, 0, n)
+	for i, g := range goroutines {
+		for j := range g.Stack.Calls {
+			refs = appendPtrArgs(refs, &g.Stack.Calls[j].Args, i == 0)
+		}
+		// CreatedBy.Args is never set.
+	}
+	sort.Sort(refs)
+	nextID := 1
+	// First the pointers referenced more than once including by the primary
+	// thread, then the others. This is done so the output is deterministic.
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < len(refs); {
+			j := i + 1
+			inPrimary := refs[i].primary
+			for ; j < len(refs) && refs[j].arg.Value == refs[i].arg.Value; j++ {
+				inPrimary = inPrimary || refs[j].primary
+			}
+			if (pass == 0 && inPrimary && j-i > 1) || (pass == 1 && !inPrimary) {
+				name := "#" + strconv.Itoa(nextID)
+				for _, r := range refs[i:j] {
+					r.arg.Name = name
+				}
+				nextID++
+			}
+			i = j
+		}
+	}
+}
+
+// appendPtrArgs appends the pointer arguments of args to refs, including the
+// ones in the aggregates.
+func appendPtrArgs(refs argRefs, args *Args, primary bool) argRefs {
+	for i := range args.Values {
+		if arg := &args.Values[i]; arg.IsAggregate {
+			refs = appendPtrArgs(refs, &arg.Fields, primary)
+		} else if arg.IsPtr() {
+			refs = append(refs, argRef{arg: arg, primary: primary})
+		}
+	}
+	return refs
 }
 
 func pathJoin(s ...string) string {
 	return strings.Join(s, "/")
 }
 
-type uint64Slice []uint64
+// FNV-1a constants, see hash/fnv. It is reimplemented to hash the strings
+// without allocating.
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+func hashString(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime
+	}
+	// Separator, so "ab","c" and "a","bc" hash differently.
+	h ^= 0xff
+	h *= fnvPrime
+	return h
+}
+
+func hashInt(h uint64, v int) uint64 {
+	for i := uint(0); i < 64; i += 8 {
+		h ^= uint64(v>>i) & 0xff
+		h *= fnvPrime
+	}
+	return h
+}
+
+// hashCall hashes the fields of c compared by Call.similar() for all the
+// Similarity levels.
+func hashCall(h uint64, c *Call) uint64 {
+	h = hashString(h, c.Func.Raw)
+	h = hashString(h, c.SrcPath)
+	h = hashInt(h, c.Line)
+	h = hashInt(h, len(c.Args.Values))
+	if c.Args.Elided {
+		h = hashInt(h, 1)
+	}
+	return h
+}
+
+// argRef is a pointer argument, see nameArguments().
+type argRef struct {
+	arg *Arg
+	// primary is true if the argument is in the first goroutine.
+	primary bool
+}
+
+type argRefs []argRef
 
-func (a uint64Slice) Len() int           { return len(a) }
-func (a uint64Slice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a uint64Slice) Less(i, j int) bool { return a[i] < a[j] }
+func (a argRefs) Len() int           { return len(a) }
+func (a argRefs) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a argRefs) Less(i, j int) bool { return a[i].arg.Value < a[j].arg.Value }
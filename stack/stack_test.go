@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -306,6 +307,44 @@ func TestArgs(t *testing.T) {
 	compareString(t, "yo", a.String())
 }
 
+func TestArgsFormat(t *testing.T) {
+	t.Parallel()
+	a := Args{
+		Values: []Arg{
+			{Value: 0},
+			{Value: 0xc000010000},
+			{Value: 0xc000010000},
+			{Value: 16},
+			{Value: 0x7fff671c7118, Name: "#1"},
+			{Value: 0x7fff671c7118, Name: "#1"},
+		},
+		Elided: true,
+	}
+	data := []struct {
+		f    ArgsFormat
+		want string
+	}{
+		{ArgsFormat{}, a.String()},
+		{ArgsFormat{Off: true}, "..."},
+		{ArgsFormat{Decimal: true}, "0, 824633786368, 824633786368, 16, #1, #1, ..."},
+		{ArgsFormat{ElideZero: true}, "_, 0xc000010000, 0xc000010000, 0x10, #1, #1, ..."},
+		{ArgsFormat{CollapseRepeated: true}, "0, 0xc000010000 (x2), 0x10, #1 (x2), ..."},
+	}
+	for i, line := range data {
+		if got := a.Format(&line.f); got != line.want {
+			t.Fatalf("#%d: want %q, got %q", i, line.want, got)
+		}
+	}
+	empty := Args{}
+	if got := empty.Format(&ArgsFormat{Off: true}); got != "" {
+		t.Fatalf("unexpected %q", got)
+	}
+	p := Args{Processed: []string{"[]int(nil)", "[]int(nil)"}}
+	if got := p.Format(&ArgsFormat{CollapseRepeated: true, Decimal: true}); got != "[]int(nil) (x2)" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
 func TestFuncAnonymous(t *testing.T) {
 	t.Parallel()
 	f := Func{Raw: "main.func·001"}
@@ -326,6 +365,75 @@ func TestFuncGC(t *testing.T) {
 	compareBool(t, false, f.IsExported())
 }
 
+func TestFuncMethod(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		raw, receiver, typeParams, bareName string
+	}{
+		{"main.main", "", "", "main"},
+		{"gc", "", "", "gc"},
+		{"net/http.(*Server).Serve", "*Server", "", "Serve"},
+		{"net/http.(*Server).Serve.func1", "*Server", "", "Serve.func1"},
+		{"net/http.serverHandler.ServeHTTP", "serverHandler", "", "ServeHTTP"},
+		{"main.(*T).M-fm", "*T", "", "M-fm"},
+		{"main.Fn.func1", "", "", "Fn.func1"},
+		{"main.Fn.func1.2", "", "", "Fn.func1.2"},
+		{"main.glob..func1", "", "", "glob..func1"},
+		{"main.init.0", "", "", "init.0"},
+		{"gopkg.in/yaml%2ev2.Marshal", "", "", "Marshal"},
+		{"example.com/x.Fn[go.shape.int]", "", "go.shape.int", "Fn"},
+		{"example.com/x.Fn[go.shape.*example.com/y.T]", "", "go.shape.*example.com/y.T", "Fn"},
+		{"example.com/x.Fn[...]", "", "...", "Fn"},
+		{"example.com/x.List[...].Len", "List", "...", "Len"},
+		{"example.com/x.(*List[go.shape.int]).Push", "*List", "go.shape.int", "Push"},
+		{"example.com/x.Map[go.shape.string,go.shape.int].Get.func1", "Map", "go.shape.string,go.shape.int", "Get.func1"},
+	}
+	for i, line := range data {
+		f := Func{Raw: line.raw}
+		if r := f.Receiver(); r != line.receiver {
+			t.Fatalf("#%d: %s: want receiver %q, got %q", i, line.raw, line.receiver, r)
+		}
+		if p := f.TypeParams(); p != line.typeParams {
+			t.Fatalf("#%d: %s: want type params %q, got %q", i, line.raw, line.typeParams, p)
+		}
+		if n := f.BareName(); n != line.bareName {
+			t.Fatalf("#%d: %s: want name %q, got %q", i, line.raw, line.bareName, n)
+		}
+	}
+}
+
+func TestSignatureTestName(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		calls     []string
+		createdBy string
+		want      string
+	}{
+		{[]string{"foo.helper", "foo.TestFoo", "testing.tRunner"}, "testing.(*T).Run", "TestFoo"},
+		{[]string{"foo.TestFoo.func1", "testing.tRunner"}, "testing.(*T).Run", "TestFoo"},
+		{[]string{"foo.Test_bar", "testing.tRunner"}, "testing.(*T).Run", "Test_bar"},
+		{[]string{"foo.BenchmarkFoo", "testing.(*B).runN", "testing.(*B).run1.func1"}, "testing.(*B).run1", "BenchmarkFoo"},
+		{[]string{"foo.ExampleFoo", "testing.runExample", "testing.runExamples", "main.main"}, "", "ExampleFoo"},
+		// Elided before tRunner.
+		{[]string{"foo.recurse", "foo.TestFoo"}, "testing.(*T).Run", "TestFoo"},
+		// Created by a test.
+		{[]string{"foo.worker"}, "foo.TestFoo.func2", "TestFoo"},
+		{[]string{"foo.worker"}, "foo.startWorkers", ""},
+		{[]string{"foo.Testing", "testing.tRunner"}, "testing.(*T).Run", ""},
+		{[]string{"foo.(*TestSuite).Run", "testing.tRunner"}, "testing.(*T).Run", ""},
+		{[]string{"main.main"}, "", ""},
+	}
+	for i, line := range data {
+		s := Signature{CreatedBy: Call{Func: newFunc(line.createdBy)}}
+		for _, c := range line.calls {
+			s.Stack.Calls = append(s.Stack.Calls, Call{Func: newFunc(c)})
+		}
+		if got := s.TestName(); got != line.want {
+			t.Fatalf("#%d: want %q, got %q", i, line.want, got)
+		}
+	}
+}
+
 func TestSignature(t *testing.T) {
 	t.Parallel()
 	s := getSignature()
@@ -344,6 +452,62 @@ func TestSignature(t *testing.T) {
 	compareString(t, "DoStuff @ /gopath/src/foo/bar.go:72", s.CreatedByString(true))
 }
 
+func TestSignature_Hash(t *testing.T) {
+	t.Parallel()
+	s := getSignature()
+	h := s.Hash()
+	// The values, the flags and the durations are not hashed.
+	r := getSignature()
+	r.Stack.Calls[0].Args.Values[1].Value = 3
+	r.Locked = true
+	r.SleepMax = 10
+	if r.Hash() != h {
+		t.Fatal("expected same hash")
+	}
+	r.Stack.Calls[0].Line = 73
+	if r.Hash() == h {
+		t.Fatal("expected different hash")
+	}
+	r = getSignature()
+	r.Stack.Calls[0].Args.Values = r.Stack.Calls[0].Args.Values[:1]
+	if r.Hash() == h {
+		t.Fatal("expected different hash")
+	}
+	r = getSignature()
+	r.State = "chan send"
+	if r.Hash() == h {
+		t.Fatal("expected different hash")
+	}
+}
+
+func TestSignature_WaitRange(t *testing.T) {
+	t.Parallel()
+	s := getSignature()
+	if min, max := s.WaitRange(); min != 0 || max != 0 {
+		t.Fatalf("unexpected %s, %s", min, max)
+	}
+	s.SleepMin = 1
+	s.SleepMax = 10
+	if min, max := s.WaitRange(); min != time.Minute || max != 10*time.Minute {
+		t.Fatalf("unexpected %s, %s", min, max)
+	}
+
+	// Merging a signature with a finer granularity.
+	r := getSignature()
+	r.WaitMin = 30 * time.Second
+	r.WaitMax = 30 * time.Second
+	m := s.merge(r)
+	if min, max := m.WaitRange(); min != 30*time.Second || max != 10*time.Minute {
+		t.Fatalf("unexpected %s, %s", min, max)
+	}
+	if m.SleepMin != 0 || m.SleepMax != 10 {
+		t.Fatalf("unexpected %d, %d", m.SleepMin, m.SleepMax)
+	}
+	if s.equal(r) {
+		t.Fatal("inequal")
+	}
+}
+
 func TestSignature_Equal(t *testing.T) {
 	t.Parallel()
 	s1 := getSignature()
@@ -519,6 +683,16 @@ func zapArgs(t *testing.T, a, b *Args) {
 
 func compareGoroutines(t *testing.T, want, got []*Goroutine) {
 	helper(t)()
+	// The positions in the input are tested in TestParseDumpPositions.
+	if got != nil {
+		g := make([]*Goroutine, len(got))
+		for i := range got {
+			c := *got[i]
+			c.StartLine, c.EndLine, c.Start, c.End = 0, 0, 0, 0
+			g[i] = &c
+		}
+		got = g
+	}
 	if diff := cmp.Diff(want, got); diff != "" {
 		t.Fatalf("Goroutine mismatch (-want +got):\n%s", diff)
 	}
@@ -0,0 +1,216 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maruel/panicparse/internal/htmlstack"
+	"github.com/maruel/panicparse/stack"
+)
+
+// CollectorHandler returns a http.HandlerFunc that collects the stack dumps
+// pushed to it, e.g. by crashing jobs, sidecars or CI, and serves them. This
+// turns webstack into a lightweight crash collection server.
+//
+// It must be registered on a subtree, e.g. "/crashes/":
+//
+// POST "/crashes/" with a raw stack dump as the body stores it. The response
+// is 201 Created with the URL of the dump in the Location header. The
+// "source" query value, e.g. "/crashes/?source=job-1234", tells where the dump
+// comes from; it defaults to the remote address. For example:
+//
+//   curl --data-binary @crash.txt http://localhost:6060/crashes/?source=ci
+//
+// GET "/crashes/" lists the dumps stored, the most recent first, with a chart
+// of the total number of goroutines and of the largest buckets over time, to
+// confirm a leak. Push the dumps of a process periodically to track it. The
+// "source" form value, e.g. "/crashes/?source=job-1234", only lists the dumps
+// from this source.
+//
+// GET "/crashes/<id>" serves the goroutines of a dump. It accepts the same
+// form values as ContextHandler except src, since the source paths come from
+// the dump.
+//
+// GET "/crashes/<id>/raw" returns the dump as it was received.
+// "/crashes/<id>/export.csv" and ".../export.tsv" return its buckets as for
+// SnapshotHandler.
+//
+// The dumps are kept in memory. At most max dumps are kept, the oldest ones
+// are dropped first; 0 means no limit. A dump larger than 64MiB is rejected.
+func CollectorHandler(max int) http.HandlerFunc {
+	return CollectorHandlerWithStore(NewMemoryStore(), max)
+}
+
+// CollectorHandlerWithStore is like CollectorHandler except that the dumps
+// are stored in s, e.g. a DiskStore to keep them across restarts.
+func CollectorHandlerWithStore(s SnapshotStore, max int) http.HandlerFunc {
+	c := &collector{store: s, max: max, now: time.Now}
+	return c.serveHTTP
+}
+
+// maxDumpSize is the maximum size of a dump accepted by CollectorHandler.
+const maxDumpSize = 64 << 20
+
+// collector serves the stack dumps received.
+type collector struct {
+	store SnapshotStore
+	max   int
+	now   func() time.Time
+}
+
+func (c *collector) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "POST":
+		c.post(w, req)
+	case "GET":
+		raw, export := isRaw(req), exportFormat(req) != 0
+		p := req.URL.Path
+		if i := strings.LastIndex(p, "/bucket/"); i != -1 {
+			p = p[:i]
+		}
+		p = strings.TrimSuffix(p, "/")
+		if raw {
+			p = strings.TrimSuffix(p, "/raw")
+		} else if export {
+			p = path.Dir(p)
+		}
+		id, err := strconv.Atoi(path.Base(p))
+		if err != nil {
+			if raw || export {
+				http.Error(w, "dump not found", http.StatusNotFound)
+				return
+			}
+			c.list(w, req)
+			return
+		}
+		b, err := c.store.Get(id)
+		if err == ErrNotFound {
+			http.Error(w, "dump not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "failed to load the dump", http.StatusInternalServerError)
+			return
+		}
+		if raw {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			out, done := compress(w, req)
+			_, _ = out.Write(b)
+			done()
+			return
+		}
+		ctx, err := stack.ParseDump(bytes.NewReader(b), ioutil.Discard, false)
+		if err != nil || ctx == nil {
+			http.Error(w, "failed to parse the dump", http.StatusInternalServerError)
+			return
+		}
+		// The source paths are the ones of the host that sent the dump, never
+		// read them.
+		serveBuckets(w, req, nil, ctx.Goroutines, nil, &htmlstack.Opts{}, false)
+	default:
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+// post parses and stores the stack dump in the request body.
+func (c *collector) post(w http.ResponseWriter, req *http.Request) {
+	raw, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxDumpSize))
+	if err != nil {
+		http.Error(w, "failed to read the stack dump", http.StatusRequestEntityTooLarge)
+		return
+	}
+	// The paths are the ones of the host that crashed, don't look for them
+	// locally.
+	ctx, err := stack.ParseDump(bytes.NewReader(raw), ioutil.Discard, false)
+	if err != nil || ctx == nil {
+		http.Error(w, "no stack dump found", http.StatusBadRequest)
+		return
+	}
+	// Don't use FormValue() since it would try to parse the body as a form.
+	src := req.URL.Query().Get("source")
+	if src == "" {
+		src = req.RemoteAddr
+	}
+	info := NewSnapshotInfo(ctx, src, c.now())
+	if err := c.store.Put(info, raw); err != nil {
+		http.Error(w, "failed to store the stack dump", http.StatusInternalServerError)
+		return
+	}
+	if c.max > 0 {
+		// The dump is stored, don't fail the request.
+		_ = c.store.Prune(c.max)
+	}
+	u := basePath(req) + strings.TrimSuffix(req.URL.Path, "/") + "/" + strconv.Itoa(info.ID)
+	w.Header().Set("Location", u)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte(u + "\n"))
+}
+
+// list serves the list of the dumps, the most recent first, with a chart of
+// their number of goroutines. The "source" form value only lists the dumps
+// from this source.
+func (c *collector) list(w http.ResponseWriter, req *http.Request) {
+	dumps, err := c.store.List()
+	if err != nil {
+		http.Error(w, "failed to list the dumps", http.StatusInternalServerError)
+		return
+	}
+	src := req.FormValue("source")
+	if src != "" {
+		var f []SnapshotInfo
+		for _, d := range dumps {
+			if d.Source == src {
+				f = append(f, d)
+			}
+		}
+		dumps = f
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = collectorTpl.Execute(w, map[string]interface{}{
+		"Chart":  historyChart(dumps),
+		"Dumps":  dumps,
+		"Source": src,
+	})
+}
+
+// collectorTpl is the list of dumps. The links are relative to the subtree
+// the handler is registered on.
+var collectorTpl = template.Must(template.New("collector").Parse(`<!DOCTYPE html>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Stack dumps</title>
+<style>
+body { font-family: sans-serif; }
+td, th { padding: 0 1em 0 0; text-align: left; }
+svg { border: 1px solid #C0C0C0; margin: 0.5em 0; }
+.legend span { font-family: monospace; margin-right: 1em; }
+</style>
+<h1>{{len .Dumps}} stack dump{{if ne 1 (len .Dumps)}}s{{end}}{{with .Source}} from {{.}} <a href="?">(all)</a>{{end}}</h1>
+{{- with .Chart}}
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+{{- range .Series}}
+<polyline fill="none" stroke="{{.Color}}" stroke-width="2" points="{{.Points}}"><title>{{.Name}}</title></polyline>
+{{- end}}
+</svg>
+<div class="legend">Goroutines, up to {{.Max}}:
+{{- range .Series}} <span style="color: {{.Color}}">{{.Name}}</span>{{end}}</div>
+{{- end}}
+{{- if .Dumps}}
+<table>
+<tr><th>#</th><th>Received</th><th>Source</th><th>Goroutines</th><th>Panic</th><th></th></tr>
+{{- range .Dumps}}
+<tr><td><a href="{{.ID}}">{{.ID}}</a></td><td>{{.Received.Format "2006-01-02 15:04:05 MST"}}</td><td><a href="?source={{.Source}}">{{.Source}}</a></td><td>{{.Goroutines}}</td><td>{{.Panic}}</td><td><a href="{{.ID}}/raw">raw</a></td></tr>
+{{- end}}
+</table>
+{{- end}}
+`))
@@ -0,0 +1,107 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCollectorHandler(t *testing.T) {
+	t.Parallel()
+	h := CollectorHandler(2)
+	do := func(method, url, body string, code int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		if w.Code != code {
+			t.Fatalf("%s %s: want %d, got %d\n%s", method, url, code, w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	w := do("GET", "/crashes/", "", 200)
+	if b := w.Body.String(); !strings.Contains(b, "0 stack dumps") {
+		t.Fatalf("unexpected list:\n%s", b)
+	}
+
+	crash := "panic: boom\n\n" + proxyDump
+	w = do("POST", "/crashes/?source=ci", crash, http.StatusCreated)
+	if l := w.Header().Get("Location"); l != "/crashes/1" {
+		t.Fatalf("unexpected Location %q", l)
+	}
+	do("POST", "/crashes/", "not a stack dump", http.StatusBadRequest)
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/crashes/", strings.NewReader(proxyDump))
+	req.Header.Set("X-Forwarded-Prefix", "/svc")
+	if h(w, req); w.Code != http.StatusCreated || w.Header().Get("Location") != "/svc/crashes/2" {
+		t.Fatalf("unexpected Location %q", w.Header().Get("Location"))
+	}
+
+	w = do("GET", "/crashes/", "", 200)
+	b := w.Body.String()
+	for _, want := range []string{"2 stack dumps", `<a href="1">1</a>`, `<a href="?source=ci">ci</a>`, "<svg ", "<td>panic: boom</td>", `<a href="2/raw">raw</a>`} {
+		if !strings.Contains(b, want) {
+			t.Fatalf("%q not found in:\n%s", want, b)
+		}
+	}
+	if strings.Index(b, `<a href="2">`) > strings.Index(b, `<a href="1">`) {
+		t.Fatalf("expected the most recent first:\n%s", b)
+	}
+
+	w = do("GET", "/crashes/?source=ci", "", 200)
+	if b := w.Body.String(); !strings.Contains(b, "1 stack dump from ci") || strings.Contains(b, `<a href="2">`) || strings.Contains(b, "<svg ") {
+		t.Fatalf("unexpected list:\n%s", b)
+	}
+
+	w = do("GET", "/crashes/1?state=chan+receive", "", 200)
+	if b := w.Body.String(); !strings.Contains(b, "2 routines") || strings.Contains(b, "main.go:10") {
+		t.Fatalf("unexpected page:\n%s", b)
+	}
+	if w = do("GET", "/crashes/1/raw", "", 200); w.Body.String() != crash {
+		t.Fatalf("unexpected raw dump:\n%s", w.Body.String())
+	}
+	// The source paths come from the dump, they must not be read.
+	do("GET", "/crashes/1?src=3", "", 400)
+	do("GET", "/crashes/3", "", 404)
+	do("GET", "/crashes/raw", "", 404)
+	do("PUT", "/crashes/", "", 405)
+
+	// The oldest dump is dropped.
+	do("POST", "/crashes/", proxyDump, http.StatusCreated)
+	do("GET", "/crashes/1", "", 404)
+	do("GET", "/crashes/3", "", 200)
+}
+
+func TestCollectorHandlerWithStore(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "webstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	CollectorHandlerWithStore(s, 0)(w, httptest.NewRequest("POST", "/crashes/", strings.NewReader(proxyDump)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("%d\n%s", w.Code, w.Body.String())
+	}
+
+	// Simulate a restart.
+	if s, err = NewDiskStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	CollectorHandlerWithStore(s, 0)(w, httptest.NewRequest("GET", "/crashes/1/raw", nil))
+	if w.Code != 200 || w.Body.String() != proxyDump {
+		t.Fatalf("%d\n%s", w.Code, w.Body.String())
+	}
+}
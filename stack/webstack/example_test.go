@@ -78,3 +78,76 @@ func ExampleSnapshotHandler_complex() {
 	// Access as http://localhost:6060/debug/panicparse
 	log.Println(http.ListenAndServe("localhost:6060", nil))
 }
+
+func ExampleMetricsHandler() {
+	// Scrape with the Prometheus config:
+	//   metrics_path: /debug/panicparse/metrics
+	//   params:
+	//     minCount: ['10']
+	http.HandleFunc("/debug/panicparse/metrics", webstack.MetricsHandler)
+
+	log.Println(http.ListenAndServe("localhost:6060", nil))
+}
+
+func ExampleProxyHandler() {
+	// Aggregates the goroutines of all the replicas of a service.
+	c := &http.Client{Timeout: 10 * time.Second}
+	urls := []string{
+		"http://replica1:6060/debug/pprof/goroutine?debug=2",
+		"http://replica2:6060/debug/pprof/goroutine?debug=2",
+	}
+	http.HandleFunc("/debug/panicparse/fleet", webstack.ProxyHandler(c, urls))
+
+	// Access as http://localhost:6060/debug/panicparse/fleet
+	log.Println(http.ListenAndServe("localhost:6060", nil))
+}
+
+func ExampleCollectorHandler() {
+	// Keeps the last 100 stack dumps pushed by crashing jobs, e.g. with:
+	//   go test ./... 2>&1 | curl --data-binary @- http://localhost:6060/crashes/?source=ci
+	http.HandleFunc("/crashes/", webstack.CollectorHandler(100))
+
+	// Access as http://localhost:6060/crashes/
+	log.Println(http.ListenAndServe("localhost:6060", nil))
+}
+
+func ExampleCollectorHandlerWithStore() {
+	// Keeps the last 1000 stack dumps pushed across restarts.
+	s, err := webstack.NewDiskStore("/var/lib/crashes")
+	if err != nil {
+		log.Fatal(err)
+	}
+	http.HandleFunc("/crashes/", webstack.CollectorHandlerWithStore(s, 1000))
+
+	// Access as http://localhost:6060/crashes/
+	log.Println(http.ListenAndServe("localhost:6060", nil))
+}
+
+func ExampleWithBasePath() {
+	// Served behind a reverse proxy forwarding
+	// https://example.com/myservice/debug/panicparse to
+	// http://localhost:6060/debug/panicparse.
+	http.HandleFunc("/debug/panicparse", webstack.WithBasePath("/myservice", webstack.SnapshotHandler))
+
+	log.Println(http.ListenAndServe("localhost:6060", nil))
+}
+
+func ExampleTemplate() {
+	// Adds a dark theme and a banner to the page.
+	t := webstack.Template()
+	_, err := t.Parse(`
+{{define "head"}}<style>
+@media (prefers-color-scheme: dark) {
+  body { background-color: #202020; color: #E0E0E0; }
+  table.stack tr:hover { background-color: #404040; }
+}
+</style>{{end}}
+{{define "header"}}<h1>ACME production</h1>{{end}}`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	http.HandleFunc("/debug/panicparse", webstack.SnapshotHandlerWithTemplate(t))
+
+	// Access as http://localhost:6060/debug/panicparse
+	log.Println(http.ListenAndServe("localhost:6060", nil))
+}
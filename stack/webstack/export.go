@@ -0,0 +1,68 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// exportFormat returns the separator of the export requested as
+// ".../export.csv" or ".../export.tsv", or 0 if none.
+func exportFormat(req *http.Request) rune {
+	switch path.Base(req.URL.Path) {
+	case "export.csv":
+		return ','
+	case "export.tsv":
+		return '\t'
+	default:
+		return 0
+	}
+}
+
+// serveExport serves the buckets as CSV or TSV, one row per bucket.
+func serveExport(w http.ResponseWriter, req *http.Request, buckets []*stack.Bucket, sep rune) {
+	name := "goroutines.csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	if sep == '\t' {
+		name = "goroutines.tsv"
+		w.Header().Set("Content-Type", "text/tab-separated-values; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+name+"\"")
+	out, done := compress(w, req)
+	_ = writeExport(out, buckets, sep)
+	done()
+}
+
+// writeExport writes one row per bucket with its fingerprint, number of
+// goroutines, state, first call outside the standard library and wait range
+// in seconds.
+func writeExport(w io.Writer, buckets []*stack.Bucket, sep rune) error {
+	c := csv.NewWriter(w)
+	c.Comma = sep
+	_ = c.Write([]string{"fingerprint", "count", "state", "top_app_frame", "wait_min_seconds", "wait_max_seconds"})
+	for _, b := range buckets {
+		frame := ""
+		if call := b.Stack.AppCall(); call != nil {
+			frame = call.Func.PkgDotName() + " " + call.SrcLine()
+		}
+		min, max := b.WaitRange()
+		_ = c.Write([]string{
+			b.Fingerprint(),
+			strconv.Itoa(len(b.IDs)),
+			b.State,
+			frame,
+			strconv.FormatFloat(min.Seconds(), 'f', -1, 64),
+			strconv.FormatFloat(max.Seconds(), 'f', -1, 64),
+		})
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestWriteExport(t *testing.T) {
+	t.Parallel()
+	dump := "goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n\n" +
+		"goroutine 6 [chan receive, 3 minutes]:\n" +
+		"sync.(*Cond).Wait()\n" +
+		"\t/goroot/src/sync/cond.go:56 +0x20\n" +
+		"github.com/foo/bar.worker()\n" +
+		"\t/gopath/src/github.com/foo/bar/bar.go:20 +0x20\n\n"
+	c, err := stack.ParseDump(strings.NewReader(dump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets := stack.Aggregate(c.Goroutines, stack.AnyPointer)
+	var main, worker *stack.Bucket
+	for _, b := range buckets {
+		if b.State == "running" {
+			main = b
+		} else {
+			worker = b
+		}
+	}
+	var b bytes.Buffer
+	if err := writeExport(&b, []*stack.Bucket{main, worker}, '\t'); err != nil {
+		t.Fatal(err)
+	}
+	want := "fingerprint\tcount\tstate\ttop_app_frame\twait_min_seconds\twait_max_seconds\n" +
+		main.Fingerprint() + "\t1\trunning\tmain.main main.go:10\t0\t0\n" +
+		worker.Fingerprint() + "\t1\tchan receive\tbar.worker bar.go:20\t180\t180\n"
+	if got := b.String(); got != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestContextHandler_Export(t *testing.T) {
+	t.Parallel()
+	c, err := stack.ParseDump(strings.NewReader(proxyDump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ContextHandler(c)
+	data := []struct {
+		url, contentType, header string
+		lines                    int
+	}{
+		{"/debug/export.csv", "text/csv; charset=utf-8", "fingerprint,count,", 3},
+		{"/debug/export.tsv?state=chan+receive", "text/tab-separated-values; charset=utf-8", "fingerprint\tcount\t", 2},
+	}
+	for _, line := range data {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", line.url, nil))
+		if w.Code != 200 {
+			t.Fatalf("%s: %d\n%s", line.url, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != line.contentType {
+			t.Fatalf("%s: unexpected Content-Type %q", line.url, ct)
+		}
+		b := w.Body.String()
+		if !strings.HasPrefix(b, line.header) {
+			t.Fatalf("%s: unexpected body:\n%s", line.url, b)
+		}
+		if l := strings.Count(b, "\n"); l != line.lines {
+			t.Fatalf("%s: want %d lines, got %d:\n%s", line.url, line.lines, l, b)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compress returns a writer compressing with gzip when the client accepts it,
+// otherwise w. The headers must be set before. done must be called once
+// finished writing.
+//
+// The page of a process with tens of thousands of goroutines is many
+// megabytes of repetitive HTML, which compresses very well.
+func compress(w http.ResponseWriter, req *http.Request) (out io.Writer, done func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(req) {
+		return w, func() {}
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	// Favor speed, the snapshot is taken while the request is waiting.
+	g, _ := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	return g, func() { _ = g.Close() }
+}
+
+// acceptsGzip returns true if the Accept-Encoding header accepts gzip.
+func acceptsGzip(req *http.Request) bool {
+	for _, v := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(v, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		// "q=0" means not acceptable.
+		for _, p := range parts[1:] {
+			if p = strings.TrimSpace(p); strings.HasPrefix(p, "q=") {
+				if q, err := strconv.ParseFloat(p[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
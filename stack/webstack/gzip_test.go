@@ -0,0 +1,74 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=1.0, *;q=0.5", true},
+		{"br", false},
+		{"gzip;q=0", false},
+		{"gzip; q=0.000", false},
+		{"x-gzip", false},
+	}
+	for _, line := range data {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", line.header)
+		if got := acceptsGzip(req); got != line.want {
+			t.Fatalf("%q: %t != %t", line.header, line.want, got)
+		}
+	}
+}
+
+func TestContextHandler_Gzip(t *testing.T) {
+	t.Parallel()
+	c, err := stack.ParseDump(strings.NewReader(proxyDump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	ContextHandler(c)(w, req)
+	if w.Code != 200 {
+		t.Fatalf("%d\n%s", w.Code, w.Body.String())
+	}
+	if e := w.Header().Get("Content-Encoding"); e != "gzip" {
+		t.Fatalf("unexpected Content-Encoding %q", e)
+	}
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "main.worker") || !strings.HasSuffix(strings.TrimSpace(string(b)), "</div>") {
+		t.Fatalf("unexpected page:\n%s", b)
+	}
+
+	// Not compressed when not accepted.
+	w = httptest.NewRecorder()
+	ContextHandler(c)(w, httptest.NewRequest("GET", "/", nil))
+	if e := w.Header().Get("Content-Encoding"); e != "" || !strings.Contains(w.Body.String(), "main.worker") {
+		t.Fatalf("unexpected response %q:\n%s", e, w.Body.String())
+	}
+}
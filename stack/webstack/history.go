@@ -0,0 +1,128 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// historyBuckets is the number of largest buckets whose goroutine count is
+// remembered in SnapshotInfo.Buckets.
+const historyBuckets = 10
+
+// chartBuckets is the number of buckets shown in the history chart.
+const chartBuckets = 5
+
+// Size of the history chart in pixels.
+const (
+	chartWidth  = 600
+	chartHeight = 150
+)
+
+// chartColors is the color of each series; the total first.
+var chartColors = []string{"#000000", "#C00000", "#00A000", "#0000C0", "#C08000", "#8000C0"}
+
+// largestBuckets returns the number of goroutines of the n largest buckets,
+// keyed by their short ID.
+func largestBuckets(goroutines []*stack.Goroutine, n int) map[string]int {
+	buckets := stack.Aggregate(goroutines, stack.AnyPointer)
+	sort.SliceStable(buckets, func(i, j int) bool { return len(buckets[i].IDs) > len(buckets[j].IDs) })
+	if len(buckets) > n {
+		buckets = buckets[:n]
+	}
+	out := make(map[string]int, len(buckets))
+	for _, b := range buckets {
+		out[b.ShortID()] = len(b.IDs)
+	}
+	return out
+}
+
+// chart is a time-series chart rendered as SVG.
+type chart struct {
+	Width, Height int
+	// Max is the largest value, the top of the chart.
+	Max    int
+	Series []series
+}
+
+// series is a line of the chart.
+type series struct {
+	Name  string
+	Color string
+	// Points is the SVG polyline points.
+	Points string
+}
+
+// historyChart returns the chart of the total number of goroutines and of the
+// largest buckets over time, or nil if there are fewer than two stack dumps.
+//
+// dumps is the most recent first, as returned by SnapshotStore.List.
+func historyChart(dumps []SnapshotInfo) *chart {
+	if len(dumps) < 2 {
+		return nil
+	}
+	// Oldest first.
+	d := make([]SnapshotInfo, len(dumps))
+	for i := range dumps {
+		d[len(dumps)-1-i] = dumps[i]
+	}
+	// Select the buckets with the most goroutines at any time.
+	peak := map[string]int{}
+	max := 1
+	for _, s := range d {
+		if s.Goroutines > max {
+			max = s.Goroutines
+		}
+		for id, n := range s.Buckets {
+			if n > peak[id] {
+				peak[id] = n
+			}
+		}
+	}
+	ids := make([]string, 0, len(peak))
+	for id := range peak {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if peak[ids[i]] != peak[ids[j]] {
+			return peak[ids[i]] > peak[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > chartBuckets {
+		ids = ids[:chartBuckets]
+	}
+
+	first, last := d[0].Received, d[len(d)-1].Received
+	span := last.Sub(first)
+	points := func(value func(s *SnapshotInfo) int) string {
+		p := make([]string, 0, len(d))
+		for i := range d {
+			x := 0.
+			if span > 0 {
+				x = float64(d[i].Received.Sub(first)) / float64(span) * chartWidth
+			} else {
+				// Same time, spread them evenly.
+				x = float64(i) / float64(len(d)-1) * chartWidth
+			}
+			y := chartHeight - float64(value(&d[i]))/float64(max)*chartHeight
+			p = append(p, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		return strings.Join(p, " ")
+	}
+	c := &chart{Width: chartWidth, Height: chartHeight, Max: max}
+	c.Series = append(c.Series, series{"total", chartColors[0], points(func(s *SnapshotInfo) int { return s.Goroutines })})
+	for i, id := range ids {
+		id := id
+		// A bucket missing from a stack dump is counted as 0, albeit it could be
+		// in it but not among the largest.
+		c.Series = append(c.Series, series{id, chartColors[i+1], points(func(s *SnapshotInfo) int { return s.Buckets[id] })})
+	}
+	return c
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestLargestBuckets(t *testing.T) {
+	t.Parallel()
+	c, err := stack.ParseDump(strings.NewReader(proxyDump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := largestBuckets(c.Goroutines, 1)
+	if len(got) != 1 {
+		t.Fatalf("unexpected %v", got)
+	}
+	for _, n := range got {
+		if n != 2 {
+			t.Fatalf("unexpected %v", got)
+		}
+	}
+}
+
+func TestHistoryChart(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(1000, 0)
+	if c := historyChart([]SnapshotInfo{{Received: now, Goroutines: 1}}); c != nil {
+		t.Fatalf("unexpected chart %v", c)
+	}
+	// Most recent first.
+	dumps := []SnapshotInfo{
+		{Received: now.Add(2 * time.Minute), Goroutines: 100, Buckets: map[string]int{"leak": 90, "ok": 5}},
+		{Received: now.Add(time.Minute), Goroutines: 50, Buckets: map[string]int{"leak": 40}},
+		{Received: now, Goroutines: 10, Buckets: map[string]int{"ok": 5, "leak": 2}},
+	}
+	want := &chart{
+		Width:  600,
+		Height: 150,
+		Max:    100,
+		Series: []series{
+			{"total", "#000000", "0.0,135.0 300.0,75.0 600.0,0.0"},
+			{"leak", "#C00000", "0.0,147.0 300.0,90.0 600.0,15.0"},
+			{"ok", "#00A000", "0.0,142.5 300.0,150.0 600.0,142.5"},
+		},
+	}
+	if got := historyChart(dumps); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %#v\ngot  %#v", want, got)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// MetricsHandler implements http.HandlerFunc to return metrics about a
+// snapshot of the current goroutines in the Prometheus text exposition
+// format, so a goroutine leak can trigger an alert.
+//
+// The metrics are:
+//   - panicparse_goroutines{state}: the number of goroutines per state.
+//   - panicparse_bucket_goroutines{bucket,state,func}: the number of
+//     goroutines per bucket, labeled with the bucket short ID, its state and
+//     its top function.
+//   - panicparse_bucket_wait_max_seconds{bucket}: the longest time a
+//     goroutine of the bucket has been waiting, for the buckets waiting for
+//     at least a minute.
+//
+// It accepts the maxmem, similarity, top, minCount and state form values of
+// SnapshotHandler. The totals per state are not affected by the filtering.
+// Use minCount to limit the number of series, e.g. "?minCount=10".
+func MetricsHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	maxmem := 64 << 20
+	if s := req.FormValue("maxmem"); s != "" {
+		var err error
+		if maxmem, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "invalid maxmem value", http.StatusBadRequest)
+			return
+		}
+	}
+	s, err := similarity(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := filterOpts(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c, err := stack.ParseDump(bytes.NewReader(snapshot(maxmem)), ioutil.Discard, false)
+	if err != nil || c == nil {
+		http.Error(w, "failed to process the snapshot, try a larger maxmem value", http.StatusInternalServerError)
+		return
+	}
+	buckets := stack.Buckets(stack.Aggregate(c.Goroutines, s)).Filter(opts)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = writeMetrics(w, c.Goroutines, buckets)
+}
+
+// writeMetrics writes the metrics in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, goroutines []*stack.Goroutine, buckets []*stack.Bucket) error {
+	states := map[string]int{}
+	for _, g := range goroutines {
+		states[g.State]++
+	}
+	keys := make([]string, 0, len(states))
+	for k := range states {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	b.WriteString("# HELP panicparse_goroutines Number of goroutines per state.\n")
+	b.WriteString("# TYPE panicparse_goroutines gauge\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "panicparse_goroutines{state=\"%s\"} %d\n", escapeLabel(k), states[k])
+	}
+	b.WriteString("# HELP panicparse_bucket_goroutines Number of goroutines per bucket.\n")
+	b.WriteString("# TYPE panicparse_bucket_goroutines gauge\n")
+	for _, bucket := range buckets {
+		f := ""
+		if len(bucket.Stack.Calls) != 0 {
+			f = bucket.Stack.Calls[0].Func.PkgDotName()
+		}
+		fmt.Fprintf(&b, "panicparse_bucket_goroutines{bucket=\"%s\",state=\"%s\",func=\"%s\"} %d\n", bucket.ShortID(), escapeLabel(bucket.State), escapeLabel(f), len(bucket.IDs))
+	}
+	b.WriteString("# HELP panicparse_bucket_wait_max_seconds Longest wait of the goroutines of a bucket.\n")
+	b.WriteString("# TYPE panicparse_bucket_wait_max_seconds gauge\n")
+	for _, bucket := range buckets {
+		if _, max := bucket.WaitRange(); max != 0 {
+			fmt.Fprintf(&b, "panicparse_bucket_wait_max_seconds{bucket=\"%s\"} %g\n", bucket.ShortID(), max.Seconds())
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// escapeLabel escapes a label value as required by the Prometheus text
+// exposition format.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	t.Parallel()
+	dump := "goroutine 1 [running]:\n" +
+		"main.main()\n" +
+		"\t/gopath/src/foo/main.go:10 +0x20\n\n" +
+		"goroutine 6 [chan receive, 3 minutes]:\n" +
+		"main.worker()\n" +
+		"\t/gopath/src/foo/main.go:20 +0x20\n\n" +
+		"goroutine 7 [chan receive, 5 minutes]:\n" +
+		"main.worker()\n" +
+		"\t/gopath/src/foo/main.go:20 +0x20\n\n"
+	c, err := stack.ParseDump(strings.NewReader(dump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets := stack.Aggregate(c.Goroutines, stack.AnyPointer)
+	var b bytes.Buffer
+	if err := writeMetrics(&b, c.Goroutines, buckets); err != nil {
+		t.Fatal(err)
+	}
+	var worker, main *stack.Bucket
+	for _, bucket := range buckets {
+		if bucket.State == "running" {
+			main = bucket
+		} else {
+			worker = bucket
+		}
+	}
+	want := "# HELP panicparse_goroutines Number of goroutines per state.\n" +
+		"# TYPE panicparse_goroutines gauge\n" +
+		"panicparse_goroutines{state=\"chan receive\"} 2\n" +
+		"panicparse_goroutines{state=\"running\"} 1\n" +
+		"# HELP panicparse_bucket_goroutines Number of goroutines per bucket.\n" +
+		"# TYPE panicparse_bucket_goroutines gauge\n"
+	for _, bucket := range buckets {
+		if bucket == main {
+			want += "panicparse_bucket_goroutines{bucket=\"" + main.ShortID() + "\",state=\"running\",func=\"main.main\"} 1\n"
+		} else {
+			want += "panicparse_bucket_goroutines{bucket=\"" + worker.ShortID() + "\",state=\"chan receive\",func=\"main.worker\"} 2\n"
+		}
+	}
+	want += "# HELP panicparse_bucket_wait_max_seconds Longest wait of the goroutines of a bucket.\n" +
+		"# TYPE panicparse_bucket_wait_max_seconds gauge\n" +
+		"panicparse_bucket_wait_max_seconds{bucket=\"" + worker.ShortID() + "\"} 300\n"
+	if got := b.String(); got != want {
+		t.Fatalf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestMetricsHandler_Err(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		method, url string
+		code        int
+	}{
+		{"POST", "/metrics", 405},
+		{"GET", "/metrics?maxmem=abc", 400},
+		{"GET", "/metrics?similarity=alike", 400},
+		{"GET", "/metrics?mincount=-1", 400},
+	}
+	for _, line := range data {
+		w := httptest.NewRecorder()
+		MetricsHandler(w, httptest.NewRequest(line.method, line.url, nil))
+		if w.Code != line.code {
+			t.Fatalf("%s %s: %d\n%s", line.method, line.url, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	t.Parallel()
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Fatalf("unexpected %q", got)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maruel/panicparse/internal/htmlstack"
+	"github.com/maruel/panicparse/internal/origin"
+	"github.com/maruel/panicparse/stack"
+)
+
+// ProxyHandler returns a http.HandlerFunc that fetches the stack dumps of
+// multiple processes, e.g. all the replicas of a service, and serves their
+// goroutines aggregated together with the number of goroutines of each bucket
+// per host.
+//
+// urls are fetched concurrently on each request. Each must return a text
+// stack dump, e.g. "http://host1:6060/debug/pprof/goroutine?debug=2" served by
+// net/http/pprof or ".../raw" served by SnapshotHandler. The hosts that
+// couldn't be fetched are listed at the top of the page.
+//
+// It accepts the same form values as ContextHandler except src, since the
+// source paths are the ones of the remote hosts. c is used to fetch the
+// URLs; a client with a 30 seconds timeout is used if nil.
+func ProxyHandler(c *http.Client, urls []string) http.HandlerFunc {
+	if c == nil {
+		c = &http.Client{Timeout: 30 * time.Second}
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+			return
+		}
+		m := fetchAll(c, req, urls)
+		if len(m.errs) == len(urls) {
+			http.Error(w, "failed to fetch the stack dumps:\n"+strings.Join(m.errs, "\n"), http.StatusBadGateway)
+			return
+		}
+		serveBuckets(w, req, nil, m.goroutines, m.hosts, &htmlstack.Opts{Annotate: m.hosts.Annotate, Errors: m.errs}, false)
+	}
+}
+
+// merged is the goroutines of multiple stack dumps.
+type merged struct {
+	goroutines []*stack.Goroutine
+	// hosts is the host of each goroutine.
+	hosts *origin.Origins
+	errs  []string
+}
+
+// fetchAll fetches and parses the stack dumps concurrently.
+//
+// The goroutines have temporary IDs since their IDs collide across processes,
+// call hosts.Restore() once they are aggregated.
+func fetchAll(c *http.Client, req *http.Request, urls []string) *merged {
+	contexts := make([]*stack.Context, len(urls))
+	errs := make([]error, len(urls))
+	var wg sync.WaitGroup
+	for i := range urls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			contexts[i], errs[i] = fetch(c, req, urls[i])
+		}(i)
+	}
+	wg.Wait()
+
+	m := &merged{hosts: &origin.Origins{}}
+	for i, u := range urls {
+		if errs[i] != nil {
+			m.errs = append(m.errs, fmt.Sprintf("%s: %v", u, errs[i]))
+			continue
+		}
+		m.hosts.Add(hostName(urls, i), contexts[i].Goroutines)
+		m.goroutines = append(m.goroutines, contexts[i].Goroutines...)
+	}
+	sort.Strings(m.errs)
+	return m
+}
+
+// fetch fetches and parses a stack dump. The request is canceled when req is.
+func fetch(c *http.Client, req *http.Request, u string) (*stack.Context, error) {
+	r, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(r.WithContext(req.Context()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	// The paths are the ones of the remote host, don't look for them locally.
+	ctx, err := stack.ParseDump(resp.Body, ioutil.Discard, false)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		return nil, errors.New("no stack dump found")
+	}
+	return ctx, nil
+}
+
+// hostName returns the host of urls[i], or the whole URL if another URL has
+// the same host.
+func hostName(urls []string, i int) string {
+	h := func(s string) string {
+		if u, err := url.Parse(s); err == nil && u.Host != "" {
+			return u.Host
+		}
+		return s
+	}
+	name := h(urls[i])
+	for j := range urls {
+		if j != i && h(urls[j]) == name {
+			return urls[i]
+		}
+	}
+	return name
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+const proxyDump = "goroutine 1 [running]:\n" +
+	"main.main()\n" +
+	"\t/gopath/src/foo/main.go:10 +0x20\n\n" +
+	"goroutine 6 [chan receive]:\n" +
+	"main.worker()\n" +
+	"\t/gopath/src/foo/main.go:20 +0x20\n\n" +
+	"goroutine 7 [chan receive]:\n" +
+	"main.worker()\n" +
+	"\t/gopath/src/foo/main.go:20 +0x20\n\n"
+
+func TestProxyHandler(t *testing.T) {
+	t.Parallel()
+	dump := func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, proxyDump)
+	}
+	s1 := httptest.NewServer(http.HandlerFunc(dump))
+	defer s1.Close()
+	s2 := httptest.NewServer(http.HandlerFunc(dump))
+	defer s2.Close()
+	s3 := httptest.NewServer(http.NotFoundHandler())
+	defer s3.Close()
+	h1 := strings.TrimPrefix(s1.URL, "http://")
+	h2 := strings.TrimPrefix(s2.URL, "http://")
+
+	h := ProxyHandler(nil, []string{s1.URL + "/debug", s2.URL + "/debug", s3.URL + "/debug"})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/?state=chan+receive", nil))
+	if w.Code != 200 {
+		t.Fatalf("%d\n%s", w.Code, w.Body.String())
+	}
+	b := w.Body.String()
+	for _, want := range []string{
+		"4 routines",
+		"(" + h1 + ": 2, " + h2 + ": 2)",
+		"<li>" + s3.URL + "/debug: 404 Not Found</li>",
+	} {
+		if !strings.Contains(b, want) {
+			t.Fatalf("%q not found in:\n%s", want, b)
+		}
+	}
+	if strings.Contains(b, "main.go:10") {
+		t.Fatalf("unexpected running bucket:\n%s", b)
+	}
+
+	// The source paths are the ones of the remote hosts, they must not be read.
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/?src=3", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("src: %d", w.Code)
+	}
+
+	// All failed.
+	w = httptest.NewRecorder()
+	ProxyHandler(nil, []string{s3.URL})(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("%d\n%s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: %d", w.Code)
+	}
+}
+
+func TestFetchAll(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, proxyDump)
+	}))
+	defer s.Close()
+	m := fetchAll(http.DefaultClient, httptest.NewRequest("GET", "/", nil), []string{s.URL + "/a", s.URL + "/b"})
+	if len(m.errs) != 0 {
+		t.Fatal(m.errs)
+	}
+	buckets := stack.Aggregate(m.goroutines, stack.AnyPointer)
+	m.hosts.Restore(m.goroutines, buckets)
+	// The original IDs are kept.
+	var ids []int
+	for _, g := range m.goroutines {
+		ids = append(ids, g.ID)
+	}
+	if want := []int{1, 6, 7, 1, 6, 7}; !reflect.DeepEqual(want, ids) {
+		t.Fatalf("%v != %v", want, ids)
+	}
+	if want := []int{6, 6, 7, 7}; !reflect.DeepEqual(want, buckets[1].IDs) {
+		t.Fatalf("%v != %v", want, buckets[1].IDs)
+	}
+	if a := m.hosts.Annotate(buckets[1]); a != s.URL+"/a: 2, "+s.URL+"/b: 2" {
+		t.Fatalf("unexpected %q", a)
+	}
+}
+
+func TestHostName(t *testing.T) {
+	t.Parallel()
+	urls := []string{"http://a:6060/debug", "http://b:6060/x", "http://b:6060/y", "junk"}
+	want := []string{"a:6060", "http://b:6060/x", "http://b:6060/y", "junk"}
+	for i := range urls {
+		if got := hostName(urls, i); got != want[i] {
+			t.Fatalf("#%d: %q != %q", i, want[i], got)
+		}
+	}
+}
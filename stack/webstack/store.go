@@ -0,0 +1,270 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+// ErrNotFound is returned by SnapshotStore.Get when the snapshot doesn't
+// exist.
+var ErrNotFound = errors.New("snapshot not found")
+
+// SnapshotInfo is the metadata of a stored stack dump.
+type SnapshotInfo struct {
+	// ID is assigned by SnapshotStore.Put. IDs are increasing.
+	ID       int
+	Received time.Time
+	// Source is where the stack dump comes from, e.g. a host or a job name.
+	Source string
+	// Panic is the last panic message, if any.
+	Panic      string
+	Goroutines int
+	// Buckets is the number of goroutines of the largest buckets, keyed by
+	// their short ID. It is used to chart their evolution.
+	Buckets map[string]int `json:",omitempty"`
+}
+
+// NewSnapshotInfo returns the metadata of the parsed stack dump c, to store
+// it with SnapshotStore.Put.
+func NewSnapshotInfo(c *stack.Context, source string, received time.Time) *SnapshotInfo {
+	info := &SnapshotInfo{
+		Received:   received,
+		Source:     source,
+		Goroutines: len(c.Goroutines),
+		Buckets:    largestBuckets(c.Goroutines, historyBuckets),
+	}
+	if len(c.Panics) != 0 {
+		p := c.Panics[len(c.Panics)-1]
+		info.Panic = p.Kind + ": " + p.Message
+	}
+	return info
+}
+
+// SnapshotStore stores raw stack dumps, e.g. the ones received by
+// CollectorHandler.
+//
+// Implementations must be safe for concurrent use.
+type SnapshotStore interface {
+	// Put stores the stack dump and sets info.ID.
+	Put(info *SnapshotInfo, raw []byte) error
+	// List returns the metadata of the stack dumps stored, the most recent
+	// first.
+	List() ([]SnapshotInfo, error)
+	// Get returns the raw stack dump, or ErrNotFound.
+	Get(id int) ([]byte, error)
+	// Prune deletes the oldest stack dumps to keep at most keep of them.
+	Prune(keep int) error
+}
+
+// MemoryStore is a SnapshotStore keeping the stack dumps in memory. They are
+// lost when the process exits.
+type MemoryStore struct {
+	mu     sync.Mutex
+	lastID int
+	// dumps is in the order stored.
+	dumps []memoryDump
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Put implements SnapshotStore.
+func (m *MemoryStore) Put(info *SnapshotInfo, raw []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	info.ID = m.lastID
+	m.dumps = append(m.dumps, memoryDump{*info, raw})
+	return nil
+}
+
+// List implements SnapshotStore.
+func (m *MemoryStore) List() ([]SnapshotInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]SnapshotInfo, 0, len(m.dumps))
+	for i := len(m.dumps) - 1; i >= 0; i-- {
+		out = append(out, m.dumps[i].info)
+	}
+	return out, nil
+}
+
+// Get implements SnapshotStore.
+func (m *MemoryStore) Get(id int) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.dumps {
+		if d.info.ID == id {
+			return d.raw, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Prune implements SnapshotStore.
+func (m *MemoryStore) Prune(keep int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.dumps) > keep {
+		// Copy so the memory of the dropped dumps can be reclaimed.
+		m.dumps = append([]memoryDump(nil), m.dumps[len(m.dumps)-keep:]...)
+	}
+	return nil
+}
+
+// DiskStore is a SnapshotStore keeping the stack dumps in a directory, so
+// they are kept across restarts.
+//
+// Each stack dump is stored as "<id>.txt", along with its metadata as
+// "<id>.json".
+type DiskStore struct {
+	dir string
+
+	mu     sync.Mutex
+	lastID int
+}
+
+// NewDiskStore returns a DiskStore storing the stack dumps in dir, which is
+// created if needed. The stack dumps already in dir are kept.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	d := &DiskStore{dir: dir}
+	ids, err := d.ids()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != 0 {
+		d.lastID = ids[len(ids)-1]
+	}
+	return d, nil
+}
+
+// Put implements SnapshotStore.
+func (d *DiskStore) Put(info *SnapshotInfo, raw []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := *info
+	i.ID = d.lastID + 1
+	meta, err := json.Marshal(&i)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(d.path(i.ID, ".txt"), raw, 0600); err != nil {
+		return err
+	}
+	// Write the metadata last, since the stack dumps are listed by it.
+	if err := ioutil.WriteFile(d.path(i.ID, ".json"), meta, 0600); err != nil {
+		_ = os.Remove(d.path(i.ID, ".txt"))
+		return err
+	}
+	d.lastID = i.ID
+	info.ID = i.ID
+	return nil
+}
+
+// List implements SnapshotStore.
+func (d *DiskStore) List() ([]SnapshotInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids, err := d.ids()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SnapshotInfo, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		b, err := ioutil.ReadFile(d.path(ids[i], ".json"))
+		if err != nil {
+			return nil, err
+		}
+		var info SnapshotInfo
+		if err := json.Unmarshal(b, &info); err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// Get implements SnapshotStore.
+func (d *DiskStore) Get(id int) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := os.Stat(d.path(id, ".json")); os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	b, err := ioutil.ReadFile(d.path(id, ".txt"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+// Prune implements SnapshotStore.
+func (d *DiskStore) Prune(keep int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids, err := d.ids()
+	if err != nil {
+		return err
+	}
+	for len(ids) > keep {
+		// Remove the metadata first, so a partially deleted stack dump is not
+		// listed.
+		if err := os.Remove(d.path(ids[0], ".json")); err != nil {
+			return err
+		}
+		if err := os.Remove(d.path(ids[0], ".txt")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// Private stuff.
+
+type memoryDump struct {
+	info SnapshotInfo
+	raw  []byte
+}
+
+// path returns the path of a file of the stack dump.
+func (d *DiskStore) path(id int, ext string) string {
+	return filepath.Join(d.dir, strconv.Itoa(id)+ext)
+}
+
+// ids returns the IDs of the stack dumps stored, in increasing order.
+func (d *DiskStore) ids() ([]int, error) {
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, e := range entries {
+		if n := e.Name(); strings.HasSuffix(n, ".json") {
+			if id, err := strconv.Atoi(strings.TrimSuffix(n, ".json")); err == nil && id > 0 {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
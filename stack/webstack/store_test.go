@@ -0,0 +1,102 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package webstack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	testStore(t, NewMemoryStore())
+}
+
+func TestDiskStore(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "webstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	// The stack dumps and the IDs are kept across restarts.
+	if s, err = NewDiskStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	l, err := s.List()
+	if err != nil || len(l) != 2 || l[0].ID != 3 || l[0].Source != "c" {
+		t.Fatalf("unexpected list %v, %v", l, err)
+	}
+	info := &SnapshotInfo{}
+	if err := s.Put(info, []byte("d")); err != nil || info.ID != 4 {
+		t.Fatalf("unexpected ID %d, %v", info.ID, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "4.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testStore tests a SnapshotStore, which must be empty.
+func testStore(t *testing.T, s SnapshotStore) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i, src := range []string{"a", "b", "c"} {
+		info := &SnapshotInfo{Received: now, Source: src, Goroutines: i}
+		if err := s.Put(info, []byte(src+" dump")); err != nil {
+			t.Fatal(err)
+		}
+		if info.ID != i+1 {
+			t.Fatalf("unexpected ID %d", info.ID)
+		}
+	}
+	l, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 3 || l[0].ID != 3 || l[2].ID != 1 || l[1].Source != "b" || l[1].Goroutines != 1 || !l[1].Received.Equal(now) {
+		t.Fatalf("unexpected list %v", l)
+	}
+	if b, err := s.Get(2); err != nil || string(b) != "b dump" {
+		t.Fatalf("unexpected dump %q, %v", b, err)
+	}
+	if _, err := s.Get(4); err != ErrNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := s.Prune(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(1); err != ErrNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if l, err = s.List(); err != nil || len(l) != 2 || l[1].ID != 2 {
+		t.Fatalf("unexpected list %v, %v", l, err)
+	}
+}
+
+func TestNewSnapshotInfo(t *testing.T) {
+	t.Parallel()
+	c, err := stack.ParseDump(strings.NewReader(
+		"panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:10 +0x20\n"),
+		ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	info := NewSnapshotInfo(c, "job", now)
+	if info.Received != now || info.Source != "job" || info.Panic != "panic: boom" || info.Goroutines != 1 || len(info.Buckets) != 1 {
+		t.Fatalf("unexpected %#v", info)
+	}
+}
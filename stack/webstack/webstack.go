@@ -3,19 +3,30 @@
 // that can be found in the LICENSE file.
 
 // Package webstack provides a http.HandlerFunc that serves a snapshot similar
-// to net/http/pprof.Index().
+// to net/http/pprof.Index(), one that serves an already parsed stack dump,
+// one that aggregates the stack dumps of multiple processes, one that collects
+// the stack dumps pushed to it and one that exports metrics about the
+// goroutines for Prometheus.
 //
 // Contrary to net/http/pprof, the handler is not automatically registered.
 package webstack
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"html/template"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/maruel/panicparse/internal/htmlstack"
+	"github.com/maruel/panicparse/internal/origin"
 	"github.com/maruel/panicparse/stack"
 )
 
@@ -28,9 +39,19 @@ import (
 // The implementation is designed to be reasonably fast, it currently does a
 // small amount of disk I/O only for file presence.
 //
+// The page is streamed as it is rendered and compressed with gzip when the
+// client accepts it, as it is many megabytes for a process with tens of
+// thousands of goroutines.
+//
 // It is a direct replacement for "/debug/pprof/goroutine?debug=2" handler in
 // net/http/pprof.
 //
+// pprof: (default: "/debug/pprof/" if net/http/pprof is registered on
+// http.DefaultServeMux) Base path of the net/http/pprof handlers, to link each
+// bucket to the profiles relevant to its state, e.g. the mutex profile for the
+// goroutines waiting on a lock. "off" disables the links. It is prefixed with
+// the base path, see WithBasePath().
+//
 // augment: (default: 0) When set to 1, panicparse tries to find the sources on
 // disk to improve the display of arguments based on type information. This is
 // slower and should be avoided on high utilization server.
@@ -40,8 +61,157 @@ import (
 // Minimum is 1048576.
 //
 // similarity: (default: "anypointer") Can be one of stack.Similarity value in
-// lowercase: "exactflags", "exactlines", "anypointer" or "anyvalue".
+// lowercase: "exactflags", "exactlines", "anypointer" or "anyvalue". "exact" is
+// an alias for "exactlines".
+//
+// bucket: (default: "") Only shows the buckets which short ID starts with this
+// value, as printed by panicparse. A 404 is returned if no bucket matches.
+//
+// top: (default: 0) Only shows the N buckets with the most goroutines. 0 means
+// no limit.
+//
+// minCount: (default: 0) Only shows the buckets with at least N goroutines.
+// "mincount" is also accepted.
+//
+// state: (default: "") Only shows the buckets in one of these comma separated
+// states, e.g. "chan receive,select".
+//
+// include: (default: "") Regexp to only keep the goroutines with a function
+// name or source path matching in any call, as stack.Filter.
+//
+// exclude: (default: "") Regexp to drop the goroutines with a function name or
+// source path matching in any call, as stack.Filter.
+//
+// sort: (default: "stack") Order of the buckets; "stack" for the order of
+// stack.Aggregate() or "interest" for stack.ByInterest.
+//
+// src: (default: 0) Shows N lines of source around each call in an
+// expandable section, when the source file is found on disk. This does disk
+// I/O and should be avoided on high utilization server. At most 50 lines are
+// shown.
+//
+// The bucket can also be specified in the URL path as ".../bucket/<id>" when
+// the handler is registered on a subtree, e.g. "/debug/panicparse/". This
+// enables deep links to a bucket in the current snapshot.
+//
+// Likewise, ".../raw" returns the snapshot unparsed as text/plain, exactly as
+// printed by runtime.Stack(), to archive it or feed it to other tools. Only
+// maxmem is used then.
+//
+// ".../export.csv" and ".../export.tsv" return one row per bucket with its
+// fingerprint, number of goroutines, state, first call outside the standard
+// library and wait range in seconds, for a quick analysis in a spreadsheet.
+// The buckets are selected as for the HTML page.
 func SnapshotHandler(w http.ResponseWriter, req *http.Request) {
+	serveSnapshot(w, req, nil, nil)
+}
+
+// SnapshotHandlerWithTemplate returns a http.HandlerFunc like SnapshotHandler
+// that renders the page with t, as returned by Template() and customized.
+func SnapshotHandlerWithTemplate(t *template.Template) http.HandlerFunc {
+	return SnapshotHandlerWithOpts(&SnapshotOpts{Template: t})
+}
+
+// SnapshotOpts is the options of SnapshotHandlerWithOpts.
+type SnapshotOpts struct {
+	// Template renders the page, as returned by Template() and customized. The
+	// default page is rendered if nil.
+	Template *template.Template
+	// CacheTTL is how long a snapshot is reused for the following requests,
+	// so a storm of page reloads doesn't repeatedly pause a process with a
+	// large number of goroutines. The maxmem form value is ignored when the
+	// snapshot is reused. 0 disables the cache.
+	CacheTTL time.Duration
+	// MinInterval is the minimum time between two snapshots. A request that
+	// can't be served from the cache during this interval fails with 429 Too
+	// Many Requests. 0 disables the limit.
+	MinInterval time.Duration
+}
+
+// SnapshotHandlerWithOpts returns a http.HandlerFunc like SnapshotHandler
+// configured with o.
+func SnapshotHandlerWithOpts(o *SnapshotOpts) http.HandlerFunc {
+	c := &snapshotCache{ttl: o.CacheTTL, minInterval: o.MinInterval, now: time.Now, capture: snapshot}
+	t := o.Template
+	return func(w http.ResponseWriter, req *http.Request) {
+		serveSnapshot(w, req, t, c)
+	}
+}
+
+// snapshotCache caches the last snapshot and limits how often snapshots are
+// taken.
+type snapshotCache struct {
+	ttl         time.Duration
+	minInterval time.Duration
+	now         func() time.Time
+	capture     func(maxmem int) []byte
+
+	mu   sync.Mutex
+	last time.Time
+	e    *snapshotEntry
+}
+
+// snapshotEntry is a snapshot, parsed once on first use.
+type snapshotEntry struct {
+	buf  []byte
+	once sync.Once
+	c    *stack.Context
+	err  error
+}
+
+// parse returns the snapshot parsed. The Context must not be modified.
+func (e *snapshotEntry) parse() (*stack.Context, error) {
+	e.once.Do(func() {
+		e.c, e.err = parseSnapshot(e.buf)
+	})
+	return e.c, e.err
+}
+
+// get returns the cached snapshot if still valid, otherwise takes a new one.
+//
+// It returns nil and how long to wait when a snapshot was taken less than
+// minInterval ago.
+func (s *snapshotCache) get(maxmem int) (*snapshotEntry, time.Duration) {
+	// Hold the lock while taking the snapshot so concurrent requests wait for
+	// it and reuse it.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if s.e != nil {
+		since := now.Sub(s.last)
+		if since < s.ttl {
+			return s.e, 0
+		}
+		if since < s.minInterval {
+			return nil, s.minInterval - since
+		}
+	}
+	s.e = &snapshotEntry{buf: s.capture(maxmem)}
+	s.last = now
+	return s.e, 0
+}
+
+// Template returns the template set of the page served by the handlers, to
+// customize it with Parse() and pass it to SnapshotHandlerWithTemplate() or
+// ContextHandlerWithTemplate().
+//
+// The following templates can be redefined:
+//   - "title": the page title.
+//   - "style": the CSS, e.g. to use a dark theme.
+//   - "head": additional content of <head>, e.g. a stylesheet. Empty by
+//     default.
+//   - "header": content shown before the buckets, e.g. branding. Empty by
+//     default.
+//   - "footer": content shown at the bottom of the page. Empty by default.
+//
+// The templates are executed with a map containing "Buckets", "GOROOT",
+// "GOPATH", "GOMAXPROCS", "Now" and "Version".
+func Template() *template.Template {
+	return htmlstack.Template()
+}
+
+// serveSnapshot implements SnapshotHandler. t and cache can be nil.
+func serveSnapshot(w http.ResponseWriter, req *http.Request, t *template.Template, cache *snapshotCache) {
 	if req.Method != "GET" {
 		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
 		return
@@ -55,43 +225,315 @@ func SnapshotHandler(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 	}
-	c, err := snapshot(maxmem)
+	pprof, err := pprofBase(req, http.DefaultServeMux)
 	if err != nil {
-		http.Error(w, "failed to process the snapshot, try a larger maxmem value", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	augment := false
 	if s := req.FormValue("augment"); s != "" {
 		if v, err := strconv.Atoi(s); v == 1 {
-			stack.Augment(c.Goroutines)
+			augment = true
 		} else if err != nil || v != 0 {
 			http.Error(w, "invalid augment value", http.StatusBadRequest)
 			return
 		}
 	}
+	var e *snapshotEntry
+	if cache != nil {
+		var wait time.Duration
+		if e, wait = cache.get(maxmem); e == nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			http.Error(w, "retry later", http.StatusTooManyRequests)
+			return
+		}
+	} else {
+		e = &snapshotEntry{buf: snapshot(maxmem)}
+	}
+	if isRaw(req) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		out, done := compress(w, req)
+		_, _ = out.Write(e.buf)
+		done()
+		return
+	}
+	var c *stack.Context
+	if augment {
+		// Augment() modifies the goroutines so the cached Context can't be used.
+		if c, err = parseSnapshot(e.buf); err == nil {
+			stack.Augment(c.Goroutines)
+		}
+	} else {
+		c, err = e.parse()
+	}
+	if err != nil {
+		http.Error(w, "failed to process the snapshot, try a larger maxmem value", http.StatusInternalServerError)
+		return
+	}
+	serveBuckets(w, req, t, c.Goroutines, nil, &htmlstack.Opts{Live: true, Pprof: pprof}, true)
+}
+
+// ContextHandler returns a http.HandlerFunc that serves the goroutines of an
+// already parsed stack dump, for example one loaded from a file.
+//
+// It accepts the same form values as SnapshotHandler except augment and
+// maxmem. Call stack.Augment() before if desired. c must not be modified
+// afterward.
+func ContextHandler(c *stack.Context) http.HandlerFunc {
+	return ContextHandlerWithTemplate(c, nil)
+}
+
+// ContextHandlerWithTemplate is like ContextHandler except that it renders the
+// page with t, as returned by Template() and customized. t can be nil.
+func ContextHandlerWithTemplate(c *stack.Context, t *template.Template) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+			return
+		}
+		serveBuckets(w, req, t, c.Goroutines, nil, &htmlstack.Opts{}, true)
+	}
+}
+
+// maxSrc is the maximum value of the src form value.
+const maxSrc = 50
+
+// serveBuckets aggregates, sorts and selects the goroutines as requested in
+// the form values and writes the buckets as HTML with t, or the default
+// template if nil. The Src field of o is set from the form values.
+//
+// origins, if not nil, is the stack dump of each goroutine, to set back their
+// original IDs once aggregated.
+//
+// localSrc must only be true when the goroutines come from a trusted source,
+// e.g. this process; otherwise the source paths in the dump could be used to
+// read any file, so the src form value is rejected.
+func serveBuckets(w http.ResponseWriter, req *http.Request, t *template.Template, goroutines []*stack.Goroutine, origins *origin.Origins, o *htmlstack.Opts, localSrc bool) {
+	s, err := similarity(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := filterOpts(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	frames, err := frameFilter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := req.FormValue("src"); v != "" {
+		if !localSrc {
+			http.Error(w, "src is not supported for this dump", http.StatusBadRequest)
+			return
+		}
+		if o.Src, err = strconv.Atoi(v); err != nil || o.Src < 0 || o.Src > maxSrc {
+			http.Error(w, "invalid src value", http.StatusBadRequest)
+			return
+		}
+	}
+	var rank stack.Ranker
+	switch req.FormValue("sort") {
+	case "stack", "":
+	case "interest":
+		rank = stack.ByInterest
+	default:
+		http.Error(w, "invalid sort value", http.StatusBadRequest)
+		return
+	}
+
+	buckets := stack.Buckets(stack.Aggregate(frames.Apply(goroutines), s))
+	origins.Restore(goroutines, buckets)
+	if rank != nil {
+		buckets.Sort(rank)
+	}
+	buckets = buckets.Filter(opts)
+	if id := bucketID(req); id != "" {
+		if buckets = selectBuckets(buckets, id); len(buckets) == 0 {
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
+	}
+	if sep := exportFormat(req); sep != 0 {
+		serveExport(w, req, buckets, sep)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if t == nil {
+		t = htmlstack.Template()
+	}
+	// The page is streamed as it is rendered.
+	out, done := compress(w, req)
+	_ = htmlstack.WriteTemplate(out, t, buckets, o)
+	done()
+}
+
+// isRaw returns true if the URL path ends with "/raw".
+func isRaw(req *http.Request) bool {
+	return strings.HasSuffix(strings.TrimSuffix(req.URL.Path, "/"), "/raw")
+}
+
+// pprofBase returns the base path of the net/http/pprof handlers requested as
+// a form value, or "/debug/pprof/" if registered on mux. It is prefixed with
+// the base path.
+func pprofBase(req *http.Request, mux *http.ServeMux) (string, error) {
+	const def = "/debug/pprof/"
+	switch v := req.FormValue("pprof"); v {
+	case "off":
+		return "", nil
+	case "":
+		r, err := http.NewRequest("GET", def, nil)
+		if err != nil {
+			return "", err
+		}
+		_, p := mux.Handler(r)
+		// Starting with Go 1.22, the pattern is prefixed with the method, e.g.
+		// "GET /debug/pprof/" as registered by net/http/pprof.
+		if i := strings.IndexByte(p, ' '); i != -1 {
+			p = p[i+1:]
+		}
+		if p == def {
+			return basePath(req) + def, nil
+		}
+		return "", nil
+	default:
+		// Only accept a path on the same host.
+		if !strings.HasPrefix(v, "/") || strings.HasPrefix(v, "//") {
+			return "", errors.New("invalid pprof value")
+		}
+		if !strings.HasSuffix(v, "/") {
+			v += "/"
+		}
+		return basePath(req) + v, nil
+	}
+}
 
-	var s stack.Similarity
+// WithBasePath returns a http.HandlerFunc that calls h with the absolute
+// links it generates prefixed with base. Use it when the handler is served
+// behind a reverse proxy that strips a path prefix, e.g. base is "/myservice"
+// when "https://example.com/myservice/debug/panicparse" is forwarded to
+// "/debug/panicparse".
+//
+// Without it, the X-Forwarded-Prefix header set by some reverse proxies is
+// used. It works with all the handlers of this package.
+func WithBasePath(base string, h http.HandlerFunc) http.HandlerFunc {
+	base = strings.TrimSuffix(base, "/")
+	return func(w http.ResponseWriter, req *http.Request) {
+		h(w, req.WithContext(context.WithValue(req.Context(), basePathKey{}, base)))
+	}
+}
+
+// basePathKey is the context key of the base path set by WithBasePath.
+type basePathKey struct{}
+
+// basePath returns the prefix of the absolute links, without trailing "/".
+func basePath(req *http.Request) string {
+	if v, ok := req.Context().Value(basePathKey{}).(string); ok {
+		return v
+	}
+	// Use the first one when there are multiple proxies.
+	p := strings.TrimSpace(strings.Split(req.Header.Get("X-Forwarded-Prefix"), ",")[0])
+	// Only accept a path on the same host.
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") {
+		return ""
+	}
+	return strings.TrimSuffix(p, "/")
+}
+
+// bucketID returns the bucket ID requested either in the URL path or as a form
+// value.
+func bucketID(req *http.Request) string {
+	const prefix = "/bucket/"
+	if i := strings.LastIndex(req.URL.Path, prefix); i != -1 {
+		return strings.TrimSuffix(req.URL.Path[i+len(prefix):], "/")
+	}
+	return req.FormValue("bucket")
+}
+
+// similarity returns the stack.Similarity requested as a form value.
+func similarity(req *http.Request) (stack.Similarity, error) {
 	switch req.FormValue("similarity") {
 	case "exactflags":
-		s = stack.ExactFlags
-	case "exactlines":
-		s = stack.ExactLines
+		return stack.ExactFlags, nil
+	case "exactlines", "exact":
+		return stack.ExactLines, nil
 	case "anypointer", "":
-		s = stack.AnyPointer
+		return stack.AnyPointer, nil
 	case "anyvalue":
-		s = stack.AnyValue
+		return stack.AnyValue, nil
 	default:
-		http.Error(w, "invalid similarity value", http.StatusBadRequest)
-		return
+		return 0, errors.New("invalid similarity value")
 	}
+}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	buckets := stack.Aggregate(c.Goroutines, s)
-	_ = htmlstack.Write(w, buckets, false, true)
+// filterOpts returns the stack.FilterOpts requested as form values.
+func filterOpts(req *http.Request) (stack.FilterOpts, error) {
+	var opts stack.FilterOpts
+	var err error
+	if v := req.FormValue("top"); v != "" {
+		if opts.Top, err = strconv.Atoi(v); err != nil || opts.Top < 0 {
+			return opts, errors.New("invalid top value")
+		}
+	}
+	v := req.FormValue("minCount")
+	if v == "" {
+		v = req.FormValue("mincount")
+	}
+	if v != "" {
+		if opts.MinCount, err = strconv.Atoi(v); err != nil || opts.MinCount < 0 {
+			return opts, errors.New("invalid minCount value")
+		}
+	}
+	if v := req.FormValue("state"); v != "" {
+		opts.States = strings.Split(v, ",")
+	}
+	return opts, nil
 }
 
-// snapshot returns a Context based on the snapshot of the stacks of the
-// current process.
-func snapshot(maxmem int) (*stack.Context, error) {
+// frameFilter returns the stack.Filter requested as form values.
+func frameFilter(req *http.Request) (*stack.Filter, error) {
+	f := &stack.Filter{}
+	var err error
+	if v := req.FormValue("include"); v != "" {
+		if f.Include, err = regexp.Compile(v); err != nil {
+			return nil, errors.New("invalid include value")
+		}
+	}
+	if v := req.FormValue("exclude"); v != "" {
+		if f.Exclude, err = regexp.Compile(v); err != nil {
+			return nil, errors.New("invalid exclude value")
+		}
+	}
+	return f, nil
+}
+
+// selectBuckets returns the buckets matching the ID.
+func selectBuckets(buckets stack.Buckets, id string) stack.Buckets {
+	var out stack.Buckets
+	for _, b := range buckets {
+		if b.MatchID(id) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// parseSnapshot parses a snapshot returned by snapshot().
+func parseSnapshot(buf []byte) (*stack.Context, error) {
+	// TODO(maruel): No disk I/O should be done here, albeit GOROOT should still
+	// be guessed. Thus guesspaths shall be neither true nor false.
+	c, err := stack.ParseDump(bytes.NewReader(buf), ioutil.Discard, true)
+	if err == nil && c == nil {
+		err = errors.New("no goroutine found")
+	}
+	return c, err
+}
+
+// snapshot returns the stacks of the current process as printed by
+// runtime.Stack(). It is truncated to maxmem.
+func snapshot(maxmem int) []byte {
 	// We don't know how big the buffer needs to be to collect all the
 	// goroutines. Start with 1 MB and try a few times, doubling each time. Give
 	// up and use a truncated trace if maxmem is not enough.
@@ -114,7 +556,5 @@ func snapshot(maxmem int) (*stack.Context, error) {
 		}
 		buf = make([]byte, l)
 	}
-	// TODO(maruel): No disk I/O should be done here, albeit GOROOT should still
-	// be guessed. Thus guesspaths shall be neither true nor false.
-	return stack.ParseDump(bytes.NewReader(buf), ioutil.Discard, true)
+	return buf
 }
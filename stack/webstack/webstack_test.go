@@ -2,13 +2,26 @@
 // Use of this source code is governed under the Apache License, Version 2.0
 // that can be found in the LICENSE file.
 
+// Use the Go 1.22 patterns, which net/http/pprof registers with the method,
+// e.g. "GET /debug/pprof/", even though go.mod targets an older version.
+//go:debug httpmuxgo121=0
+
 package webstack
 
 import (
 	"context"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	_ "net/http/pprof"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/maruel/panicparse/stack"
 )
 
 func TestSnapshotHandler(t *testing.T) {
@@ -56,6 +69,405 @@ func TestSnapshotHandler_Err(t *testing.T) {
 	}
 }
 
+func TestSnapshotHandler_Bucket(t *testing.T) {
+	t.Parallel()
+	for _, url := range []string{"/debug?bucket=ffffffffff", "/debug/bucket/ffffffffff"} {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		SnapshotHandler(w, req)
+		if w.Code != 404 {
+			t.Fatalf("%s: %d\n%s", url, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestContextHandler_Bucket(t *testing.T) {
+	t.Parallel()
+	// Unlike TestSnapshotHandler_Bucket, the dump doesn't depend on the
+	// toolchain running the test.
+	dump := strings.Join([]string{
+		"goroutine 1 [running]:",
+		"main.main({0xc000012018, 0x3}, {{0x1, 0x2}, ...})",
+		"\t/gopath/src/foo/main.go:10 +0x20",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.wait(0xc000012020?)",
+		"\t/gopath/src/foo/wait.go:20 +0x20",
+		"",
+	}, "\n")
+	c, err := stack.ParseDump(strings.NewReader(dump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ""
+	for _, b := range stack.Aggregate(c.Goroutines, stack.AnyPointer) {
+		if b.Stack.Calls[0].Func.Raw == "main.wait" {
+			id = b.ShortID()
+		}
+	}
+	h := ContextHandler(c)
+	for _, url := range []string{"/?bucket=" + id, "/bucket/" + id} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != 200 {
+			t.Fatalf("%s: %d\n%s", url, w.Code, w.Body.String())
+		}
+		if b := w.Body.String(); !strings.Contains(b, "wait.go:20") || strings.Contains(b, "main.go:10") {
+			t.Fatalf("%s: unexpected body:\n%s", url, b)
+		}
+	}
+	for _, url := range []string{"/?bucket=ffffffffff", "/bucket/ffffffffff"} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != 404 {
+			t.Fatalf("%s: %d\n%s", url, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestSnapshotHandler_Raw(t *testing.T) {
+	t.Parallel()
+	for _, url := range []string{"/debug/raw", "/debug/raw/", "/debug/raw?maxmem=1"} {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		SnapshotHandler(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%s: %d\n%s", url, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+			t.Fatalf("%s: unexpected Content-Type %q", url, ct)
+		}
+		if b := w.Body.String(); !strings.HasPrefix(b, "goroutine ") || !strings.Contains(b, "TestSnapshotHandler_Raw") {
+			t.Fatalf("%s: unexpected body:\n%s", url, b)
+		}
+	}
+}
+
+func TestIsRaw(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		url  string
+		want bool
+	}{
+		{"/debug", false},
+		{"/debug/raw", true},
+		{"/debug/raw/", true},
+		{"/debug/rawx", false},
+		{"/debug?raw=1", false},
+	}
+	for _, line := range data {
+		if got := isRaw(httptest.NewRequest("GET", line.url, nil)); got != line.want {
+			t.Fatalf("%s: %t != %t", line.url, line.want, got)
+		}
+	}
+}
+
+func TestSnapshotCache(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(1000, 0)
+	captures := 0
+	c := &snapshotCache{
+		ttl:         time.Second,
+		minInterval: 5 * time.Second,
+		now:         func() time.Time { return now },
+		capture: func(maxmem int) []byte {
+			captures++
+			return []byte(strconv.Itoa(captures))
+		},
+	}
+	get := func(want string, wantWait time.Duration) {
+		e, wait := c.get(0)
+		got := ""
+		if e != nil {
+			got = string(e.buf)
+		}
+		if got != want || wait != wantWait {
+			t.Fatalf("%s: want %q, %s; got %q, %s", now, want, wantWait, got, wait)
+		}
+	}
+	get("1", 0)
+	// Reused within the TTL.
+	now = now.Add(500 * time.Millisecond)
+	get("1", 0)
+	// Rate limited within the minimum interval.
+	now = now.Add(time.Second)
+	get("", 3500*time.Millisecond)
+	now = now.Add(3500 * time.Millisecond)
+	get("2", 0)
+}
+
+func TestSnapshotHandlerWithOpts_Raw(t *testing.T) {
+	t.Parallel()
+	h := SnapshotHandlerWithOpts(&SnapshotOpts{CacheTTL: time.Hour})
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", "/debug/raw", nil))
+		if w.Code != 200 {
+			t.Fatalf("%d\n%s", w.Code, w.Body.String())
+		}
+		bodies = append(bodies, w.Body.String())
+	}
+	if bodies[0] != bodies[1] {
+		t.Fatal("expected the snapshot to be reused")
+	}
+
+	h = SnapshotHandlerWithOpts(&SnapshotOpts{MinInterval: time.Hour})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/debug/raw", nil))
+	if w.Code != 200 {
+		t.Fatalf("%d\n%s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/debug/raw", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("%d\n%s", w.Code, w.Body.String())
+	}
+	if r := w.Header().Get("Retry-After"); r != "3600" {
+		t.Fatalf("unexpected Retry-After %q", r)
+	}
+}
+
+func TestPprofBase(t *testing.T) {
+	t.Parallel()
+	empty := http.NewServeMux()
+	registered := http.NewServeMux()
+	registered.HandleFunc("/debug/pprof/", http.NotFound)
+	data := []struct {
+		url  string
+		mux  *http.ServeMux
+		want string
+	}{
+		{"/debug", empty, ""},
+		{"/debug", registered, "/debug/pprof/"},
+		// Registered by net/http/pprof.
+		{"/debug", http.DefaultServeMux, "/debug/pprof/"},
+		{"/debug?pprof=off", registered, ""},
+		{"/debug?pprof=/admin/pprof", empty, "/admin/pprof/"},
+		{"/debug?pprof=/admin/pprof/", empty, "/admin/pprof/"},
+	}
+	for _, line := range data {
+		got, err := pprofBase(httptest.NewRequest("GET", line.url, nil), line.mux)
+		if err != nil {
+			t.Fatalf("%s: %v", line.url, err)
+		}
+		if got != line.want {
+			t.Fatalf("%s: %q != %q", line.url, line.want, got)
+		}
+	}
+	req := httptest.NewRequest("GET", "/debug?pprof=/admin/pprof", nil)
+	req.Header.Set("X-Forwarded-Prefix", "/svc/")
+	if got, err := pprofBase(req, empty); err != nil || got != "/svc/admin/pprof/" {
+		t.Fatalf("unexpected %q, %v", got, err)
+	}
+	for _, url := range []string{"/debug?pprof=javascript:alert(1)", "/debug?pprof=//evil.com/"} {
+		if _, err := pprofBase(httptest.NewRequest("GET", url, nil), empty); err == nil {
+			t.Fatalf("%s: expected error", url)
+		}
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"/svc", "/svc"},
+		{"/svc/", "/svc"},
+		{"/a, /b", "/a"},
+		{"//evil.com", ""},
+		{"javascript:alert(1)", ""},
+	}
+	for _, line := range data {
+		req := httptest.NewRequest("GET", "/debug", nil)
+		req.Header.Set("X-Forwarded-Prefix", line.header)
+		if got := basePath(req); got != line.want {
+			t.Fatalf("%q: %q != %q", line.header, line.want, got)
+		}
+	}
+
+	var got string
+	h := WithBasePath("/override/", func(w http.ResponseWriter, req *http.Request) {
+		got = basePath(req)
+	})
+	req := httptest.NewRequest("GET", "/debug", nil)
+	req.Header.Set("X-Forwarded-Prefix", "/svc")
+	h(httptest.NewRecorder(), req)
+	if got != "/override" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
+func TestBucketID(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		url  string
+		want string
+	}{
+		{"/debug", ""},
+		{"/debug?bucket=ab12", "ab12"},
+		{"/debug/bucket/ab12", "ab12"},
+		{"/debug/bucket/ab12/", "ab12"},
+		{"/debug/bucket/ab12?bucket=cd34", "ab12"},
+	}
+	for _, line := range data {
+		if got := bucketID(httptest.NewRequest("GET", line.url, nil)); got != line.want {
+			t.Fatalf("%s: %q != %q", line.url, line.want, got)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		url  string
+		want stack.Similarity
+	}{
+		{"/debug", stack.AnyPointer},
+		{"/debug?similarity=exactflags", stack.ExactFlags},
+		{"/debug?similarity=exactlines", stack.ExactLines},
+		{"/debug?similarity=exact", stack.ExactLines},
+		{"/debug?similarity=anypointer", stack.AnyPointer},
+		{"/debug?similarity=anyvalue", stack.AnyValue},
+	}
+	for _, line := range data {
+		got, err := similarity(httptest.NewRequest("GET", line.url, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", line.url, err)
+		}
+		if got != line.want {
+			t.Fatalf("%s: %v != %v", line.url, line.want, got)
+		}
+	}
+	if _, err := similarity(httptest.NewRequest("GET", "/debug?similarity=alike", nil)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestFilterOpts(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		url  string
+		want stack.FilterOpts
+	}{
+		{"/debug", stack.FilterOpts{}},
+		{"/debug?top=10&minCount=2", stack.FilterOpts{Top: 10, MinCount: 2}},
+		{"/debug?mincount=3", stack.FilterOpts{MinCount: 3}},
+		{"/debug?state=chan+receive,select", stack.FilterOpts{States: []string{"chan receive", "select"}}},
+	}
+	for _, line := range data {
+		got, err := filterOpts(httptest.NewRequest("GET", line.url, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", line.url, err)
+		}
+		if !reflect.DeepEqual(line.want, got) {
+			t.Fatalf("%s: %#v != %#v", line.url, line.want, got)
+		}
+	}
+	for _, url := range []string{"/debug?top=-1", "/debug?top=a", "/debug?minCount=b", "/debug?mincount=b"} {
+		if _, err := filterOpts(httptest.NewRequest("GET", url, nil)); err == nil {
+			t.Fatalf("%s: expected error", url)
+		}
+	}
+}
+
+func TestSelectBuckets(t *testing.T) {
+	t.Parallel()
+	buckets := stack.Buckets{
+		{Signature: stack.Signature{State: "running"}},
+		{Signature: stack.Signature{State: "chan receive"}},
+	}
+	id := buckets[1].ShortID()
+	if got := selectBuckets(buckets, id[:4]); len(got) != 1 || got[0] != buckets[1] {
+		t.Fatalf("unexpected %v", got)
+	}
+	if got := selectBuckets(buckets, "zz"); len(got) != 0 {
+		t.Fatalf("unexpected %v", got)
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	t.Parallel()
+	dump := strings.Join([]string{
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/gopath/src/foo/main.go:10 +0x20",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.wait()",
+		"\t/gopath/src/foo/wait.go:20 +0x20",
+		"",
+	}, "\n")
+	c, err := stack.ParseDump(strings.NewReader(dump), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ContextHandler(c)
+	data := []struct {
+		url  string
+		code int
+		want []string
+		not  []string
+	}{
+		{"/", 200, []string{"main.go:10", "wait.go:20"}, nil},
+		{"/?sort=interest&state=running", 200, []string{"main.go:10"}, []string{"wait.go:20"}},
+		{"/?include=wait", 200, []string{"wait.go:20"}, []string{"main.go:10"}},
+		{"/?exclude=wait", 200, []string{"main.go:10"}, []string{"wait.go:20"}},
+		{"/bucket/ffff", 404, nil, nil},
+		{"/?include=(", 400, nil, nil},
+		{"/?src=2", 200, []string{"main.go:10"}, []string{"<details>"}},
+		{"/?src=-1", 400, nil, nil},
+		{"/?src=51", 400, nil, nil},
+		{"/?sort=foo", 400, nil, nil},
+		{"/?similarity=foo", 400, nil, nil},
+	}
+	for _, line := range data {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", line.url, nil))
+		if w.Code != line.code {
+			t.Fatalf("%s: %d\n%s", line.url, w.Code, w.Body.String())
+		}
+		for _, s := range line.want {
+			if !strings.Contains(w.Body.String(), s) {
+				t.Fatalf("%s: %q not found", line.url, s)
+			}
+		}
+		for _, s := range line.not {
+			if strings.Contains(w.Body.String(), s) {
+				t.Fatalf("%s: %q found", line.url, s)
+			}
+		}
+	}
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: %d", w.Code)
+	}
+}
+
+func TestContextHandlerWithTemplate(t *testing.T) {
+	t.Parallel()
+	c, err := stack.ParseDump(strings.NewReader("goroutine 1 [running]:\nmain.main()\n\t/gopath/src/foo/main.go:10 +0x20\n\n"), ioutil.Discard, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := Template()
+	if _, err := tmpl.Parse(`{{define "style"}}body { background: black; }{{end}}{{define "footer"}}<p>ACME</p>{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	ContextHandlerWithTemplate(c, tmpl)(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 {
+		t.Fatalf("%d\n%s", w.Code, w.Body.String())
+	}
+	b := w.Body.String()
+	if !strings.Contains(b, "<style>body { background: black; }</style>") || !strings.Contains(b, "<p>ACME</p>") || !strings.Contains(b, "main.go:10") {
+		t.Fatalf("unexpected page:\n%s", b)
+	}
+}
+
 func TestSnapshotHandler_Method_POST(t *testing.T) {
 	t.Parallel()
 	req := httptest.NewRequest("POST", "/debug", nil)
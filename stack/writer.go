@@ -0,0 +1,129 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// WriterOpts are the options of NewWriter.
+type WriterOpts struct {
+	// Similarity is used to aggregate the goroutines of each stack dump.
+	Similarity Similarity
+	// JSON writes the buckets of each stack dump as a JSON list instead of as
+	// text.
+	JSON bool
+	// Parse are the options to parse each stack dump. Defaults to
+	// ParseDump's.
+	Parse *Opts
+	// Args controls how the arguments are rendered as text.
+	Args ArgsFormat
+}
+
+// Writer is an io.Writer that passes through what is written to it, except
+// for the stack dumps, which are written aggregated instead.
+//
+// Install it as the sink of a logger or as the output of a process to
+// prettify the stack dumps logged, e.g. when a recovered panic is logged.
+//
+// A stack dump is considered ended on the first line that is not part of it,
+// so Close must be called to flush the last one.
+type Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+	once sync.Once
+	err  error
+}
+
+// NewWriter returns a Writer writing to dst.
+//
+// opts can be nil for the default options. The stack dumps that cannot be
+// parsed are written as is.
+func NewWriter(dst io.Writer, opts *WriterOpts) *Writer {
+	if opts == nil {
+		opts = &WriterOpts{}
+	}
+	pr, pw := io.Pipe()
+	w := &Writer{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := SplitDump(pr, dst, func(sec *Section) error {
+			return writeSection(dst, sec, opts)
+		})
+		// Unblock the writers on error.
+		_ = pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w
+}
+
+// Write implements io.Writer.
+//
+// It is safe for concurrent use; the writes are serialized.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close flushes the stack dump being written, if any, and returns the first
+// error that happened while writing to dst.
+func (w *Writer) Close() error {
+	_ = w.pw.Close()
+	w.once.Do(func() { w.err = <-w.done })
+	return w.err
+}
+
+// Private stuff.
+
+// writeSection writes the stack dump sec aggregated to dst.
+func writeSection(dst io.Writer, sec *Section, opts *WriterOpts) error {
+	o := opts.Parse
+	if o == nil {
+		o = &Opts{}
+	}
+	c, err := ParseDumpWithOpts(bytes.NewReader(sec.Raw), ioutil.Discard, o)
+	if c == nil || err != nil {
+		// Do not lose the stack dump.
+		_, err = dst.Write(sec.Raw)
+		return err
+	}
+	buckets := Aggregate(c.Goroutines, opts.Similarity)
+	if opts.JSON {
+		return json.NewEncoder(dst).Encode(buckets)
+	}
+	_, err = io.WriteString(dst, formatBuckets(buckets, &opts.Args))
+	return err
+}
+
+// formatBuckets renders the buckets as text, the same as panicparse without
+// colors.
+func formatBuckets(buckets []*Bucket, f *ArgsFormat) string {
+	var out []string
+	for _, b := range buckets {
+		extra := ""
+		if s := b.SleepString(); s != "" {
+			extra += " [" + s + "]"
+		}
+		if b.Locked {
+			extra += " [locked]"
+		}
+		if c := b.CreatedBy.Func.PkgDotName(); c != "" {
+			extra += " [Created by " + c + " @ " + b.CreatedBy.SrcLine() + "]"
+		}
+		out = append(out, fmt.Sprintf("%d: %s%s [%s]", len(b.IDs), b.State, extra, b.ShortID()))
+		for i := range b.Stack.Calls {
+			c := &b.Stack.Calls[i]
+			out = append(out, fmt.Sprintf("    %s %s %s(%s)", c.Func.PkgName(), c.SrcLine(), c.Func.Name(), c.Args.Format(f)))
+		}
+		if b.Stack.Elided {
+			out = append(out, "    (...)")
+		}
+	}
+	return strings.Join(out, "\n") + "\n"
+}
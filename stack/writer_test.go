@@ -0,0 +1,90 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+const writerDump = "goroutine 1 [running]:\n" +
+	"main.main()\n" +
+	"\t/gopath/src/foo/main.go:10 +0x20\n" +
+	"\n" +
+	"goroutine 6 [chan receive, 3 minutes]:\n" +
+	"main.worker(0xc000010000)\n" +
+	"\t/gopath/src/foo/main.go:20 +0x20\n" +
+	"created by main.main\n" +
+	"\t/gopath/src/foo/main.go:8 +0x20\n" +
+	"\n" +
+	"goroutine 7 [chan receive, 3 minutes]:\n" +
+	"main.worker(0xc000010000)\n" +
+	"\t/gopath/src/foo/main.go:20 +0x20\n" +
+	"created by main.main\n" +
+	"\t/gopath/src/foo/main.go:8 +0x20\n"
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	w := NewWriter(out, &WriterOpts{Similarity: AnyPointer})
+	// Write in small chunks, like a logger would.
+	in := "log line 1\n" + writerDump + "\nlog line 2\n"
+	for len(in) != 0 {
+		n := 7
+		if n > len(in) {
+			n = len(in)
+		}
+		if _, err := io.WriteString(w, in[:n]); err != nil {
+			t.Fatal(err)
+		}
+		in = in[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	lines := strings.Split(got, "\n")
+	if lines[0] != "log line 1" || lines[len(lines)-2] != "log line 2" {
+		t.Fatalf("unexpected:\n%s", got)
+	}
+	for _, want := range []string{
+		"1: running [",
+		"    main main.go:10 main()\n",
+		"2: chan receive [3 minutes] [Created by main.main @ main.go:8] [",
+		"    main main.go:20 worker(#1)\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "goroutine ") {
+		t.Fatalf("unexpected raw stack dump:\n%s", got)
+	}
+}
+
+func TestWriterJSON(t *testing.T) {
+	t.Parallel()
+	out := &bytes.Buffer{}
+	w := NewWriter(out, &WriterOpts{Similarity: AnyPointer, JSON: true})
+	if _, err := io.WriteString(w, writerDump); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var buckets []*Bucket
+	if err := json.Unmarshal(out.Bytes(), &buckets); err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("unexpected %s", out.String())
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package terminal decides whether to output ANSI colors to a file.
+//
+// It honors the NO_COLOR (https://no-color.org/) and CLICOLOR_FORCE
+// environment variables, dumb terminals and enables the native ANSI escape
+// code support of the Windows 10 console.
+package terminal
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mattn/go-colorable"
+	"github.com/mattn/go-isatty"
+)
+
+// Mode is when to output colors.
+//
+// It implements flag.Value, to be used as -color=always|auto|never.
+type Mode int
+
+const (
+	// Auto outputs colors only when the file is a terminal and the
+	// environment does not disable them.
+	Auto Mode = iota
+	// Always outputs colors, e.g. when piping to "less -R".
+	Always
+	// Never outputs colors.
+	Never
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Always:
+		return "always"
+	case Never:
+		return "never"
+	default:
+		return "auto"
+	}
+}
+
+// Set implements flag.Value.
+func (m *Mode) Set(s string) error {
+	switch s {
+	case "auto":
+		*m = Auto
+	case "always":
+		*m = Always
+	case "never":
+		*m = Never
+	default:
+		return fmt.Errorf("invalid color mode %q; expected one of: always, auto, never", s)
+	}
+	return nil
+}
+
+// Color returns true if ANSI colors should be written to f.
+func Color(m Mode, f *os.File) bool {
+	return color(m, isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd()), os.Getenv)
+}
+
+// NewWriter returns a writer to f that renders ANSI colors.
+//
+// On Windows, it enables the virtual terminal processing of the console if
+// supported, and otherwise translates the escape codes to console API calls.
+// It returns f as is on other OSes.
+func NewWriter(f *os.File) io.Writer {
+	if enableVirtualTerminal(f) {
+		return f
+	}
+	return colorable.NewColorable(f)
+}
+
+// color implements Color.
+//
+// The environment is only considered in Auto mode:
+//   - NO_COLOR set to any value disables colors.
+//   - CLICOLOR_FORCE set to a value other than "0" enables colors, even when
+//     not a terminal.
+//   - TERM=dumb disables colors.
+func color(m Mode, tty bool, getenv func(string) string) bool {
+	switch m {
+	case Always:
+		return true
+	case Never:
+		return false
+	}
+	if getenv("NO_COLOR") != "" {
+		return false
+	}
+	if v := getenv("CLICOLOR_FORCE"); v != "" && v != "0" {
+		return true
+	}
+	if getenv("TERM") == "dumb" {
+		return false
+	}
+	return tty
+}
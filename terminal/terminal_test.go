@@ -0,0 +1,56 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package terminal
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestColor(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		m    Mode
+		tty  bool
+		env  map[string]string
+		want bool
+	}{
+		{Auto, true, nil, true},
+		{Auto, false, nil, false},
+		{Auto, true, map[string]string{"NO_COLOR": "1"}, false},
+		{Auto, true, map[string]string{"TERM": "dumb"}, false},
+		{Auto, false, map[string]string{"CLICOLOR_FORCE": "1"}, true},
+		{Auto, false, map[string]string{"CLICOLOR_FORCE": "0"}, false},
+		{Auto, true, map[string]string{"TERM": "dumb", "CLICOLOR_FORCE": "1"}, true},
+		// NO_COLOR has precedence.
+		{Auto, true, map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "1"}, false},
+		{Always, false, map[string]string{"NO_COLOR": "1"}, true},
+		{Never, true, map[string]string{"CLICOLOR_FORCE": "1"}, false},
+	}
+	for i, line := range data {
+		getenv := func(k string) string { return line.env[k] }
+		if got := color(line.m, line.tty, getenv); got != line.want {
+			t.Fatalf("#%d: color(%s, %t, %v) = %t", i, line.m, line.tty, line.env, got)
+		}
+	}
+}
+
+func TestModeFlag(t *testing.T) {
+	t.Parallel()
+	var m Mode
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&m, "color", "")
+	for _, want := range []Mode{Always, Never, Auto} {
+		if err := fs.Set("color", want.String()); err != nil {
+			t.Fatal(err)
+		}
+		if m != want {
+			t.Fatalf("want %s, got %s", want, m)
+		}
+	}
+	if err := m.Set("yes"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2020 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package terminal
+
+import "os"
+
+// enableVirtualTerminal returns true, terminals support ANSI escape codes
+// natively.
+func enableVirtualTerminal(f *os.File) bool {
+	return true
+}